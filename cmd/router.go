@@ -0,0 +1,34 @@
+/*
+Copyright © 2025 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"my_template/cmn"
+
+	"github.com/gin-gonic/gin"
+)
+
+// setupRouter 构建应用的路由：按配置文件的 middleware.pipeline 应用中间件后注册业务路由
+// serve 与 routes 共用，保证路由清单与实际提供服务的路由一致
+func setupRouter() (*gin.Engine, *cmn.RouteGroup, *cmn.MiddlewareRegistry, error) {
+	router := gin.New()
+	registry := cmn.NewMiddlewareRegistry(router)
+	if err := registry.LoadFromConfig(); err != nil {
+		return nil, nil, nil, err
+	}
+	if err := registry.Apply(); err != nil {
+		return nil, nil, nil, err
+	}
+	routes := cmn.RecordRoutes(router)
+	registerRoutes(routes)
+	return router, routes, registry, nil
+}
+
+// registerRoutes 注册业务路由，新增接口在这里添加
+// 通过 routes 注册的路由才会在路由清单中显示中间件链
+func registerRoutes(routes *cmn.RouteGroup) {
+	routes.GET("/health", func(c *gin.Context) {
+		cmn.OK(c, "ok")
+	})
+}
@@ -0,0 +1,73 @@
+/*
+Copyright © 2025 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"my_template/cmn"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/cobra"
+)
+
+var (
+	routesFormat          string
+	routesUnauthenticated bool
+)
+
+// routesCmd 列出所有路由及其中间件链
+var routesCmd = &cobra.Command{
+	Use:   "routes",
+	Short: "列出所有路由及保护它们的中间件",
+	Long: `与 serve 使用同一份路由构建逻辑，列出每条路由的方法、路径、处理器与中间件链
+（是否需要认证、限流策略、超时），便于安全审查时发现未认证的接口。
+
+示例:
+  template routes --config .conf_linux.json
+  template routes --format json --unauthenticated`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// 初始化配置文件
+		if err := cmn.ViperInit(configFile); err != nil {
+			return fmt.Errorf("初始化配置文件失败:%w", err)
+		}
+
+		//初始化日志
+		if err := cmn.LoggerInit(); err != nil {
+			return fmt.Errorf("初始化日志失败:%w", err)
+		}
+
+		// 只构建路由，不输出 gin 的调试信息
+		gin.SetMode(gin.ReleaseMode)
+		_, routes, registry, err := setupRouter()
+		if err != nil {
+			return err
+		}
+		entries := cmn.RouteInventory(routes, registry)
+		if routesUnauthenticated {
+			entries = cmn.UnauthenticatedRoutes(entries)
+		}
+
+		switch routesFormat {
+		case "table":
+			fmt.Fprint(cmd.OutOrStdout(), cmn.FormatRouteTable(entries))
+		case "json":
+			data, err := json.MarshalIndent(entries, "", "  ")
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), string(data))
+		default:
+			return fmt.Errorf("不支持的输出格式: %s", routesFormat)
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(routesCmd)
+	routesCmd.Flags().StringVar(&configFile, "config", ".conf_linux.json", "config file (default is .conf_linux.json)")
+	routesCmd.Flags().StringVar(&routesFormat, "format", "table", "output format: table or json")
+	routesCmd.Flags().BoolVar(&routesUnauthenticated, "unauthenticated", false, "only list routes that do not require authentication")
+}
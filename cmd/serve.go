@@ -6,8 +6,10 @@ package cmd
 import (
 	"fmt"
 	"my_template/cmn"
+	"net"
 
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 )
 
 var (
@@ -38,6 +40,18 @@ to quickly create a Cobra application.`,
 			msg := fmt.Sprintf("初始化日志失败:%s", err.Error())
 			panic(msg)
 		}
+
+		// 与 routes 子命令共用路由构建逻辑
+		router, _, _, err := setupRouter()
+		if err != nil {
+			msg := fmt.Sprintf("构建路由失败:%s", err.Error())
+			panic(msg)
+		}
+		addr := net.JoinHostPort(viper.GetString("appServe.host"), viper.GetString("appServe.port"))
+		if err := router.Run(addr); err != nil {
+			msg := fmt.Sprintf("启动服务失败:%s", err.Error())
+			panic(msg)
+		}
 	},
 }
 
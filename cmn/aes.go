@@ -31,6 +31,7 @@ func EncryptAES(plainText string, key []byte) (string, error) {
 	return base64.StdEncoding.EncodeToString(cipherText), nil
 }
 
+// DecryptAES 解密 EncryptAES 的结果
 func DecryptAES(cipherTextBase64 string, key []byte) (string, error) {
 	cipherText, err := base64.StdEncoding.DecodeString(cipherTextBase64)
 	if err != nil {
@@ -60,3 +61,33 @@ func DecryptAES(cipherTextBase64 string, key []byte) (string, error) {
 
 	return string(plainText), nil
 }
+
+// DecryptAESCBC 使用 AES-CBC 解密并去除 PKCS#7 填充，用于解密第三方（如微信开放数据）的 CBC 密文
+// 本项目自己加密的数据使用 EncryptAES（GCM，带完整性校验）
+func DecryptAESCBC(cipherText, key, iv []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(iv) != block.BlockSize() {
+		return nil, errors.New("invalid iv size")
+	}
+	if len(cipherText) == 0 || len(cipherText)%block.BlockSize() != 0 {
+		return nil, errors.New("cipherText is not a multiple of the block size")
+	}
+
+	plainText := make([]byte, len(cipherText))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plainText, cipherText)
+
+	// 去除 PKCS#7 填充
+	padding := int(plainText[len(plainText)-1])
+	if padding == 0 || padding > block.BlockSize() {
+		return nil, errors.New("invalid padding")
+	}
+	for _, b := range plainText[len(plainText)-padding:] {
+		if int(b) != padding {
+			return nil, errors.New("invalid padding")
+		}
+	}
+	return plainText[:len(plainText)-padding], nil
+}
@@ -0,0 +1,291 @@
+package cmn
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// BatchSkipped 快速失败时未执行的子请求的状态码
+const BatchSkipped = -2
+
+// BatchItem 批量请求中的一个子请求
+type BatchItem struct {
+	// SN 调用顺序，按 SN 升序执行并返回；不填时按数组下标从 1 开始编号
+	SN int `json:"SN,omitempty"`
+	// Action 写入子请求 body 的 ReqProto.Action（body 为 JSON 对象且未指定 action 时）
+	Action string `json:"action,omitempty"`
+	// Method 默认为 POST
+	Method string `json:"method,omitempty"`
+	// Path 目标路径，可以带查询参数，如 /api/v1/posts?page=1
+	Path string          `json:"path"`
+	Body json.RawMessage `json:"body,omitempty"`
+}
+
+// BatchRequest 批量请求
+type BatchRequest struct {
+	Items []BatchItem `json:"items"`
+	// FailFast 为空时使用 BatchConfig.FailFast
+	FailFast *bool `json:"failFast,omitempty"`
+}
+
+// BatchConfig 批量请求配置
+type BatchConfig struct {
+	MaxItems int  // 单次批量请求的子请求数量上限，默认 20
+	FailFast bool // 默认是否在第一个失败的子请求后停止执行
+
+	// DB 不为空时所有子请求在同一个事务中执行，任一子请求失败则回滚，此时总是快速失败
+	// 子请求通过 ContextDB（或 db.GetPgWithContext）获取事务
+	DB func() *gorm.DB
+}
+
+// DefaultBatchConfig 默认批量请求配置
+func DefaultBatchConfig() *BatchConfig {
+	return &BatchConfig{
+		MaxItems: 20,
+	}
+}
+
+type batchContextKey struct{}
+type batchTxContextKey struct{}
+
+// batchTx 批量请求的事务及开启事务的数据库
+type batchTx struct {
+	db *gorm.DB
+	tx *gorm.DB
+}
+
+// ContextDB 返回绑定 ctx 的数据库会话；ctx 处于由 db 开启的批量事务中时返回该事务
+func ContextDB(ctx context.Context, db *gorm.DB) *gorm.DB {
+	if db == nil {
+		return nil
+	}
+	if bt, ok := ctx.Value(batchTxContextKey{}).(*batchTx); ok && bt.db == db {
+		return bt.tx.WithContext(ctx)
+	}
+	return db.WithContext(ctx)
+}
+
+// InBatch 判断请求是否为批量请求中的子请求
+func InBatch(ctx context.Context) bool {
+	inBatch, _ := ctx.Value(batchContextKey{}).(bool)
+	return inBatch
+}
+
+// BatchHandler 批量请求处理器：子请求通过同一个 gin 引擎分发，经过完整的中间件链（认证、限流、超时等）
+// 子请求继承外层请求的请求头（Authorization、Accept-Language 等），返回按 SN 排序的 ReplyProto 数组
+//
+//	router.POST("/api/v1/batch", cmn.BatchHandler(router, &cmn.BatchConfig{MaxItems: 20, DB: db.GetPg}))
+func BatchHandler(engine *gin.Engine, config *BatchConfig) gin.HandlerFunc {
+	if config == nil {
+		config = DefaultBatchConfig()
+	}
+	if config.MaxItems <= 0 {
+		config.MaxItems = 20
+	}
+
+	return func(c *gin.Context) {
+		if InBatch(c.Request.Context()) {
+			abortWithCode(c, CodeBadRequest, "批量请求不能嵌套")
+			return
+		}
+		var req BatchRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			abortWithCode(c, CodeBadRequest, "批量请求格式错误: "+err.Error())
+			return
+		}
+		items, err := normalizeBatchItems(req.Items, config.MaxItems)
+		if err != nil {
+			abortWithCode(c, CodeBadRequest, err.Error())
+			return
+		}
+
+		failFast := config.FailFast
+		if req.FailFast != nil {
+			failFast = *req.FailFast
+		}
+
+		var replies []ReplyProto
+		if config.DB == nil {
+			replies = dispatchBatch(engine, c, items, nil, failFast)
+		} else {
+			db := config.DB()
+			if db == nil {
+				abortWithCode(c, CodeServiceUnavailable, "数据库未初始化")
+				return
+			}
+			err = db.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+				replies = dispatchBatch(engine, c, items, &batchTx{db: db, tx: tx}, true)
+				for _, reply := range replies {
+					if reply.Status != Success {
+						return errBatchRollback
+					}
+				}
+				return nil
+			})
+			if err != nil && !errors.Is(err, errBatchRollback) {
+				Fail(c, err)
+				return
+			}
+		}
+		OK(c, replies)
+	}
+}
+
+// errBatchRollback 子请求失败时用于回滚事务
+var errBatchRollback = errors.New("batch rollback")
+
+// normalizeBatchItems 校验子请求、补全 SN 与方法并按 SN 排序
+func normalizeBatchItems(items []BatchItem, maxItems int) ([]BatchItem, error) {
+	if len(items) == 0 {
+		return nil, errors.New("批量请求为空")
+	}
+	if len(items) > maxItems {
+		return nil, fmt.Errorf("批量请求最多 %d 个子请求", maxItems)
+	}
+
+	result := make([]BatchItem, len(items))
+	seen := make(map[int]bool, len(items))
+	for i, item := range items {
+		if item.SN == 0 {
+			item.SN = i + 1
+		}
+		if seen[item.SN] {
+			return nil, fmt.Errorf("重复的 SN: %d", item.SN)
+		}
+		seen[item.SN] = true
+
+		item.Method = strings.ToUpper(item.Method)
+		if item.Method == "" {
+			item.Method = http.MethodPost
+		}
+		if !strings.HasPrefix(item.Path, "/") {
+			return nil, fmt.Errorf("SN %d: path 必须以 / 开头", item.SN)
+		}
+		if item.Action != "" {
+			body, err := withBatchAction(item.Body, item.Action)
+			if err != nil {
+				return nil, fmt.Errorf("SN %d: %w", item.SN, err)
+			}
+			item.Body = body
+		}
+		result[i] = item
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].SN < result[j].SN
+	})
+	return result, nil
+}
+
+// withBatchAction 把 action 写入 body（body 已指定 action 时保持不变）
+func withBatchAction(body json.RawMessage, action string) (json.RawMessage, error) {
+	fields := make(map[string]json.RawMessage)
+	if len(bytes.TrimSpace(body)) > 0 {
+		if err := json.Unmarshal(body, &fields); err != nil {
+			return nil, errors.New("指定 action 时 body 必须是 JSON 对象")
+		}
+	}
+	if _, ok := fields["action"]; ok {
+		return body, nil
+	}
+	fields["action"], _ = json.Marshal(action)
+	return json.Marshal(fields)
+}
+
+// dispatchBatch 按顺序执行子请求，failFast 时第一个失败之后的子请求标记为跳过
+func dispatchBatch(engine *gin.Engine, c *gin.Context, items []BatchItem, bt *batchTx, failFast bool) []ReplyProto {
+	ctx := context.WithValue(c.Request.Context(), batchContextKey{}, true)
+	if bt != nil {
+		ctx = context.WithValue(ctx, batchTxContextKey{}, bt)
+	}
+
+	replies := make([]ReplyProto, 0, len(items))
+	failed := false
+	for _, item := range items {
+		if failed && failFast {
+			replies = append(replies, ReplyProto{
+				Status: BatchSkipped,
+				Msg:    "skipped",
+				API:    item.Path,
+				Method: item.Method,
+				SN:     item.SN,
+			})
+			continue
+		}
+		reply := dispatchBatchItem(ctx, engine, c, item)
+		if reply.Status != Success {
+			failed = true
+		}
+		replies = append(replies, reply)
+	}
+	return replies
+}
+
+// dispatchBatchItem 执行一个子请求并把响应转换为 ReplyProto
+func dispatchBatchItem(ctx context.Context, engine *gin.Engine, c *gin.Context, item BatchItem) ReplyProto {
+	reply := ReplyProto{API: item.Path, Method: item.Method, SN: item.SN}
+	if i := strings.IndexByte(reply.API, '?'); i >= 0 {
+		reply.API = reply.API[:i]
+	}
+
+	req, err := http.NewRequestWithContext(ctx, item.Method, item.Path, bytes.NewReader(item.Body))
+	if err != nil {
+		reply.Status = http.StatusBadRequest
+		reply.Msg = err.Error()
+		return reply
+	}
+	req.Header = c.Request.Header.Clone()
+	req.Header.Del("Content-Length")
+	if len(item.Body) > 0 {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.RemoteAddr = c.Request.RemoteAddr
+
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, req)
+
+	body := bytes.TrimSpace(w.Body.Bytes())
+	if sub, ok := parseReplyProto(body); ok {
+		reply.Status = sub.Status
+		reply.Msg = sub.Msg
+		reply.Data = sub.Data
+		reply.RowCount = sub.RowCount
+	} else if json.Valid(body) {
+		reply.Data = body
+	} else if len(body) > 0 {
+		reply.Data, _ = json.Marshal(string(body))
+	}
+	// 非信封格式的错误响应（如 404）使用 HTTP 状态码作为状态
+	if w.Code >= http.StatusBadRequest && reply.Status == Success {
+		reply.Status = w.Code
+		if reply.Msg == "" {
+			reply.Msg = http.StatusText(w.Code)
+		}
+	}
+	return reply
+}
+
+// parseReplyProto 解析 ReplyProto 信封，body 不是带 status 字段的 JSON 对象时返回 false
+func parseReplyProto(body []byte) (ReplyProto, bool) {
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(body, &fields) != nil {
+		return ReplyProto{}, false
+	}
+	if _, ok := fields["status"]; !ok {
+		return ReplyProto{}, false
+	}
+	var reply ReplyProto
+	if json.Unmarshal(body, &reply) != nil {
+		return ReplyProto{}, false
+	}
+	return reply, true
+}
@@ -0,0 +1,225 @@
+package cmn
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// batchTestDriver 只記錄事務提交與回滾的數據庫驅動
+type batchTestDriver struct {
+	mu        sync.Mutex
+	commits   int
+	rollbacks int
+}
+
+func (d *batchTestDriver) Open(string) (driver.Conn, error) { return &batchTestConn{d: d}, nil }
+
+func (d *batchTestDriver) Connect(context.Context) (driver.Conn, error) { return d.Open("") }
+
+func (d *batchTestDriver) Driver() driver.Driver { return d }
+
+func (d *batchTestDriver) counts() (int, int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.commits, d.rollbacks
+}
+
+type batchTestConn struct{ d *batchTestDriver }
+
+func (c *batchTestConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (c *batchTestConn) Close() error                        { return nil }
+func (c *batchTestConn) Begin() (driver.Tx, error)           { return c, nil }
+
+func (c *batchTestConn) Commit() error {
+	c.d.mu.Lock()
+	defer c.d.mu.Unlock()
+	c.d.commits++
+	return nil
+}
+
+func (c *batchTestConn) Rollback() error {
+	c.d.mu.Lock()
+	defer c.d.mu.Unlock()
+	c.d.rollbacks++
+	return nil
+}
+
+// newBatchTestDB 使用記錄事務的驅動創建 GORM 連接
+func newBatchTestDB(t *testing.T) (*gorm.DB, *batchTestDriver) {
+	d := &batchTestDriver{}
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: sql.OpenDB(d)}), &gorm.Config{DisableAutomaticPing: true})
+	assert.NoError(t, err)
+	return db, d
+}
+
+// serveBatch 發送批量請求，返回 HTTP 狀態碼、外層響應與子請求響應
+func serveBatch(t *testing.T, router *gin.Engine, body string) (int, ReplyProto, []ReplyProto) {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/batch", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Tenant", "t1")
+	router.ServeHTTP(w, req)
+
+	var reply ReplyProto
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &reply))
+	var items []ReplyProto
+	if len(reply.Data) > 0 {
+		assert.NoError(t, json.Unmarshal(reply.Data, &items))
+	}
+	return w.Code, reply, items
+}
+
+// newBatchTestRouter 創建帶有若干測試路由的引擎
+func newBatchTestRouter(config *BatchConfig) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		// 全局中間件同樣作用於子請求
+		c.Header("X-Seen", "1")
+		if c.GetHeader("X-Tenant") == "" {
+			abortWithCode(c, CodeUnauthorized, "未認證")
+			return
+		}
+		c.Next()
+	})
+	router.POST("/batch", BatchHandler(router, config))
+	router.POST("/echo", func(c *gin.Context) {
+		var req ReqProto
+		if err := c.ShouldBindJSON(&req); err != nil {
+			FailWithStatus(c, http.StatusBadRequest, err)
+			return
+		}
+		OK(c, gin.H{"action": req.Action, "tenant": c.GetHeader("X-Tenant"), "page": c.Query("page")})
+	})
+	router.GET("/fail", func(c *gin.Context) {
+		Fail(c, NewAppError(-3, "余额不足"))
+	})
+	router.GET("/plain", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"status": "ok"})
+	})
+	return router
+}
+
+func TestBatchHandler(t *testing.T) {
+	t.Run("按SN順序執行並返回", func(t *testing.T) {
+		router := newBatchTestRouter(nil)
+		code, reply, items := serveBatch(t, router, `{"items": [
+			{"SN": 3, "method": "get", "path": "/plain"},
+			{"SN": 1, "action": "list", "path": "/echo?page=2", "body": {"page": 2}},
+			{"SN": 2, "path": "/echo", "body": {"action": "own"}, "action": "list"}
+		]}`)
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, Success, reply.Status)
+		assert.Len(t, items, 3)
+
+		assert.Equal(t, []int{1, 2, 3}, []int{items[0].SN, items[1].SN, items[2].SN})
+		assert.Equal(t, "/echo", items[0].API)
+		assert.Equal(t, "POST", items[0].Method)
+		assert.JSONEq(t, `{"action": "list", "tenant": "t1", "page": "2"}`, string(items[0].Data))
+		assert.JSONEq(t, `{"action": "own", "tenant": "t1", "page": ""}`, string(items[1].Data))
+		// 非信封格式的響應原樣放入 data
+		assert.Equal(t, Success, items[2].Status)
+		assert.JSONEq(t, `{"status": "ok"}`, string(items[2].Data))
+	})
+
+	t.Run("單個子請求失敗不影響其它子請求", func(t *testing.T) {
+		router := newBatchTestRouter(nil)
+		_, _, items := serveBatch(t, router, `{"items": [
+			{"method": "GET", "path": "/fail"},
+			{"method": "GET", "path": "/missing"},
+			{"path": "/echo", "body": {}}
+		]}`)
+		assert.Len(t, items, 3)
+		assert.Equal(t, -3, items[0].Status)
+		assert.Equal(t, "余额不足", items[0].Msg)
+		assert.Equal(t, http.StatusNotFound, items[1].Status)
+		assert.Equal(t, Success, items[2].Status)
+	})
+
+	t.Run("快速失敗跳過後續子請求", func(t *testing.T) {
+		router := newBatchTestRouter(&BatchConfig{FailFast: true})
+		_, _, items := serveBatch(t, router, `{"items": [
+			{"path": "/echo", "body": {}},
+			{"method": "GET", "path": "/fail"},
+			{"path": "/echo", "body": {}}
+		]}`)
+		assert.Equal(t, Success, items[0].Status)
+		assert.Equal(t, -3, items[1].Status)
+		assert.Equal(t, BatchSkipped, items[2].Status)
+		assert.Equal(t, 3, items[2].SN)
+
+		// 請求可以覆蓋默認值
+		_, _, items = serveBatch(t, router, `{"failFast": false, "items": [
+			{"method": "GET", "path": "/fail"},
+			{"path": "/echo", "body": {}}
+		]}`)
+		assert.Equal(t, Success, items[1].Status)
+	})
+
+	t.Run("非法的批量請求", func(t *testing.T) {
+		router := newBatchTestRouter(&BatchConfig{MaxItems: 2})
+		cases := []string{
+			`{"items": []}`,
+			`{"items": [{"path": "/echo"}, {"path": "/echo"}, {"path": "/echo"}]}`,
+			`{"items": [{"SN": 1, "path": "/echo"}, {"SN": 1, "path": "/echo"}]}`,
+			`{"items": [{"path": "echo"}]}`,
+			`{"items": [{"path": "/echo", "action": "x", "body": [1]}]}`,
+		}
+		for _, body := range cases {
+			code, reply, _ := serveBatch(t, router, body)
+			assert.Equal(t, http.StatusBadRequest, code, body)
+			assert.NotEqual(t, Success, reply.Status, body)
+		}
+	})
+
+	t.Run("不能嵌套批量請求", func(t *testing.T) {
+		router := newBatchTestRouter(nil)
+		_, _, items := serveBatch(t, router, `{"items": [{"path": "/batch", "body": {"items": [{"path": "/echo"}]}}]}`)
+		assert.Equal(t, http.StatusBadRequest, items[0].Status)
+	})
+
+	t.Run("事務中執行", func(t *testing.T) {
+		db, d := newBatchTestDB(t)
+		router := newBatchTestRouter(&BatchConfig{DB: func() *gorm.DB { return db }})
+		router.GET("/tx", func(c *gin.Context) {
+			_, inTx := ContextDB(c.Request.Context(), db).Statement.ConnPool.(*sql.Tx)
+			OK(c, inTx)
+		})
+
+		_, _, items := serveBatch(t, router, `{"items": [{"method": "GET", "path": "/tx"}, {"method": "GET", "path": "/tx"}]}`)
+		assert.Equal(t, "true", string(items[0].Data))
+		assert.Equal(t, "true", string(items[1].Data))
+		commits, rollbacks := d.counts()
+		assert.Equal(t, 1, commits)
+		assert.Equal(t, 0, rollbacks)
+
+		// 任一子請求失敗時回滾，並且總是快速失敗
+		_, reply, items := serveBatch(t, router, `{"failFast": false, "items": [
+			{"method": "GET", "path": "/tx"},
+			{"method": "GET", "path": "/fail"},
+			{"method": "GET", "path": "/tx"}
+		]}`)
+		assert.Equal(t, Success, reply.Status)
+		assert.Equal(t, BatchSkipped, items[2].Status)
+		commits, rollbacks = d.counts()
+		assert.Equal(t, 1, commits)
+		assert.Equal(t, 1, rollbacks)
+
+		// 批量請求之外不使用事務
+		_, inTx := ContextDB(context.Background(), db).Statement.ConnPool.(*sql.Tx)
+		assert.False(t, inTx)
+	})
+}
@@ -0,0 +1,288 @@
+package cmn
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/locales/en"
+	"github.com/go-playground/locales/zh"
+	ut "github.com/go-playground/universal-translator"
+	"github.com/go-playground/validator/v10"
+	en_translations "github.com/go-playground/validator/v10/translations/en"
+	zh_translations "github.com/go-playground/validator/v10/translations/zh"
+)
+
+// FieldError 单个字段的校验错误
+type FieldError struct {
+	Field   string `json:"field"`   // json 字段路径，如 items[0].phone
+	Rule    string `json:"rule"`    // 校验规则，如 required、phone
+	Message string `json:"message"` // 按请求语言翻译后的错误信息
+}
+
+// Bind 从请求体解码 JSON 并校验，校验规则使用 binding 标签（与 gin 一致）
+//
+//	type CreateUserReq struct {
+//		Name   string `json:"name" binding:"required,max=32"`
+//		Phone  string `json:"phone" binding:"required,phone"`
+//		IdCard string `json:"idCard" binding:"omitempty,idcard"`
+//		Status string `json:"status" binding:"enum=user_status"`
+//	}
+//
+//	req, err := cmn.Bind[CreateUserReq](c)
+//	if err != nil {
+//		cmn.Fail(c, err) // 400，data.fields 为逐字段的错误
+//		return
+//	}
+func Bind[T any](c *gin.Context) (T, error) {
+	var body []byte
+	if c.Request.Body != nil {
+		var err error
+		if body, err = io.ReadAll(c.Request.Body); err != nil {
+			var zero T
+			// 请求体限制中间件返回的 413 错误原样返回
+			var appErr *AppError
+			if errors.As(err, &appErr) {
+				return zero, appErr
+			}
+			return zero, WrapError(CodeBadRequest, err)
+		}
+	}
+	return BindData[T](c, body)
+}
+
+// BindData 解码 ReqProto.Data（或任意 JSON）并校验
+func BindData[T any](c *gin.Context, data json.RawMessage) (T, error) {
+	var v T
+	lang := negotiateLanguage(c.GetHeader("Accept-Language"), bindLanguages)
+
+	if len(bytes.TrimSpace(data)) == 0 {
+		return v, NewAppError(CodeBadRequest, "请求体为空")
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	if err := decoder.Decode(&v); err != nil {
+		return v, decodeError(err, lang)
+	}
+	if err := Validate(v, lang); err != nil {
+		return v, err
+	}
+	return v, nil
+}
+
+// Validate 校验结构体（或结构体指针），lang 为错误信息的语言
+// 校验失败时返回错误码为 CodeValidation 的 AppError
+func Validate(v interface{}, lang string) error {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return nil
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil
+	}
+
+	validate, translators := bindValidator()
+	err := validate.Struct(rv.Interface())
+	if err == nil {
+		return nil
+	}
+	var errs validator.ValidationErrors
+	if !errors.As(err, &errs) {
+		return WrapError(CodeBadRequest, err)
+	}
+
+	trans := translators[lang]
+	if trans == nil {
+		trans = translators[DefaultLanguage]
+	}
+	fields := make([]FieldError, 0, len(errs))
+	for _, fe := range errs {
+		fields = append(fields, FieldError{
+			Field:   fieldPath(fe),
+			Rule:    fe.Tag(),
+			Message: fe.Translate(trans),
+		})
+	}
+	return validationError(fields)
+}
+
+// validationError 构造校验错误，{error} 为第一个字段的错误
+func validationError(fields []FieldError) *AppError {
+	return NewCodeError(CodeValidation).
+		WithDetail("error", fields[0].Message).
+		WithDetail("fields", fields)
+}
+
+// fieldPath 返回去掉顶层结构体名的 json 字段路径
+func fieldPath(fe validator.FieldError) string {
+	ns := fe.Namespace()
+	if i := strings.IndexByte(ns, '.'); i >= 0 {
+		return ns[i+1:]
+	}
+	return ns
+}
+
+// decodeError 把 JSON 解码错误转换为 AppError，类型错误作为字段错误返回
+func decodeError(err error, lang string) error {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		msg := fmt.Sprintf("%s类型错误，应为%s", typeErr.Field, typeErr.Type.String())
+		if lang == "en" {
+			msg = fmt.Sprintf("%s must be of type %s", typeErr.Field, typeErr.Type.String())
+		}
+		return validationError([]FieldError{{Field: typeErr.Field, Rule: "type", Message: msg}})
+	}
+	return NewAppError(CodeBadRequest, "请求体不是合法的 JSON").WithCause(err)
+}
+
+// bindLanguages 校验错误信息支持的语言
+var bindLanguages = map[string]bool{"zh": true, "en": true}
+
+var (
+	bindValidatorOnce sync.Once
+	bindValidate      *validator.Validate
+	bindTranslators   map[string]ut.Translator
+)
+
+// bindValidator 返回注册了自定义规则与中英文翻译的校验器
+func bindValidator() (*validator.Validate, map[string]ut.Translator) {
+	bindValidatorOnce.Do(func() {
+		v := validator.New()
+		v.SetTagName("binding")
+		// 错误中使用 json 字段名
+		v.RegisterTagNameFunc(func(f reflect.StructField) string {
+			name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+			if name == "-" {
+				return ""
+			}
+			if name == "" {
+				return f.Name
+			}
+			return name
+		})
+		_ = v.RegisterValidation("phone", validatePhone)
+		_ = v.RegisterValidation("idcard", validateIdCard)
+		_ = v.RegisterValidation("enum", validateEnum)
+
+		zhLocale, enLocale := zh.New(), en.New()
+		uni := ut.New(zhLocale, zhLocale, enLocale)
+		zhTrans, _ := uni.GetTranslator("zh")
+		enTrans, _ := uni.GetTranslator("en")
+		_ = zh_translations.RegisterDefaultTranslations(v, zhTrans)
+		_ = en_translations.RegisterDefaultTranslations(v, enTrans)
+
+		custom := map[string][2]string{
+			"phone":  {"{0}必须是有效的手机号码", "{0} must be a valid mobile phone number"},
+			"idcard": {"{0}必须是有效的身份证号码", "{0} must be a valid ID card number"},
+			"enum":   {"{0}必须是[{1}]中的一个", "{0} must be one of [{1}]"},
+		}
+		for tag, messages := range custom {
+			registerBindTranslation(v, zhTrans, tag, messages[0])
+			registerBindTranslation(v, enTrans, tag, messages[1])
+		}
+
+		bindValidate = v
+		bindTranslators = map[string]ut.Translator{"zh": zhTrans, "en": enTrans}
+	})
+	return bindValidate, bindTranslators
+}
+
+// registerBindTranslation 注册自定义规则的翻译，{1} 为枚举的可选值
+func registerBindTranslation(v *validator.Validate, trans ut.Translator, tag, text string) {
+	_ = v.RegisterTranslation(tag, trans, func(ut ut.Translator) error {
+		return ut.Add(tag, text, true)
+	}, func(ut ut.Translator, fe validator.FieldError) string {
+		param := fe.Param()
+		if tag == "enum" {
+			param = strings.Join(enumValues(fe.Param()), ", ")
+		}
+		msg, err := ut.T(tag, fe.Field(), param)
+		if err != nil {
+			return fe.Error()
+		}
+		return msg
+	})
+}
+
+// phonePattern 中国大陆手机号
+var phonePattern = regexp.MustCompile(`^1[3-9]\d{9}$`)
+
+func validatePhone(fl validator.FieldLevel) bool {
+	return phonePattern.MatchString(fl.Field().String())
+}
+
+// validateIdCard 校验 18 位居民身份证号：格式、出生日期与校验码
+func validateIdCard(fl validator.FieldLevel) bool {
+	return IsValidIdCard(fl.Field().String())
+}
+
+// IsValidIdCard 校验 18 位居民身份证号（格式、出生日期与 GB 11643 校验码）
+func IsValidIdCard(id string) bool {
+	if len(id) != 18 {
+		return false
+	}
+	weights := [17]int{7, 9, 10, 5, 8, 4, 2, 1, 6, 3, 7, 9, 10, 5, 8, 4, 2}
+	sum := 0
+	for i := 0; i < 17; i++ {
+		if id[i] < '0' || id[i] > '9' {
+			return false
+		}
+		sum += int(id[i]-'0') * weights[i]
+	}
+	birth, err := time.Parse("20060102", id[6:14])
+	if err != nil || birth.Year() < 1900 || birth.After(time.Now()) {
+		return false
+	}
+	check := "10X98765432"[sum%11]
+	last := id[17]
+	if last == 'x' {
+		last = 'X'
+	}
+	return last == check
+}
+
+var (
+	enumsMu sync.RWMutex
+	enums   = make(map[string][]string)
+)
+
+// RegisterEnum 注册枚举，配合 binding:"enum=名称" 使用，值按字符串比较
+//
+//	cmn.RegisterEnum("user_status", "active", "disabled")
+func RegisterEnum(name string, values ...interface{}) {
+	strs := make([]string, 0, len(values))
+	for _, value := range values {
+		strs = append(strs, fmt.Sprint(value))
+	}
+	enumsMu.Lock()
+	defer enumsMu.Unlock()
+	enums[name] = strs
+}
+
+// enumValues 返回枚举的可选值
+func enumValues(name string) []string {
+	enumsMu.RLock()
+	defer enumsMu.RUnlock()
+	return enums[name]
+}
+
+// validateEnum 值必须在注册的枚举中，未注册的枚举校验失败
+func validateEnum(fl validator.FieldLevel) bool {
+	value := fmt.Sprint(fl.Field().Interface())
+	for _, allowed := range enumValues(fl.Param()) {
+		if value == allowed {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,121 @@
+package cmn
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+type bindTestUser struct {
+	Name   string `json:"name" binding:"required,max=8"`
+	Phone  string `json:"phone" binding:"required,phone"`
+	IdCard string `json:"idCard" binding:"omitempty,idcard"`
+	Status string `json:"status" binding:"enum=bind_test_status"`
+	Age    int    `json:"age" binding:"gte=0,lte=150"`
+}
+
+// bindTestContext 構造帶請求體的 gin.Context
+func bindTestContext(body, lang string) *gin.Context {
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request, _ = http.NewRequest("POST", "/users", bytes.NewBufferString(body))
+	c.Request.Header.Set("Accept-Language", lang)
+	return c
+}
+
+// fieldErrorsOf 取出校驗錯誤中的字段錯誤
+func fieldErrorsOf(t *testing.T, err error) []FieldError {
+	var appErr *AppError
+	assert.True(t, errors.As(err, &appErr))
+	assert.Equal(t, CodeValidation, appErr.StatusCode)
+	fields, _ := appErr.Details["fields"].([]FieldError)
+	return fields
+}
+
+func TestBind(t *testing.T) {
+	RegisterEnum("bind_test_status", "active", "disabled")
+
+	t.Run("綁定成功", func(t *testing.T) {
+		c := bindTestContext(`{"name": "tom", "phone": "13800138000", "idCard": "11010519491231002X", "status": "active", "age": 18}`, "")
+		user, err := Bind[bindTestUser](c)
+		assert.NoError(t, err)
+		assert.Equal(t, "tom", user.Name)
+		assert.Equal(t, 18, user.Age)
+	})
+
+	t.Run("字段錯誤使用json名稱並翻譯為中文", func(t *testing.T) {
+		c := bindTestContext(`{"phone": "12345", "idCard": "110105194912310021", "status": "deleted", "age": 200}`, "zh-CN")
+		_, err := Bind[bindTestUser](c)
+		fields := fieldErrorsOf(t, err)
+		assert.Equal(t, []FieldError{
+			{Field: "name", Rule: "required", Message: "name为必填字段"},
+			{Field: "phone", Rule: "phone", Message: "phone必须是有效的手机号码"},
+			{Field: "idCard", Rule: "idcard", Message: "idCard必须是有效的身份证号码"},
+			{Field: "status", Rule: "enum", Message: "status必须是[active, disabled]中的一个"},
+			{Field: "age", Rule: "lte", Message: "age必须小于或等于150"},
+		}, fields)
+	})
+
+	t.Run("按Accept-Language返回英文", func(t *testing.T) {
+		gin.SetMode(gin.TestMode)
+		router := gin.New()
+		router.POST("/users", func(c *gin.Context) {
+			user, err := Bind[bindTestUser](c)
+			if err != nil {
+				Fail(c, err)
+				return
+			}
+			OK(c, user)
+		})
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/users", bytes.NewBufferString(`{"name": "tom", "phone": "abc", "status": "active"}`))
+		req.Header.Set("Accept-Language", "en-US,en;q=0.9")
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		var reply Reply[struct {
+			Fields []FieldError `json:"fields"`
+		}]
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &reply))
+		assert.Equal(t, CodeValidation, reply.Status)
+		assert.Equal(t, "Validation failed: phone must be a valid mobile phone number", reply.Msg)
+		assert.Equal(t, []FieldError{{Field: "phone", Rule: "phone", Message: "phone must be a valid mobile phone number"}}, reply.Data.Fields)
+	})
+
+	t.Run("類型錯誤與非法JSON", func(t *testing.T) {
+		_, err := Bind[bindTestUser](bindTestContext(`{"name": "tom", "age": "18"}`, ""))
+		fields := fieldErrorsOf(t, err)
+		assert.Equal(t, "age", fields[0].Field)
+		assert.Equal(t, "type", fields[0].Rule)
+
+		_, err = Bind[bindTestUser](bindTestContext(`{"name": `, ""))
+		assert.Equal(t, CodeBadRequest, ErrorCodeOf(err))
+
+		_, err = Bind[bindTestUser](bindTestContext(``, ""))
+		assert.Equal(t, CodeBadRequest, ErrorCodeOf(err))
+	})
+
+	t.Run("綁定ReqProto.Data", func(t *testing.T) {
+		var req ReqProto
+		assert.NoError(t, json.Unmarshal([]byte(`{"action": "create", "data": {"name": "a", "phone": "13800138000", "status": "disabled"}}`), &req))
+		user, err := BindData[bindTestUser](bindTestContext("", ""), req.Data)
+		assert.NoError(t, err)
+		assert.Equal(t, "disabled", user.Status)
+	})
+}
+
+func TestIsValidIdCard(t *testing.T) {
+	assert.True(t, IsValidIdCard("11010519491231002X"))
+	assert.True(t, IsValidIdCard("11010519491231002x"))
+	assert.False(t, IsValidIdCard("110105194912310021")) // 校驗碼錯誤
+	assert.False(t, IsValidIdCard("110105194913310027")) // 月份錯誤
+	assert.False(t, IsValidIdCard("1101051949123100"))
+	assert.False(t, IsValidIdCard("11010519491231002A"))
+}
@@ -1,7 +1,9 @@
 package db
 
 import (
+	"context"
 	"fmt"
+	"my_template/cmn"
 	"time"
 
 	"github.com/spf13/viper"
@@ -25,6 +27,10 @@ func InitMySQL() error {
 	if err != nil {
 		return fmt.Errorf("打开 MySQL 连接失败: %w", err)
 	}
+	// 行级安全策略：按认证信息自动过滤受保护模型的查询、更新与删除
+	if err := cmn.EnableRowLevelSecurity(db); err != nil {
+		return fmt.Errorf("注册 MySQL 行级安全回调失败: %w", err)
+	}
 	sqlDB, err := db.DB()
 	if err != nil {
 		return fmt.Errorf("获取 MySQL 底层连接失败: %w", err)
@@ -47,3 +53,10 @@ func InitMySQL() error {
 func GetMySql() *gorm.DB {
 	return MySQLDB
 }
+
+// GetMySqlWithContext 返回绑定 ctx 的 MySQL 会话，ctx 取消或超时后查询会立即中止
+// 在请求处理器中配合 cmn.BudgetContext 使用，使查询遵守请求剩余的时间预算
+// 处于 cmn.BatchHandler 开启的批量事务中时返回该事务
+func GetMySqlWithContext(ctx context.Context) *gorm.DB {
+	return cmn.ContextDB(ctx, MySQLDB)
+}
@@ -1,7 +1,9 @@
 package db
 
 import (
+	"context"
 	"fmt"
+	"my_template/cmn"
 	"time"
 
 	"github.com/spf13/viper"
@@ -26,6 +28,10 @@ func InitPostgreSQL() error {
 	if err != nil {
 		return fmt.Errorf("打开 PostgreSQL 连接失败: %w", err)
 	}
+	// 行级安全策略：按认证信息自动过滤受保护模型的查询、更新与删除
+	if err := cmn.EnableRowLevelSecurity(db); err != nil {
+		return fmt.Errorf("注册 PostgreSQL 行级安全回调失败: %w", err)
+	}
 	sqlDB, err := db.DB()
 	if err != nil {
 		return fmt.Errorf("获取 PostgreSQL 底层连接失败: %w", err)
@@ -49,3 +55,10 @@ func GetPg() *gorm.DB {
 	return PGDB
 
 }
+
+// GetPgWithContext 返回绑定 ctx 的 PostgreSQL 会话，ctx 取消或超时后查询会立即中止
+// 在请求处理器中配合 cmn.BudgetContext 使用，使查询遵守请求剩余的时间预算
+// 处于 cmn.BatchHandler 开启的批量事务中时返回该事务
+func GetPgWithContext(ctx context.Context) *gorm.DB {
+	return cmn.ContextDB(ctx, PGDB)
+}
@@ -32,6 +32,8 @@ func InitRedis() error {
 		DialTimeout:  5 * time.Second,
 		ReadTimeout:  3 * time.Second,
 		WriteTimeout: 3 * time.Second,
+		// 命令的网络读写超时遵守调用方 ctx 的截止时间，客户端断开或请求预算耗尽时立即返回
+		ContextTimeoutEnabled: true,
 	})
 
 	// 测试连接
@@ -1,21 +1,153 @@
 package cmn
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 
+	"go.uber.org/zap/zapcore"
+)
+
+// 错误码范围：0 成功，负数为通用错误，400-599 与 HTTP 状态码一致，1000-9999 为框架内置，业务错误码从 10000 开始
 const (
 	Success     = 0
 	CommonError = -1
+
+	// 与 HTTP 状态码一致的错误码，内置中间件使用
+	CodeBadRequest         = http.StatusBadRequest
+	CodeUnauthorized       = http.StatusUnauthorized
+	CodeForbidden          = http.StatusForbidden
+	CodeNotFound           = http.StatusNotFound
+	CodeRequestTimeout     = http.StatusRequestTimeout
+	CodeRequestTooLarge    = http.StatusRequestEntityTooLarge
+	CodeUnsupportedMedia   = http.StatusUnsupportedMediaType
+	CodeTooManyRequests    = http.StatusTooManyRequests
+	CodeInternal           = http.StatusInternalServerError
+	CodeServiceUnavailable = http.StatusServiceUnavailable
+
+	// 调用上游 HTTP 服务的错误，Details 中的 status 为上游返回的 HTTP 状态码
+	CodeUpstreamRejected    = 1001 // 上游返回 4xx（429 除外）
+	CodeUpstreamUnavailable = 1002 // 上游返回 5xx 或 429，可重试
+
+	// CodeValidation 请求参数校验失败，Details 中 fields 为逐字段的错误
+	CodeValidation = 1003
+	// CodeCircuitOpen 上游熔断中，请求未发送即失败，Details 中 host 为熔断的主机
+	CodeCircuitOpen = 1004
+)
+
+// DefaultLanguage 默认语言，AppError.Message 视为该语言的消息
+var DefaultLanguage = "zh"
+
+// ErrorDef 错误码定义，每个错误码只定义一次
+type ErrorDef struct {
+	Code       int
+	HTTPStatus int               // 响应的 HTTP 状态码
+	Level      zapcore.Level     // 请求日志中记录该错误使用的级别
+	Retryable  bool              // 调用方是否可以重试
+	Messages   map[string]string // 语言 -> 消息模板，模板中的 {name} 由 Details 替换
+}
+
+var (
+	errorDefsMu sync.RWMutex
+	errorDefs   = make(map[int]ErrorDef)
 )
 
+// DefineError 定义错误码，重复定义时 panic（应在包初始化时调用）
+//
+//	const CodeBalanceNotEnough = 10001
+//	var _ = cmn.DefineError(cmn.ErrorDef{
+//		Code: CodeBalanceNotEnough, HTTPStatus: http.StatusOK, Level: zapcore.InfoLevel,
+//		Messages: map[string]string{"zh": "余额不足，还差 {amount} 元", "en": "Insufficient balance, {amount} short"},
+//	})
+func DefineError(def ErrorDef) ErrorDef {
+	if def.HTTPStatus == 0 {
+		def.HTTPStatus = http.StatusOK
+	}
+	errorDefsMu.Lock()
+	defer errorDefsMu.Unlock()
+
+	if _, ok := errorDefs[def.Code]; ok {
+		panic(fmt.Sprintf("错误码 %d 重复定义", def.Code))
+	}
+	errorDefs[def.Code] = def
+	return def
+}
+
+// LookupError 查找错误码定义
+func LookupError(code int) (ErrorDef, bool) {
+	errorDefsMu.RLock()
+	defer errorDefsMu.RUnlock()
+
+	def, ok := errorDefs[code]
+	return def, ok
+}
+
+func init() {
+	builtin := []ErrorDef{
+		// CommonError 沿用原有行为返回 HTTP 200
+		{Code: CommonError, HTTPStatus: http.StatusOK, Level: zapcore.ErrorLevel,
+			Messages: map[string]string{"zh": "操作失败", "en": "Operation failed"}},
+		{Code: CodeBadRequest, HTTPStatus: http.StatusBadRequest, Level: zapcore.InfoLevel,
+			Messages: map[string]string{"zh": "请求参数错误", "en": "Bad request"}},
+		{Code: CodeUnauthorized, HTTPStatus: http.StatusUnauthorized, Level: zapcore.InfoLevel,
+			Messages: map[string]string{"zh": "未认证", "en": "Unauthorized"}},
+		{Code: CodeForbidden, HTTPStatus: http.StatusForbidden, Level: zapcore.WarnLevel,
+			Messages: map[string]string{"zh": "无权访问", "en": "Forbidden"}},
+		{Code: CodeNotFound, HTTPStatus: http.StatusNotFound, Level: zapcore.InfoLevel,
+			Messages: map[string]string{"zh": "资源不存在", "en": "Not found"}},
+		{Code: CodeRequestTimeout, HTTPStatus: http.StatusRequestTimeout, Level: zapcore.WarnLevel, Retryable: true,
+			Messages: map[string]string{"zh": "请求超时", "en": "Request timeout"}},
+		{Code: CodeRequestTooLarge, HTTPStatus: http.StatusRequestEntityTooLarge, Level: zapcore.WarnLevel,
+			Messages: map[string]string{"zh": "请求体过大", "en": "Request entity too large"}},
+		{Code: CodeUnsupportedMedia, HTTPStatus: http.StatusUnsupportedMediaType, Level: zapcore.InfoLevel,
+			Messages: map[string]string{"zh": "不支持的请求格式", "en": "Unsupported media type"}},
+		{Code: CodeTooManyRequests, HTTPStatus: http.StatusTooManyRequests, Level: zapcore.WarnLevel, Retryable: true,
+			Messages: map[string]string{"zh": "请求过于频繁，请稍后再试", "en": "Too many requests, please try again later"}},
+		{Code: CodeInternal, HTTPStatus: http.StatusInternalServerError, Level: zapcore.ErrorLevel,
+			Messages: map[string]string{"zh": "服务器内部错误", "en": "Internal server error"}},
+		{Code: CodeServiceUnavailable, HTTPStatus: http.StatusServiceUnavailable, Level: zapcore.ErrorLevel, Retryable: true,
+			Messages: map[string]string{"zh": "服务暂不可用", "en": "Service unavailable"}},
+		{Code: CodeUpstreamRejected, HTTPStatus: http.StatusBadGateway, Level: zapcore.WarnLevel,
+			Messages: map[string]string{"zh": "上游服务拒绝请求（HTTP {status}）", "en": "Upstream service rejected the request (HTTP {status})"}},
+		{Code: CodeUpstreamUnavailable, HTTPStatus: http.StatusBadGateway, Level: zapcore.ErrorLevel, Retryable: true,
+			Messages: map[string]string{"zh": "上游服务不可用（HTTP {status}）", "en": "Upstream service unavailable (HTTP {status})"}},
+		{Code: CodeValidation, HTTPStatus: http.StatusBadRequest, Level: zapcore.InfoLevel,
+			Messages: map[string]string{"zh": "参数校验失败：{error}", "en": "Validation failed: {error}"}},
+		{Code: CodeCircuitOpen, HTTPStatus: http.StatusServiceUnavailable, Level: zapcore.WarnLevel, Retryable: true,
+			Messages: map[string]string{"zh": "上游服务暂不可用，请稍后再试", "en": "Upstream service is temporarily unavailable, please try again later"}},
+	}
+	for _, def := range builtin {
+		DefineError(def)
+	}
+}
+
 // AppError 是我们的自定义错误类型
 type AppError struct {
 	StatusCode int
-	Message    string
+	// Message 默认语言的消息，为空时使用错误码定义中的模板
+	Message string
+	// Details 附加信息，用于替换消息模板中的 {name}，并作为错误响应的 data 返回给客户端
+	Details map[string]interface{}
+	// Cause 原始错误，不返回给客户端
+	Cause error
 }
 
 // Error 方法让 AppError 实现了 error 接口
 func (e *AppError) Error() string {
-	return fmt.Sprintf("code: %d,err: %s", e.StatusCode, e.Message)
+	msg := fmt.Sprintf("code: %d,err: %s", e.StatusCode, e.Localize(DefaultLanguage))
+	if e.Cause != nil {
+		msg += ": " + e.Cause.Error()
+	}
+	return msg
+}
+
+// Unwrap 支持 errors.Is / errors.As 检查原始错误
+func (e *AppError) Unwrap() error {
+	return e.Cause
 }
 
 func NewAppError(statusCode int, message string) *AppError {
@@ -24,3 +156,170 @@ func NewAppError(statusCode int, message string) *AppError {
 		Message:    message,
 	}
 }
+
+// NewCodeError 创建使用错误码定义中消息模板的错误
+func NewCodeError(code int) *AppError {
+	return &AppError{StatusCode: code}
+}
+
+// WrapError 使用错误码包装原始错误，cause 为 nil 时返回 nil
+func WrapError(code int, cause error) *AppError {
+	if cause == nil {
+		return nil
+	}
+	return &AppError{StatusCode: code, Cause: cause}
+}
+
+// WithDetail 添加附加信息
+func (e *AppError) WithDetail(key string, value interface{}) *AppError {
+	if e.Details == nil {
+		e.Details = make(map[string]interface{})
+	}
+	e.Details[key] = value
+	return e
+}
+
+// WithCause 设置原始错误
+func (e *AppError) WithCause(cause error) *AppError {
+	e.Cause = cause
+	return e
+}
+
+// HTTPStatus 返回错误响应的 HTTP 状态码
+//   - 已定义的错误码使用定义中的状态码
+//   - 未定义的错误码是 HTTP 错误码（4xx/5xx）时作为 HTTP 状态码，其余返回 200
+func (e *AppError) HTTPStatus() int {
+	if def, ok := LookupError(e.StatusCode); ok {
+		return def.HTTPStatus
+	}
+	if e.StatusCode >= 400 && e.StatusCode < 600 {
+		return e.StatusCode
+	}
+	return http.StatusOK
+}
+
+// Retryable 调用方是否可以重试
+func (e *AppError) Retryable() bool {
+	def, ok := LookupError(e.StatusCode)
+	return ok && def.Retryable
+}
+
+// LogLevel 记录该错误使用的日志级别，未定义的错误码使用 Error
+func (e *AppError) LogLevel() zapcore.Level {
+	if def, ok := LookupError(e.StatusCode); ok {
+		return def.Level
+	}
+	return zapcore.ErrorLevel
+}
+
+// Localize 返回指定语言的消息
+// 默认语言优先使用 Message；其它语言使用错误码定义中的模板，没有该语言的模板时退回默认语言
+func (e *AppError) Localize(lang string) string {
+	def, defined := LookupError(e.StatusCode)
+	if lang != DefaultLanguage && defined {
+		if tmpl, ok := def.Messages[lang]; ok {
+			return e.render(tmpl)
+		}
+	}
+	if e.Message != "" {
+		return e.Message
+	}
+	if defined {
+		if tmpl, ok := def.Messages[DefaultLanguage]; ok {
+			return e.render(tmpl)
+		}
+	}
+	return http.StatusText(e.HTTPStatus())
+}
+
+// render 用 Details 替换模板中的 {name}
+func (e *AppError) render(tmpl string) string {
+	if len(e.Details) == 0 {
+		return tmpl
+	}
+	pairs := make([]string, 0, len(e.Details)*2)
+	for k, v := range e.Details {
+		pairs = append(pairs, "{"+k+"}", fmt.Sprint(v))
+	}
+	return strings.NewReplacer(pairs...).Replace(tmpl)
+}
+
+// ErrorCodeOf 返回错误的错误码，不是 AppError 时返回 CommonError，nil 返回 Success
+func ErrorCodeOf(err error) int {
+	if err == nil {
+		return Success
+	}
+	var appErr *AppError
+	if errors.As(err, &appErr) {
+		return appErr.StatusCode
+	}
+	return CommonError
+}
+
+// IsRetryable 判断错误是否可以重试
+func IsRetryable(err error) bool {
+	var appErr *AppError
+	return errors.As(err, &appErr) && appErr.Retryable()
+}
+
+// errorLogLevel 返回记录错误使用的日志级别
+func errorLogLevel(err error) zapcore.Level {
+	var appErr *AppError
+	if errors.As(err, &appErr) {
+		return appErr.LogLevel()
+	}
+	return zapcore.ErrorLevel
+}
+
+// errorLanguages 返回错误码可用的语言
+func errorLanguages(code int) map[string]bool {
+	languages := map[string]bool{DefaultLanguage: true}
+	if def, ok := LookupError(code); ok {
+		for lang := range def.Messages {
+			languages[lang] = true
+		}
+	}
+	return languages
+}
+
+// negotiateLanguage 按 Accept-Language 的权重选择可用的语言，如 "en-US,en;q=0.9,zh;q=0.8"
+// 依次尝试完整标签与主语言（zh-TW -> zh），都不可用时返回默认语言
+func negotiateLanguage(acceptLanguage string, available map[string]bool) string {
+	type tag struct {
+		lang string
+		q    float64
+	}
+	var tags []tag
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		lang := strings.TrimSpace(fields[0])
+		if lang == "" || lang == "*" {
+			continue
+		}
+		q := 1.0
+		for _, param := range fields[1:] {
+			if v, ok := strings.CutPrefix(strings.TrimSpace(param), "q="); ok {
+				if f, err := strconv.ParseFloat(v, 64); err == nil {
+					q = f
+				}
+			}
+		}
+		if q > 0 {
+			tags = append(tags, tag{lang: lang, q: q})
+		}
+	}
+	sort.SliceStable(tags, func(i, j int) bool { return tags[i].q > tags[j].q })
+
+	for _, t := range tags {
+		if available[t.lang] {
+			return t.lang
+		}
+		if base, _, ok := strings.Cut(t.lang, "-"); ok && available[strings.ToLower(base)] {
+			return strings.ToLower(base)
+		}
+		if available[strings.ToLower(t.lang)] {
+			return strings.ToLower(t.lang)
+		}
+	}
+	return DefaultLanguage
+}
@@ -0,0 +1,135 @@
+package cmn
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap/zapcore"
+)
+
+const errorTestCodeBalance = 19001
+
+func init() {
+	DefineError(ErrorDef{
+		Code:       errorTestCodeBalance,
+		HTTPStatus: http.StatusOK,
+		Level:      zapcore.InfoLevel,
+		Messages:   map[string]string{"zh": "余额不足，还差 {amount} 元", "en": "Insufficient balance, {amount} short"},
+	})
+}
+
+func TestErrorCatalog(t *testing.T) {
+	t.Run("錯誤碼只能定義一次", func(t *testing.T) {
+		assert.Panics(t, func() {
+			DefineError(ErrorDef{Code: errorTestCodeBalance})
+		})
+		def, ok := LookupError(CodeTooManyRequests)
+		assert.True(t, ok)
+		assert.True(t, def.Retryable)
+	})
+
+	t.Run("框架錯誤碼都在目錄中定義", func(t *testing.T) {
+		codes := []int{
+			CommonError, CodeBadRequest, CodeUnauthorized, CodeForbidden, CodeNotFound, CodeRequestTimeout,
+			CodeRequestTooLarge, CodeUnsupportedMedia, CodeTooManyRequests, CodeInternal, CodeServiceUnavailable,
+			CodeUpstreamRejected, CodeUpstreamUnavailable, CodeValidation, CodeCircuitOpen,
+		}
+		for _, code := range codes {
+			def, ok := LookupError(code)
+			if assert.True(t, ok, code) {
+				assert.NotEmpty(t, def.Messages["zh"], code)
+				assert.NotEmpty(t, def.Messages["en"], code)
+			}
+		}
+	})
+
+	t.Run("HTTP狀態碼", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, NewCodeError(errorTestCodeBalance).HTTPStatus())
+		assert.Equal(t, http.StatusBadGateway, NewCodeError(CodeUpstreamUnavailable).HTTPStatus())
+		assert.Equal(t, http.StatusOK, NewAppError(CommonError, "x").HTTPStatus())
+		// 未定義的錯誤碼沿用原有規則
+		assert.Equal(t, http.StatusConflict, NewAppError(http.StatusConflict, "x").HTTPStatus())
+		assert.Equal(t, http.StatusOK, NewAppError(-3, "x").HTTPStatus())
+	})
+
+	t.Run("按語言選擇消息", func(t *testing.T) {
+		err := NewCodeError(errorTestCodeBalance).WithDetail("amount", 12.5)
+		assert.Equal(t, "余额不足，还差 12.5 元", err.Localize("zh"))
+		assert.Equal(t, "Insufficient balance, 12.5 short", err.Localize("en"))
+		assert.Equal(t, "余额不足，还差 12.5 元", err.Localize("fr"))
+
+		// Message 是默認語言的消息，其它語言使用模板
+		err = NewAppError(CodeTooManyRequests, "登录失败次数过多")
+		assert.Equal(t, "登录失败次数过多", err.Localize("zh"))
+		assert.Equal(t, "Too many requests, please try again later", err.Localize("en"))
+
+		// 未定義的錯誤碼總是使用 Message
+		assert.Equal(t, "余额不足", NewAppError(-3, "余额不足").Localize("en"))
+	})
+
+	t.Run("Accept-Language協商", func(t *testing.T) {
+		available := map[string]bool{"zh": true, "en": true}
+		assert.Equal(t, "en", negotiateLanguage("en-US,en;q=0.9,zh;q=0.8", available))
+		assert.Equal(t, "zh", negotiateLanguage("zh-TW", available))
+		assert.Equal(t, "zh", negotiateLanguage("fr;q=1, zh;q=0.5, en;q=0.7", map[string]bool{"zh": true}))
+		assert.Equal(t, "en", negotiateLanguage("fr, en;q=0.3", available))
+		assert.Equal(t, "zh", negotiateLanguage("en;q=0, *", available))
+		assert.Equal(t, "zh", negotiateLanguage("", available))
+	})
+
+	t.Run("包裝原始錯誤", func(t *testing.T) {
+		err := WrapError(CodeServiceUnavailable, io.ErrUnexpectedEOF)
+		assert.True(t, errors.Is(err, io.ErrUnexpectedEOF))
+		assert.Equal(t, "code: 503,err: 服务暂不可用: unexpected EOF", err.Error())
+		assert.True(t, IsRetryable(err))
+		assert.Nil(t, WrapError(CodeInternal, nil))
+
+		wrapped := errors.Join(errors.New("context"), err)
+		assert.Equal(t, CodeServiceUnavailable, ErrorCodeOf(wrapped))
+		assert.True(t, IsRetryable(wrapped))
+		assert.False(t, IsRetryable(errors.New("x")))
+		assert.Equal(t, CommonError, ErrorCodeOf(errors.New("x")))
+		assert.Equal(t, Success, ErrorCodeOf(nil))
+		assert.Equal(t, zapcore.InfoLevel, errorLogLevel(NewCodeError(CodeBadRequest)))
+	})
+
+	t.Run("錯誤響應按請求語言返回", func(t *testing.T) {
+		gin.SetMode(gin.TestMode)
+		router := gin.New()
+		router.GET("/pay", func(c *gin.Context) {
+			Fail(c, NewCodeError(errorTestCodeBalance).WithDetail("amount", 3))
+		})
+		router.GET("/limited", func(c *gin.Context) {
+			abortWithCode(c, CodeTooManyRequests, "请求过于频繁，请稍后再试")
+		})
+
+		serve := func(path, lang string) (int, ReplyProto) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", path, nil)
+			req.Header.Set("Accept-Language", lang)
+			router.ServeHTTP(w, req)
+			var reply ReplyProto
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &reply))
+			return w.Code, reply
+		}
+
+		code, reply := serve("/pay", "en-GB,en;q=0.9")
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, errorTestCodeBalance, reply.Status)
+		assert.Equal(t, "Insufficient balance, 3 short", reply.Msg)
+		assert.JSONEq(t, `{"amount": 3}`, string(reply.Data))
+
+		code, reply = serve("/limited", "en")
+		assert.Equal(t, http.StatusTooManyRequests, code)
+		assert.Equal(t, "Too many requests, please try again later", reply.Msg)
+
+		_, reply = serve("/limited", "zh-CN")
+		assert.Equal(t, "请求过于频繁，请稍后再试", reply.Msg)
+	})
+}
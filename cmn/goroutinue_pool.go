@@ -1,9 +1,12 @@
 package cmn
 
 import (
+	"fmt"
 	"github.com/spf13/viper"
 	"runtime"
+	"runtime/debug"
 	"sync"
+	"time"
 
 	"github.com/panjf2000/ants/v2"
 	"go.uber.org/zap"
@@ -27,7 +30,14 @@ func InitGoroutinePool(preAlloc bool) error {
 		p, err := ants.NewPool(size,
 			ants.WithPreAlloc(preAlloc),
 			ants.WithPanicHandler(func(panicVal interface{}) {
-				zap.L().Error("panic in ants worker", zap.Any("panic", panicVal))
+				stack := string(debug.Stack())
+				zap.L().Error("panic in ants worker", zap.Any("panic", panicVal), zap.String("stack", stack))
+				ReportPanic(&PanicReport{
+					Time:   time.Now(),
+					Source: PanicSourcePool,
+					Value:  fmt.Sprintf("%v", panicVal),
+					Stack:  stack,
+				})
 			}),
 		)
 		if err != nil {
@@ -1,7 +1,12 @@
 package cmn
 
 import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
 	neturl "net/url"
+	"strings"
 	"time"
 
 	"github.com/valyala/fasthttp"
@@ -10,69 +15,381 @@ import (
 
 // SendHttpRequest 使用 fasthttp 发送 HTTP 请求（可指定方法），默认 Content-Type 为 application/json
 // 步骤：0) 校验 URL 1) 获取请求/响应对象 2) 设置方法/URL 3) 设置基础请求头 3.1) 追加自定义请求头 4) 写入请求体 5) 发送请求(支持超时) 6) 读取响应 7) 非2xx返回错误 8) 返回响应体
-// 成功返回响应体（2xx 视为成功），否则返回 CodeError，Code 为 HTTP 状态码
+// 成功返回响应体（2xx 视为成功），否则返回错误码为 CodeUpstreamRejected/CodeUpstreamUnavailable 的 AppError，
+// 上游的 HTTP 状态码与响应体通过 errors.As 取得 *HTTPStatusError
 // headers 参数用于附加自定义请求头（若与基础头冲突，将覆盖基础头）
 // timeout 为超时时间，若 <= 0 则默认使用 5s
+// 只发送一次，需要重试时使用 HttpClient
 func SendHttpRequest(method, url string, body []byte, headers map[string]string, timeout time.Duration) ([]byte, error) {
+	if timeout <= 0 {
+		timeout = defaultHttpTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return SendHttpRequestWithContext(ctx, method, url, body, headers)
+}
+
+const defaultHttpTimeout = 5 * time.Second
+
+// HTTPStatusError 上游返回的非 2xx 响应，作为 AppError 的 Cause
+type HTTPStatusError struct {
+	StatusCode int
+	Body       []byte
+}
+
+func (e *HTTPStatusError) Error() string {
+	return fmt.Sprintf("http status %d: %s", e.StatusCode, e.Body)
+}
+
+// newUpstreamError 根据上游状态码返回错误，5xx 与 429 可重试
+func newUpstreamError(status int, body []byte) *AppError {
+	code := CodeUpstreamRejected
+	if status >= 500 || status == http.StatusTooManyRequests {
+		code = CodeUpstreamUnavailable
+	}
+	return NewCodeError(code).
+		WithDetail("status", status).
+		WithCause(&HTTPStatusError{StatusCode: status, Body: body})
+}
+
+// SendHttpRequestWithContext 与 SendHttpRequest 相同，但超时由 ctx 的截止时间决定（没有截止时间时默认 5s）
+// ctx 被取消（如客户端断开、请求预算耗尽）时立即返回 ctx.Err()，不再等待上游响应
+func SendHttpRequestWithContext(ctx context.Context, method, url string, body []byte, headers map[string]string) ([]byte, error) {
+	header := map[string]string{"Content-Type": jsonContentType}
+	for k, v := range headers {
+		if strings.EqualFold(k, "Content-Type") {
+			delete(header, "Content-Type")
+		}
+		header[k] = v
+	}
+	resp, err := defaultHttpClient.Do(ctx, &HttpRequest{Method: method, URL: url, Header: header, Body: body})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+const jsonContentType = "application/json; charset=utf-8"
+
+// HttpRequest 出站 HTTP 请求
+type HttpRequest struct {
+	Method string
+	URL    string            // 完整 URL，或相对于 HttpClientConfig.BaseURL 的路径
+	Query  neturl.Values     // 追加到 URL 的查询参数
+	Header map[string]string // 请求头，覆盖客户端的默认请求头
+	Body   []byte
+
+	// BodyReader 流式请求体，设置后忽略 Body；流式请求体无法重放，因此不会重试
+	BodyReader io.Reader
+	BodySize   int64 // BodyReader 的长度，未知时为 -1（使用 chunked 编码）
+
+	stream bool // 流式读取 2xx 响应体，见 HttpClient.Stream
+}
+
+// HttpResponse 出站请求的响应
+type HttpResponse struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+	Attempts   int // 实际发送的次数（含重试）
+
+	// Stream 流式响应体，仅 HttpClient.Stream 的 2xx 响应设置（此时 Body 为空），读取完毕后必须 Close
+	Stream io.ReadCloser
+}
+
+// HttpHandler 发送一次请求；非 2xx 响应不是错误，由调用方根据状态码处理
+type HttpHandler func(ctx context.Context, req *HttpRequest) (*HttpResponse, error)
+
+// HttpClientConfig HTTP 客户端配置
+type HttpClientConfig struct {
+	BaseURL string            // 请求 URL 不是完整 URL 时拼接在前面，如 https://api.example.com/v1
+	Header  map[string]string // 默认请求头，如 Authorization、User-Agent
+	Timeout time.Duration     // 单次尝试的超时时间，总时间同时受 ctx 截止时间限制；为 0 时只使用 ctx 的截止时间（没有时为 5s）
+	Retry   *RetryPolicy      // 为空时不重试
+
+	// Breaker 按主机熔断，每次尝试分别计入统计；熔断中返回 CodeCircuitOpen 且不再重试，为空时不熔断
+	Breaker *CircuitBreaker
+
+	// Log 请求日志的脱敏、截断与级别，为空时使用 DefaultHttpLogConfig（不记录请求头与请求体）
+	Log *HttpLogConfig
+
+	// Cassette 录制或回放请求（用于测试），回放时不访问网络；重试与熔断仍然生效，每次尝试分别录制
+	Cassette *Cassette
+
+	// Interceptors 按优先级组成的拦截器链（认证、请求 ID、签名、指标等），包裹在 Retry 与 Breaker 之外
+	Interceptors []HttpInterceptor
+
+	// ReplyProto 上游使用 ReplyProto 信封且错误时可能返回 HTTP 200（如本仓库的 CommonError），
+	// 开启后 DoJSON 把 2xx 响应中 status 不为 0 的信封视为 CodeUpstreamRejected
+	ReplyProto bool
+}
+
+// HttpClient 可复用的出站 HTTP 客户端（基于 fasthttp），并发安全
+type HttpClient struct {
+	config       HttpClientConfig
+	client       *fasthttp.Client
+	handler      HttpHandler
+	log          *HttpLogConfig
+	interceptors []HttpInterceptor // 已排序
+}
+
+// defaultHttpClient SendHttpRequest 使用的客户端，只发送一次
+var defaultHttpClient = NewHttpClient(nil)
+
+// NewHttpClient 创建 HTTP 客户端
+//
+//	client := cmn.NewHttpClient(&cmn.HttpClientConfig{
+//		BaseURL: "https://api.example.com/v1",
+//		Timeout: 10 * time.Second,
+//		Retry:   cmn.DefaultRetryPolicy(),
+//	})
+//	resp, err := client.Get(ctx, "/items", url.Values{"page": {"1"}})
+func NewHttpClient(config *HttpClientConfig) *HttpClient {
+	c := &HttpClient{client: &fasthttp.Client{}, log: defaultHttpLogConfig}
+	if config != nil {
+		c.config = *config
+	}
+	if c.config.Log != nil {
+		c.log = c.config.Log
+	}
+	c.handler = c.send
+	if c.config.Cassette != nil {
+		c.handler = c.config.Cassette.wrap(c.handler)
+	}
+	if c.config.Breaker != nil {
+		c.handler = c.config.Breaker.wrap(c.handler, c.log)
+	}
+	if c.config.Retry != nil {
+		c.handler = c.config.Retry.wrap(c.handler, c.log)
+	}
+	c.interceptors = sortInterceptors(c.config.Interceptors)
+	c.handler = wrapInterceptors(c.handler, c.interceptors, c.log)
+	if c.config.Retry != nil || hasRetryInterceptor(c.interceptors) {
+		// 重试由 RetryPolicy 负责，关闭 fasthttp 内置的幂等请求重试，避免次数叠加
+		c.client.MaxIdemponentCallAttempts = 1
+	}
+	return c
+}
+
+// Get 发送 GET 请求
+func (c *HttpClient) Get(ctx context.Context, path string, query neturl.Values) (*HttpResponse, error) {
+	return c.Do(ctx, &HttpRequest{Method: http.MethodGet, URL: path, Query: query})
+}
+
+// Post 发送 POST 请求
+func (c *HttpClient) Post(ctx context.Context, path, contentType string, body []byte) (*HttpResponse, error) {
+	return c.Do(ctx, &HttpRequest{Method: http.MethodPost, URL: path, Header: map[string]string{"Content-Type": contentType}, Body: body})
+}
+
+// Do 发送请求，成功（2xx）返回响应；非 2xx 同时返回响应与上游错误（见 SendHttpRequest）
+// 请求头只包含客户端默认请求头与 req.Header，不会自动设置 Content-Type
+func (c *HttpClient) Do(ctx context.Context, req *HttpRequest) (*HttpResponse, error) {
+	req = c.prepare(req)
+
 	// 0) 校验 URL 前缀与合法性
-	u, err := neturl.ParseRequestURI(url)
+	u, err := neturl.ParseRequestURI(req.URL)
 	if err != nil {
-		Logger().Error("Invalid URL", zap.Error(err), zap.String("url", url))
+		Logger().Error("Invalid URL", zap.Error(err), zap.String("url", c.log.RedactURL(req.URL)))
 		return nil, NewAppError(CommonError, "invalid url: "+err.Error())
 	}
 	if u.Scheme != "http" && u.Scheme != "https" {
-		Logger().Error("Unsupported URL scheme", zap.String("url", url))
+		Logger().Error("Unsupported URL scheme", zap.String("url", c.log.RedactURL(req.URL)))
 		return nil, NewAppError(CommonError, "unsupported url scheme: "+u.Scheme)
 	}
-	Logger().Info("Send HTTP request", zap.String("method", method), zap.String("url", url))
-	// 1) 从对象池获取 Request/Response
-	req := fasthttp.AcquireRequest()
-	resp := fasthttp.AcquireResponse()
-	// 1.1) 函数结束时释放对象，归还到池中
-	defer fasthttp.ReleaseRequest(req)
-	defer fasthttp.ReleaseResponse(resp)
+	if err := ctx.Err(); err != nil {
+		Logger().Error("HTTP request canceled before sending", zap.Error(err), zap.String("url", c.log.RedactURL(req.URL)))
+		return nil, err
+	}
 
-	// 2) 设置 HTTP 方法与 URL
-	req.Header.SetMethod(method)
-	req.SetRequestURI(url)
+	start := time.Now()
+	resp, err := c.handler(ctx, req)
+	if err != nil {
+		return resp, err
+	}
+	c.logResponse(req, resp, time.Since(start))
 
-	// 3) 设置基础请求头（User-Agent / Content-Type）
-	req.Header.SetContentType("application/json; charset=utf-8")
+	// 7) 非 2xx 返回上游错误（HTTP 状态码与响应体见 HTTPStatusError）
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp, newUpstreamError(resp.StatusCode, resp.Body)
+	}
+	// 8) 返回响应
+	return resp, nil
+}
 
-	// 3.1) 追加自定义请求头（会覆盖基础头）
-	for k, v := range headers {
-		if k == "" {
-			continue
+// logResponse 按状态码对应的级别记录一次请求（含重试），URL、请求头与请求体均已脱敏
+func (c *HttpClient) logResponse(req *HttpRequest, resp *HttpResponse, latency time.Duration) {
+	level := c.log.LevelForStatus(resp.StatusCode)
+	if ce := Logger().Check(level, "HTTP request"); ce != nil {
+		reqHeader := make(http.Header, len(req.Header))
+		for k, v := range req.Header {
+			reqHeader.Set(k, v)
 		}
-		req.Header.Set(k, v)
+		fields := []zap.Field{
+			zap.String("method", req.Method),
+			zap.String("url", c.log.RedactURL(req.URL)),
+			zap.Int("status", resp.StatusCode),
+			zap.Int("attempts", resp.Attempts),
+			zap.Duration("latency", latency),
+		}
+		fields = append(fields, c.log.headerFields(reqHeader, resp.Header)...)
+		fields = append(fields, c.log.bodyFields(req.Body, reqHeader.Get("Content-Type"), resp.Body, resp.Header.Get("Content-Type"))...)
+		ce.Write(fields...)
 	}
+}
 
-	// 4) 写入请求体（可为空）
-	if body != nil {
-		req.SetBodyRaw(body)
-	} else {
-		req.SetBodyRaw([]byte{})
+// prepare 返回拼接了 BaseURL、查询参数与默认请求头的请求副本，不修改调用方的请求与请求头
+func (c *HttpClient) prepare(req *HttpRequest) *HttpRequest {
+	r := *req
+	r.URL = resolveURL(c.config.BaseURL, req.URL, req.Query)
+	r.Query = nil
+	// 总是复制请求头，拦截器可以直接修改
+	r.Header = make(map[string]string, len(c.config.Header)+len(req.Header))
+	for k, v := range c.config.Header {
+		r.Header[k] = v
 	}
+	for k, v := range req.Header {
+		for dk := range c.config.Header {
+			if strings.EqualFold(k, dk) {
+				delete(r.Header, dk)
+			}
+		}
+		r.Header[k] = v
+	}
+	return &r
+}
 
-	// 5) 发送请求（支持超时）
-	if timeout <= 0 {
-		timeout = 5 * time.Second
+// resolveURL 拼接 BaseURL 与路径并追加查询参数，path 为完整 URL 时忽略 BaseURL
+func resolveURL(base, path string, query neturl.Values) string {
+	full := path
+	if base != "" && !strings.HasPrefix(path, "http://") && !strings.HasPrefix(path, "https://") {
+		full = strings.TrimRight(base, "/")
+		if path != "" {
+			full += "/" + strings.TrimLeft(path, "/")
+		}
 	}
-	if err := fasthttp.DoTimeout(req, resp, timeout); err != nil {
-		Logger().Error("HTTP request error", zap.Error(err), zap.String("url", url))
-		return nil, err
+	if len(query) == 0 {
+		return full
 	}
+	u, err := neturl.Parse(full)
+	if err != nil {
+		return full
+	}
+	values := u.Query()
+	for k, vs := range query {
+		for _, v := range vs {
+			values.Add(k, v)
+		}
+	}
+	u.RawQuery = values.Encode()
+	return u.String()
+}
+
+// httpResult fasthttp 调用结果
+type httpResult struct {
+	resp *HttpResponse
+	err  error
+}
+
+// send 使用 fasthttp 发送一次请求，截止时间取单次超时与 ctx 截止时间中较早的一个
+func (c *HttpClient) send(ctx context.Context, r *HttpRequest) (*HttpResponse, error) {
+	deadline, ok := ctx.Deadline()
+	if c.config.Timeout > 0 {
+		if attempt := time.Now().Add(c.config.Timeout); !ok || attempt.Before(deadline) {
+			deadline = attempt
+		}
+	} else if !ok {
+		deadline = time.Now().Add(defaultHttpTimeout)
+	}
+	Logger().Debug("Send HTTP request", zap.String("method", r.Method), zap.String("url", c.log.RedactURL(r.URL)))
+
+	// 请求在独立 goroutine 中执行，由该 goroutine 负责归还 Request/Response，
+	// 这样 ctx 取消时可以立即返回而不会与仍在进行的请求争用对象
+	done := make(chan httpResult, 1)
+	go func() {
+		// 1) 从对象池获取 Request/Response
+		req := fasthttp.AcquireRequest()
+		resp := fasthttp.AcquireResponse()
+		// 1.1) 结束时释放对象，归还到池中；流式响应在 Stream 关闭时释放
+		release := func() {
+			fasthttp.ReleaseRequest(req)
+			fasthttp.ReleaseResponse(resp)
+		}
+
+		// 2) 设置 HTTP 方法与 URL
+		req.Header.SetMethod(r.Method)
+		req.SetRequestURI(r.URL)
+
+		// 3) 设置请求头（默认请求头已在 prepare 中合并），未指定时不发送 Content-Type
+		req.Header.SetNoDefaultContentType(true)
+		for k, v := range r.Header {
+			if k == "" {
+				continue
+			}
+			req.Header.Set(k, v)
+		}
 
-	// 6) 读取状态码并复制响应体（复制后可安全释放 resp）
-	status := resp.StatusCode()
-	respBody := append([]byte(nil), resp.Body()...)
+		// 4) 写入请求体（可为空）
+		switch {
+		case r.BodyReader != nil:
+			size := r.BodySize
+			if size <= 0 {
+				size = -1
+			}
+			req.SetBodyStream(r.BodyReader, int(size))
+		case r.Body != nil:
+			req.SetBodyRaw(r.Body)
+		default:
+			req.SetBodyRaw([]byte{})
+		}
+		resp.StreamBody = r.stream
 
-	// 7) 非 2xx 返回 CodeError（将响应体作为错误消息）
-	if status < 200 || status >= 300 {
-		Logger().Error("HTTP request error", zap.Int("status", status), zap.String("url", url))
-		return nil, NewAppError(status, string(respBody))
+		// 5) 发送请求（截止时间来自 ctx 与单次超时，流式响应体的读取同样受该截止时间限制）
+		if err := c.client.DoDeadline(req, resp, deadline); err != nil {
+			release()
+			done <- httpResult{err: err}
+			return
+		}
+
+		// 6) 读取状态码与响应头并复制响应体（复制后可安全释放 resp）
+		header := make(http.Header)
+		for k, v := range resp.Header.All() {
+			header.Add(string(k), string(v))
+		}
+		result := &HttpResponse{StatusCode: resp.StatusCode(), Header: header, Attempts: 1}
+		switch {
+		case r.stream && result.StatusCode >= 200 && result.StatusCode < 300 && resp.BodyStream() != nil:
+			result.Stream = newResponseStream(ctx, resp.BodyStream(), func() {
+				_ = resp.CloseBodyStream()
+				release()
+			})
+			done <- httpResult{resp: result}
+			return
+		case r.stream && resp.BodyStream() != nil:
+			// 错误响应只读取有限的长度，用于返回错误信息
+			body, _ := io.ReadAll(io.LimitReader(resp.BodyStream(), maxStreamErrorBody))
+			_ = resp.CloseBodyStream()
+			result.Body = body
+		default:
+			result.Body = append([]byte(nil), resp.Body()...)
+		}
+		release()
+		done <- httpResult{resp: result}
+	}()
+
+	select {
+	case <-ctx.Done():
+		Logger().Error("HTTP request canceled", zap.Error(ctx.Err()), zap.String("url", c.log.RedactURL(r.URL)))
+		// 请求可能已经返回了流式响应，关闭它以归还连接
+		go func() {
+			if result := <-done; result.resp != nil && result.resp.Stream != nil {
+				_ = result.resp.Stream.Close()
+			}
+		}()
+		return nil, ctx.Err()
+	case result := <-done:
+		if result.err != nil {
+			Logger().Error("HTTP request error", zap.Error(result.err), zap.String("url", c.log.RedactURL(r.URL)))
+		}
+		return result.resp, result.err
 	}
-	Logger().Info("HTTP request success", zap.Int("status", status), zap.String("url", url), zap.String("body", string(respBody)))
-	// 8) 返回响应体
-	return respBody, nil
 }
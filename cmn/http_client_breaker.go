@@ -0,0 +1,463 @@
+package cmn
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	neturl "net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// CircuitState 熔断器状态
+type CircuitState int
+
+const (
+	CircuitClosed   CircuitState = iota // 正常放行，统计失败率
+	CircuitOpen                         // 熔断中，请求直接失败
+	CircuitHalfOpen                     // 熔断超时后放行少量探测请求
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	default:
+		return fmt.Sprintf("CircuitState(%d)", int(s))
+	}
+}
+
+func (s CircuitState) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + s.String() + `"`), nil
+}
+
+// CircuitOpenError 熔断时返回的 AppError 的 Cause，调用方可据此返回降级响应
+//
+//	var openErr *cmn.CircuitOpenError
+//	if errors.As(err, &openErr) {
+//		cmn.OK(c, cachedResult) // 降级
+//		return
+//	}
+type CircuitOpenError struct {
+	Host       string
+	RetryAfter time.Duration // 距离下一次探测的时间
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("circuit open for %s, retry after %s", e.Host, e.RetryAfter)
+}
+
+// IsCircuitOpen 判断错误是否由熔断导致
+func IsCircuitOpen(err error) bool {
+	var openErr *CircuitOpenError
+	return errors.As(err, &openErr)
+}
+
+// BreakerConfig 熔断器配置
+type BreakerConfig struct {
+	Window       time.Duration // 统计窗口，窗口结束后清零计数，默认 10s
+	MinRequests  int           // 窗口内请求数达到该值才判断失败率，默认 10
+	FailureRatio float64       // 失败率达到该值时熔断，默认 0.5
+	OpenTimeout  time.Duration // 熔断持续时间，之后进入半开状态，默认 30s
+
+	// HalfOpenRequests 半开状态允许的并发探测请求数，全部成功后恢复，默认 1
+	HalfOpenRequests int
+
+	// IsFailure 判断一次请求是否失败，默认网络错误、超时与 5xx 视为失败
+	// 调用方的 ctx 取消或超过截止时间时结果不计入统计，也不会调用 IsFailure
+	IsFailure func(resp *HttpResponse, err error) bool
+
+	// OnStateChange 状态变化回调（已记录日志），可用于告警或指标；在熔断器的锁外调用，可以查询熔断器状态
+	OnStateChange func(host string, from, to CircuitState)
+}
+
+// DefaultBreakerConfig 默认熔断器配置
+func DefaultBreakerConfig() *BreakerConfig {
+	return &BreakerConfig{
+		Window:           10 * time.Second,
+		MinRequests:      10,
+		FailureRatio:     0.5,
+		OpenTimeout:      30 * time.Second,
+		HalfOpenRequests: 1,
+	}
+}
+
+// defaultIsFailure 网络错误、超时与 5xx 视为失败
+func defaultIsFailure(resp *HttpResponse, err error) bool {
+	if err != nil {
+		return !errors.Is(err, context.Canceled)
+	}
+	return resp.StatusCode >= 500
+}
+
+// CircuitBreaker 按主机熔断，同一个熔断器可以被多个 HttpClient 共享
+type CircuitBreaker struct {
+	name   string
+	config BreakerConfig
+
+	mu       sync.Mutex
+	circuits map[string]*circuit
+}
+
+// circuit 单个主机的熔断状态
+type circuit struct {
+	state       CircuitState
+	since       time.Time // 进入当前状态的时间
+	windowStart time.Time
+	requests    int
+	failures    int
+	probes      int // 半开状态下进行中的探测请求
+	successes   int // 半开状态下成功的探测请求
+
+	// generation 状态切换或统计窗口清零时递增，旧放行请求的结果不再计入
+	generation uint64
+}
+
+// admission 一次放行，记录放行时主机的 generation
+type admission struct {
+	host       string
+	generation uint64
+}
+
+// stateChange 在锁内收集的状态变化，解锁后记录日志并回调
+type stateChange struct {
+	host     string
+	from, to CircuitState
+	fields   []zap.Field
+}
+
+var (
+	breakersMu sync.RWMutex
+	breakers   = make(map[string]*CircuitBreaker)
+)
+
+// NewCircuitBreaker 创建熔断器并按名称注册，CircuitStatuses 与 CircuitHealthHandler 会报告它的状态
+// 同名的熔断器会被替换
+//
+//	breaker := cmn.NewCircuitBreaker("llm", cmn.DefaultBreakerConfig())
+//	client := cmn.NewHttpClient(&cmn.HttpClientConfig{Retry: cmn.DefaultRetryPolicy(), Breaker: breaker})
+func NewCircuitBreaker(name string, config *BreakerConfig) *CircuitBreaker {
+	if config == nil {
+		config = DefaultBreakerConfig()
+	}
+	b := &CircuitBreaker{name: name, config: *config, circuits: make(map[string]*circuit)}
+	if b.config.Window <= 0 {
+		b.config.Window = 10 * time.Second
+	}
+	if b.config.MinRequests <= 0 {
+		b.config.MinRequests = 10
+	}
+	if b.config.FailureRatio <= 0 {
+		b.config.FailureRatio = 0.5
+	}
+	if b.config.OpenTimeout <= 0 {
+		b.config.OpenTimeout = 30 * time.Second
+	}
+	if b.config.HalfOpenRequests <= 0 {
+		b.config.HalfOpenRequests = 1
+	}
+	if b.config.IsFailure == nil {
+		b.config.IsFailure = defaultIsFailure
+	}
+
+	breakersMu.Lock()
+	breakers[name] = b
+	breakersMu.Unlock()
+	return b
+}
+
+// Name 熔断器名称
+func (b *CircuitBreaker) Name() string {
+	return b.name
+}
+
+// State 返回主机的当前状态
+func (b *CircuitBreaker) State(host string) CircuitState {
+	b.mu.Lock()
+	c, ok := b.circuits[host]
+	if !ok {
+		b.mu.Unlock()
+		return CircuitClosed
+	}
+	changes := b.refresh(host, c, time.Now(), nil)
+	state := c.state
+	b.mu.Unlock()
+
+	b.notify(changes)
+	return state
+}
+
+// wrap 为 next 增加熔断，放在重试之内，每次尝试都计入统计；log 用于日志中的 URL 脱敏
+func (b *CircuitBreaker) wrap(next HttpHandler, log *HttpLogConfig) HttpHandler {
+	return func(ctx context.Context, req *HttpRequest) (*HttpResponse, error) {
+		a, err := b.allow(requestHost(req.URL))
+		if err != nil {
+			Logger().Warn("HTTP request rejected by circuit breaker",
+				zap.String("breaker", b.name), zap.String("url", log.RedactURL(req.URL)))
+			return nil, err
+		}
+		resp, err := next(ctx, req)
+		if callerDone(ctx) {
+			// 调用方取消或超过截止时间，不代表上游故障
+			b.release(a)
+		} else {
+			b.record(a, resp, err)
+		}
+		return resp, err
+	}
+}
+
+// callerDone 判断调用方的 ctx 是否已取消或已到截止时间
+// 单次请求的截止时间取自 ctx 时，fasthttp 可能先于 ctx 报告超时，因此同时比较截止时间
+func callerDone(ctx context.Context) bool {
+	if ctx.Err() != nil {
+		return true
+	}
+	deadline, ok := ctx.Deadline()
+	return ok && !time.Now().Before(deadline)
+}
+
+// allow 判断是否放行请求，熔断中返回 CodeCircuitOpen
+func (b *CircuitBreaker) allow(host string) (admission, error) {
+	b.mu.Lock()
+	now := time.Now()
+	c, ok := b.circuits[host]
+	if !ok {
+		c = &circuit{state: CircuitClosed, since: now, windowStart: now}
+		b.circuits[host] = c
+	}
+	changes := b.refresh(host, c, now, nil)
+
+	var err error
+	switch c.state {
+	case CircuitOpen:
+		err = b.openError(host, c, now)
+	case CircuitHalfOpen:
+		if c.probes+c.successes >= b.config.HalfOpenRequests {
+			err = b.openError(host, c, now)
+		} else {
+			c.probes++
+		}
+	default:
+		c.requests++
+	}
+	a := admission{host: host, generation: c.generation}
+	b.mu.Unlock()
+
+	b.notify(changes)
+	return a, err
+}
+
+// release 放行的请求不计入统计：closed 状态撤销请求数，半开状态归还探测名额
+func (b *CircuitBreaker) release(a admission) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c := b.circuits[a.host]
+	if c == nil || c.generation != a.generation {
+		return
+	}
+	switch c.state {
+	case CircuitHalfOpen:
+		if c.probes > 0 {
+			c.probes--
+		}
+	case CircuitClosed:
+		if c.requests > 0 {
+			c.requests--
+		}
+	}
+}
+
+// record 记录请求结果并在需要时切换状态；放行后状态已切换或窗口已清零的结果直接丢弃
+func (b *CircuitBreaker) record(a admission, resp *HttpResponse, err error) {
+	if err != nil && errors.Is(err, context.Canceled) {
+		b.release(a)
+		return
+	}
+	failed := b.config.IsFailure(resp, err)
+
+	b.mu.Lock()
+	c := b.circuits[a.host]
+	if c == nil || c.generation != a.generation {
+		b.mu.Unlock()
+		return
+	}
+	now := time.Now()
+
+	var changes []stateChange
+	switch c.state {
+	case CircuitHalfOpen:
+		if c.probes > 0 {
+			c.probes--
+		}
+		if failed {
+			changes = append(changes, b.transition(a.host, c, CircuitOpen, now))
+			break
+		}
+		c.successes++
+		if c.successes >= b.config.HalfOpenRequests {
+			changes = append(changes, b.transition(a.host, c, CircuitClosed, now))
+		}
+	case CircuitClosed:
+		if failed {
+			c.failures++
+		}
+		if c.requests >= b.config.MinRequests &&
+			float64(c.failures)/float64(c.requests) >= b.config.FailureRatio {
+			changes = append(changes, b.transition(a.host, c, CircuitOpen, now))
+		}
+	}
+	b.mu.Unlock()
+
+	b.notify(changes)
+}
+
+// refresh 按时间推进状态：统计窗口到期清零，熔断超时进入半开；调用时需持有 b.mu
+func (b *CircuitBreaker) refresh(host string, c *circuit, now time.Time, changes []stateChange) []stateChange {
+	switch c.state {
+	case CircuitClosed:
+		if now.Sub(c.windowStart) >= b.config.Window {
+			c.windowStart = now
+			c.requests, c.failures = 0, 0
+			c.generation++
+		}
+	case CircuitOpen:
+		if now.Sub(c.since) >= b.config.OpenTimeout {
+			changes = append(changes, b.transition(host, c, CircuitHalfOpen, now))
+		}
+	}
+	return changes
+}
+
+// transition 切换状态并返回状态变化，调用时需持有 b.mu；日志与回调由 notify 在解锁后完成
+func (b *CircuitBreaker) transition(host string, c *circuit, to CircuitState, now time.Time) stateChange {
+	change := stateChange{host: host, from: c.state, to: to}
+	change.fields = []zap.Field{
+		zap.String("breaker", b.name),
+		zap.String("host", host),
+		zap.String("from", change.from.String()),
+		zap.String("to", to.String()),
+	}
+	if to == CircuitOpen && change.from == CircuitClosed {
+		change.fields = append(change.fields, zap.Int("requests", c.requests), zap.Int("failures", c.failures))
+	}
+
+	c.state = to
+	c.since = now
+	c.windowStart = now
+	c.requests, c.failures, c.probes, c.successes = 0, 0, 0, 0
+	c.generation++
+	return change
+}
+
+// notify 记录状态变化日志并调用 OnStateChange，调用时不能持有 b.mu
+func (b *CircuitBreaker) notify(changes []stateChange) {
+	for _, change := range changes {
+		if change.to == CircuitOpen {
+			Logger().Error("Circuit breaker state changed", change.fields...)
+		} else {
+			Logger().Warn("Circuit breaker state changed", change.fields...)
+		}
+		if b.config.OnStateChange != nil {
+			b.config.OnStateChange(change.host, change.from, change.to)
+		}
+	}
+}
+
+// openError 熔断时返回的错误
+func (b *CircuitBreaker) openError(host string, c *circuit, now time.Time) error {
+	retryAfter := max(c.since.Add(b.config.OpenTimeout).Sub(now), 0)
+	return NewCodeError(CodeCircuitOpen).
+		WithDetail("host", host).
+		WithCause(&CircuitOpenError{Host: host, RetryAfter: retryAfter})
+}
+
+// CircuitStatus 单个主机的熔断状态，用于健康检查
+type CircuitStatus struct {
+	Breaker  string       `json:"breaker"`
+	Host     string       `json:"host"`
+	State    CircuitState `json:"state"`
+	Since    time.Time    `json:"since"`
+	Requests int          `json:"requests"` // 当前统计窗口内的请求数
+	Failures int          `json:"failures"` // 当前统计窗口内的失败数
+}
+
+// Status 返回各主机的熔断状态，按主机排序
+func (b *CircuitBreaker) Status() []CircuitStatus {
+	b.mu.Lock()
+	now := time.Now()
+	var changes []stateChange
+	statuses := make([]CircuitStatus, 0, len(b.circuits))
+	for host, c := range b.circuits {
+		changes = b.refresh(host, c, now, changes)
+		statuses = append(statuses, CircuitStatus{
+			Breaker:  b.name,
+			Host:     host,
+			State:    c.state,
+			Since:    c.since,
+			Requests: c.requests,
+			Failures: c.failures,
+		})
+	}
+	b.mu.Unlock()
+
+	b.notify(changes)
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Host < statuses[j].Host })
+	return statuses
+}
+
+// CircuitStatuses 返回所有已注册熔断器的状态，按熔断器名称与主机排序
+func CircuitStatuses() []CircuitStatus {
+	breakersMu.RLock()
+	list := make([]*CircuitBreaker, 0, len(breakers))
+	for _, b := range breakers {
+		list = append(list, b)
+	}
+	breakersMu.RUnlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].name < list[j].name })
+
+	var statuses []CircuitStatus
+	for _, b := range list {
+		statuses = append(statuses, b.Status()...)
+	}
+	return statuses
+}
+
+// CircuitHealthHandler 健康检查处理器，报告所有熔断器的状态
+// 上游熔断不代表本服务不可用，因此总是返回 200，有熔断时 status 为 degraded
+//
+//	router.GET("/health/upstreams", cmn.CircuitHealthHandler())
+func CircuitHealthHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		statuses := CircuitStatuses()
+		status := "ok"
+		for _, s := range statuses {
+			if s.State != CircuitClosed {
+				status = "degraded"
+				break
+			}
+		}
+		if statuses == nil {
+			statuses = []CircuitStatus{}
+		}
+		c.JSON(http.StatusOK, gin.H{"status": status, "circuits": statuses})
+	}
+}
+
+// requestHost 返回 URL 的主机（含端口），解析失败时返回原始 URL
+func requestHost(rawURL string) string {
+	u, err := neturl.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return rawURL
+	}
+	return u.Host
+}
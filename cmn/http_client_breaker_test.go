@@ -0,0 +1,320 @@
+package cmn
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// toggleServer 返回的狀態碼可以在測試中切換
+func toggleServer(status *int32) (*httptest.Server, *int32) {
+	var hits int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.WriteHeader(int(atomic.LoadInt32(status)))
+	}))
+	return server, &hits
+}
+
+func testBreakerConfig() *BreakerConfig {
+	return &BreakerConfig{
+		Window:           time.Minute,
+		MinRequests:      4,
+		FailureRatio:     0.5,
+		OpenTimeout:      50 * time.Millisecond,
+		HalfOpenRequests: 1,
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	t.Run("失敗率達到閾值後熔斷並快速失敗", func(t *testing.T) {
+		status := int32(http.StatusInternalServerError)
+		server, hits := toggleServer(&status)
+		defer server.Close()
+
+		var changes []string
+		config := testBreakerConfig()
+		config.OnStateChange = func(host string, from, to CircuitState) {
+			changes = append(changes, from.String()+"->"+to.String())
+		}
+		breaker := NewCircuitBreaker("test-open", config)
+		client := NewHttpClient(&HttpClientConfig{Breaker: breaker})
+		host := requestHost(server.URL)
+
+		for i := 0; i < 4; i++ {
+			_, err := client.Do(context.Background(), &HttpRequest{Method: http.MethodGet, URL: server.URL})
+			assert.Equal(t, CodeUpstreamUnavailable, ErrorCodeOf(err))
+		}
+		assert.Equal(t, CircuitOpen, breaker.State(host))
+
+		start := time.Now()
+		_, err := client.Do(context.Background(), &HttpRequest{Method: http.MethodGet, URL: server.URL})
+		assert.Less(t, time.Since(start), 20*time.Millisecond)
+		assert.Equal(t, CodeCircuitOpen, ErrorCodeOf(err))
+		assert.True(t, IsCircuitOpen(err))
+		var openErr *CircuitOpenError
+		assert.True(t, errors.As(err, &openErr))
+		assert.Equal(t, host, openErr.Host)
+		assert.Equal(t, http.StatusServiceUnavailable, err.(*AppError).HTTPStatus())
+		assert.Equal(t, int32(4), atomic.LoadInt32(hits))
+		assert.Equal(t, []string{"closed->open"}, changes)
+	})
+
+	t.Run("未達最小請求數不熔斷", func(t *testing.T) {
+		status := int32(http.StatusInternalServerError)
+		server, _ := toggleServer(&status)
+		defer server.Close()
+
+		breaker := NewCircuitBreaker("test-volume", testBreakerConfig())
+		client := NewHttpClient(&HttpClientConfig{Breaker: breaker})
+		for i := 0; i < 3; i++ {
+			_, _ = client.Do(context.Background(), &HttpRequest{Method: http.MethodGet, URL: server.URL})
+		}
+		assert.Equal(t, CircuitClosed, breaker.State(requestHost(server.URL)))
+	})
+
+	t.Run("失敗率低於閾值不熔斷", func(t *testing.T) {
+		status := int32(http.StatusOK)
+		server, _ := toggleServer(&status)
+		defer server.Close()
+
+		breaker := NewCircuitBreaker("test-ratio", testBreakerConfig())
+		client := NewHttpClient(&HttpClientConfig{Breaker: breaker})
+		for i := 0; i < 10; i++ {
+			if i%4 == 0 {
+				atomic.StoreInt32(&status, http.StatusBadGateway)
+			} else {
+				atomic.StoreInt32(&status, http.StatusOK)
+			}
+			_, _ = client.Do(context.Background(), &HttpRequest{Method: http.MethodGet, URL: server.URL})
+		}
+		assert.Equal(t, CircuitClosed, breaker.State(requestHost(server.URL)))
+	})
+
+	t.Run("4xx 不計為失敗", func(t *testing.T) {
+		status := int32(http.StatusNotFound)
+		server, _ := toggleServer(&status)
+		defer server.Close()
+
+		breaker := NewCircuitBreaker("test-4xx", testBreakerConfig())
+		client := NewHttpClient(&HttpClientConfig{Breaker: breaker})
+		for i := 0; i < 6; i++ {
+			_, _ = client.Do(context.Background(), &HttpRequest{Method: http.MethodGet, URL: server.URL})
+		}
+		assert.Equal(t, CircuitClosed, breaker.State(requestHost(server.URL)))
+	})
+
+	t.Run("半開探測成功後恢復", func(t *testing.T) {
+		status := int32(http.StatusServiceUnavailable)
+		server, _ := toggleServer(&status)
+		defer server.Close()
+
+		var changes []string
+		config := testBreakerConfig()
+		config.OnStateChange = func(host string, from, to CircuitState) {
+			changes = append(changes, from.String()+"->"+to.String())
+		}
+		breaker := NewCircuitBreaker("test-recover", config)
+		client := NewHttpClient(&HttpClientConfig{Breaker: breaker})
+		host := requestHost(server.URL)
+		for i := 0; i < 4; i++ {
+			_, _ = client.Do(context.Background(), &HttpRequest{Method: http.MethodGet, URL: server.URL})
+		}
+		assert.Equal(t, CircuitOpen, breaker.State(host))
+
+		time.Sleep(60 * time.Millisecond)
+		assert.Equal(t, CircuitHalfOpen, breaker.State(host))
+
+		atomic.StoreInt32(&status, http.StatusOK)
+		_, err := client.Do(context.Background(), &HttpRequest{Method: http.MethodGet, URL: server.URL})
+		assert.NoError(t, err)
+		assert.Equal(t, CircuitClosed, breaker.State(host))
+		assert.Equal(t, []string{"closed->open", "open->half-open", "half-open->closed"}, changes)
+	})
+
+	t.Run("半開探測失敗後重新熔斷", func(t *testing.T) {
+		status := int32(http.StatusServiceUnavailable)
+		server, hits := toggleServer(&status)
+		defer server.Close()
+
+		breaker := NewCircuitBreaker("test-reopen", testBreakerConfig())
+		client := NewHttpClient(&HttpClientConfig{Breaker: breaker})
+		host := requestHost(server.URL)
+		for i := 0; i < 4; i++ {
+			_, _ = client.Do(context.Background(), &HttpRequest{Method: http.MethodGet, URL: server.URL})
+		}
+		time.Sleep(60 * time.Millisecond)
+
+		_, err := client.Do(context.Background(), &HttpRequest{Method: http.MethodGet, URL: server.URL})
+		assert.Equal(t, CodeUpstreamUnavailable, ErrorCodeOf(err))
+		assert.Equal(t, CircuitOpen, breaker.State(host))
+
+		_, err = client.Do(context.Background(), &HttpRequest{Method: http.MethodGet, URL: server.URL})
+		assert.Equal(t, CodeCircuitOpen, ErrorCodeOf(err))
+		assert.Equal(t, int32(5), atomic.LoadInt32(hits))
+	})
+
+	t.Run("半開狀態只放行有限的探測請求", func(t *testing.T) {
+		breaker := NewCircuitBreaker("test-probes", testBreakerConfig())
+		host := "probe.example.com"
+		for i := 0; i < 4; i++ {
+			a, err := breaker.allow(host)
+			assert.NoError(t, err)
+			breaker.record(a, &HttpResponse{StatusCode: http.StatusBadGateway}, nil)
+		}
+		time.Sleep(60 * time.Millisecond)
+
+		_, err := breaker.allow(host)
+		assert.NoError(t, err)
+		_, err = breaker.allow(host)
+		assert.Equal(t, CodeCircuitOpen, ErrorCodeOf(err))
+	})
+
+	t.Run("按主機獨立熔斷", func(t *testing.T) {
+		breaker := NewCircuitBreaker("test-hosts", testBreakerConfig())
+		for i := 0; i < 4; i++ {
+			a, err := breaker.allow("a.example.com")
+			assert.NoError(t, err)
+			breaker.record(a, nil, errors.New("connection reset"))
+		}
+		assert.Equal(t, CircuitOpen, breaker.State("a.example.com"))
+		assert.Equal(t, CircuitClosed, breaker.State("b.example.com"))
+		_, err := breaker.allow("b.example.com")
+		assert.NoError(t, err)
+	})
+
+	t.Run("調用方取消不計為失敗", func(t *testing.T) {
+		breaker := NewCircuitBreaker("test-canceled", testBreakerConfig())
+		for i := 0; i < 4; i++ {
+			a, err := breaker.allow("c.example.com")
+			assert.NoError(t, err)
+			breaker.record(a, nil, context.Canceled)
+		}
+		assert.Equal(t, CircuitClosed, breaker.State("c.example.com"))
+	})
+
+	t.Run("調用方超時不計為失敗", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(100 * time.Millisecond)
+		}))
+		defer server.Close()
+
+		breaker := NewCircuitBreaker("test-deadline", testBreakerConfig())
+		client := NewHttpClient(&HttpClientConfig{Breaker: breaker})
+		for i := 0; i < 4; i++ {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+			_, err := client.Do(ctx, &HttpRequest{Method: http.MethodGet, URL: server.URL})
+			cancel()
+			assert.Error(t, err)
+		}
+		assert.Equal(t, CircuitClosed, breaker.State(requestHost(server.URL)))
+		statuses := breaker.Status()
+		if !assert.Len(t, statuses, 1) {
+			return
+		}
+		assert.Equal(t, 0, statuses[0].Requests)
+		assert.Equal(t, 0, statuses[0].Failures)
+	})
+
+	t.Run("狀態切換後舊請求的結果不計入", func(t *testing.T) {
+		breaker := NewCircuitBreaker("test-stale", testBreakerConfig())
+		host := "stale.example.com"
+		stale, err := breaker.allow(host)
+		assert.NoError(t, err)
+		for breaker.State(host) == CircuitClosed {
+			a, err := breaker.allow(host)
+			assert.NoError(t, err)
+			breaker.record(a, nil, errors.New("connection reset"))
+		}
+		time.Sleep(60 * time.Millisecond)
+		assert.Equal(t, CircuitHalfOpen, breaker.State(host))
+
+		// 熔斷前放行的請求在半開狀態返回成功，不能當作探測成功
+		breaker.record(stale, &HttpResponse{StatusCode: http.StatusOK}, nil)
+		assert.Equal(t, CircuitHalfOpen, breaker.State(host))
+	})
+
+	t.Run("狀態變化回調可以查詢熔斷器", func(t *testing.T) {
+		config := testBreakerConfig()
+		var breaker *CircuitBreaker
+		var states []CircuitState
+		config.OnStateChange = func(host string, from, to CircuitState) {
+			states = append(states, breaker.State(host))
+		}
+		breaker = NewCircuitBreaker("test-callback", config)
+		host := "callback.example.com"
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for i := 0; i < 4; i++ {
+				a, _ := breaker.allow(host)
+				breaker.record(a, nil, errors.New("connection reset"))
+			}
+		}()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("OnStateChange 在持有鎖時被調用")
+		}
+		assert.Equal(t, []CircuitState{CircuitOpen}, states)
+	})
+
+	t.Run("熔斷時不重試", func(t *testing.T) {
+		status := int32(http.StatusServiceUnavailable)
+		server, hits := toggleServer(&status)
+		defer server.Close()
+
+		config := testBreakerConfig()
+		config.MinRequests = 2
+		breaker := NewCircuitBreaker("test-retry", config)
+		client := NewHttpClient(&HttpClientConfig{Retry: fastRetryPolicy(), Breaker: breaker})
+		_, err := client.Do(context.Background(), &HttpRequest{Method: http.MethodGet, URL: server.URL})
+		// 第 2 次嘗試後熔斷，第 3 次嘗試被熔斷器拒絕
+		assert.Equal(t, CodeCircuitOpen, ErrorCodeOf(err))
+		assert.Equal(t, int32(2), atomic.LoadInt32(hits))
+	})
+}
+
+func TestCircuitHealthHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	breaker := NewCircuitBreaker("test-health", testBreakerConfig())
+	for i := 0; i < 4; i++ {
+		a, _ := breaker.allow("down.example.com")
+		breaker.record(a, &HttpResponse{StatusCode: http.StatusBadGateway}, nil)
+	}
+
+	router := gin.New()
+	router.GET("/health/upstreams", CircuitHealthHandler())
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/health/upstreams", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var body struct {
+		Status   string `json:"status"`
+		Circuits []struct {
+			Breaker string `json:"breaker"`
+			Host    string `json:"host"`
+			State   string `json:"state"`
+		} `json:"circuits"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(t, "degraded", body.Status)
+
+	found := false
+	for _, c := range body.Circuits {
+		if c.Breaker == "test-health" && c.Host == "down.example.com" {
+			found = true
+			assert.Equal(t, "open", c.State)
+		}
+	}
+	assert.True(t, found)
+}
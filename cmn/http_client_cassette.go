@@ -0,0 +1,405 @@
+package cmn
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	neturl "net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"unicode/utf8"
+
+	"go.uber.org/zap"
+)
+
+// CassetteMode 录制/回放模式
+type CassetteMode string
+
+const (
+	CassetteReplay CassetteMode = "replay" // 只回放，不访问网络，找不到匹配的记录时返回 ErrCassetteMiss（默认）
+	CassetteRecord CassetteMode = "record" // 访问真实服务并录制，Save 时覆盖原文件
+	CassetteAuto   CassetteMode = "auto"   // 文件存在时回放，否则录制
+)
+
+// ErrCassetteMiss 回放时找不到匹配的请求记录
+var ErrCassetteMiss = errors.New("cassette: no matching interaction")
+
+// CassetteRequest 录制的请求（已脱敏）
+type CassetteRequest struct {
+	Method   string            `json:"method"`
+	URL      string            `json:"url"`
+	Header   map[string]string `json:"header,omitempty"`
+	Body     string            `json:"body,omitempty"`
+	Encoding string            `json:"encoding,omitempty"` // 非文本请求体为 base64
+}
+
+// CassetteResponse 录制的响应（已脱敏）
+type CassetteResponse struct {
+	StatusCode int         `json:"status"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       string      `json:"body,omitempty"`
+	Encoding   string      `json:"encoding,omitempty"` // 非文本响应体为 base64
+}
+
+// CassetteInteraction 一次请求与响应
+type CassetteInteraction struct {
+	Request  CassetteRequest  `json:"request"`
+	Response CassetteResponse `json:"response"`
+}
+
+// CassetteMatcher 判断录制的请求与实际请求（同样已脱敏）是否匹配
+type CassetteMatcher func(recorded, actual *CassetteRequest) bool
+
+// CassetteConfig 录制/回放配置
+type CassetteConfig struct {
+	Mode CassetteMode // 为空时为 CassetteReplay
+
+	// Match 全部满足时视为匹配，默认 MatchMethod、MatchURL、MatchBody
+	Match []CassetteMatcher
+
+	// AllowRepeat 匹配的记录都已回放过时，重复回放最后一条；默认每条记录只回放一次，
+	// 这样同一请求的多次调用（如重试）按录制顺序返回
+	AllowRepeat bool
+
+	// Scrub 录制时按 RedactHeaders、RedactFields 脱敏 URL 参数、请求头、JSON 与表单字段（不截断），
+	// 为空时使用 DefaultHttpLogConfig；回放前实际请求按同样规则脱敏后再匹配
+	Scrub *HttpLogConfig
+
+	// BeforeSave 写入文件前调用，用于替换 Scrub 无法识别的敏感内容，如 appid、手机号；
+	// 回放时同样作用于实际请求（Response 为空）后再匹配，保证替换后的记录仍能匹配
+	BeforeSave func(interaction *CassetteInteraction)
+}
+
+// Cassette 把出站请求录制到文件并在测试中回放，用于离线运行依赖第三方接口的集成测试
+//
+//	cassette, err := cmn.NewCassette("testdata/wx_login.json", &cmn.CassetteConfig{
+//		Mode: cmn.CassetteMode(os.Getenv("HTTP_CASSETTE")), // 本地设置 HTTP_CASSETTE=record 重新录制，CI 中只回放
+//	})
+//	require.NoError(t, err)
+//	t.Cleanup(func() { require.NoError(t, cassette.Save()) })
+//	client := cmn.NewHttpClient(&cmn.HttpClientConfig{Cassette: cassette})
+type Cassette struct {
+	path   string
+	config CassetteConfig
+	record bool
+
+	mu           sync.Mutex
+	interactions []CassetteInteraction
+	used         []bool
+}
+
+// NewCassette 创建录制/回放器，回放模式下读取 path，文件不存在时返回错误
+func NewCassette(path string, config *CassetteConfig) (*Cassette, error) {
+	c := &Cassette{path: path}
+	if config != nil {
+		c.config = *config
+	}
+	if c.config.Scrub == nil {
+		c.config.Scrub = DefaultHttpLogConfig()
+	}
+	if len(c.config.Match) == 0 {
+		c.config.Match = []CassetteMatcher{MatchMethod, MatchURL, MatchBody}
+	}
+
+	switch c.config.Mode {
+	case CassetteRecord:
+		c.record = true
+	case CassetteAuto:
+		if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+			c.record = true
+		}
+	case "", CassetteReplay:
+	default:
+		return nil, fmt.Errorf("cassette: unknown mode %q", c.config.Mode)
+	}
+	if c.record {
+		return c, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cassette: %w", err)
+	}
+	if err := json.Unmarshal(data, &c.interactions); err != nil {
+		return nil, fmt.Errorf("cassette: parse %s: %w", path, err)
+	}
+	c.used = make([]bool, len(c.interactions))
+	return c, nil
+}
+
+// Recording 是否处于录制模式
+func (c *Cassette) Recording() bool {
+	return c.record
+}
+
+// Interactions 返回已录制或已加载的记录
+func (c *Cassette) Interactions() []CassetteInteraction {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]CassetteInteraction(nil), c.interactions...)
+}
+
+// Save 录制模式下把记录写入文件（自动创建目录），回放模式下不做任何事
+func (c *Cassette) Save() error {
+	if !c.record {
+		return nil
+	}
+	c.mu.Lock()
+	interactions := append([]CassetteInteraction{}, c.interactions...)
+	c.mu.Unlock()
+
+	data, err := json.MarshalIndent(interactions, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), os.ModePerm); err != nil {
+		return err
+	}
+	return os.WriteFile(c.path, append(data, '\n'), 0o644)
+}
+
+// wrap 录制模式下发送请求并保存脱敏后的请求与响应，回放模式下返回匹配的记录，不访问网络
+func (c *Cassette) wrap(next HttpHandler) HttpHandler {
+	return func(ctx context.Context, req *HttpRequest) (*HttpResponse, error) {
+		// 流式请求体读入内存，录制与匹配都需要完整的请求体
+		if req.BodyReader != nil {
+			body, err := io.ReadAll(req.BodyReader)
+			if closer, ok := req.BodyReader.(io.Closer); ok {
+				_ = closer.Close()
+			}
+			if err != nil {
+				return nil, err
+			}
+			r := *req
+			r.Body, r.BodyReader, r.BodySize = body, nil, 0
+			req = &r
+		}
+		if c.record {
+			return c.recordRequest(ctx, req, next)
+		}
+		return c.replay(ctx, req)
+	}
+}
+
+func (c *Cassette) recordRequest(ctx context.Context, req *HttpRequest, next HttpHandler) (*HttpResponse, error) {
+	resp, err := next(ctx, req)
+	if resp == nil {
+		return resp, err
+	}
+	if resp.Stream != nil {
+		body, readErr := io.ReadAll(resp.Stream)
+		_ = resp.Stream.Close()
+		if readErr != nil {
+			return nil, readErr
+		}
+		resp.Body, resp.Stream = nil, newResponseStream(ctx, bytes.NewReader(body), func() {})
+		c.add(req, resp.StatusCode, resp.Header, body)
+		return resp, err
+	}
+	c.add(req, resp.StatusCode, resp.Header, resp.Body)
+	return resp, err
+}
+
+// add 脱敏后保存一条记录
+func (c *Cassette) add(req *HttpRequest, status int, header http.Header, body []byte) {
+	interaction := CassetteInteraction{
+		Request: c.scrubRequest(req),
+		Response: CassetteResponse{
+			StatusCode: status,
+			Header:     c.scrubHeader(header),
+		},
+	}
+	interaction.Response.Body, interaction.Response.Encoding = c.scrubBody(body, header.Get("Content-Type"))
+	if c.config.BeforeSave != nil {
+		c.config.BeforeSave(&interaction)
+	}
+	c.mu.Lock()
+	c.interactions = append(c.interactions, interaction)
+	c.mu.Unlock()
+}
+
+func (c *Cassette) replay(ctx context.Context, req *HttpRequest) (*HttpResponse, error) {
+	actual := c.scrubRequest(req)
+	if c.config.BeforeSave != nil {
+		probe := CassetteInteraction{Request: actual}
+		c.config.BeforeSave(&probe)
+		actual = probe.Request
+	}
+	interaction, ok := c.match(&actual)
+	if !ok {
+		Logger().Error("Cassette miss", zap.String("method", actual.Method), zap.String("url", actual.URL), zap.String("cassette", c.path))
+		return nil, fmt.Errorf("%w: %s %s", ErrCassetteMiss, actual.Method, actual.URL)
+	}
+
+	body, err := decodeCassetteBody(interaction.Response.Body, interaction.Response.Encoding)
+	if err != nil {
+		return nil, fmt.Errorf("cassette: %w", err)
+	}
+	resp := &HttpResponse{
+		StatusCode: interaction.Response.StatusCode,
+		Header:     interaction.Response.Header.Clone(),
+		Attempts:   1,
+	}
+	if resp.Header == nil {
+		resp.Header = make(http.Header)
+	}
+	if req.stream && resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		resp.Stream = newResponseStream(ctx, bytes.NewReader(body), func() {})
+	} else {
+		resp.Body = body
+	}
+	return resp, nil
+}
+
+// match 返回第一条未回放过的匹配记录，AllowRepeat 时全部回放过后返回最后一条
+func (c *Cassette) match(actual *CassetteRequest) (CassetteInteraction, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	last := -1
+	for i := range c.interactions {
+		if !c.matches(&c.interactions[i].Request, actual) {
+			continue
+		}
+		if !c.used[i] {
+			c.used[i] = true
+			return c.interactions[i], true
+		}
+		last = i
+	}
+	if c.config.AllowRepeat && last >= 0 {
+		return c.interactions[last], true
+	}
+	return CassetteInteraction{}, false
+}
+
+func (c *Cassette) matches(recorded, actual *CassetteRequest) bool {
+	for _, match := range c.config.Match {
+		if !match(recorded, actual) {
+			return false
+		}
+	}
+	return true
+}
+
+// scrubRequest 返回脱敏后的请求记录
+func (c *Cassette) scrubRequest(req *HttpRequest) CassetteRequest {
+	header := make(http.Header, len(req.Header))
+	for k, v := range req.Header {
+		header.Set(k, v)
+	}
+	r := CassetteRequest{Method: req.Method, URL: c.config.Scrub.RedactURL(req.URL)}
+	if len(header) > 0 {
+		r.Header = c.config.Scrub.RedactHeader(header)
+	}
+	r.Body, r.Encoding = c.scrubBody(req.Body, header.Get("Content-Type"))
+	return r
+}
+
+// scrubHeader 脱敏响应头
+func (c *Cassette) scrubHeader(header http.Header) http.Header {
+	result := make(http.Header, len(header))
+	for k, v := range c.config.Scrub.RedactHeader(header) {
+		if v == redactedValue {
+			result[k] = []string{v}
+			continue
+		}
+		result[k] = append([]string(nil), header[k]...)
+	}
+	return result
+}
+
+// scrubBody 脱敏 JSON 与表单字段，其它文本原样保存，非文本使用 base64
+func (c *Cassette) scrubBody(body []byte, contentType string) (string, string) {
+	if len(body) == 0 {
+		return "", ""
+	}
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch {
+	case mediaType == "application/x-www-form-urlencoded":
+		return c.config.Scrub.redactValues(string(body)), ""
+	case json.Valid(body):
+		return c.config.Scrub.redactJSON(body), ""
+	case utf8.Valid(body):
+		return string(body), ""
+	default:
+		return base64.StdEncoding.EncodeToString(body), "base64"
+	}
+}
+
+func decodeCassetteBody(body, encoding string) ([]byte, error) {
+	switch encoding {
+	case "":
+		if body == "" {
+			return nil, nil
+		}
+		return []byte(body), nil
+	case "base64":
+		return base64.StdEncoding.DecodeString(body)
+	default:
+		return nil, fmt.Errorf("unknown body encoding %q", encoding)
+	}
+}
+
+// MatchMethod 匹配请求方法
+func MatchMethod(recorded, actual *CassetteRequest) bool {
+	return recorded.Method == actual.Method
+}
+
+// MatchURL 匹配 URL，查询参数不区分顺序
+func MatchURL(recorded, actual *CassetteRequest) bool {
+	return MatchURLIgnoring()(recorded, actual)
+}
+
+// MatchURLIgnoring 匹配 URL，但忽略指定的查询参数（如时间戳、随机数、签名）
+func MatchURLIgnoring(params ...string) CassetteMatcher {
+	return func(recorded, actual *CassetteRequest) bool {
+		r, err1 := neturl.Parse(recorded.URL)
+		a, err2 := neturl.Parse(actual.URL)
+		if err1 != nil || err2 != nil {
+			return recorded.URL == actual.URL
+		}
+		rq, aq := r.Query(), a.Query()
+		for _, p := range params {
+			rq.Del(p)
+			aq.Del(p)
+		}
+		r.RawQuery, a.RawQuery = "", ""
+		return r.String() == a.String() && reflect.DeepEqual(rq, aq)
+	}
+}
+
+// MatchBody 匹配请求体，JSON 按内容比较（忽略字段顺序与空白）
+func MatchBody(recorded, actual *CassetteRequest) bool {
+	if recorded.Body == actual.Body {
+		return true
+	}
+	var r, a interface{}
+	if json.Unmarshal([]byte(recorded.Body), &r) != nil || json.Unmarshal([]byte(actual.Body), &a) != nil {
+		return false
+	}
+	return reflect.DeepEqual(r, a)
+}
+
+// MatchHeader 匹配指定的请求头（已脱敏的请求头只比较是否存在）
+func MatchHeader(names ...string) CassetteMatcher {
+	return func(recorded, actual *CassetteRequest) bool {
+		for _, name := range names {
+			if headerValue(recorded.Header, name) != headerValue(actual.Header, name) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+func headerValue(header map[string]string, name string) string {
+	return header[http.CanonicalHeaderKey(name)]
+}
@@ -0,0 +1,237 @@
+package cmn
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// cassetteServer 返回 WeChat 風格的 JSON，按請求次數遞增 openid
+func cassetteServer(t *testing.T) (*httptest.Server, *int32) {
+	var hits int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&hits, 1)
+		switch r.URL.Path {
+		case "/events":
+			w.Header().Set("Content-Type", "text/event-stream")
+			_, _ = io.WriteString(w, "data: hello\n\ndata: [DONE]\n\n")
+		case "/image":
+			w.Header().Set("Content-Type", "image/png")
+			_, _ = w.Write([]byte{0x89, 'P', 'N', 'G', 0xff})
+		default:
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Set-Cookie", "sid=s1")
+			_, _ = io.WriteString(w, `{"openid":"o`+string(rune('0'+n))+`","session_key":"real-session-key"}`)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, &hits
+}
+
+func TestCassette(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("錄製後回放，不訪問網絡且已脫敏", func(t *testing.T) {
+		server, hits := cassetteServer(t)
+		path := filepath.Join(t.TempDir(), "testdata", "wx.json")
+
+		recorder, err := NewCassette(path, &CassetteConfig{Mode: CassetteRecord})
+		if !assert.NoError(t, err) {
+			return
+		}
+		client := NewHttpClient(&HttpClientConfig{Cassette: recorder, Header: map[string]string{"Authorization": "Bearer t1"}})
+		resp, err := client.Get(ctx, server.URL+"/sns/jscode2session?appid=wx1&secret=app-secret&js_code=c1", nil)
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Equal(t, `{"openid":"o1","session_key":"real-session-key"}`, string(resp.Body), "錄製時返回真實響應")
+		assert.NoError(t, recorder.Save())
+
+		data, err := os.ReadFile(path)
+		if !assert.NoError(t, err) {
+			return
+		}
+		for _, secret := range []string{"app-secret", "real-session-key", "Bearer t1", "sid=s1"} {
+			assert.NotContains(t, string(data), secret)
+		}
+
+		player, err := NewCassette(path, nil)
+		if !assert.NoError(t, err) {
+			return
+		}
+		client = NewHttpClient(&HttpClientConfig{Cassette: player, Header: map[string]string{"Authorization": "Bearer t2"}})
+		resp, err = client.Get(ctx, server.URL+"/sns/jscode2session?js_code=c1&secret=other-secret&appid=wx1", nil)
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Equal(t, `{"openid":"o1","session_key":"[REDACTED]"}`, string(resp.Body))
+		assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+		assert.Equal(t, int32(1), atomic.LoadInt32(hits), "回放不訪問網絡")
+	})
+
+	t.Run("找不到匹配記錄時返回 ErrCassetteMiss", func(t *testing.T) {
+		player := replayCassette(t, CassetteInteraction{
+			Request:  CassetteRequest{Method: http.MethodGet, URL: "https://api.example.com/a"},
+			Response: CassetteResponse{StatusCode: 200},
+		})
+		client := NewHttpClient(&HttpClientConfig{Cassette: player, Retry: fastRetryPolicy()})
+		_, err := client.Get(ctx, "https://api.example.com/b", nil)
+		assert.True(t, errors.Is(err, ErrCassetteMiss))
+		_, err = client.Post(ctx, "https://api.example.com/a", "", nil)
+		assert.True(t, errors.Is(err, ErrCassetteMiss), "方法不同")
+	})
+
+	t.Run("同一請求按錄製順序回放，回放完後不再匹配", func(t *testing.T) {
+		request := CassetteRequest{Method: http.MethodGet, URL: "https://api.example.com/token"}
+		player := replayCassette(t,
+			CassetteInteraction{Request: request, Response: CassetteResponse{StatusCode: 503}},
+			CassetteInteraction{Request: request, Response: CassetteResponse{StatusCode: 200, Body: "ok"}},
+		)
+		client := NewHttpClient(&HttpClientConfig{Cassette: player, Retry: fastRetryPolicy()})
+		resp, err := client.Get(ctx, "https://api.example.com/token", nil)
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Equal(t, "ok", string(resp.Body))
+		assert.Equal(t, 2, resp.Attempts, "重試時回放下一條記錄")
+
+		_, err = client.Get(ctx, "https://api.example.com/token", nil)
+		assert.True(t, errors.Is(err, ErrCassetteMiss))
+	})
+
+	t.Run("AllowRepeat 時重複回放最後一條", func(t *testing.T) {
+		player := replayCassette(t, CassetteInteraction{
+			Request:  CassetteRequest{Method: http.MethodGet, URL: "https://api.example.com/token"},
+			Response: CassetteResponse{StatusCode: 200, Body: "ok"},
+		})
+		player.config.AllowRepeat = true
+		client := NewHttpClient(&HttpClientConfig{Cassette: player})
+		for i := 0; i < 3; i++ {
+			resp, err := client.Get(ctx, "https://api.example.com/token", nil)
+			if assert.NoError(t, err) {
+				assert.Equal(t, "ok", string(resp.Body))
+			}
+		}
+	})
+
+	t.Run("JSON 請求體按內容匹配，可忽略指定的查詢參數", func(t *testing.T) {
+		player := replayCassette(t, CassetteInteraction{
+			Request: CassetteRequest{
+				Method: http.MethodPost,
+				URL:    "https://api.example.com/pay?nonce=n1&ts=1&mchid=m1",
+				Body:   `{"amount":100,"password":"[REDACTED]"}`,
+			},
+			Response: CassetteResponse{StatusCode: 200, Body: `{"status":0}`},
+		})
+		player.config.Match = []CassetteMatcher{MatchMethod, MatchURLIgnoring("nonce", "ts"), MatchBody}
+		client := NewHttpClient(&HttpClientConfig{Cassette: player})
+		resp, err := client.Post(ctx, "https://api.example.com/pay?mchid=m1&ts=2&nonce=n2", "application/json", []byte(`{ "password": "p2", "amount": 100 }`))
+		if assert.NoError(t, err) {
+			assert.Equal(t, `{"status":0}`, string(resp.Body))
+		}
+	})
+
+	t.Run("BeforeSave 替換的內容回放時仍能匹配", func(t *testing.T) {
+		server, hits := cassetteServer(t)
+		path := filepath.Join(t.TempDir(), "wx.json")
+		config := &CassetteConfig{
+			Mode: CassetteRecord,
+			BeforeSave: func(interaction *CassetteInteraction) {
+				interaction.Request.URL = strings.ReplaceAll(interaction.Request.URL, "wx-real-appid", "wx-appid")
+				interaction.Request.Body = strings.ReplaceAll(interaction.Request.Body, "13800138000", "1380000****")
+			},
+		}
+		recorder, err := NewCassette(path, config)
+		if !assert.NoError(t, err) {
+			return
+		}
+		client := NewHttpClient(&HttpClientConfig{Cassette: recorder})
+		_, err = client.Post(ctx, server.URL+"/bind?appid=wx-real-appid", "application/json", []byte(`{"phone":"13800138000"}`))
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.NoError(t, recorder.Save())
+		data, err := os.ReadFile(path)
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.NotContains(t, string(data), "wx-real-appid")
+		assert.NotContains(t, string(data), "13800138000")
+
+		config.Mode = CassetteReplay
+		player, err := NewCassette(path, config)
+		if !assert.NoError(t, err) {
+			return
+		}
+		client = NewHttpClient(&HttpClientConfig{Cassette: player})
+		resp, err := client.Post(ctx, server.URL+"/bind?appid=wx-real-appid", "application/json", []byte(`{"phone":"13800138000"}`))
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Equal(t, `{"openid":"o1","session_key":"[REDACTED]"}`, string(resp.Body))
+		assert.Equal(t, int32(1), atomic.LoadInt32(hits), "回放不訪問網絡")
+	})
+
+	t.Run("錄製並回放 SSE 流式響應與二進制響應", func(t *testing.T) {
+		server, hits := cassetteServer(t)
+		path := filepath.Join(t.TempDir(), "stream.json")
+
+		for i := 0; i < 2; i++ {
+			cassette, err := NewCassette(path, &CassetteConfig{Mode: CassetteAuto})
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.Equal(t, i == 0, cassette.Recording(), "文件不存在時錄製，存在時回放")
+			client := NewHttpClient(&HttpClientConfig{Cassette: cassette, BaseURL: server.URL})
+
+			var data []string
+			for event, err := range client.Events(ctx, &HttpRequest{Method: http.MethodPost, URL: "/events", Body: []byte(`{"stream":true}`)}) {
+				if !assert.NoError(t, err) {
+					break
+				}
+				data = append(data, event.Data)
+			}
+			assert.Equal(t, []string{"hello", "[DONE]"}, data)
+
+			resp, err := client.Get(ctx, "/image", nil)
+			if assert.NoError(t, err) {
+				assert.Equal(t, []byte{0x89, 'P', 'N', 'G', 0xff}, resp.Body)
+			}
+			assert.NoError(t, cassette.Save())
+		}
+		assert.Equal(t, int32(2), atomic.LoadInt32(hits), "第二次從文件回放")
+	})
+
+	t.Run("回放模式下文件不存在時返回錯誤", func(t *testing.T) {
+		_, err := NewCassette(filepath.Join(t.TempDir(), "missing.json"), nil)
+		assert.Error(t, err)
+		_, err = NewCassette("x.json", &CassetteConfig{Mode: "replay-all"})
+		assert.Error(t, err)
+	})
+}
+
+// replayCassette 把記錄寫入臨時文件後以回放模式加載
+func replayCassette(t *testing.T, interactions ...CassetteInteraction) *Cassette {
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	recorder, err := NewCassette(path, &CassetteConfig{Mode: CassetteRecord})
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	recorder.interactions = interactions
+	assert.NoError(t, recorder.Save())
+
+	player, err := NewCassette(path, nil)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	return player
+}
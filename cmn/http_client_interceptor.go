@@ -0,0 +1,207 @@
+package cmn
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 内置拦截器的默认优先级，数值越小越靠外层（越先执行），相同优先级保持配置顺序
+const (
+	PriorityHttpRequestID = 100
+	PriorityHttpAuth      = 200
+	PriorityHttpMetrics   = 300 // 在重试之外，一次调用（含重试）记录一次
+	PriorityHttpRetry     = 400
+	PriorityHttpDefault   = 1000 // 自定义拦截器默认在重试之内，每次尝试都会执行（如签名）
+)
+
+// HttpInterceptorFunc 拦截器函数，调用 next 继续执行，不调用时直接返回结果
+// req 是本次调用的副本，可以直接修改 Header 等字段
+type HttpInterceptorFunc func(ctx context.Context, req *HttpRequest, next HttpHandler) (*HttpResponse, error)
+
+// HttpInterceptor 出站请求拦截器，按 Priority 组成执行链，包裹在 HttpClientConfig 的重试、熔断之外
+//
+//	client := cmn.NewHttpClient(&cmn.HttpClientConfig{
+//		BaseURL: "https://api.example.com",
+//		Interceptors: []cmn.HttpInterceptor{
+//			cmn.WithRequestID(),
+//			cmn.WithBearerToken(token),
+//			cmn.WithRetry(cmn.DefaultRetryPolicy()),
+//			{Name: "sign", Handle: signRequest}, // 默认优先级，在重试之内
+//		},
+//	})
+type HttpInterceptor struct {
+	Name     string // 名称，用于 HttpClient.Interceptors 查看执行链
+	Priority int    // 优先级，越小越靠外层；为 0 时使用 PriorityHttpDefault
+	Handle   HttpInterceptorFunc
+
+	// wrap 需要客户端日志配置的内置拦截器（如重试）使用，设置后忽略 Handle
+	wrap func(next HttpHandler, log *HttpLogConfig) HttpHandler
+}
+
+// sortInterceptors 返回按优先级排序的拦截器，不修改原切片
+func sortInterceptors(interceptors []HttpInterceptor) []HttpInterceptor {
+	chain := make([]HttpInterceptor, len(interceptors))
+	copy(chain, interceptors)
+	for i := range chain {
+		if chain[i].Priority == 0 {
+			chain[i].Priority = PriorityHttpDefault
+		}
+	}
+	sort.SliceStable(chain, func(i, j int) bool {
+		return chain[i].Priority < chain[j].Priority
+	})
+	return chain
+}
+
+// wrapInterceptors 由内向外包裹拦截器，chain 已排序
+func wrapInterceptors(handler HttpHandler, chain []HttpInterceptor, log *HttpLogConfig) HttpHandler {
+	for i := len(chain) - 1; i >= 0; i-- {
+		interceptor, next := chain[i], handler
+		switch {
+		case interceptor.wrap != nil:
+			handler = interceptor.wrap(next, log)
+		case interceptor.Handle != nil:
+			handler = func(ctx context.Context, req *HttpRequest) (*HttpResponse, error) {
+				return interceptor.Handle(ctx, req, next)
+			}
+		}
+	}
+	return handler
+}
+
+// Interceptors 返回排序后的拦截器执行链（由外到内）
+func (c *HttpClient) Interceptors() []MiddlewareInfo {
+	infos := make([]MiddlewareInfo, 0, len(c.interceptors))
+	for i, interceptor := range c.interceptors {
+		infos = append(infos, MiddlewareInfo{Index: i, Name: interceptor.Name, Priority: interceptor.Priority})
+	}
+	return infos
+}
+
+// setHeader 设置请求头，替换不同大小写的同名请求头
+func setHeader(header map[string]string, name, value string) {
+	for k := range header {
+		if strings.EqualFold(k, name) {
+			delete(header, k)
+		}
+	}
+	header[name] = value
+}
+
+// WithBearerToken 设置 Authorization: Bearer <token>，请求已指定 Authorization 时不覆盖
+func WithBearerToken(token string) HttpInterceptor {
+	return WithBearerTokenFunc(func(context.Context) (string, error) {
+		return token, nil
+	})
+}
+
+// WithBearerTokenFunc 每次尝试前获取 token 后设置 Authorization，用于会过期、需要刷新的 token；
+// 获取失败时不发送请求并返回该错误
+func WithBearerTokenFunc(token func(ctx context.Context) (string, error)) HttpInterceptor {
+	return HttpInterceptor{
+		Name:     "bearer_token",
+		Priority: PriorityHttpAuth,
+		Handle: func(ctx context.Context, req *HttpRequest, next HttpHandler) (*HttpResponse, error) {
+			if hasHeader(req.Header, "Authorization") {
+				return next(ctx, req)
+			}
+			t, err := token(ctx)
+			if err != nil {
+				return nil, err
+			}
+			setHeader(req.Header, "Authorization", "Bearer "+t)
+			return next(ctx, req)
+		},
+	}
+}
+
+type requestIDContextKey struct{}
+
+// ContextWithRequestID 把请求 ID 放入 context，请求 ID 中间件会自动放入请求的 context
+func ContextWithRequestID(ctx context.Context, requestId string) context.Context {
+	return context.WithValue(ctx, requestIDContextKey{}, requestId)
+}
+
+// RequestIDFromContext 从 context 获取请求 ID，同时支持直接传入 *gin.Context
+func RequestIDFromContext(ctx context.Context) (string, bool) {
+	if requestId, ok := ctx.Value(requestIDContextKey{}).(string); ok && requestId != "" {
+		return requestId, true
+	}
+	requestId, ok := ctx.Value("request_id").(string)
+	return requestId, ok && requestId != ""
+}
+
+// WithRequestID 把 context 中的请求 ID 通过 X-Request-ID 传给下游，没有时生成新的 ID，
+// 同一次调用的多次重试使用相同的 ID
+func WithRequestID() HttpInterceptor {
+	return HttpInterceptor{
+		Name:     "request_id",
+		Priority: PriorityHttpRequestID,
+		Handle: func(ctx context.Context, req *HttpRequest, next HttpHandler) (*HttpResponse, error) {
+			if !hasHeader(req.Header, RequestIDHeader) {
+				requestId, ok := RequestIDFromContext(ctx)
+				if !ok {
+					requestId = newRequestId()
+				}
+				setHeader(req.Header, RequestIDHeader, requestId)
+			}
+			return next(ctx, req)
+		},
+	}
+}
+
+// HttpMetric 一次出站调用（含重试）的指标
+type HttpMetric struct {
+	Method     string
+	Host       string
+	StatusCode int // 没有响应（网络错误、超时、熔断）时为 0
+	Attempts   int
+	Latency    time.Duration
+	Err        error // 网络错误、超时等；非 2xx 响应不是错误，见 StatusCode
+}
+
+// WithMetrics 每次调用结束后调用 observe，用于上报 Prometheus 等监控系统；observe 应尽快返回
+func WithMetrics(observe func(metric HttpMetric)) HttpInterceptor {
+	return HttpInterceptor{
+		Name:     "metrics",
+		Priority: PriorityHttpMetrics,
+		Handle: func(ctx context.Context, req *HttpRequest, next HttpHandler) (*HttpResponse, error) {
+			start := time.Now()
+			resp, err := next(ctx, req)
+			metric := HttpMetric{
+				Method:  req.Method,
+				Host:    requestHost(req.URL),
+				Latency: time.Since(start),
+				Err:     err,
+			}
+			if resp != nil {
+				metric.StatusCode = resp.StatusCode
+				metric.Attempts = resp.Attempts
+			}
+			observe(metric)
+			return resp, err
+		},
+	}
+}
+
+// WithRetry 按策略重试，与 HttpClientConfig.Retry 相同，但可以通过优先级调整与其它拦截器的顺序；
+// 两者不要同时使用，否则重试次数叠加
+func WithRetry(policy *RetryPolicy) HttpInterceptor {
+	return HttpInterceptor{
+		Name:     "retry",
+		Priority: PriorityHttpRetry,
+		wrap:     policy.wrap,
+	}
+}
+
+// hasRetryInterceptor 判断拦截器中是否包含 WithRetry
+func hasRetryInterceptor(interceptors []HttpInterceptor) bool {
+	for _, interceptor := range interceptors {
+		if interceptor.wrap != nil && interceptor.Name == "retry" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,182 @@
+package cmn
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// headerServer 記錄每次請求的請求頭，前 failures 次返回 503
+func headerServer(t *testing.T, failures int32) (*httptest.Server, func() []http.Header) {
+	var (
+		mu      sync.Mutex
+		headers []http.Header
+		hits    int32
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		headers = append(headers, r.Header.Clone())
+		mu.Unlock()
+		if atomic.AddInt32(&hits, 1) <= failures {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+	return server, func() []http.Header {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]http.Header(nil), headers...)
+	}
+}
+
+func TestHttpInterceptors(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("按優先級由外到內執行，相同優先級保持配置順序", func(t *testing.T) {
+		server, _ := headerServer(t, 0)
+		var order []string
+		trace := func(name string) HttpInterceptorFunc {
+			return func(ctx context.Context, req *HttpRequest, next HttpHandler) (*HttpResponse, error) {
+				order = append(order, name)
+				return next(ctx, req)
+			}
+		}
+		client := NewHttpClient(&HttpClientConfig{Interceptors: []HttpInterceptor{
+			{Name: "sign", Handle: trace("sign")},
+			{Name: "trace", Handle: trace("trace")},
+			{Name: "auth", Priority: PriorityHttpAuth, Handle: trace("auth")},
+		}})
+		_, err := client.Get(ctx, server.URL, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"auth", "sign", "trace"}, order)
+		assert.Equal(t, []MiddlewareInfo{
+			{Index: 0, Name: "auth", Priority: PriorityHttpAuth},
+			{Index: 1, Name: "sign", Priority: PriorityHttpDefault},
+			{Index: 2, Name: "trace", Priority: PriorityHttpDefault},
+		}, client.Interceptors())
+	})
+
+	t.Run("攔截器可以直接返回而不發送請求", func(t *testing.T) {
+		server, headers := headerServer(t, 0)
+		client := NewHttpClient(&HttpClientConfig{Interceptors: []HttpInterceptor{{
+			Name: "cache",
+			Handle: func(ctx context.Context, req *HttpRequest, next HttpHandler) (*HttpResponse, error) {
+				return &HttpResponse{StatusCode: http.StatusOK, Header: http.Header{}, Body: []byte("cached")}, nil
+			},
+		}}})
+		resp, err := client.Get(ctx, server.URL, nil)
+		if assert.NoError(t, err) {
+			assert.Equal(t, "cached", string(resp.Body))
+		}
+		assert.Empty(t, headers())
+	})
+
+	t.Run("WithBearerToken 不覆蓋請求指定的 Authorization，且不修改調用方的請求頭", func(t *testing.T) {
+		server, headers := headerServer(t, 0)
+		client := NewHttpClient(&HttpClientConfig{Interceptors: []HttpInterceptor{WithBearerToken("t1")}})
+		_, err := client.Get(ctx, server.URL, nil)
+		assert.NoError(t, err)
+
+		header := map[string]string{"authorization": "Basic b1"}
+		_, err = client.Do(ctx, &HttpRequest{Method: http.MethodGet, URL: server.URL, Header: header})
+		assert.NoError(t, err)
+
+		got := headers()
+		assert.Equal(t, "Bearer t1", got[0].Get("Authorization"))
+		assert.Equal(t, "Basic b1", got[1].Get("Authorization"))
+		assert.Equal(t, map[string]string{"authorization": "Basic b1"}, header)
+	})
+
+	t.Run("WithBearerTokenFunc 獲取失敗時不發送請求", func(t *testing.T) {
+		server, headers := headerServer(t, 0)
+		tokenErr := errors.New("token expired")
+		client := NewHttpClient(&HttpClientConfig{Interceptors: []HttpInterceptor{
+			WithBearerTokenFunc(func(context.Context) (string, error) { return "", tokenErr }),
+		}})
+		_, err := client.Get(ctx, server.URL, nil)
+		assert.ErrorIs(t, err, tokenErr)
+		assert.Empty(t, headers())
+	})
+
+	t.Run("WithRequestID 傳遞請求 ID，重試時保持不變", func(t *testing.T) {
+		server, headers := headerServer(t, 1)
+		client := NewHttpClient(&HttpClientConfig{Interceptors: []HttpInterceptor{
+			WithRequestID(),
+			WithRetry(fastRetryPolicy()),
+		}})
+		_, err := client.Get(ContextWithRequestID(ctx, "req-1"), server.URL, nil)
+		assert.NoError(t, err)
+		_, err = client.Get(ctx, server.URL, nil)
+		assert.NoError(t, err)
+
+		got := headers()
+		if assert.Len(t, got, 3) {
+			assert.Equal(t, "req-1", got[0].Get(RequestIDHeader))
+			assert.Equal(t, "req-1", got[1].Get(RequestIDHeader))
+			assert.Len(t, got[2].Get(RequestIDHeader), 32, "沒有請求 ID 時生成")
+		}
+	})
+
+	t.Run("WithRequestID 沿用入站請求的 ID（gin.Context 或請求的 context）", func(t *testing.T) {
+		gin.SetMode(gin.TestMode)
+		server, headers := headerServer(t, 0)
+		client := NewHttpClient(&HttpClientConfig{Interceptors: []HttpInterceptor{WithRequestID()}})
+
+		router := gin.New()
+		router.Use(RequestIDMiddleware())
+		router.GET("/gin", func(c *gin.Context) {
+			_, _ = client.Get(c, server.URL, nil)
+		})
+		router.GET("/request", func(c *gin.Context) {
+			_, _ = client.Get(c.Request.Context(), server.URL, nil)
+		})
+		for _, path := range []string{"/gin", "/request"} {
+			req := httptest.NewRequest(http.MethodGet, path, nil)
+			req.Header.Set(RequestIDHeader, "in"+path)
+			router.ServeHTTP(httptest.NewRecorder(), req)
+		}
+
+		got := headers()
+		if assert.Len(t, got, 2) {
+			assert.Equal(t, "in/gin", got[0].Get(RequestIDHeader))
+			assert.Equal(t, "in/request", got[1].Get(RequestIDHeader))
+		}
+	})
+
+	t.Run("WithMetrics 在重試之外記錄一次，簽名攔截器每次嘗試都執行", func(t *testing.T) {
+		server, headers := headerServer(t, 2)
+		var metrics []HttpMetric
+		var signed int32
+		client := NewHttpClient(&HttpClientConfig{Interceptors: []HttpInterceptor{
+			{Name: "sign", Handle: func(ctx context.Context, req *HttpRequest, next HttpHandler) (*HttpResponse, error) {
+				setHeader(req.Header, "X-Signature", string(rune('0'+atomic.AddInt32(&signed, 1))))
+				return next(ctx, req)
+			}},
+			WithRetry(fastRetryPolicy()),
+			WithMetrics(func(m HttpMetric) { metrics = append(metrics, m) }),
+		}})
+		_, err := client.Get(ctx, server.URL+"/items", nil)
+		assert.NoError(t, err)
+
+		if assert.Len(t, metrics, 1) {
+			assert.Equal(t, http.MethodGet, metrics[0].Method)
+			assert.Equal(t, requestHost(server.URL), metrics[0].Host)
+			assert.Equal(t, http.StatusOK, metrics[0].StatusCode)
+			assert.Equal(t, 3, metrics[0].Attempts)
+			assert.NoError(t, metrics[0].Err)
+		}
+		got := headers()
+		if assert.Len(t, got, 3) {
+			assert.Equal(t, "3", got[2].Get("X-Signature"))
+		}
+	})
+}
@@ -0,0 +1,110 @@
+package cmn
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	neturl "net/url"
+)
+
+// GetJSON 发送 GET 请求并把响应体解码为 T，client 为空时使用默认客户端
+//
+//	type Item struct{ Id int64 `json:"id"` }
+//	items, err := cmn.GetJSON[[]Item](ctx, client, "/items", url.Values{"page": {"1"}})
+func GetJSON[T any](ctx context.Context, client *HttpClient, path string, query neturl.Values) (T, error) {
+	return DoJSON[T](ctx, client, &HttpRequest{Method: http.MethodGet, URL: path, Query: query})
+}
+
+// PostJSON 把 body 编码为 JSON 发送 POST 请求，并把响应体解码为 Resp
+//
+//	reply, err := cmn.PostJSON[CreateItemReq, Item](ctx, client, "/items", CreateItemReq{Name: "a"})
+func PostJSON[Req, Resp any](ctx context.Context, client *HttpClient, path string, body Req) (Resp, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		var zero Resp
+		return zero, WrapError(CodeInternal, err)
+	}
+	return DoJSON[Resp](ctx, client, &HttpRequest{
+		Method: http.MethodPost,
+		URL:    path,
+		Header: map[string]string{"Content-Type": jsonContentType},
+		Body:   data,
+	})
+}
+
+// DoJSON 发送请求并把响应体解码为 T（未指定 Accept 时设置为 application/json）
+// 非 2xx 响应返回上游错误（见 SendHttpRequest），响应体符合 ReplyProto 时上游的 status、msg、data 放入 Details；
+// 2xx 响应只有在 HttpClientConfig.ReplyProto 开启时才按 ReplyProto 判断错误
+func DoJSON[T any](ctx context.Context, client *HttpClient, req *HttpRequest) (T, error) {
+	var v T
+	if client == nil {
+		client = defaultHttpClient
+	}
+	r := *req
+	if !hasHeader(r.Header, "Accept") && !hasHeader(client.config.Header, "Accept") {
+		r.Header = make(map[string]string, len(req.Header)+1)
+		for k, val := range req.Header {
+			r.Header[k] = val
+		}
+		r.Header["Accept"] = "application/json"
+	}
+
+	resp, err := client.Do(ctx, &r)
+	if resp == nil {
+		return v, err
+	}
+	var statusErr *HTTPStatusError
+	if errors.As(err, &statusErr) || client.config.ReplyProto {
+		if replyErr := replyProtoError(resp, err); replyErr != nil {
+			return v, replyErr
+		}
+	}
+	if err != nil {
+		return v, err
+	}
+	if len(resp.Body) == 0 {
+		return v, nil
+	}
+	if err := json.Unmarshal(resp.Body, &v); err != nil {
+		return v, NewAppError(CodeUpstreamRejected, "上游响应不是合法的 JSON").
+			WithDetail("status", resp.StatusCode).
+			WithCause(err)
+	}
+	return v, nil
+}
+
+// replyProtoError 响应体为 status 不为 0 的 ReplyProto 时返回上游错误，
+// 上游的错误码只放入 Details（upstreamStatus、upstreamMsg、upstreamData），不作为本服务的错误码；
+// 5xx 与 429 仍为可重试的 CodeUpstreamUnavailable，其余为 CodeUpstreamRejected
+// cause 为非 2xx 时的上游错误，可通过 errors.As 取得 *HTTPStatusError
+func replyProtoError(resp *HttpResponse, cause error) *AppError {
+	reply, ok := parseReplyProto(resp.Body)
+	if !ok || reply.Status == Success {
+		return nil
+	}
+	code := CodeUpstreamRejected
+	if ErrorCodeOf(cause) == CodeUpstreamUnavailable {
+		code = CodeUpstreamUnavailable
+	}
+	appErr := NewCodeError(code).
+		WithDetail("status", resp.StatusCode).
+		WithDetail("upstreamStatus", reply.Status).
+		WithDetail("upstreamMsg", reply.Msg)
+	var data map[string]interface{}
+	if len(reply.Data) > 0 && json.Unmarshal(reply.Data, &data) == nil {
+		appErr.WithDetail("upstreamData", data)
+	}
+	appErr.Cause = cause
+	return appErr
+}
+
+// hasHeader 判断是否设置了请求头（不区分大小写）
+func hasHeader(header map[string]string, name string) bool {
+	for k := range header {
+		if http.CanonicalHeaderKey(k) == http.CanonicalHeaderKey(name) {
+			return true
+		}
+	}
+	return false
+}
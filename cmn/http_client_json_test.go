@@ -0,0 +1,257 @@
+package cmn
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	neturl "net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type jsonTestItem struct {
+	Id   int64  `json:"id"`
+	Name string `json:"name"`
+}
+
+// echoServer 以 JSON 返回收到的請求
+func echoServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"method":        r.Method,
+			"path":          r.URL.Path,
+			"query":         r.URL.RawQuery,
+			"contentType":   r.Header.Get("Content-Type"),
+			"accept":        r.Header.Get("Accept"),
+			"authorization": r.Header.Get("Authorization"),
+			"body":          string(body),
+		})
+	}))
+}
+
+type echoReply struct {
+	Method        string `json:"method"`
+	Path          string `json:"path"`
+	Query         string `json:"query"`
+	ContentType   string `json:"contentType"`
+	Accept        string `json:"accept"`
+	Authorization string `json:"authorization"`
+	Body          string `json:"body"`
+}
+
+func TestHttpClientRequest(t *testing.T) {
+	server := echoServer()
+	defer server.Close()
+
+	client := NewHttpClient(&HttpClientConfig{
+		BaseURL: server.URL + "/api/v1/",
+		Header:  map[string]string{"Authorization": "Bearer default", "Accept": "text/plain"},
+	})
+
+	t.Run("拼接 BaseURL、查詢參數與默認請求頭", func(t *testing.T) {
+		resp, err := client.Get(context.Background(), "/items", neturl.Values{"page": {"2"}, "q": {"a b"}})
+		assert.NoError(t, err)
+		var reply echoReply
+		assert.NoError(t, json.Unmarshal(resp.Body, &reply))
+		assert.Equal(t, "/api/v1/items", reply.Path)
+		assert.Equal(t, "page=2&q=a+b", reply.Query)
+		assert.Equal(t, "Bearer default", reply.Authorization)
+		assert.Equal(t, "text/plain", reply.Accept)
+	})
+
+	t.Run("請求頭覆蓋默認請求頭（不區分大小寫）", func(t *testing.T) {
+		resp, err := client.Do(context.Background(), &HttpRequest{
+			Method: http.MethodGet,
+			URL:    "items?page=1",
+			Query:  neturl.Values{"size": {"10"}},
+			Header: map[string]string{"authorization": "Bearer override"},
+		})
+		assert.NoError(t, err)
+		var reply echoReply
+		assert.NoError(t, json.Unmarshal(resp.Body, &reply))
+		assert.Equal(t, "Bearer override", reply.Authorization)
+		assert.Equal(t, "page=1&size=10", reply.Query)
+	})
+
+	t.Run("完整 URL 忽略 BaseURL", func(t *testing.T) {
+		resp, err := client.Get(context.Background(), server.URL+"/other", nil)
+		assert.NoError(t, err)
+		var reply echoReply
+		assert.NoError(t, json.Unmarshal(resp.Body, &reply))
+		assert.Equal(t, "/other", reply.Path)
+	})
+
+	t.Run("不自動設置 Content-Type", func(t *testing.T) {
+		resp, err := NewHttpClient(nil).Do(context.Background(), &HttpRequest{Method: http.MethodPost, URL: server.URL, Body: []byte("raw")})
+		assert.NoError(t, err)
+		var reply echoReply
+		assert.NoError(t, json.Unmarshal(resp.Body, &reply))
+		assert.Equal(t, "", reply.ContentType)
+		assert.Equal(t, "raw", reply.Body)
+
+		resp, err = client.Post(context.Background(), "/upload", "text/csv", []byte("a,b"))
+		assert.NoError(t, err)
+		assert.NoError(t, json.Unmarshal(resp.Body, &reply))
+		assert.Equal(t, "text/csv", reply.ContentType)
+	})
+
+	t.Run("SendHttpRequest 保持默認 JSON Content-Type", func(t *testing.T) {
+		body, err := SendHttpRequest(http.MethodPost, server.URL, []byte(`{}`), nil, 0)
+		assert.NoError(t, err)
+		var reply echoReply
+		assert.NoError(t, json.Unmarshal(body, &reply))
+		assert.Equal(t, jsonContentType, reply.ContentType)
+
+		body, err = SendHttpRequest(http.MethodPost, server.URL, []byte(`a=1`), map[string]string{"content-type": "application/x-www-form-urlencoded"}, 0)
+		assert.NoError(t, err)
+		assert.NoError(t, json.Unmarshal(body, &reply))
+		assert.Equal(t, "application/x-www-form-urlencoded", reply.ContentType)
+	})
+
+	t.Run("不修改調用方的請求", func(t *testing.T) {
+		req := &HttpRequest{Method: http.MethodGet, URL: "items", Query: neturl.Values{"a": {"1"}}}
+		_, err := client.Do(context.Background(), req)
+		assert.NoError(t, err)
+		assert.Equal(t, "items", req.URL)
+		assert.Nil(t, req.Header)
+	})
+}
+
+func TestHttpClientJSON(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/items/1", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"id":1,"name":"apple"}`))
+	})
+	mux.HandleFunc("/items", func(w http.ResponseWriter, r *http.Request) {
+		var item jsonTestItem
+		if r.Header.Get("Content-Type") != jsonContentType || json.NewDecoder(r.Body).Decode(&item) != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		item.Id = 42
+		_ = json.NewEncoder(w).Encode(item)
+	})
+	mux.HandleFunc("/accept", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{"accept": r.Header.Get("Accept")})
+	})
+	mux.HandleFunc("/forbidden", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte(`{"status":403,"msg":"无权访问该订单","data":{"orderId":7}}`))
+	})
+	mux.HandleFunc("/common-error", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"status":-1,"msg":"库存不足"}`))
+	})
+	mux.HandleFunc("/item-with-status", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"id":1,"name":"apple","status":2}`))
+	})
+	mux.HandleFunc("/gateway", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+		_, _ = w.Write([]byte(`<html>bad gateway</html>`))
+	})
+	mux.HandleFunc("/html", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`<html></html>`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	client := NewHttpClient(&HttpClientConfig{BaseURL: server.URL})
+
+	t.Run("GetJSON 解碼響應", func(t *testing.T) {
+		item, err := GetJSON[jsonTestItem](context.Background(), client, "/items/1", nil)
+		assert.NoError(t, err)
+		assert.Equal(t, jsonTestItem{Id: 1, Name: "apple"}, item)
+	})
+
+	t.Run("PostJSON 編碼請求並解碼響應", func(t *testing.T) {
+		item, err := PostJSON[jsonTestItem, jsonTestItem](context.Background(), client, "/items", jsonTestItem{Name: "pear"})
+		assert.NoError(t, err)
+		assert.Equal(t, jsonTestItem{Id: 42, Name: "pear"}, item)
+	})
+
+	t.Run("默認 Accept 為 JSON", func(t *testing.T) {
+		reply, err := GetJSON[map[string]string](context.Background(), client, "/accept", nil)
+		assert.NoError(t, err)
+		assert.Equal(t, "application/json", reply["accept"])
+	})
+
+	t.Run("ReplyProto 錯誤響應轉為 AppError", func(t *testing.T) {
+		_, err := GetJSON[jsonTestItem](context.Background(), client, "/forbidden", nil)
+		var appErr *AppError
+		if !assert.True(t, errors.As(err, &appErr)) {
+			return
+		}
+		// 上游的 status 只放入 Details，不會成為本服務的錯誤碼與 HTTP 狀態碼
+		assert.Equal(t, CodeUpstreamRejected, appErr.StatusCode)
+		assert.Equal(t, http.StatusBadGateway, appErr.HTTPStatus())
+		assert.Equal(t, http.StatusForbidden, appErr.Details["status"])
+		assert.Equal(t, CodeForbidden, appErr.Details["upstreamStatus"])
+		assert.Equal(t, "无权访问该订单", appErr.Details["upstreamMsg"])
+		assert.Equal(t, map[string]interface{}{"orderId": float64(7)}, appErr.Details["upstreamData"])
+
+		var statusErr *HTTPStatusError
+		assert.True(t, errors.As(err, &statusErr))
+		assert.Equal(t, http.StatusForbidden, statusErr.StatusCode)
+	})
+
+	t.Run("2xx 響應中的 status 字段默認作為數據解碼", func(t *testing.T) {
+		item, err := GetJSON[jsonTestItem](context.Background(), client, "/item-with-status", nil)
+		assert.NoError(t, err)
+		assert.Equal(t, jsonTestItem{Id: 1, Name: "apple"}, item)
+
+		_, err = GetJSON[map[string]interface{}](context.Background(), client, "/common-error", nil)
+		assert.NoError(t, err)
+	})
+
+	t.Run("開啟 ReplyProto 後 HTTP 200 的信封錯誤返回上游錯誤", func(t *testing.T) {
+		replyClient := NewHttpClient(&HttpClientConfig{BaseURL: server.URL, ReplyProto: true})
+		_, err := GetJSON[jsonTestItem](context.Background(), replyClient, "/common-error", nil)
+		var appErr *AppError
+		if !assert.True(t, errors.As(err, &appErr)) {
+			return
+		}
+		assert.Equal(t, CodeUpstreamRejected, appErr.StatusCode)
+		assert.Equal(t, CommonError, appErr.Details["upstreamStatus"])
+		assert.Equal(t, "库存不足", appErr.Details["upstreamMsg"])
+	})
+
+	t.Run("非 ReplyProto 錯誤響應返回上游錯誤", func(t *testing.T) {
+		_, err := GetJSON[jsonTestItem](context.Background(), client, "/gateway", nil)
+		assert.Equal(t, CodeUpstreamUnavailable, ErrorCodeOf(err))
+	})
+
+	t.Run("響應不是 JSON", func(t *testing.T) {
+		_, err := GetJSON[jsonTestItem](context.Background(), client, "/html", nil)
+		assert.Equal(t, CodeUpstreamRejected, ErrorCodeOf(err))
+	})
+
+	t.Run("ctx 已取消", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err := GetJSON[jsonTestItem](ctx, client, "/items/1", nil)
+		assert.True(t, errors.Is(err, context.Canceled))
+	})
+}
+
+func TestResolveURL(t *testing.T) {
+	tests := []struct {
+		base, path string
+		query      neturl.Values
+		want       string
+	}{
+		{"", "https://a.com/x", nil, "https://a.com/x"},
+		{"https://a.com/v1", "items", nil, "https://a.com/v1/items"},
+		{"https://a.com/v1/", "/items", nil, "https://a.com/v1/items"},
+		{"https://a.com/v1", "", nil, "https://a.com/v1"},
+		{"https://a.com/v1", "http://b.com/y", nil, "http://b.com/y"},
+		{"https://a.com", "items?x=1", neturl.Values{"y": {"2"}}, "https://a.com/items?x=1&y=2"},
+		{"", "https://a.com/s", neturl.Values{"q": {"中文"}}, "https://a.com/s?q=%E4%B8%AD%E6%96%87"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, resolveURL(tt.base, tt.path, tt.query), tt.base+" "+tt.path)
+	}
+}
@@ -0,0 +1,146 @@
+package cmn
+
+import (
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/textproto"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// MultipartForm multipart/form-data 请求体构建器，文件内容在发送时流式写入，不会整体读入内存
+//
+//	f, _ := os.Open("avatar.png")
+//	defer f.Close()
+//	form := cmn.NewMultipartForm().
+//		AddField("bizType", "avatar").
+//		AddFile("file", "avatar.png", f)
+//	resp, err := client.Do(ctx, form.Request(http.MethodPost, "/upload"))
+type MultipartForm struct {
+	boundary string
+	parts    []multipartPart
+}
+
+// multipartPart 表单中的一个字段或文件
+type multipartPart struct {
+	name        string
+	value       string
+	filename    string
+	contentType string
+	file        io.Reader
+}
+
+// NewMultipartForm 创建 multipart 表单
+func NewMultipartForm() *MultipartForm {
+	return &MultipartForm{boundary: multipart.NewWriter(io.Discard).Boundary()}
+}
+
+// AddField 添加普通字段
+func (f *MultipartForm) AddField(name, value string) *MultipartForm {
+	f.parts = append(f.parts, multipartPart{name: name, value: value})
+	return f
+}
+
+// AddFile 添加文件，Content-Type 按文件扩展名推断（未知时为 application/octet-stream）
+// r 在发送时读取，不会被关闭
+func (f *MultipartForm) AddFile(name, filename string, r io.Reader) *MultipartForm {
+	contentType := mime.TypeByExtension(filepath.Ext(filename))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	return f.AddFileWithType(name, filename, contentType, r)
+}
+
+// AddFileWithType 添加指定 Content-Type 的文件
+func (f *MultipartForm) AddFileWithType(name, filename, contentType string, r io.Reader) *MultipartForm {
+	f.parts = append(f.parts, multipartPart{name: name, filename: filename, contentType: contentType, file: r})
+	return f
+}
+
+// ContentType 返回带 boundary 的 Content-Type
+func (f *MultipartForm) ContentType() string {
+	return "multipart/form-data; boundary=" + f.boundary
+}
+
+// Reader 返回表单的流式请求体，第一次读取时才开始写入；只能读取一次
+func (f *MultipartForm) Reader() io.ReadCloser {
+	return &multipartReader{form: f}
+}
+
+// Request 返回发送该表单的请求（chunked 编码），可再补充 Header、Query
+func (f *MultipartForm) Request(method, url string) *HttpRequest {
+	return &HttpRequest{
+		Method:     method,
+		URL:        url,
+		Header:     map[string]string{"Content-Type": f.ContentType()},
+		BodyReader: f.Reader(),
+		BodySize:   -1,
+	}
+}
+
+// writeTo 按顺序写入所有字段与文件
+func (f *MultipartForm) writeTo(w io.Writer) error {
+	mw := multipart.NewWriter(w)
+	if err := mw.SetBoundary(f.boundary); err != nil {
+		return err
+	}
+	for _, part := range f.parts {
+		if part.file == nil {
+			if err := mw.WriteField(part.name, part.value); err != nil {
+				return err
+			}
+			continue
+		}
+		header := make(textproto.MIMEHeader)
+		header.Set("Content-Disposition", `form-data; name="`+escapeQuotes(part.name)+`"; filename="`+escapeQuotes(part.filename)+`"`)
+		header.Set("Content-Type", part.contentType)
+		pw, err := mw.CreatePart(header)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(pw, part.file); err != nil {
+			return err
+		}
+	}
+	return mw.Close()
+}
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+func escapeQuotes(s string) string {
+	return quoteEscaper.Replace(s)
+}
+
+// multipartReader 通过 io.Pipe 边写边读，关闭时结束写入的 goroutine
+type multipartReader struct {
+	form  *MultipartForm
+	once  sync.Once
+	pipe  *io.PipeReader
+	close sync.Once
+}
+
+func (r *multipartReader) start() {
+	r.once.Do(func() {
+		pr, pw := io.Pipe()
+		r.pipe = pr
+		go func() {
+			pw.CloseWithError(r.form.writeTo(pw))
+		}()
+	})
+}
+
+func (r *multipartReader) Read(p []byte) (int, error) {
+	r.start()
+	return r.pipe.Read(p)
+}
+
+func (r *multipartReader) Close() error {
+	r.close.Do(func() {
+		// 未读取过时同样启动写入，写入的 goroutine 在写管道时收到错误后退出
+		r.start()
+		_ = r.pipe.Close()
+	})
+	return nil
+}
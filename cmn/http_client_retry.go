@@ -0,0 +1,169 @@
+package cmn
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/valyala/fasthttp"
+	"go.uber.org/zap"
+)
+
+// RetryPolicy 出站请求的重试策略
+type RetryPolicy struct {
+	MaxAttempts int           // 最多发送次数（含首次），默认 3
+	BaseDelay   time.Duration // 首次重试前的等待时间，之后每次翻倍，默认 100ms
+	MaxDelay    time.Duration // 单次等待的上限，默认 2s；Retry-After 超过该值时不再重试
+	Jitter      float64       // 随机抖动比例（0-1），等待时间在 [delay*(1-Jitter), delay] 之间，默认 0.5
+
+	RetryStatuses      []int // 需要重试的状态码，默认 429、502、503、504
+	RetryNetworkErrors bool  // 是否重试网络错误（连接失败、连接重置、超时）
+	RetryNonIdempotent bool  // 是否重试非幂等方法（POST、PATCH），默认只重试幂等方法
+}
+
+// DefaultRetryPolicy 默认重试策略：幂等方法最多发送 3 次，重试网络错误与 429/502/503/504
+func DefaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts:        3,
+		BaseDelay:          100 * time.Millisecond,
+		MaxDelay:           2 * time.Second,
+		Jitter:             0.5,
+		RetryStatuses:      []int{http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
+		RetryNetworkErrors: true,
+	}
+}
+
+// idempotentMethods 可以安全重试的方法
+var idempotentMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodOptions: true,
+	http.MethodTrace:   true,
+	http.MethodPut:     true,
+	http.MethodDelete:  true,
+}
+
+// wrap 为 next 增加重试，log 用于日志中的 URL 脱敏
+func (p *RetryPolicy) wrap(next HttpHandler, log *HttpLogConfig) HttpHandler {
+	policy := *p
+	if policy.MaxAttempts <= 0 {
+		policy.MaxAttempts = 3
+	}
+	if policy.BaseDelay <= 0 {
+		policy.BaseDelay = 100 * time.Millisecond
+	}
+	if policy.MaxDelay <= 0 {
+		policy.MaxDelay = 2 * time.Second
+	}
+
+	return func(ctx context.Context, req *HttpRequest) (*HttpResponse, error) {
+		// 流式请求体已被读取，无法重放
+		retryable := (policy.RetryNonIdempotent || idempotentMethods[req.Method]) && req.BodyReader == nil
+		for attempt := 1; ; attempt++ {
+			resp, err := next(ctx, req)
+			if resp != nil {
+				resp.Attempts = attempt
+			}
+			if !retryable || attempt >= policy.MaxAttempts || ctx.Err() != nil || !policy.shouldRetry(resp, err) {
+				return resp, err
+			}
+
+			delay := policy.backoff(attempt)
+			if resp != nil {
+				if retryAfter, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok {
+					if retryAfter > policy.MaxDelay {
+						Logger().Warn("HTTP request not retried, Retry-After too long",
+							zap.String("url", log.RedactURL(req.URL)), zap.Int("attempt", attempt), zap.Duration("retry_after", retryAfter))
+						return resp, err
+					}
+					delay = max(delay, retryAfter)
+				}
+			}
+			if deadline, ok := ctx.Deadline(); ok && time.Now().Add(delay).After(deadline) {
+				return resp, err
+			}
+
+			fields := []zap.Field{
+				zap.String("method", req.Method),
+				zap.String("url", log.RedactURL(req.URL)),
+				zap.Int("attempt", attempt),
+				zap.Int("max_attempts", policy.MaxAttempts),
+				zap.Duration("delay", delay),
+			}
+			if err != nil {
+				fields = append(fields, zap.Error(err))
+			} else {
+				fields = append(fields, zap.Int("status", resp.StatusCode))
+			}
+			Logger().Warn("HTTP request retry", fields...)
+
+			timer := time.NewTimer(delay)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return nil, ctx.Err()
+			case <-timer.C:
+			}
+		}
+	}
+}
+
+// shouldRetry 判断本次结果是否需要重试
+func (p *RetryPolicy) shouldRetry(resp *HttpResponse, err error) bool {
+	if err != nil {
+		return p.RetryNetworkErrors && isNetworkError(err)
+	}
+	for _, status := range p.RetryStatuses {
+		if resp.StatusCode == status {
+			return true
+		}
+	}
+	return false
+}
+
+// backoff 返回第 attempt 次失败后的等待时间（指数退避 + 抖动）
+func (p *RetryPolicy) backoff(attempt int) time.Duration {
+	delay := p.BaseDelay << (attempt - 1)
+	if delay <= 0 || delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	if p.Jitter > 0 {
+		jitter := min(p.Jitter, 1)
+		delay -= time.Duration(rand.Float64() * jitter * float64(delay))
+	}
+	return delay
+}
+
+// isNetworkError 判断是否为网络错误（不含 ctx 取消）
+func isNetworkError(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) ||
+		errors.Is(err, fasthttp.ErrTimeout) ||
+		errors.Is(err, fasthttp.ErrConnectionClosed) ||
+		errors.Is(err, fasthttp.ErrDialTimeout) ||
+		errors.Is(err, fasthttp.ErrNoFreeConns)
+}
+
+// parseRetryAfter 解析 Retry-After（秒数或 HTTP 日期）
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return max(time.Until(t), 0), true
+	}
+	return 0, false
+}
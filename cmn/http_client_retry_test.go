@@ -0,0 +1,221 @@
+package cmn
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fastRetryPolicy 测试用的重试策略，等待时间很短
+func fastRetryPolicy() *RetryPolicy {
+	policy := DefaultRetryPolicy()
+	policy.BaseDelay = time.Millisecond
+	policy.MaxDelay = 50 * time.Millisecond
+	return policy
+}
+
+// statusSequenceServer 依次返回 statuses 中的状态码，之后返回 200
+func statusSequenceServer(statuses ...int) (*httptest.Server, *int32) {
+	var hits int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(atomic.AddInt32(&hits, 1))
+		if n <= len(statuses) {
+			w.WriteHeader(statuses[n-1])
+			return
+		}
+		_, _ = w.Write([]byte(`{"status":"ok"}`))
+	}))
+	return server, &hits
+}
+
+func TestHttpClientRetry(t *testing.T) {
+	t.Run("可重試狀態碼後成功", func(t *testing.T) {
+		server, hits := statusSequenceServer(http.StatusServiceUnavailable, http.StatusBadGateway)
+		defer server.Close()
+
+		client := NewHttpClient(&HttpClientConfig{Retry: fastRetryPolicy()})
+		resp, err := client.Do(context.Background(), &HttpRequest{Method: http.MethodGet, URL: server.URL})
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, 3, resp.Attempts)
+		assert.Equal(t, int32(3), atomic.LoadInt32(hits))
+	})
+
+	t.Run("超過最大次數返回最後的錯誤", func(t *testing.T) {
+		server, hits := statusSequenceServer(503, 503, 503, 503)
+		defer server.Close()
+
+		client := NewHttpClient(&HttpClientConfig{Retry: fastRetryPolicy()})
+		resp, err := client.Do(context.Background(), &HttpRequest{Method: http.MethodGet, URL: server.URL})
+		assert.Equal(t, CodeUpstreamUnavailable, ErrorCodeOf(err))
+		assert.Equal(t, 3, resp.Attempts)
+		assert.Equal(t, int32(3), atomic.LoadInt32(hits))
+	})
+
+	t.Run("不可重試狀態碼只發送一次", func(t *testing.T) {
+		server, hits := statusSequenceServer(http.StatusBadRequest)
+		defer server.Close()
+
+		client := NewHttpClient(&HttpClientConfig{Retry: fastRetryPolicy()})
+		_, err := client.Do(context.Background(), &HttpRequest{Method: http.MethodGet, URL: server.URL})
+		assert.Equal(t, CodeUpstreamRejected, ErrorCodeOf(err))
+		assert.Equal(t, int32(1), atomic.LoadInt32(hits))
+	})
+
+	t.Run("POST 默認不重試", func(t *testing.T) {
+		server, hits := statusSequenceServer(http.StatusServiceUnavailable)
+		defer server.Close()
+
+		client := NewHttpClient(&HttpClientConfig{Retry: fastRetryPolicy()})
+		_, err := client.Do(context.Background(), &HttpRequest{Method: http.MethodPost, URL: server.URL, Body: []byte(`{}`)})
+		assert.Error(t, err)
+		assert.Equal(t, int32(1), atomic.LoadInt32(hits))
+	})
+
+	t.Run("允許時重試 POST", func(t *testing.T) {
+		server, hits := statusSequenceServer(http.StatusServiceUnavailable)
+		defer server.Close()
+
+		policy := fastRetryPolicy()
+		policy.RetryNonIdempotent = true
+		client := NewHttpClient(&HttpClientConfig{Retry: policy})
+		resp, err := client.Do(context.Background(), &HttpRequest{Method: http.MethodPost, URL: server.URL, Body: []byte(`{}`)})
+		assert.NoError(t, err)
+		assert.Equal(t, 2, resp.Attempts)
+		assert.Equal(t, int32(2), atomic.LoadInt32(hits))
+	})
+
+	t.Run("遵守 Retry-After", func(t *testing.T) {
+		var hits int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if atomic.AddInt32(&hits, 1) == 1 {
+				w.Header().Set("Retry-After", "1")
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer server.Close()
+
+		policy := fastRetryPolicy()
+		policy.MaxDelay = 2 * time.Second
+		client := NewHttpClient(&HttpClientConfig{Retry: policy})
+		start := time.Now()
+		resp, err := client.Do(context.Background(), &HttpRequest{Method: http.MethodGet, URL: server.URL})
+		assert.NoError(t, err)
+		assert.Equal(t, 2, resp.Attempts)
+		assert.GreaterOrEqual(t, time.Since(start), time.Second)
+	})
+
+	t.Run("Retry-After 超過上限時不重試", func(t *testing.T) {
+		var hits int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&hits, 1)
+			w.Header().Set("Retry-After", "120")
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		defer server.Close()
+
+		client := NewHttpClient(&HttpClientConfig{Retry: fastRetryPolicy()})
+		resp, err := client.Do(context.Background(), &HttpRequest{Method: http.MethodGet, URL: server.URL})
+		assert.Equal(t, CodeUpstreamUnavailable, ErrorCodeOf(err))
+		assert.Equal(t, 1, resp.Attempts)
+		assert.Equal(t, int32(1), atomic.LoadInt32(&hits))
+	})
+
+	t.Run("重試網絡錯誤", func(t *testing.T) {
+		// 接受連接後立即關閉，模擬連接被重置
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.NoError(t, err)
+		defer listener.Close()
+		var accepted int32
+		go func() {
+			for {
+				conn, err := listener.Accept()
+				if err != nil {
+					return
+				}
+				atomic.AddInt32(&accepted, 1)
+				_ = conn.Close()
+			}
+		}()
+
+		client := NewHttpClient(&HttpClientConfig{Retry: fastRetryPolicy()})
+		_, err = client.Do(context.Background(), &HttpRequest{Method: http.MethodGet, URL: "http://" + listener.Addr().String()})
+		assert.Error(t, err)
+		assert.Equal(t, int32(3), atomic.LoadInt32(&accepted))
+	})
+
+	t.Run("截止時間不足時不再等待", func(t *testing.T) {
+		server, hits := statusSequenceServer(503, 503, 503)
+		defer server.Close()
+
+		policy := fastRetryPolicy()
+		policy.BaseDelay = time.Second
+		policy.MaxDelay = time.Second
+		policy.Jitter = 0
+		client := NewHttpClient(&HttpClientConfig{Retry: policy})
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+
+		start := time.Now()
+		_, err := client.Do(ctx, &HttpRequest{Method: http.MethodGet, URL: server.URL})
+		assert.Equal(t, CodeUpstreamUnavailable, ErrorCodeOf(err))
+		assert.Less(t, time.Since(start), 200*time.Millisecond)
+		assert.Equal(t, int32(1), atomic.LoadInt32(hits))
+	})
+
+	t.Run("等待期間取消", func(t *testing.T) {
+		server, hits := statusSequenceServer(503, 503, 503)
+		defer server.Close()
+
+		policy := fastRetryPolicy()
+		policy.BaseDelay = time.Second
+		policy.MaxDelay = time.Second
+		client := NewHttpClient(&HttpClientConfig{Retry: policy})
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(50*time.Millisecond, cancel)
+
+		_, err := client.Do(ctx, &HttpRequest{Method: http.MethodGet, URL: server.URL})
+		assert.True(t, errors.Is(err, context.Canceled))
+		assert.Equal(t, int32(1), atomic.LoadInt32(hits))
+	})
+}
+
+func TestRetryBackoff(t *testing.T) {
+	policy := &RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second, Jitter: 0.5}
+	for attempt := 1; attempt <= 10; attempt++ {
+		full := min(policy.BaseDelay<<(attempt-1), policy.MaxDelay)
+		delay := policy.backoff(attempt)
+		assert.LessOrEqual(t, delay, full)
+		assert.GreaterOrEqual(t, delay, full/2)
+	}
+
+	policy.Jitter = 0
+	assert.Equal(t, 400*time.Millisecond, policy.backoff(3))
+	assert.Equal(t, time.Second, policy.backoff(64))
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	d, ok := parseRetryAfter("3")
+	assert.True(t, ok)
+	assert.Equal(t, 3*time.Second, d)
+
+	d, ok = parseRetryAfter(time.Now().Add(10 * time.Second).UTC().Format(http.TimeFormat))
+	assert.True(t, ok)
+	assert.InDelta(t, float64(10*time.Second), float64(d), float64(2*time.Second))
+
+	_, ok = parseRetryAfter("")
+	assert.False(t, ok)
+	_, ok = parseRetryAfter("-1")
+	assert.False(t, ok)
+	_, ok = parseRetryAfter("soon")
+	assert.False(t, ok)
+}
@@ -0,0 +1,227 @@
+package cmn
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxStreamErrorBody 流式请求的错误响应最多读取的长度
+const maxStreamErrorBody = 64 << 10
+
+// Stream 发送请求并流式读取响应体，2xx 时 resp.Stream 为响应体，使用完毕后必须 Close；
+// 非 2xx 时与 Do 相同返回上游错误，resp.Body 为错误响应的前 64KB
+// 响应体的读取受单次超时与 ctx 截止时间限制，长时间的流式响应需要设置足够的 Timeout 或 ctx 截止时间
+//
+//	resp, err := client.Stream(ctx, &cmn.HttpRequest{Method: "GET", URL: "/files/1"})
+//	if err != nil {
+//		return err
+//	}
+//	defer resp.Stream.Close()
+func (c *HttpClient) Stream(ctx context.Context, req *HttpRequest) (*HttpResponse, error) {
+	r := *req
+	r.stream = true
+	resp, err := c.Do(ctx, &r)
+	if err == nil && resp.Stream == nil {
+		// 响应体已被完整读取（如 204、HEAD）
+		resp.Stream = io.NopCloser(bytes.NewReader(resp.Body))
+	}
+	return resp, err
+}
+
+// Download 把响应体写入 w，返回写入的字节数；maxBytes > 0 时响应体超过该大小返回错误（已写入的部分不会回滚）
+//
+//	f, _ := os.Create(path)
+//	defer f.Close()
+//	n, err := client.Download(ctx, &cmn.HttpRequest{Method: "GET", URL: fileURL}, f, 100<<20)
+func (c *HttpClient) Download(ctx context.Context, req *HttpRequest, w io.Writer, maxBytes int64) (int64, error) {
+	resp, err := c.Stream(ctx, req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Stream.Close()
+
+	if maxBytes > 0 {
+		if length, err := strconv.ParseInt(resp.Header.Get("Content-Length"), 10, 64); err == nil && length > maxBytes {
+			return 0, responseTooLargeError(resp.StatusCode, maxBytes)
+		}
+	}
+
+	var body io.Reader = resp.Stream
+	if maxBytes > 0 {
+		body = io.LimitReader(resp.Stream, maxBytes)
+	}
+	n, err := io.Copy(w, body)
+	if err != nil {
+		return n, err
+	}
+	if maxBytes > 0 && n == maxBytes {
+		// 再读一个字节判断是否超过上限
+		if _, err := io.ReadFull(resp.Stream, make([]byte, 1)); err == nil {
+			return n, responseTooLargeError(resp.StatusCode, maxBytes)
+		}
+	}
+	return n, nil
+}
+
+// responseTooLargeError 上游响应体超过上限
+func responseTooLargeError(status int, maxBytes int64) *AppError {
+	return NewAppError(CodeUpstreamRejected, fmt.Sprintf("上游响应体超过 %d 字节", maxBytes)).
+		WithDetail("status", status).
+		WithDetail("maxBytes", maxBytes)
+}
+
+// responseStream 流式响应体，ctx 结束后不再读取，关闭时归还连接
+type responseStream struct {
+	ctx       context.Context
+	r         io.Reader
+	closeOnce sync.Once
+	release   func()
+}
+
+func newResponseStream(ctx context.Context, r io.Reader, release func()) *responseStream {
+	return &responseStream{ctx: ctx, r: r, release: release}
+}
+
+func (s *responseStream) Read(p []byte) (int, error) {
+	if err := s.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return s.r.Read(p)
+}
+
+func (s *responseStream) Close() error {
+	s.closeOnce.Do(s.release)
+	return nil
+}
+
+// ServerSentEvent 服务器推送事件（text/event-stream）
+type ServerSentEvent struct {
+	ID    string        // 最近一次的事件 ID（未设置时沿用上一个事件的 ID）
+	Event string        // 事件类型，未设置时为 message
+	Data  string        // 多行 data 以换行连接
+	Retry time.Duration // 服务器建议的重连间隔，未设置时为 0
+}
+
+// Events 发送请求并按事件迭代 text/event-stream 响应，退出循环时自动关闭连接
+// 请求失败或读取出错时产生一次错误后结束；未设置 Accept 时设置为 text/event-stream
+//
+//	for event, err := range client.Events(ctx, &cmn.HttpRequest{Method: "POST", URL: "/chat/completions", Body: body}) {
+//		if err != nil {
+//			return err
+//		}
+//		if event.Data == "[DONE]" {
+//			break
+//		}
+//		handle(event.Data)
+//	}
+func (c *HttpClient) Events(ctx context.Context, req *HttpRequest) iter.Seq2[ServerSentEvent, error] {
+	return func(yield func(ServerSentEvent, error) bool) {
+		r := *req
+		if !hasHeader(r.Header, "Accept") && !hasHeader(c.config.Header, "Accept") {
+			r.Header = make(map[string]string, len(req.Header)+1)
+			for k, v := range req.Header {
+				r.Header[k] = v
+			}
+			r.Header["Accept"] = "text/event-stream"
+		}
+
+		resp, err := c.Stream(ctx, &r)
+		if err != nil {
+			yield(ServerSentEvent{}, err)
+			return
+		}
+		defer resp.Stream.Close()
+
+		reader := newSSEReader(resp.Stream)
+		for {
+			event, err := reader.next()
+			if errors.Is(err, io.EOF) {
+				return
+			}
+			if err != nil {
+				yield(ServerSentEvent{}, err)
+				return
+			}
+			if !yield(event, nil) {
+				return
+			}
+		}
+	}
+}
+
+// maxSSELine 单行事件数据的最大长度
+const maxSSELine = 1 << 20
+
+// sseReader 按 https://html.spec.whatwg.org/multipage/server-sent-events.html 解析事件流
+type sseReader struct {
+	scanner *bufio.Scanner
+	lastID  string
+}
+
+func newSSEReader(r io.Reader) *sseReader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 4096), maxSSELine)
+	return &sseReader{scanner: scanner}
+}
+
+// next 返回下一个事件，流结束时返回 io.EOF（结尾不完整的事件被丢弃）
+func (r *sseReader) next() (ServerSentEvent, error) {
+	var (
+		event   ServerSentEvent
+		data    strings.Builder
+		hasData bool
+	)
+	for r.scanner.Scan() {
+		line := r.scanner.Text()
+		if line == "" {
+			// 空行分发事件，没有 data 的事件被忽略
+			if !hasData {
+				event = ServerSentEvent{}
+				continue
+			}
+			event.ID = r.lastID
+			event.Data = data.String()
+			if event.Event == "" {
+				event.Event = "message"
+			}
+			return event, nil
+		}
+		if strings.HasPrefix(line, ":") {
+			continue // 注释，常用作心跳
+		}
+
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "data":
+			if hasData {
+				data.WriteByte('\n')
+			}
+			data.WriteString(value)
+			hasData = true
+		case "event":
+			event.Event = value
+		case "id":
+			if !strings.ContainsRune(value, 0) {
+				r.lastID = value
+			}
+		case "retry":
+			if ms, err := strconv.Atoi(value); err == nil && ms >= 0 {
+				event.Retry = time.Duration(ms) * time.Millisecond
+			}
+		}
+	}
+	if err := r.scanner.Err(); err != nil {
+		return ServerSentEvent{}, err
+	}
+	return ServerSentEvent{}, io.EOF
+}
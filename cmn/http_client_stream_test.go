@@ -0,0 +1,329 @@
+package cmn
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHttpClientStreamBody(t *testing.T) {
+	t.Run("流式請求體", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			fmt.Fprintf(w, "%d %v %s", len(body), r.TransferEncoding, body[:5])
+		}))
+		defer server.Close()
+
+		payload := strings.Repeat("hello", 100000)
+		resp, err := NewHttpClient(nil).Do(context.Background(), &HttpRequest{
+			Method:     http.MethodPost,
+			URL:        server.URL,
+			BodyReader: strings.NewReader(payload),
+			BodySize:   -1,
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, "500000 [chunked] hello", string(resp.Body))
+	})
+
+	t.Run("已知長度的流式請求體", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, "%d", r.ContentLength)
+		}))
+		defer server.Close()
+
+		resp, err := NewHttpClient(nil).Do(context.Background(), &HttpRequest{
+			Method:     http.MethodPut,
+			URL:        server.URL,
+			BodyReader: strings.NewReader("abc"),
+			BodySize:   3,
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, "3", string(resp.Body))
+	})
+
+	t.Run("流式請求體不重試", func(t *testing.T) {
+		server, hits := statusSequenceServer(http.StatusServiceUnavailable)
+		defer server.Close()
+
+		client := NewHttpClient(&HttpClientConfig{Retry: fastRetryPolicy()})
+		_, err := client.Do(context.Background(), &HttpRequest{
+			Method:     http.MethodPut,
+			URL:        server.URL,
+			BodyReader: strings.NewReader("abc"),
+			BodySize:   3,
+		})
+		assert.Equal(t, CodeUpstreamUnavailable, ErrorCodeOf(err))
+		assert.Equal(t, int32(1), atomic.LoadInt32(hits))
+	})
+}
+
+// chunkServer 分塊寫出響應，每塊之間 flush
+func chunkServer(chunks ...string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, chunk := range chunks {
+			_, _ = io.WriteString(w, chunk)
+			w.(http.Flusher).Flush()
+		}
+	}))
+}
+
+func TestHttpClientStream(t *testing.T) {
+	t.Run("流式讀取響應體", func(t *testing.T) {
+		server := chunkServer("a", "b", "c")
+		defer server.Close()
+
+		resp, err := NewHttpClient(nil).Stream(context.Background(), &HttpRequest{Method: http.MethodGet, URL: server.URL})
+		assert.NoError(t, err)
+		defer resp.Stream.Close()
+		assert.Nil(t, resp.Body)
+		body, err := io.ReadAll(resp.Stream)
+		assert.NoError(t, err)
+		assert.Equal(t, "abc", string(body))
+	})
+
+	t.Run("錯誤響應返回上游錯誤與響應體", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = io.WriteString(w, strings.Repeat("x", maxStreamErrorBody*2))
+		}))
+		defer server.Close()
+
+		resp, err := NewHttpClient(nil).Stream(context.Background(), &HttpRequest{Method: http.MethodGet, URL: server.URL})
+		assert.Equal(t, CodeUpstreamRejected, ErrorCodeOf(err))
+		assert.Nil(t, resp.Stream)
+		assert.Len(t, resp.Body, maxStreamErrorBody)
+	})
+
+	t.Run("沒有響應體", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		defer server.Close()
+
+		resp, err := NewHttpClient(nil).Stream(context.Background(), &HttpRequest{Method: http.MethodDelete, URL: server.URL})
+		assert.NoError(t, err)
+		body, err := io.ReadAll(resp.Stream)
+		assert.NoError(t, err)
+		assert.Empty(t, body)
+		assert.NoError(t, resp.Stream.Close())
+	})
+
+	t.Run("ctx 取消後停止讀取", func(t *testing.T) {
+		release := make(chan struct{})
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = io.WriteString(w, "first")
+			w.(http.Flusher).Flush()
+			<-release
+		}))
+		defer server.Close()
+		defer close(release)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		resp, err := NewHttpClient(nil).Stream(ctx, &HttpRequest{Method: http.MethodGet, URL: server.URL})
+		assert.NoError(t, err)
+		defer resp.Stream.Close()
+
+		buf := make([]byte, 5)
+		_, err = io.ReadFull(resp.Stream, buf)
+		assert.NoError(t, err)
+		assert.Equal(t, "first", string(buf))
+
+		cancel()
+		_, err = resp.Stream.Read(buf)
+		assert.True(t, errors.Is(err, context.Canceled))
+	})
+}
+
+func TestHttpClientDownload(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/fixed", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "10")
+		_, _ = io.WriteString(w, "0123456789")
+	})
+	mux.HandleFunc("/chunked", func(w http.ResponseWriter, r *http.Request) {
+		for i := 0; i < 10; i++ {
+			_, _ = io.WriteString(w, "0123456789")
+			w.(http.Flusher).Flush()
+		}
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	client := NewHttpClient(&HttpClientConfig{BaseURL: server.URL})
+
+	t.Run("寫入 io.Writer", func(t *testing.T) {
+		var buf bytes.Buffer
+		n, err := client.Download(context.Background(), &HttpRequest{Method: http.MethodGet, URL: "/chunked"}, &buf, 0)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(100), n)
+		assert.Equal(t, strings.Repeat("0123456789", 10), buf.String())
+	})
+
+	t.Run("恰好等於上限", func(t *testing.T) {
+		var buf bytes.Buffer
+		n, err := client.Download(context.Background(), &HttpRequest{Method: http.MethodGet, URL: "/fixed"}, &buf, 10)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(10), n)
+	})
+
+	t.Run("Content-Length 超過上限", func(t *testing.T) {
+		var buf bytes.Buffer
+		n, err := client.Download(context.Background(), &HttpRequest{Method: http.MethodGet, URL: "/fixed"}, &buf, 5)
+		assert.Equal(t, CodeUpstreamRejected, ErrorCodeOf(err))
+		assert.Equal(t, int64(0), n)
+		assert.Equal(t, 0, buf.Len())
+	})
+
+	t.Run("chunked 響應超過上限", func(t *testing.T) {
+		var buf bytes.Buffer
+		n, err := client.Download(context.Background(), &HttpRequest{Method: http.MethodGet, URL: "/chunked"}, &buf, 25)
+		assert.Equal(t, CodeUpstreamRejected, ErrorCodeOf(err))
+		assert.Equal(t, int64(25), n)
+		assert.Equal(t, 25, buf.Len())
+	})
+}
+
+func TestMultipartForm(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+		content, _ := io.ReadAll(file)
+		fmt.Fprintf(w, "%s|%s|%s|%s|%s", r.FormValue("bizType"), header.Filename,
+			header.Header.Get("Content-Type"), content, r.FormValue("note"))
+	}))
+	defer server.Close()
+
+	t.Run("上傳字段與文件", func(t *testing.T) {
+		form := NewMultipartForm().
+			AddField("bizType", "avatar").
+			AddFile("file", `a"b.png`, strings.NewReader("PNGDATA")).
+			AddField("note", "備註")
+		assert.True(t, strings.HasPrefix(form.ContentType(), "multipart/form-data; boundary="))
+
+		resp, err := NewHttpClient(nil).Do(context.Background(), form.Request(http.MethodPost, server.URL))
+		assert.NoError(t, err)
+		assert.Equal(t, `avatar|a"b.png|image/png|PNGDATA|備註`, string(resp.Body))
+	})
+
+	t.Run("指定文件類型", func(t *testing.T) {
+		form := NewMultipartForm().AddFileWithType("file", "data.bin", "text/csv", strings.NewReader("a,b"))
+		resp, err := NewHttpClient(nil).Do(context.Background(), form.Request(http.MethodPost, server.URL))
+		assert.NoError(t, err)
+		assert.Equal(t, `|data.bin|text/csv|a,b|`, string(resp.Body))
+	})
+
+	t.Run("未讀取即關閉", func(t *testing.T) {
+		reader := NewMultipartForm().AddField("a", "1").Reader()
+		assert.NoError(t, reader.Close())
+		_, err := reader.Read(make([]byte, 1))
+		assert.ErrorIs(t, err, io.ErrClosedPipe)
+	})
+}
+
+func TestHttpClientEvents(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/events", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept") != "text/event-stream" {
+			w.WriteHeader(http.StatusNotAcceptable)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		events := []string{
+			": heartbeat\n\n",
+			"data: first\n\n",
+			"id: 7\nevent: delta\ndata: line1\ndata: line2\n\n",
+			"retry: 3000\ndata:no-space\n\n",
+			"data: [DONE]\n\n",
+		}
+		for _, event := range events {
+			_, _ = io.WriteString(w, event)
+			w.(http.Flusher).Flush()
+		}
+	})
+	mux.HandleFunc("/infinite", func(w http.ResponseWriter, r *http.Request) {
+		for i := 0; ; i++ {
+			if _, err := fmt.Fprintf(w, "data: %d\n\n", i); err != nil {
+				return
+			}
+			w.(http.Flusher).Flush()
+			select {
+			case <-r.Context().Done():
+				return
+			case <-time.After(time.Millisecond):
+			}
+		}
+	})
+	mux.HandleFunc("/error", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	client := NewHttpClient(&HttpClientConfig{BaseURL: server.URL})
+
+	t.Run("迭代事件", func(t *testing.T) {
+		var events []ServerSentEvent
+		for event, err := range client.Events(context.Background(), &HttpRequest{Method: http.MethodGet, URL: "/events"}) {
+			assert.NoError(t, err)
+			events = append(events, event)
+		}
+		assert.Equal(t, []ServerSentEvent{
+			{Event: "message", Data: "first"},
+			{ID: "7", Event: "delta", Data: "line1\nline2"},
+			{ID: "7", Event: "message", Data: "no-space", Retry: 3 * time.Second},
+			{ID: "7", Event: "message", Data: "[DONE]"},
+		}, events)
+	})
+
+	t.Run("提前退出循環", func(t *testing.T) {
+		count := 0
+		for event, err := range client.Events(context.Background(), &HttpRequest{Method: http.MethodGet, URL: "/infinite"}) {
+			assert.NoError(t, err)
+			count++
+			if event.Data == "2" {
+				break
+			}
+		}
+		assert.Equal(t, 3, count)
+	})
+
+	t.Run("請求失敗產生一次錯誤", func(t *testing.T) {
+		var errs []error
+		for _, err := range client.Events(context.Background(), &HttpRequest{Method: http.MethodGet, URL: "/error"}) {
+			errs = append(errs, err)
+		}
+		assert.Len(t, errs, 1)
+		assert.Equal(t, CodeUpstreamUnavailable, ErrorCodeOf(errs[0]))
+	})
+}
+
+func TestSSEReader(t *testing.T) {
+	reader := newSSEReader(strings.NewReader("event: a\r\ndata: 1\r\n\r\nevent: ignored\r\n\r\ndata: 2\r\n\r\ndata: incomplete"))
+
+	event, err := reader.next()
+	assert.NoError(t, err)
+	assert.Equal(t, ServerSentEvent{Event: "a", Data: "1"}, event)
+
+	event, err = reader.next()
+	assert.NoError(t, err)
+	assert.Equal(t, ServerSentEvent{Event: "message", Data: "2"}, event)
+
+	_, err = reader.next()
+	assert.ErrorIs(t, err, io.EOF)
+}
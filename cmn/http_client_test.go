@@ -1,6 +1,7 @@
 package cmn
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -68,7 +69,7 @@ func TestSendHttpRequest(t *testing.T) {
 		args      args
 		want      []byte
 		wantErr   bool
-		errStatus int // Expected status code in AppError
+		errStatus int // Expected upstream status code in HTTPStatusError
 	}{
 		{
 			name: "Success GET",
@@ -163,11 +164,17 @@ func TestSendHttpRequest(t *testing.T) {
 			}
 			if tt.wantErr {
 				if tt.errStatus != 0 {
-					var appErr *AppError
-					if errors.As(err, &appErr) {
-						if appErr.StatusCode != tt.errStatus {
-							t.Errorf("SendHttpRequest() error status = %d, wantStatus %d", appErr.StatusCode, tt.errStatus)
-						}
+					var statusErr *HTTPStatusError
+					if !errors.As(err, &statusErr) {
+						t.Errorf("SendHttpRequest() error = %v, want HTTPStatusError", err)
+					} else if statusErr.StatusCode != tt.errStatus {
+						t.Errorf("SendHttpRequest() error status = %d, wantStatus %d", statusErr.StatusCode, tt.errStatus)
+					}
+					if code := ErrorCodeOf(err); code != CodeUpstreamUnavailable {
+						t.Errorf("SendHttpRequest() error code = %d, want %d", code, CodeUpstreamUnavailable)
+					}
+					if !IsRetryable(err) {
+						t.Errorf("SendHttpRequest() error should be retryable for status %d", tt.errStatus)
 					}
 				}
 			}
@@ -177,3 +184,26 @@ func TestSendHttpRequest(t *testing.T) {
 		})
 	}
 }
+
+func TestSendHttpRequestWithContext(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(500 * time.Millisecond)
+		fmt.Fprint(w, `{"status":"delayed"}`)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+	}()
+
+	start := time.Now()
+	_, err := SendHttpRequestWithContext(ctx, "GET", server.URL, nil, nil)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("SendHttpRequestWithContext() error = %v, want context.Canceled", err)
+	}
+	if elapsed := time.Since(start); elapsed > 300*time.Millisecond {
+		t.Errorf("SendHttpRequestWithContext() returned after %s, want immediate return on cancel", elapsed)
+	}
+}
@@ -0,0 +1,233 @@
+package cmn
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	neturl "net/url"
+	"strings"
+	"unicode/utf8"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// HttpLogConfig HTTP 请求日志配置（脱敏、截断与级别），出站 HttpClient 与入站日志中间件共用
+type HttpLogConfig struct {
+	// RedactHeaders 需要脱敏的请求头/响应头，不区分大小写
+	RedactHeaders []string
+	// RedactFields 需要脱敏的 JSON 字段（任意层级）与 URL/表单参数，不区分大小写且忽略 _ 与 -，
+	// 如 session_key 同时匹配 sessionKey、SESSION-KEY
+	RedactFields []string
+
+	LogHeaders   bool // 是否记录请求头与响应头（已脱敏）
+	LogBody      bool // 是否记录请求体与响应体（已脱敏并截断）
+	MaxBodyBytes int  // 记录的请求体/响应体最大长度，默认 2048
+
+	// 按状态码选择日志级别，默认 2xx/3xx 为 Info、4xx 为 Warn、5xx 为 Error
+	SuccessLevel     zapcore.Level
+	ClientErrorLevel zapcore.Level
+	ServerErrorLevel zapcore.Level
+}
+
+// DefaultHttpLogConfig 默认日志配置：脱敏常见的凭证与个人信息字段，不记录请求头与请求体
+func DefaultHttpLogConfig() *HttpLogConfig {
+	return &HttpLogConfig{
+		RedactHeaders: append([]string(nil), SensitiveHeaders...),
+		RedactFields: []string{
+			"password", "secret", "appsecret", "client_secret", "token", "access_token", "refresh_token",
+			"session_key", "api_key", "authorization", "id_card", "phone", "mobile",
+		},
+		MaxBodyBytes:     2048,
+		SuccessLevel:     zapcore.InfoLevel,
+		ClientErrorLevel: zapcore.WarnLevel,
+		ServerErrorLevel: zapcore.ErrorLevel,
+	}
+}
+
+// defaultHttpLogConfig 未配置时使用的日志配置
+var defaultHttpLogConfig = DefaultHttpLogConfig()
+
+// LevelForStatus 返回状态码对应的日志级别
+func (c *HttpLogConfig) LevelForStatus(status int) zapcore.Level {
+	switch {
+	case status >= 500:
+		return c.ServerErrorLevel
+	case status >= 400:
+		return c.ClientErrorLevel
+	default:
+		return c.SuccessLevel
+	}
+}
+
+// normalizeFieldName 统一字段名：小写并去掉 _ 与 -
+func normalizeFieldName(name string) string {
+	return strings.NewReplacer("_", "", "-", "").Replace(strings.ToLower(name))
+}
+
+// redactField 判断字段是否需要脱敏
+func (c *HttpLogConfig) redactField(name string) bool {
+	name = normalizeFieldName(name)
+	for _, field := range c.RedactFields {
+		if normalizeFieldName(field) == name {
+			return true
+		}
+	}
+	return false
+}
+
+// RedactHeader 返回脱敏后的请求头（多个值以逗号连接）
+func (c *HttpLogConfig) RedactHeader(header http.Header) map[string]string {
+	result := make(map[string]string, len(header))
+	for k, values := range header {
+		value := strings.Join(values, ", ")
+		for _, name := range c.RedactHeaders {
+			if strings.EqualFold(k, name) {
+				value = redactedValue
+				break
+			}
+		}
+		result[k] = value
+	}
+	return result
+}
+
+// RedactURL 返回查询参数脱敏后的 URL（同时脱敏 URL 中的用户名密码）
+func (c *HttpLogConfig) RedactURL(rawURL string) string {
+	u, err := neturl.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	if u.User != nil {
+		u.User = neturl.User(redactedValue)
+	}
+	if u.RawQuery != "" {
+		u.RawQuery = c.redactValues(u.RawQuery)
+	}
+	return u.String()
+}
+
+// redactValues 脱敏 URL 编码的参数，保持参数顺序
+func (c *HttpLogConfig) redactValues(raw string) string {
+	pairs := strings.Split(raw, "&")
+	for i, pair := range pairs {
+		key, _, hasValue := strings.Cut(pair, "=")
+		name, err := neturl.QueryUnescape(key)
+		if err != nil {
+			name = key
+		}
+		if hasValue && c.redactField(name) {
+			pairs[i] = key + "=" + redactedValue
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+// RedactBody 返回脱敏并截断后的请求体/响应体
+//   - JSON：按 RedactFields 脱敏任意层级的字段
+//   - application/x-www-form-urlencoded：按 RedactFields 脱敏参数
+//   - 不完整的 JSON（如只截取了开头）无法脱敏，只记录长度
+//   - 其它文本原样记录，非文本只记录长度
+func (c *HttpLogConfig) RedactBody(body []byte, contentType string) string {
+	if len(body) == 0 {
+		return ""
+	}
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	text := ""
+	trimmed := bytes.TrimSpace(body)
+	switch {
+	case mediaType == "application/x-www-form-urlencoded":
+		text = c.redactValues(string(body))
+	case json.Valid(body):
+		text = c.redactJSON(body)
+	case strings.HasSuffix(mediaType, "json") || bytes.HasPrefix(trimmed, []byte("{")) || bytes.HasPrefix(trimmed, []byte("[")):
+		return fmt.Sprintf("[invalid or truncated json %d bytes]", len(body))
+	case utf8.Valid(body) && (mediaType == "" || strings.HasPrefix(mediaType, "text/") ||
+		strings.HasSuffix(mediaType, "json") || strings.HasSuffix(mediaType, "xml")):
+		text = string(body)
+	default:
+		return fmt.Sprintf("[%s %d bytes]", mediaType, len(body))
+	}
+	return c.truncate(text, len(body))
+}
+
+// redactJSON 脱敏 JSON 中的字段
+func (c *HttpLogConfig) redactJSON(body []byte) string {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var v interface{}
+	if err := decoder.Decode(&v); err != nil {
+		return string(body)
+	}
+	redacted, err := json.Marshal(c.redactJSONValue(v))
+	if err != nil {
+		return string(body)
+	}
+	return string(redacted)
+}
+
+func (c *HttpLogConfig) redactJSONValue(v interface{}) interface{} {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		for k, item := range value {
+			if c.redactField(k) {
+				value[k] = redactedValue
+			} else {
+				value[k] = c.redactJSONValue(item)
+			}
+		}
+	case []interface{}:
+		for i, item := range value {
+			value[i] = c.redactJSONValue(item)
+		}
+	}
+	return v
+}
+
+// truncate 超过 MaxBodyBytes 时截断（不截断多字节字符），并注明原始长度
+func (c *HttpLogConfig) truncate(text string, size int) string {
+	limit := c.MaxBodyBytes
+	if limit <= 0 {
+		limit = 2048
+	}
+	if len(text) <= limit {
+		return text
+	}
+	cut := limit
+	for cut > 0 && !utf8.RuneStart(text[cut]) {
+		cut--
+	}
+	return fmt.Sprintf("%s...(truncated, %d bytes)", text[:cut], size)
+}
+
+// bodyFields 按配置返回请求体与响应体的日志字段
+func (c *HttpLogConfig) bodyFields(reqBody []byte, reqContentType string, respBody []byte, respContentType string) []zap.Field {
+	if !c.LogBody {
+		return nil
+	}
+	var fields []zap.Field
+	if len(reqBody) > 0 {
+		fields = append(fields, zap.String("request_body", c.RedactBody(reqBody, reqContentType)))
+	}
+	if len(respBody) > 0 {
+		fields = append(fields, zap.String("response_body", c.RedactBody(respBody, respContentType)))
+	}
+	return fields
+}
+
+// headerFields 按配置返回请求头与响应头的日志字段
+func (c *HttpLogConfig) headerFields(reqHeader, respHeader http.Header) []zap.Field {
+	if !c.LogHeaders {
+		return nil
+	}
+	var fields []zap.Field
+	if len(reqHeader) > 0 {
+		fields = append(fields, zap.Any("request_headers", c.RedactHeader(reqHeader)))
+	}
+	if len(respHeader) > 0 {
+		fields = append(fields, zap.Any("response_headers", c.RedactHeader(respHeader)))
+	}
+	return fields
+}
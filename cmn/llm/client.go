@@ -0,0 +1,323 @@
+// Package llm OpenAI 兼容的大模型对话客户端（阿里云百炼、火山方舟等），
+// 支持图文消息、SSE 流式输出、工具调用与用量统计，按顺序在多个服务商之间回退
+//
+//	client, err := llm.NewClient(llm.ConfigFromViper(), nil)
+//	resp, err := client.Chat(ctx, &llm.ChatRequest{Messages: []llm.Message{
+//		llm.SystemMessage("你是一个简洁的助手"),
+//		llm.UserMessage("你好"),
+//	}})
+//	fmt.Println(resp.Message.Text(), resp.Usage.TotalTokens)
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"my_template/cmn"
+
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// Provider 一个 OpenAI 兼容的服务商
+type Provider struct {
+	Name        string // 日志、用量与错误中的名称，如 aliyun、zijie
+	URL         string // chat/completions 完整地址
+	APIKey      string
+	Model       string // 纯文本对话使用的模型
+	VisionModel string // 消息包含图片时使用的模型，为空时使用 Model
+}
+
+// Config 客户端配置
+type Config struct {
+	Providers []Provider // 按顺序尝试，前一个失败时回退到下一个
+
+	// OnUsage 每次调用成功后回调（流式调用在收到用量时回调），可用于计费与统计
+	OnUsage func(ctx context.Context, provider, model string, usage Usage)
+}
+
+// providerNames ConfigFromViper 读取的服务商，按回退顺序
+var providerNames = []string{"aliyun", "zijie"}
+
+// ProviderFromViper 读取配置文件中 name 下的 ApiKey、url、model 与 languageModel：
+// 设置了 languageModel 时纯文本使用 languageModel、图文使用 model，否则都使用 model
+func ProviderFromViper(name string) Provider {
+	model := viper.GetString(name + ".model")
+	p := Provider{
+		Name:        name,
+		URL:         viper.GetString(name + ".url"),
+		APIKey:      viper.GetString(name + ".ApiKey"),
+		Model:       model,
+		VisionModel: model,
+	}
+	if languageModel := viper.GetString(name + ".languageModel"); languageModel != "" {
+		p.Model = languageModel
+	}
+	return p
+}
+
+// ConfigFromViper 按 aliyun、zijie 的顺序读取配置，跳过未配置 url 或 ApiKey 的服务商
+func ConfigFromViper() *Config {
+	config := &Config{}
+	for _, name := range providerNames {
+		if p := ProviderFromViper(name); p.URL != "" && p.APIKey != "" {
+			config.Providers = append(config.Providers, p)
+		}
+	}
+	return config
+}
+
+// Usage 本次调用消耗的 token 数
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// ChatRequest 对话请求
+type ChatRequest struct {
+	Messages    []Message
+	Tools       []Tool
+	ToolChoice  interface{} // "auto"、"none"、"required" 或指定函数，为空时由模型决定
+	Temperature *float64
+	TopP        *float64
+	MaxTokens   int
+	Stop        []string
+
+	Provider string // 只使用该服务商（不回退），为空时按配置顺序回退
+	Model    string // 覆盖服务商配置的模型；没有指定 Provider 时只使用第一个服务商（不回退），模型名不能跨服务商使用
+}
+
+// HasImage 请求是否包含图片
+func (r *ChatRequest) HasImage() bool {
+	for _, m := range r.Messages {
+		if m.HasImage() {
+			return true
+		}
+	}
+	return false
+}
+
+// ChatResponse 对话结果
+type ChatResponse struct {
+	ID           string  `json:"id"`
+	Provider     string  `json:"provider"` // 实际使用的服务商
+	Model        string  `json:"model"`
+	Message      Message `json:"message"`
+	FinishReason string  `json:"finishReason"` // stop、length、tool_calls、content_filter
+	Usage        Usage   `json:"usage"`
+}
+
+// Client 大模型对话客户端，并发安全
+type Client struct {
+	providers []Provider
+	onUsage   func(ctx context.Context, provider, model string, usage Usage)
+	client    *cmn.HttpClient
+}
+
+// NewClient 创建客户端，httpClient 为空时使用单次 2 分钟超时、不重试的客户端（失败时回退到下一个服务商）
+// 流式输出的总时长同样受单次超时限制，长回复需要传入超时更长的客户端
+func NewClient(config *Config, httpClient *cmn.HttpClient) (*Client, error) {
+	if config == nil || len(config.Providers) == 0 {
+		return nil, errors.New("llm: 没有配置服务商")
+	}
+	names := make(map[string]bool, len(config.Providers))
+	for _, p := range config.Providers {
+		if p.Name == "" || p.URL == "" || p.APIKey == "" || p.Model == "" {
+			return nil, fmt.Errorf("llm: 服务商 %q 的 name、url、ApiKey 与 model 不能为空", p.Name)
+		}
+		if names[p.Name] {
+			return nil, fmt.Errorf("llm: 服务商 %q 重复", p.Name)
+		}
+		names[p.Name] = true
+	}
+
+	c := &Client{providers: config.Providers, onUsage: config.OnUsage, client: httpClient}
+	if c.client == nil {
+		c.client = cmn.NewHttpClient(&cmn.HttpClientConfig{Timeout: 2 * time.Minute})
+	}
+	return c, nil
+}
+
+// Providers 返回按回退顺序排列的服务商名称
+func (c *Client) Providers() []string {
+	names := make([]string, len(c.providers))
+	for i, p := range c.providers {
+		names[i] = p.Name
+	}
+	return names
+}
+
+// providersFor 返回本次请求按顺序尝试的服务商
+func (c *Client) providersFor(req *ChatRequest) ([]Provider, error) {
+	if req.Provider == "" {
+		if req.Model != "" {
+			return c.providers[:1], nil
+		}
+		return c.providers, nil
+	}
+	for _, p := range c.providers {
+		if p.Name == req.Provider {
+			return []Provider{p}, nil
+		}
+	}
+	return nil, cmn.NewAppError(CodeLLMMisconfigured, "未配置大模型服务商 "+req.Provider).WithDetail("provider", req.Provider)
+}
+
+// Chat 发送对话请求，服务商失败时（请求无效除外）回退到下一个服务商
+func (c *Client) Chat(ctx context.Context, req *ChatRequest) (*ChatResponse, error) {
+	providers, err := c.providersFor(req)
+	if err != nil {
+		return nil, err
+	}
+	var lastErr error
+	for i, p := range providers {
+		if i > 0 {
+			logFallback(providers[i-1].Name, p.Name, lastErr)
+		}
+		resp, err := c.chat(ctx, p, req)
+		if err == nil {
+			return resp, nil
+		}
+		if !shouldFallback(ctx, err) {
+			return nil, err
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+// logFallback 记录回退到下一个服务商
+func logFallback(from, to string, err error) {
+	cmn.Logger().Warn("大模型调用失败，回退到下一个服务商", zap.String("provider", from), zap.String("next", to), zap.Error(err))
+}
+
+// completionRequest chat/completions 请求体
+type completionRequest struct {
+	Model         string         `json:"model"`
+	Messages      []Message      `json:"messages"`
+	Tools         []Tool         `json:"tools,omitempty"`
+	ToolChoice    interface{}    `json:"tool_choice,omitempty"`
+	Temperature   *float64       `json:"temperature,omitempty"`
+	TopP          *float64       `json:"top_p,omitempty"`
+	MaxTokens     int            `json:"max_tokens,omitempty"`
+	Stop          []string       `json:"stop,omitempty"`
+	Stream        bool           `json:"stream,omitempty"`
+	StreamOptions *streamOptions `json:"stream_options,omitempty"`
+}
+
+type streamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+// completionResponse chat/completions 响应体，流式时为每个事件的 data
+type completionResponse struct {
+	ID      string `json:"id"`
+	Model   string `json:"model"`
+	Choices []struct {
+		Message      Message `json:"message"`
+		Delta        delta   `json:"delta"`
+		FinishReason string  `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *Usage    `json:"usage"`
+	Error *APIError `json:"error"`
+}
+
+// delta 流式响应的增量
+type delta struct {
+	Content   string          `json:"content"`
+	ToolCalls []ToolCallDelta `json:"tool_calls"`
+}
+
+// newRequest 构造发送给服务商的请求
+func (p Provider) newRequest(req *ChatRequest, stream bool) (*cmn.HttpRequest, error) {
+	model := req.Model
+	if model == "" {
+		model = p.Model
+		if p.VisionModel != "" && req.HasImage() {
+			model = p.VisionModel
+		}
+	}
+	body := completionRequest{
+		Model:       model,
+		Messages:    req.Messages,
+		Tools:       req.Tools,
+		ToolChoice:  req.ToolChoice,
+		Temperature: req.Temperature,
+		TopP:        req.TopP,
+		MaxTokens:   req.MaxTokens,
+		Stop:        req.Stop,
+	}
+	if stream {
+		body.Stream = true
+		body.StreamOptions = &streamOptions{IncludeUsage: true}
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, cmn.WrapError(cmn.CodeInternal, err)
+	}
+	return &cmn.HttpRequest{
+		Method: http.MethodPost,
+		URL:    p.URL,
+		Header: map[string]string{"Content-Type": "application/json", "Authorization": "Bearer " + p.APIKey},
+		Body:   data,
+	}, nil
+}
+
+// chat 向一个服务商发送非流式请求
+func (c *Client) chat(ctx context.Context, p Provider, req *ChatRequest) (*ChatResponse, error) {
+	httpReq, err := p.newRequest(req, false)
+	if err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	resp, err := c.client.Do(ctx, httpReq)
+	if err != nil {
+		return nil, providerError(p.Name, err)
+	}
+
+	var result completionResponse
+	if err := json.Unmarshal(resp.Body, &result); err != nil {
+		return nil, cmn.NewAppError(CodeLLMError, "大模型响应不是合法的 JSON").WithDetail("provider", p.Name).WithCause(err)
+	}
+	if result.Error != nil {
+		result.Error.Provider, result.Error.StatusCode = p.Name, resp.StatusCode
+		return nil, apiErrorOf(result.Error)
+	}
+	if len(result.Choices) == 0 {
+		return nil, cmn.NewAppError(CodeLLMError, "大模型没有返回结果").WithDetail("provider", p.Name)
+	}
+
+	out := &ChatResponse{
+		ID:           result.ID,
+		Provider:     p.Name,
+		Model:        result.Model,
+		Message:      result.Choices[0].Message,
+		FinishReason: result.Choices[0].FinishReason,
+	}
+	if result.Usage != nil {
+		out.Usage = *result.Usage
+	}
+	c.reportUsage(ctx, p.Name, out.Model, out.Usage, time.Since(start), false)
+	return out, nil
+}
+
+// reportUsage 记录用量日志并回调 OnUsage
+func (c *Client) reportUsage(ctx context.Context, provider, model string, usage Usage, latency time.Duration, stream bool) {
+	cmn.Logger().Info("大模型调用完成",
+		zap.String("provider", provider),
+		zap.String("model", model),
+		zap.Bool("stream", stream),
+		zap.Int("prompt_tokens", usage.PromptTokens),
+		zap.Int("completion_tokens", usage.CompletionTokens),
+		zap.Int("total_tokens", usage.TotalTokens),
+		zap.Duration("latency", latency),
+	)
+	if c.onUsage != nil {
+		c.onUsage(ctx, provider, model, usage)
+	}
+}
@@ -0,0 +1,276 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+
+	"my_template/cmn"
+	"my_template/cmn/llm/llmtest"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+// usageRecorder 記錄 OnUsage 回調
+type usageRecorder struct {
+	mu      sync.Mutex
+	records []string
+	usages  []Usage
+}
+
+func (r *usageRecorder) observe(_ context.Context, provider, model string, usage Usage) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.records = append(r.records, provider+"/"+model)
+	r.usages = append(r.usages, usage)
+}
+
+// newTestClient 返回依次使用 aliyun、zijie 兩個本地模擬服務商的客戶端
+func newTestClient(t *testing.T) (*Client, *llmtest.Server, *llmtest.Server, *usageRecorder) {
+	aliyun := llmtest.NewServer("sk-aliyun")
+	t.Cleanup(aliyun.Close)
+	zijie := llmtest.NewServer("sk-zijie")
+	t.Cleanup(zijie.Close)
+
+	recorder := &usageRecorder{}
+	client, err := NewClient(&Config{
+		Providers: []Provider{
+			{Name: "aliyun", URL: aliyun.ChatURL(), APIKey: "sk-aliyun", Model: "qwen-max-latest", VisionModel: "qwen-vl-max-latest"},
+			{Name: "zijie", URL: zijie.ChatURL(), APIKey: "sk-zijie", Model: "doubao-1.5-vision-pro"},
+		},
+		OnUsage: recorder.observe,
+	}, nil)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	return client, aliyun, zijie, recorder
+}
+
+func TestChat(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("文本對話使用文本模型並報告用量", func(t *testing.T) {
+		client, aliyun, _, recorder := newTestClient(t)
+
+		resp, err := client.Chat(ctx, &ChatRequest{Messages: []Message{SystemMessage("簡潔"), UserMessage("你好")}})
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Equal(t, "aliyun", resp.Provider)
+		assert.Equal(t, "qwen-max-latest", resp.Model)
+		assert.Equal(t, RoleAssistant, resp.Message.Role)
+		assert.Equal(t, "echo: 你好", resp.Message.Text())
+		assert.Equal(t, "stop", resp.FinishReason)
+		assert.Equal(t, Usage{PromptTokens: 4, CompletionTokens: 8, TotalTokens: 12}, resp.Usage)
+		assert.Equal(t, []string{"aliyun/qwen-max-latest"}, recorder.records)
+
+		requests := aliyun.Requests()
+		if assert.Len(t, requests, 1) {
+			assert.False(t, requests[0].Stream)
+			assert.Equal(t, "簡潔", requests[0].Messages[0]["content"])
+		}
+	})
+
+	t.Run("圖片消息使用視覺模型", func(t *testing.T) {
+		client, aliyun, _, _ := newTestClient(t)
+
+		resp, err := client.Chat(ctx, &ChatRequest{Messages: []Message{
+			ImageMessage("這是什麼", "https://example.com/a.png", ImageDataURL("image/png", []byte{0x89, 'P', 'N', 'G'})),
+		}})
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Equal(t, "qwen-vl-max-latest", resp.Model)
+		assert.Equal(t, "echo: <image> <image> 這是什麼", resp.Message.Text())
+
+		parts := aliyun.Requests()[0].Messages[0]["content"].([]interface{})
+		if assert.Len(t, parts, 3) {
+			assert.Equal(t, "https://example.com/a.png", parts[0].(map[string]interface{})["image_url"].(map[string]interface{})["url"])
+			assert.Equal(t, "data:image/png;base64,iVBORw==", parts[1].(map[string]interface{})["image_url"].(map[string]interface{})["url"])
+		}
+	})
+
+	t.Run("工具調用與返回結果", func(t *testing.T) {
+		client, aliyun, _, _ := newTestClient(t)
+		aliyun.Enqueue(llmtest.Reply{ToolCalls: []llmtest.ToolCall{{ID: "call_1", Name: "get_weather", Arguments: `{"city":"上海"}`}}})
+		weather := FunctionTool("get_weather", "查詢城市天氣", map[string]interface{}{
+			"type":       "object",
+			"properties": map[string]interface{}{"city": map[string]string{"type": "string"}},
+		})
+
+		messages := []Message{UserMessage("上海天氣")}
+		resp, err := client.Chat(ctx, &ChatRequest{Messages: messages, Tools: []Tool{weather}})
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Equal(t, "tool_calls", resp.FinishReason)
+		if !assert.Len(t, resp.Message.ToolCalls, 1) {
+			return
+		}
+		call := resp.Message.ToolCalls[0]
+		assert.Equal(t, "get_weather", call.Function.Name)
+		var args struct{ City string }
+		assert.NoError(t, call.Function.Decode(&args))
+		assert.Equal(t, "上海", args.City)
+
+		messages = append(messages, resp.Message, ToolMessage(call.ID, "晴"))
+		_, err = client.Chat(ctx, &ChatRequest{Messages: messages, Tools: []Tool{weather}})
+		assert.NoError(t, err)
+
+		requests := aliyun.Requests()
+		assert.Equal(t, "get_weather", requests[0].Tools[0]["function"].(map[string]interface{})["name"])
+		assistant, tool := requests[1].Messages[1], requests[1].Messages[2]
+		assert.Nil(t, assistant["content"])
+		assert.Len(t, assistant["tool_calls"], 1)
+		assert.Equal(t, "call_1", tool["tool_call_id"])
+		assert.Equal(t, "晴", tool["content"])
+	})
+
+	t.Run("服務商不可用時回退到下一個", func(t *testing.T) {
+		client, aliyun, zijie, recorder := newTestClient(t)
+		aliyun.Enqueue(llmtest.Reply{Status: http.StatusServiceUnavailable, ErrorMessage: "overloaded"})
+
+		resp, err := client.Chat(ctx, &ChatRequest{Messages: []Message{UserMessage("你好")}})
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Equal(t, "zijie", resp.Provider)
+		assert.Equal(t, "doubao-1.5-vision-pro", resp.Model)
+		assert.Len(t, aliyun.Requests(), 1)
+		assert.Len(t, zijie.Requests(), 1)
+		assert.Equal(t, []string{"zijie/doubao-1.5-vision-pro"}, recorder.records)
+	})
+
+	t.Run("ApiKey 錯誤時回退，全部失敗返回最後一個錯誤", func(t *testing.T) {
+		client, aliyun, zijie, _ := newTestClient(t)
+		client.providers[0].APIKey = "wrong"
+		zijie.Enqueue(llmtest.Reply{Status: http.StatusTooManyRequests, ErrorCode: "rate_limit_exceeded"})
+
+		_, err := client.Chat(ctx, &ChatRequest{Messages: []Message{UserMessage("你好")}})
+		assert.Equal(t, CodeLLMUnavailable, cmn.ErrorCodeOf(err))
+		assert.True(t, cmn.IsRetryable(err))
+		var apiErr *APIError
+		if assert.True(t, errors.As(err, &apiErr)) {
+			assert.Equal(t, "zijie", apiErr.Provider)
+			assert.Equal(t, http.StatusTooManyRequests, apiErr.StatusCode)
+			assert.Equal(t, "rate_limit_exceeded", apiErr.Code)
+		}
+		assert.Len(t, aliyun.Requests(), 1)
+	})
+
+	t.Run("請求無效時不回退", func(t *testing.T) {
+		client, aliyun, zijie, _ := newTestClient(t)
+		aliyun.Enqueue(llmtest.Reply{Status: http.StatusBadRequest, ErrorCode: "data_inspection_failed", ErrorMessage: "Input data may contain inappropriate content."})
+
+		_, err := client.Chat(ctx, &ChatRequest{Messages: []Message{UserMessage("你好")}})
+		assert.Equal(t, CodeLLMInvalidRequest, cmn.ErrorCodeOf(err))
+		var appErr *cmn.AppError
+		if assert.True(t, errors.As(err, &appErr)) {
+			assert.Equal(t, http.StatusBadRequest, appErr.HTTPStatus())
+			assert.Equal(t, "aliyun", appErr.Details["provider"])
+		}
+		assert.Empty(t, zijie.Requests())
+	})
+
+	t.Run("指定服務商與模型時不回退", func(t *testing.T) {
+		client, aliyun, zijie, _ := newTestClient(t)
+		zijie.Enqueue(llmtest.Reply{Status: http.StatusInternalServerError})
+
+		_, err := client.Chat(ctx, &ChatRequest{Messages: []Message{UserMessage("你好")}, Provider: "zijie", Model: "doubao-pro"})
+		assert.Equal(t, CodeLLMUnavailable, cmn.ErrorCodeOf(err))
+		assert.Empty(t, aliyun.Requests())
+		assert.Equal(t, "doubao-pro", zijie.Requests()[0].Model)
+
+		_, err = client.Chat(ctx, &ChatRequest{Messages: []Message{UserMessage("你好")}, Provider: "openai"})
+		assert.Equal(t, CodeLLMMisconfigured, cmn.ErrorCodeOf(err))
+	})
+
+	t.Run("只指定模型時使用第一個服務商且不回退", func(t *testing.T) {
+		client, aliyun, zijie, _ := newTestClient(t)
+		aliyun.Enqueue(llmtest.Reply{Status: http.StatusInternalServerError})
+
+		_, err := client.Chat(ctx, &ChatRequest{Messages: []Message{UserMessage("你好")}, Model: "qwen-plus"})
+		assert.Equal(t, CodeLLMUnavailable, cmn.ErrorCodeOf(err))
+		if assert.Len(t, aliyun.Requests(), 1) {
+			assert.Equal(t, "qwen-plus", aliyun.Requests()[0].Model)
+		}
+		assert.Empty(t, zijie.Requests(), "模型名不會發送給其它服務商")
+	})
+
+	t.Run("ctx 已取消時不回退", func(t *testing.T) {
+		client, _, zijie, _ := newTestClient(t)
+		canceled, cancel := context.WithCancel(ctx)
+		cancel()
+
+		_, err := client.Chat(canceled, &ChatRequest{Messages: []Message{UserMessage("你好")}})
+		assert.True(t, errors.Is(err, context.Canceled))
+		assert.Empty(t, zijie.Requests())
+	})
+}
+
+func TestMessageJSON(t *testing.T) {
+	t.Run("文本、圖文與工具調用消息", func(t *testing.T) {
+		data, err := json.Marshal([]Message{
+			UserMessage("你好"),
+			ImageMessage("", "https://example.com/a.png"),
+			{Role: RoleAssistant, ToolCalls: []ToolCall{{ID: "c1", Type: "function", Function: FunctionCall{Name: "f", Arguments: "{}"}}}},
+		})
+		assert.NoError(t, err)
+		assert.JSONEq(t, `[
+			{"role":"user","content":"你好"},
+			{"role":"user","content":[{"type":"image_url","image_url":{"url":"https://example.com/a.png"}}]},
+			{"role":"assistant","content":null,"tool_calls":[{"id":"c1","type":"function","function":{"name":"f","arguments":"{}"}}]}
+		]`, string(data))
+
+		var messages []Message
+		assert.NoError(t, json.Unmarshal(data, &messages))
+		assert.Equal(t, "你好", messages[0].Content)
+		assert.True(t, messages[1].HasImage())
+		assert.Equal(t, "c1", messages[2].ToolCalls[0].ID)
+	})
+}
+
+func TestConfigFromViper(t *testing.T) {
+	defer viper.Reset()
+	viper.Set("aliyun.ApiKey", "sk-1")
+	viper.Set("aliyun.url", "https://dashscope.aliyuncs.com/compatible-mode/v1/chat/completions")
+	viper.Set("aliyun.model", "qwen-vl-max-latest")
+	viper.Set("aliyun.languageModel", "qwen-max-latest")
+	viper.Set("zijie.url", "https://ark.cn-beijing.volces.com/api/v3/chat/completions")
+	viper.Set("zijie.model", "doubao-1.5-vision-pro-250328")
+
+	t.Run("languageModel 用於文本，model 用於圖片，未配置 ApiKey 的跳過", func(t *testing.T) {
+		config := ConfigFromViper()
+		if !assert.Len(t, config.Providers, 1) {
+			return
+		}
+		assert.Equal(t, Provider{
+			Name:        "aliyun",
+			URL:         "https://dashscope.aliyuncs.com/compatible-mode/v1/chat/completions",
+			APIKey:      "sk-1",
+			Model:       "qwen-max-latest",
+			VisionModel: "qwen-vl-max-latest",
+		}, config.Providers[0])
+
+		viper.Set("zijie.ApiKey", "sk-2")
+		config = ConfigFromViper()
+		if assert.Len(t, config.Providers, 2) {
+			assert.Equal(t, "doubao-1.5-vision-pro-250328", config.Providers[1].Model)
+			assert.Equal(t, "doubao-1.5-vision-pro-250328", config.Providers[1].VisionModel)
+		}
+	})
+
+	t.Run("配置校驗", func(t *testing.T) {
+		_, err := NewClient(&Config{}, nil)
+		assert.Error(t, err)
+		_, err = NewClient(&Config{Providers: []Provider{{Name: "a", URL: "http://x", APIKey: "k"}}}, nil)
+		assert.Error(t, err)
+		p := Provider{Name: "a", URL: "http://x", APIKey: "k", Model: "m"}
+		_, err = NewClient(&Config{Providers: []Provider{p, p}}, nil)
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,115 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"my_template/cmn"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// 大模型接口错误码（框架内置范围 1200-1299），Details 中的 provider 为出错的服务商，status 为其 HTTP 状态码
+const (
+	CodeLLMError          = 1200 // 其它大模型接口错误
+	CodeLLMUnavailable    = 1201 // 限流、服务端错误或网络错误，可稍后重试
+	CodeLLMInvalidRequest = 1202 // 请求无效（上下文过长、内容审核不通过、图片无法识别等），换服务商通常也无法成功，不回退
+	CodeLLMMisconfigured  = 1203 // ApiKey、模型或地址错误，或没有可用的服务商
+)
+
+func init() {
+	defs := []cmn.ErrorDef{
+		{Code: CodeLLMError, HTTPStatus: http.StatusBadGateway, Level: zapcore.ErrorLevel,
+			Messages: map[string]string{"zh": "大模型接口错误（{provider}）", "en": "LLM API error ({provider})"}},
+		{Code: CodeLLMUnavailable, HTTPStatus: http.StatusServiceUnavailable, Level: zapcore.WarnLevel, Retryable: true,
+			Messages: map[string]string{"zh": "大模型服务繁忙，请稍后再试", "en": "LLM service is busy, please try again later"}},
+		{Code: CodeLLMInvalidRequest, HTTPStatus: http.StatusBadRequest, Level: zapcore.WarnLevel,
+			Messages: map[string]string{"zh": "大模型无法处理该请求", "en": "The LLM could not process this request"}},
+		{Code: CodeLLMMisconfigured, HTTPStatus: http.StatusInternalServerError, Level: zapcore.ErrorLevel,
+			Messages: map[string]string{"zh": "大模型接口配置错误", "en": "LLM API is misconfigured"}},
+	}
+	for _, def := range defs {
+		cmn.DefineError(def)
+	}
+}
+
+// APIError 服务商返回的 OpenAI 格式错误（{"error": {...}}），作为 AppError 的 Cause
+type APIError struct {
+	Provider   string `json:"-"`
+	StatusCode int    `json:"-"`
+	Type       string `json:"type"`
+	Code       string `json:"-"` // 服务商的错误码，如 invalid_api_key、rate_limit_exceeded
+	Message    string `json:"message"`
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s http status %d: %s (%s)", e.Provider, e.StatusCode, e.Message, e.Code)
+}
+
+// UnmarshalJSON code 可能是字符串或数字
+func (e *APIError) UnmarshalJSON(data []byte) error {
+	type alias APIError
+	aux := struct {
+		*alias
+		Code json.RawMessage `json:"code"`
+	}{alias: (*alias)(e)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	if len(aux.Code) > 0 && string(aux.Code) != "null" {
+		e.Code = strings.Trim(string(aux.Code), `"`)
+	}
+	return nil
+}
+
+// newAPIError 按 HTTP 状态码把服务商的错误响应转换为 AppError
+func newAPIError(provider string, status int, body []byte) *cmn.AppError {
+	apiErr := &APIError{Provider: provider, StatusCode: status}
+	var payload struct {
+		Error *APIError `json:"error"`
+	}
+	if json.Unmarshal(body, &payload) == nil && payload.Error != nil {
+		apiErr.Type, apiErr.Code, apiErr.Message = payload.Error.Type, payload.Error.Code, payload.Error.Message
+	} else {
+		apiErr.Message = string(body)
+	}
+	return apiErrorOf(apiErr)
+}
+
+// apiErrorOf 返回 APIError 对应的 AppError
+func apiErrorOf(apiErr *APIError) *cmn.AppError {
+	code := CodeLLMError
+	switch status := apiErr.StatusCode; {
+	case status == http.StatusBadRequest || status == http.StatusRequestEntityTooLarge || status == http.StatusUnprocessableEntity:
+		code = CodeLLMInvalidRequest
+	case status == http.StatusUnauthorized || status == http.StatusForbidden || status == http.StatusNotFound:
+		code = CodeLLMMisconfigured
+	case status == http.StatusTooManyRequests || status >= 500:
+		code = CodeLLMUnavailable
+	}
+	return cmn.NewCodeError(code).
+		WithDetail("provider", apiErr.Provider).
+		WithDetail("status", apiErr.StatusCode).
+		WithCause(apiErr)
+}
+
+// providerError 把 HttpClient 返回的错误转换为 AppError，ctx 取消或超时原样返回
+func providerError(provider string, err error) error {
+	var statusErr *cmn.HTTPStatusError
+	if errors.As(err, &statusErr) {
+		return newAPIError(provider, statusErr.StatusCode, statusErr.Body)
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+	return cmn.WrapError(CodeLLMUnavailable, err).WithDetail("provider", provider)
+}
+
+// shouldFallback 判断失败后是否回退到下一个服务商：ctx 已结束或请求本身无效时不回退
+func shouldFallback(ctx context.Context, err error) bool {
+	return ctx.Err() == nil && cmn.ErrorCodeOf(err) != CodeLLMInvalidRequest
+}
@@ -0,0 +1,272 @@
+// Package llmtest 本地模拟的 OpenAI 兼容 chat/completions 接口，用于测试大模型调用而不访问服务商
+//
+//	server := llmtest.NewServer("sk-test")
+//	defer server.Close()
+//	server.Enqueue(llmtest.Reply{Content: "你好"}, llmtest.Reply{Status: 503})
+//	client, _ := llm.NewClient(&llm.Config{Providers: []llm.Provider{
+//		{Name: "aliyun", URL: server.ChatURL(), APIKey: "sk-test", Model: "qwen-max-latest"},
+//	}}, nil)
+package llmtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ChatPath chat/completions 接口路径
+const ChatPath = "/v1/chat/completions"
+
+// Server 模拟 chat/completions：校验 Bearer ApiKey，按顺序返回预设的回复，没有预设时回显最后一条用户消息
+type Server struct {
+	*httptest.Server
+	apiKey string
+
+	mu       sync.Mutex
+	replies  []Reply
+	requests []Request
+}
+
+// Reply 预设的回复
+type Reply struct {
+	Content      string
+	ToolCalls    []ToolCall
+	FinishReason string // 为空时有工具调用为 tool_calls，否则为 stop
+
+	// Status 不为 0 时返回该 HTTP 状态码与 OpenAI 格式的错误，ErrorCode 与 ErrorMessage 为错误内容
+	Status       int
+	ErrorCode    string
+	ErrorMessage string
+
+	// StreamError 流式输出内容之后以 error 事件结束，模拟中途失败
+	StreamError string
+}
+
+// ToolCall 预设的工具调用
+type ToolCall struct {
+	ID        string
+	Name      string
+	Arguments string // JSON
+}
+
+// Request 收到的请求
+type Request struct {
+	Model    string                   `json:"model"`
+	Stream   bool                     `json:"stream"`
+	Messages []map[string]interface{} `json:"messages"`
+	Tools    []map[string]interface{} `json:"tools"`
+	Body     []byte                   `json:"-"`
+}
+
+// NewServer 启动模拟服务器，使用完毕后调用 Close
+func NewServer(apiKey string) *Server {
+	s := &Server{apiKey: apiKey}
+	mux := http.NewServeMux()
+	mux.HandleFunc(ChatPath, s.chat)
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+// ChatURL 返回 chat/completions 接口地址，作为 llm.Provider.URL
+func (s *Server) ChatURL() string {
+	return s.URL + ChatPath
+}
+
+// Enqueue 追加预设的回复，每个请求按顺序使用一个
+func (s *Server) Enqueue(replies ...Reply) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.replies = append(s.replies, replies...)
+}
+
+// Requests 返回收到的请求（包括 ApiKey 错误的请求）
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+func (s *Server) chat(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	var req Request
+	if err := json.Unmarshal(body, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", "invalid JSON body")
+		return
+	}
+	req.Body = body
+
+	s.mu.Lock()
+	s.requests = append(s.requests, req)
+	reply := Reply{Content: "echo: " + lastUserText(req.Messages)}
+	authorized := r.Header.Get("Authorization") == "Bearer "+s.apiKey
+	if authorized && len(s.replies) > 0 {
+		reply = s.replies[0]
+		s.replies = s.replies[1:]
+	}
+	id := fmt.Sprintf("chatcmpl-%d", len(s.requests))
+	s.mu.Unlock()
+
+	switch {
+	case !authorized:
+		writeError(w, http.StatusUnauthorized, "invalid_api_key", "Incorrect API key provided")
+	case reply.Status != 0:
+		code := reply.ErrorCode
+		if code == "" {
+			code = http.StatusText(reply.Status)
+		}
+		writeError(w, reply.Status, code, reply.ErrorMessage)
+	case req.Stream:
+		s.stream(w, id, &req, &reply)
+	default:
+		message := map[string]interface{}{"role": "assistant", "content": reply.Content}
+		if len(reply.ToolCalls) > 0 {
+			calls := make([]map[string]interface{}, len(reply.ToolCalls))
+			for i, call := range reply.ToolCalls {
+				calls[i] = toolCall(call, call.Arguments)
+			}
+			message["tool_calls"] = calls
+		}
+		writeJSON(w, map[string]interface{}{
+			"id":      id,
+			"object":  "chat.completion",
+			"created": time.Now().Unix(),
+			"model":   req.Model,
+			"choices": []map[string]interface{}{{"index": 0, "message": message, "finish_reason": finishReason(&reply)}},
+			"usage":   usage(&req, &reply),
+		})
+	}
+}
+
+// stream 以 SSE 输出：角色、每两个字符一段的内容、分两段的工具调用参数、结束原因、用量与 [DONE]
+func (s *Server) stream(w http.ResponseWriter, id string, req *Request, reply *Reply) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	flusher, _ := w.(http.Flusher)
+	send := func(v interface{}) {
+		data, _ := json.Marshal(v)
+		fmt.Fprintf(w, "data: %s\n\n", data)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+	chunk := func(delta map[string]interface{}, finish interface{}) map[string]interface{} {
+		return map[string]interface{}{
+			"id":      id,
+			"object":  "chat.completion.chunk",
+			"model":   req.Model,
+			"choices": []map[string]interface{}{{"index": 0, "delta": delta, "finish_reason": finish}},
+		}
+	}
+
+	send(chunk(map[string]interface{}{"role": "assistant", "content": ""}, nil))
+	runes := []rune(reply.Content)
+	for i := 0; i < len(runes); i += 2 {
+		send(chunk(map[string]interface{}{"content": string(runes[i:min(i+2, len(runes))])}, nil))
+	}
+	for i, call := range reply.ToolCalls {
+		half := len(call.Arguments) / 2
+		first := toolCall(call, call.Arguments[:half])
+		first["index"] = i
+		send(chunk(map[string]interface{}{"tool_calls": []interface{}{first}}, nil))
+		send(chunk(map[string]interface{}{"tool_calls": []interface{}{
+			map[string]interface{}{"index": i, "function": map[string]interface{}{"arguments": call.Arguments[half:]}},
+		}}, nil))
+	}
+	if reply.StreamError != "" {
+		send(map[string]interface{}{"error": map[string]interface{}{"code": "internal_error", "message": reply.StreamError}})
+		return
+	}
+	send(chunk(map[string]interface{}{}, finishReason(reply)))
+
+	var options struct {
+		StreamOptions struct {
+			IncludeUsage bool `json:"include_usage"`
+		} `json:"stream_options"`
+	}
+	_ = json.Unmarshal(req.Body, &options)
+	if options.StreamOptions.IncludeUsage {
+		send(map[string]interface{}{"id": id, "object": "chat.completion.chunk", "model": req.Model,
+			"choices": []interface{}{}, "usage": usage(req, reply)})
+	}
+	fmt.Fprint(w, "data: [DONE]\n\n")
+}
+
+func toolCall(call ToolCall, arguments string) map[string]interface{} {
+	return map[string]interface{}{
+		"id":       call.ID,
+		"type":     "function",
+		"function": map[string]interface{}{"name": call.Name, "arguments": arguments},
+	}
+}
+
+func finishReason(reply *Reply) string {
+	switch {
+	case reply.FinishReason != "":
+		return reply.FinishReason
+	case len(reply.ToolCalls) > 0:
+		return "tool_calls"
+	default:
+		return "stop"
+	}
+}
+
+// usage 以字符数作为 token 数：prompt 为所有消息文本，completion 为回复内容与工具调用参数
+func usage(req *Request, reply *Reply) map[string]int {
+	prompt := 0
+	for _, m := range req.Messages {
+		prompt += len([]rune(messageText(m)))
+	}
+	completion := len([]rune(reply.Content))
+	for _, call := range reply.ToolCalls {
+		completion += len(call.Arguments)
+	}
+	return map[string]int{"prompt_tokens": prompt, "completion_tokens": completion, "total_tokens": prompt + completion}
+}
+
+// lastUserText 返回最后一条用户消息的文本，图片以 <image> 表示
+func lastUserText(messages []map[string]interface{}) string {
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i]["role"] == "user" {
+			return messageText(messages[i])
+		}
+	}
+	return ""
+}
+
+func messageText(m map[string]interface{}) string {
+	switch content := m["content"].(type) {
+	case string:
+		return content
+	case []interface{}:
+		var texts []string
+		for _, p := range content {
+			part, _ := p.(map[string]interface{})
+			if part["type"] == "image_url" {
+				texts = append(texts, "<image>")
+			} else if text, ok := part["text"].(string); ok {
+				texts = append(texts, text)
+			}
+		}
+		return strings.Join(texts, " ")
+	}
+	return ""
+}
+
+// writeError 返回 OpenAI 格式的错误
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": map[string]interface{}{"code": code, "type": "invalid_request_error", "message": message},
+	})
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,181 @@
+package llm
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+)
+
+// 消息角色
+const (
+	RoleSystem    = "system"
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+	RoleTool      = "tool"
+)
+
+// 内容片段类型
+const (
+	PartText  = "text"
+	PartImage = "image_url"
+)
+
+// Message 对话消息，Parts 不为空时以数组形式发送（图文混合），否则发送 Content
+type Message struct {
+	Role       string        `json:"role"`
+	Content    string        `json:"-"`
+	Parts      []ContentPart `json:"-"`
+	ToolCalls  []ToolCall    `json:"tool_calls,omitempty"`   // assistant 消息中的工具调用
+	ToolCallID string        `json:"tool_call_id,omitempty"` // tool 消息对应的调用 ID
+}
+
+// ContentPart 图文混合消息的片段
+type ContentPart struct {
+	Type     string    `json:"type"` // PartText 或 PartImage
+	Text     string    `json:"text,omitempty"`
+	ImageURL *ImageURL `json:"image_url,omitempty"`
+}
+
+// ImageURL 图片地址，可以是 http(s) 地址或 data URL（见 ImageDataURL）
+type ImageURL struct {
+	URL    string `json:"url"`
+	Detail string `json:"detail,omitempty"` // low、high 或 auto
+}
+
+// SystemMessage 系统提示词
+func SystemMessage(text string) Message {
+	return Message{Role: RoleSystem, Content: text}
+}
+
+// UserMessage 用户文本消息
+func UserMessage(text string) Message {
+	return Message{Role: RoleUser, Content: text}
+}
+
+// AssistantMessage 模型回复，用于构造多轮对话的历史
+func AssistantMessage(text string) Message {
+	return Message{Role: RoleAssistant, Content: text}
+}
+
+// ImageMessage 用户图文消息，text 为空时只发送图片
+func ImageMessage(text string, imageURLs ...string) Message {
+	m := Message{Role: RoleUser}
+	for _, url := range imageURLs {
+		m.Parts = append(m.Parts, ContentPart{Type: PartImage, ImageURL: &ImageURL{URL: url}})
+	}
+	if text != "" {
+		m.Parts = append(m.Parts, ContentPart{Type: PartText, Text: text})
+	}
+	return m
+}
+
+// ToolMessage 工具调用的执行结果
+func ToolMessage(toolCallID, content string) Message {
+	return Message{Role: RoleTool, ToolCallID: toolCallID, Content: content}
+}
+
+// ImageDataURL 把图片内容编码为 data URL，如 ImageDataURL("image/png", data)
+func ImageDataURL(mimeType string, data []byte) string {
+	return "data:" + mimeType + ";base64," + base64.StdEncoding.EncodeToString(data)
+}
+
+// Text 返回消息的文本内容（图文消息为所有文本片段）
+func (m Message) Text() string {
+	if len(m.Parts) == 0 {
+		return m.Content
+	}
+	var texts []string
+	for _, part := range m.Parts {
+		if part.Type == PartText {
+			texts = append(texts, part.Text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+// HasImage 消息是否包含图片
+func (m Message) HasImage() bool {
+	for _, part := range m.Parts {
+		if part.Type == PartImage {
+			return true
+		}
+	}
+	return false
+}
+
+// MarshalJSON content 为字符串或片段数组；只有工具调用的 assistant 消息 content 为 null
+func (m Message) MarshalJSON() ([]byte, error) {
+	type alias Message
+	var content interface{} = m.Content
+	if len(m.Parts) > 0 {
+		content = m.Parts
+	} else if m.Content == "" && len(m.ToolCalls) > 0 {
+		content = nil
+	}
+	return json.Marshal(struct {
+		alias
+		Content interface{} `json:"content"`
+	}{alias(m), content})
+}
+
+// UnmarshalJSON content 可能是字符串、片段数组或 null
+func (m *Message) UnmarshalJSON(data []byte) error {
+	type alias Message
+	aux := struct {
+		*alias
+		Content json.RawMessage `json:"content"`
+	}{alias: (*alias)(m)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	switch {
+	case len(aux.Content) == 0 || string(aux.Content) == "null":
+		return nil
+	case aux.Content[0] == '[':
+		return json.Unmarshal(aux.Content, &m.Parts)
+	default:
+		return json.Unmarshal(aux.Content, &m.Content)
+	}
+}
+
+// Tool 可供模型调用的工具（目前只有 function）
+type Tool struct {
+	Type     string      `json:"type"`
+	Function FunctionDef `json:"function"`
+}
+
+// FunctionDef 函数定义，Parameters 为 JSON Schema
+type FunctionDef struct {
+	Name        string      `json:"name"`
+	Description string      `json:"description,omitempty"`
+	Parameters  interface{} `json:"parameters,omitempty"`
+}
+
+// FunctionTool 定义一个函数工具
+//
+//	llm.FunctionTool("get_weather", "查询城市天气", map[string]interface{}{
+//		"type":       "object",
+//		"properties": map[string]interface{}{"city": map[string]string{"type": "string"}},
+//		"required":   []string{"city"},
+//	})
+func FunctionTool(name, description string, parameters interface{}) Tool {
+	return Tool{Type: "function", Function: FunctionDef{Name: name, Description: description, Parameters: parameters}}
+}
+
+// ToolCall 模型发起的工具调用
+type ToolCall struct {
+	ID       string       `json:"id"`
+	Type     string       `json:"type"`
+	Function FunctionCall `json:"function"`
+}
+
+// FunctionCall 函数名与 JSON 编码的参数
+type FunctionCall struct {
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+// Decode 把参数解码到 v
+func (c FunctionCall) Decode(v interface{}) error {
+	return json.Unmarshal([]byte(c.Arguments), v)
+}
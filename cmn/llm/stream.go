@@ -0,0 +1,147 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"iter"
+	"net/http"
+	"time"
+
+	"my_template/cmn"
+)
+
+// ChatChunk 流式输出的一个增量
+type ChatChunk struct {
+	ID           string
+	Provider     string
+	Model        string
+	Content      string          // 新增的文本
+	ToolCalls    []ToolCallDelta // 新增的工具调用片段，按 Index 合并
+	FinishReason string          // 最后一个内容增量设置
+	Usage        *Usage          // 服务商在最后单独发送用量时设置
+}
+
+// ToolCallDelta 工具调用的增量：第一个片段包含 ID 与函数名，之后的片段只包含部分参数
+type ToolCallDelta struct {
+	Index    int          `json:"index"`
+	ID       string       `json:"id"`
+	Type     string       `json:"type"`
+	Function FunctionCall `json:"function"`
+}
+
+// Append 把流式增量合并到响应中，流结束后与 Chat 的结果相同
+//
+//	var resp llm.ChatResponse
+//	for chunk, err := range client.ChatStream(ctx, req) {
+//		if err != nil {
+//			return err
+//		}
+//		fmt.Print(chunk.Content)
+//		resp.Append(chunk)
+//	}
+func (r *ChatResponse) Append(chunk ChatChunk) {
+	if chunk.ID != "" {
+		r.ID = chunk.ID
+	}
+	if chunk.Provider != "" {
+		r.Provider = chunk.Provider
+	}
+	if chunk.Model != "" {
+		r.Model = chunk.Model
+	}
+	r.Message.Role = RoleAssistant
+	r.Message.Content += chunk.Content
+	for _, d := range chunk.ToolCalls {
+		for len(r.Message.ToolCalls) <= d.Index {
+			r.Message.ToolCalls = append(r.Message.ToolCalls, ToolCall{Type: "function"})
+		}
+		call := &r.Message.ToolCalls[d.Index]
+		if d.ID != "" {
+			call.ID = d.ID
+		}
+		if d.Type != "" {
+			call.Type = d.Type
+		}
+		if d.Function.Name != "" {
+			call.Function.Name = d.Function.Name
+		}
+		call.Function.Arguments += d.Function.Arguments
+	}
+	if chunk.FinishReason != "" {
+		r.FinishReason = chunk.FinishReason
+	}
+	if chunk.Usage != nil {
+		r.Usage = *chunk.Usage
+	}
+}
+
+// ChatStream 以 SSE 流式输出对话结果，退出循环时关闭连接；
+// 收到第一个增量之前失败时回退到下一个服务商，之后失败产生一次错误后结束
+func (c *Client) ChatStream(ctx context.Context, req *ChatRequest) iter.Seq2[ChatChunk, error] {
+	return func(yield func(ChatChunk, error) bool) {
+		providers, err := c.providersFor(req)
+		if err != nil {
+			yield(ChatChunk{}, err)
+			return
+		}
+		var lastErr error
+		for i, p := range providers {
+			if i > 0 {
+				logFallback(providers[i-1].Name, p.Name, lastErr)
+			}
+			emitted, err := c.stream(ctx, p, req, yield)
+			if err == nil {
+				return
+			}
+			if emitted || !shouldFallback(ctx, err) {
+				yield(ChatChunk{}, err)
+				return
+			}
+			lastErr = err
+		}
+		yield(ChatChunk{}, lastErr)
+	}
+}
+
+// stream 从一个服务商流式读取，返回是否已输出过增量；调用方停止迭代时返回 nil
+func (c *Client) stream(ctx context.Context, p Provider, req *ChatRequest, yield func(ChatChunk, error) bool) (bool, error) {
+	httpReq, err := p.newRequest(req, true)
+	if err != nil {
+		return false, err
+	}
+	start := time.Now()
+	emitted := false
+	for event, err := range c.client.Events(ctx, httpReq) {
+		if err != nil {
+			return emitted, providerError(p.Name, err)
+		}
+		if event.Data == "[DONE]" {
+			break
+		}
+
+		var result completionResponse
+		if err := json.Unmarshal([]byte(event.Data), &result); err != nil {
+			return emitted, cmn.NewAppError(CodeLLMError, "大模型响应不是合法的 JSON").WithDetail("provider", p.Name).WithCause(err)
+		}
+		if result.Error != nil {
+			result.Error.Provider, result.Error.StatusCode = p.Name, http.StatusOK
+			return emitted, apiErrorOf(result.Error)
+		}
+
+		chunk := ChatChunk{ID: result.ID, Provider: p.Name, Model: result.Model, Usage: result.Usage}
+		if len(result.Choices) > 0 {
+			choice := result.Choices[0]
+			chunk.Content = choice.Delta.Content
+			chunk.ToolCalls = choice.Delta.ToolCalls
+			chunk.FinishReason = choice.FinishReason
+		}
+		if result.Usage != nil {
+			c.reportUsage(ctx, p.Name, result.Model, *result.Usage, time.Since(start), true)
+		}
+		emitted = true
+		if !yield(chunk, nil) {
+			return true, nil
+		}
+	}
+	return emitted, nil
+}
@@ -0,0 +1,111 @@
+package llm
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"my_template/cmn"
+	"my_template/cmn/llm/llmtest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// collect 讀取整個流，返回合併後的結果、增量個數與錯誤
+func collect(client *Client, req *ChatRequest) (*ChatResponse, int, error) {
+	var resp ChatResponse
+	chunks := 0
+	for chunk, err := range client.ChatStream(context.Background(), req) {
+		if err != nil {
+			return &resp, chunks, err
+		}
+		chunks++
+		resp.Append(chunk)
+	}
+	return &resp, chunks, nil
+}
+
+func TestChatStream(t *testing.T) {
+	t.Run("合併增量得到完整回覆與用量", func(t *testing.T) {
+		client, aliyun, _, recorder := newTestClient(t)
+		aliyun.Enqueue(llmtest.Reply{Content: "你好，我是助手"})
+
+		resp, chunks, err := collect(client, &ChatRequest{Messages: []Message{UserMessage("你好")}})
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Greater(t, chunks, 3)
+		assert.Equal(t, "你好，我是助手", resp.Message.Content)
+		assert.Equal(t, "aliyun", resp.Provider)
+		assert.Equal(t, "qwen-max-latest", resp.Model)
+		assert.Equal(t, "stop", resp.FinishReason)
+		assert.Equal(t, Usage{PromptTokens: 2, CompletionTokens: 7, TotalTokens: 9}, resp.Usage)
+		assert.Equal(t, []string{"aliyun/qwen-max-latest"}, recorder.records)
+		assert.True(t, aliyun.Requests()[0].Stream)
+	})
+
+	t.Run("合併分段的工具調用參數", func(t *testing.T) {
+		client, aliyun, _, _ := newTestClient(t)
+		aliyun.Enqueue(llmtest.Reply{ToolCalls: []llmtest.ToolCall{
+			{ID: "call_1", Name: "get_weather", Arguments: `{"city":"上海"}`},
+			{ID: "call_2", Name: "get_time", Arguments: `{"tz":"Asia/Shanghai"}`},
+		}})
+
+		resp, _, err := collect(client, &ChatRequest{Messages: []Message{UserMessage("上海天氣和時間")}})
+		if !assert.NoError(t, err) || !assert.Len(t, resp.Message.ToolCalls, 2) {
+			return
+		}
+		assert.Equal(t, "tool_calls", resp.FinishReason)
+		assert.Equal(t, ToolCall{ID: "call_1", Type: "function", Function: FunctionCall{Name: "get_weather", Arguments: `{"city":"上海"}`}}, resp.Message.ToolCalls[0])
+		assert.Equal(t, `{"tz":"Asia/Shanghai"}`, resp.Message.ToolCalls[1].Function.Arguments)
+	})
+
+	t.Run("輸出之前失敗時回退到下一個服務商", func(t *testing.T) {
+		client, aliyun, zijie, _ := newTestClient(t)
+		aliyun.Enqueue(llmtest.Reply{Status: http.StatusInternalServerError})
+		zijie.Enqueue(llmtest.Reply{Content: "來自 zijie"})
+
+		resp, _, err := collect(client, &ChatRequest{Messages: []Message{UserMessage("你好")}})
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Equal(t, "zijie", resp.Provider)
+		assert.Equal(t, "來自 zijie", resp.Message.Content)
+	})
+
+	t.Run("輸出之後失敗時返回錯誤，不回退", func(t *testing.T) {
+		client, aliyun, zijie, _ := newTestClient(t)
+		aliyun.Enqueue(llmtest.Reply{Content: "一半", StreamError: "internal error"})
+
+		resp, _, err := collect(client, &ChatRequest{Messages: []Message{UserMessage("你好")}})
+		assert.Equal(t, CodeLLMError, cmn.ErrorCodeOf(err))
+		assert.Equal(t, "一半", resp.Message.Content)
+		assert.Empty(t, zijie.Requests())
+	})
+
+	t.Run("請求無效時不回退", func(t *testing.T) {
+		client, aliyun, zijie, _ := newTestClient(t)
+		aliyun.Enqueue(llmtest.Reply{Status: http.StatusBadRequest, ErrorCode: "context_length_exceeded"})
+
+		_, chunks, err := collect(client, &ChatRequest{Messages: []Message{UserMessage("你好")}})
+		assert.Equal(t, CodeLLMInvalidRequest, cmn.ErrorCodeOf(err))
+		assert.Zero(t, chunks)
+		assert.Empty(t, zijie.Requests())
+	})
+
+	t.Run("提前退出循環", func(t *testing.T) {
+		client, aliyun, _, recorder := newTestClient(t)
+		aliyun.Enqueue(llmtest.Reply{Content: "很長很長的回覆"})
+
+		chunks := 0
+		for _, err := range client.ChatStream(context.Background(), &ChatRequest{Messages: []Message{UserMessage("你好")}}) {
+			assert.NoError(t, err)
+			chunks++
+			if chunks == 2 {
+				break
+			}
+		}
+		assert.Equal(t, 2, chunks)
+		assert.Empty(t, recorder.records)
+	})
+}
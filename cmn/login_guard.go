@@ -0,0 +1,497 @@
+package cmn
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+// LoginAttemptStore 登录失败计数与锁定状态的存储接口
+type LoginAttemptStore interface {
+	// IncrFailure 失败次数加一并刷新过期时间，返回累计失败次数
+	IncrFailure(ctx context.Context, key string, window time.Duration) (int64, error)
+	// GetFailures 获取当前失败次数，不存在时返回 0
+	GetFailures(ctx context.Context, key string) (int64, error)
+	// SetLock 设置锁定标记
+	SetLock(ctx context.Context, key string, ttl time.Duration) error
+	// LockTTL 获取锁定剩余时间，未锁定时返回 0
+	LockTTL(ctx context.Context, key string) (time.Duration, error)
+	// Delete 删除指定的键
+	Delete(ctx context.Context, keys ...string) error
+}
+
+// RedisLoginAttemptStore 基于 Redis 的登录失败存储，适用于多副本部署
+type RedisLoginAttemptStore struct {
+	client *redis.Client
+}
+
+// NewRedisLoginAttemptStore 创建 Redis 登录失败存储
+func NewRedisLoginAttemptStore(client *redis.Client) *RedisLoginAttemptStore {
+	return &RedisLoginAttemptStore{client: client}
+}
+
+// IncrFailure 失败次数加一
+func (s *RedisLoginAttemptStore) IncrFailure(ctx context.Context, key string, window time.Duration) (int64, error) {
+	var incr *redis.IntCmd
+	_, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		incr = pipe.Incr(ctx, key)
+		pipe.PExpire(ctx, key, window)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return incr.Val(), nil
+}
+
+// GetFailures 获取当前失败次数
+func (s *RedisLoginAttemptStore) GetFailures(ctx context.Context, key string) (int64, error) {
+	n, err := s.client.Get(ctx, key).Int64()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	return n, err
+}
+
+// SetLock 设置锁定标记
+func (s *RedisLoginAttemptStore) SetLock(ctx context.Context, key string, ttl time.Duration) error {
+	return s.client.Set(ctx, key, 1, ttl).Err()
+}
+
+// LockTTL 获取锁定剩余时间
+func (s *RedisLoginAttemptStore) LockTTL(ctx context.Context, key string) (time.Duration, error) {
+	ttl, err := s.client.PTTL(ctx, key).Result()
+	if err != nil {
+		return 0, err
+	}
+	// -1 / -2 分别表示没有过期时间与键不存在
+	if ttl < 0 {
+		return 0, nil
+	}
+	return ttl, nil
+}
+
+// Delete 删除指定的键
+func (s *RedisLoginAttemptStore) Delete(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	return s.client.Del(ctx, keys...).Err()
+}
+
+// memoryAttemptSweepInterval 内存存储清理过期条目的最小间隔
+const memoryAttemptSweepInterval = time.Minute
+
+// MemoryLoginAttemptStore 基于内存的登录失败存储，仅适用于单实例或测试
+// 写入时按 memoryAttemptSweepInterval 间隔清理过期条目，避免大量不同用户名或 IP 导致内存持续增长
+type MemoryLoginAttemptStore struct {
+	mu        sync.Mutex
+	entries   map[string]*memoryAttemptEntry
+	lastSweep time.Time
+}
+
+type memoryAttemptEntry struct {
+	value     int64
+	expiresAt time.Time
+}
+
+// NewMemoryLoginAttemptStore 创建内存登录失败存储
+func NewMemoryLoginAttemptStore() *MemoryLoginAttemptStore {
+	return &MemoryLoginAttemptStore{
+		entries:   make(map[string]*memoryAttemptEntry),
+		lastSweep: time.Now(),
+	}
+}
+
+// sweep 距离上次清理超过间隔时删除所有过期条目，调用方需持有锁
+func (s *MemoryLoginAttemptStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < memoryAttemptSweepInterval {
+		return
+	}
+	s.lastSweep = now
+	for key, e := range s.entries {
+		if now.After(e.expiresAt) {
+			delete(s.entries, key)
+		}
+	}
+}
+
+// get 获取未过期的条目，调用方需持有锁
+func (s *MemoryLoginAttemptStore) get(key string, now time.Time) *memoryAttemptEntry {
+	e, ok := s.entries[key]
+	if !ok {
+		return nil
+	}
+	if now.After(e.expiresAt) {
+		delete(s.entries, key)
+		return nil
+	}
+	return e
+}
+
+// IncrFailure 失败次数加一
+func (s *MemoryLoginAttemptStore) IncrFailure(_ context.Context, key string, window time.Duration) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.sweep(now)
+	e := s.get(key, now)
+	if e == nil {
+		e = &memoryAttemptEntry{}
+		s.entries[key] = e
+	}
+	e.value++
+	e.expiresAt = now.Add(window)
+	return e.value, nil
+}
+
+// GetFailures 获取当前失败次数
+func (s *MemoryLoginAttemptStore) GetFailures(_ context.Context, key string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e := s.get(key, time.Now()); e != nil {
+		return e.value, nil
+	}
+	return 0, nil
+}
+
+// SetLock 设置锁定标记
+func (s *MemoryLoginAttemptStore) SetLock(_ context.Context, key string, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.sweep(now)
+	s.entries[key] = &memoryAttemptEntry{value: 1, expiresAt: now.Add(ttl)}
+	return nil
+}
+
+// LockTTL 获取锁定剩余时间
+func (s *MemoryLoginAttemptStore) LockTTL(_ context.Context, key string) (time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if e := s.get(key, now); e != nil {
+		return e.expiresAt.Sub(now), nil
+	}
+	return 0, nil
+}
+
+// Delete 删除指定的键
+func (s *MemoryLoginAttemptStore) Delete(_ context.Context, keys ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, key := range keys {
+		delete(s.entries, key)
+	}
+	return nil
+}
+
+// LoginGuardConfig 登录防爆破配置
+type LoginGuardConfig struct {
+	MaxUserFailures int                               // 同一用户名的失败次数达到该值时开始锁定
+	MaxIPFailures   int                               // 同一 IP 的失败次数达到该值时开始锁定
+	FailureWindow   time.Duration                     // 失败计数的保留时间（每次失败后刷新）
+	BaseLockout     time.Duration                     // 首次锁定时长，之后每多失败一次翻倍
+	MaxLockout      time.Duration                     // 最长锁定时长
+	KeyPrefix       string                            // 存储键前缀
+	UsernameFunc    func(*gin.Context) string         // 中间件中提取用户名的函数（默认读取 JSON 请求体的 username 字段）
+	ErrorHandler    func(*gin.Context, time.Duration) // 被锁定时的错误处理
+}
+
+// DefaultLoginGuardConfig 默认登录防爆破配置
+func DefaultLoginGuardConfig() *LoginGuardConfig {
+	return &LoginGuardConfig{
+		MaxUserFailures: 5,
+		MaxIPFailures:   20,
+		FailureWindow:   time.Hour,
+		BaseLockout:     time.Minute,
+		MaxLockout:      time.Hour,
+		KeyPrefix:       "login_guard:",
+		UsernameFunc:    usernameFromJSONBody,
+		ErrorHandler: func(c *gin.Context, retryAfter time.Duration) {
+			abortWithCode(c, CodeTooManyRequests, fmt.Sprintf("登录失败次数过多，请在%s后重试", retryAfter.Round(time.Second)))
+		},
+	}
+}
+
+// maxLoginBodySize usernameFromJSONBody 最多读取的请求体大小
+const maxLoginBodySize = 64 << 10
+
+// usernameFromJSONBody 从 JSON 请求体中读取 username 字段，读取后会还原请求体供后续处理器使用
+// 最多读取 maxLoginBodySize 字节，请求体更大时不解析用户名（只按 IP 检查）
+func usernameFromJSONBody(c *gin.Context) string {
+	if c.Request.Body == nil {
+		return ""
+	}
+	original := c.Request.Body
+	body, err := io.ReadAll(io.LimitReader(original, maxLoginBodySize+1))
+	// 未读完的部分接在已读取的内容之后，后续处理器仍能读到完整的请求体
+	c.Request.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(body), original), original}
+	if err != nil || len(body) > maxLoginBodySize {
+		return ""
+	}
+
+	var payload struct {
+		Username string `json:"username"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return ""
+	}
+	return payload.Username
+}
+
+// LoginLockStatus 登录锁定状态
+type LoginLockStatus struct {
+	Subject    string `json:"subject"`    // 用户名或 IP
+	Kind       string `json:"kind"`       // user / ip
+	Failures   int64  `json:"failures"`   // 当前失败次数
+	Locked     bool   `json:"locked"`     // 是否处于锁定中
+	RetryAfter int64  `json:"retryAfter"` // 剩余锁定秒数（向上取整）
+}
+
+const (
+	loginGuardKindUser = "user"
+	loginGuardKindIP   = "ip"
+)
+
+// normalizeUsername 规范化用户名（去除首尾空白并转为小写），避免通过大小写或空格绕过计数
+func normalizeUsername(username string) string {
+	return strings.ToLower(strings.TrimSpace(username))
+}
+
+// LoginGuard 登录防爆破组件：按用户名和 IP 统计失败次数，达到阈值后按指数退避锁定
+// 用户名在计数前统一规范化（去除首尾空白并转为小写）
+type LoginGuard struct {
+	store  LoginAttemptStore
+	config *LoginGuardConfig
+}
+
+// NewLoginGuard 创建登录防爆破组件
+func NewLoginGuard(store LoginAttemptStore, config *LoginGuardConfig) *LoginGuard {
+	if config == nil {
+		config = DefaultLoginGuardConfig()
+	}
+	return &LoginGuard{
+		store:  store,
+		config: config,
+	}
+}
+
+func (g *LoginGuard) failureKey(kind, subject string) string {
+	return g.config.KeyPrefix + "fail:" + kind + ":" + subject
+}
+
+func (g *LoginGuard) lockKey(kind, subject string) string {
+	return g.config.KeyPrefix + "lock:" + kind + ":" + subject
+}
+
+// lockoutFor 根据失败次数计算锁定时长：达到阈值时锁定 BaseLockout，之后每多失败一次翻倍，未达到阈值返回 0
+func (g *LoginGuard) lockoutFor(failures int64, threshold int) time.Duration {
+	if threshold <= 0 || failures < int64(threshold) {
+		return 0
+	}
+	exp := float64(failures - int64(threshold))
+	lockout := time.Duration(float64(g.config.BaseLockout) * math.Pow(2, exp))
+	// 指数溢出或超过上限时使用最长锁定时长
+	if lockout <= 0 || lockout > g.config.MaxLockout {
+		lockout = g.config.MaxLockout
+	}
+	return lockout
+}
+
+// Check 检查用户名与 IP 是否处于锁定中，返回剩余锁定时间（未锁定返回 0）
+func (g *LoginGuard) Check(ctx context.Context, username, ip string) (time.Duration, error) {
+	var retryAfter time.Duration
+	if ip != "" {
+		ttl, err := g.store.LockTTL(ctx, g.lockKey(loginGuardKindIP, ip))
+		if err != nil {
+			return 0, err
+		}
+		retryAfter = max(retryAfter, ttl)
+	}
+	if username = normalizeUsername(username); username != "" {
+		ttl, err := g.store.LockTTL(ctx, g.lockKey(loginGuardKindUser, username))
+		if err != nil {
+			return 0, err
+		}
+		retryAfter = max(retryAfter, ttl)
+	}
+	return retryAfter, nil
+}
+
+// record 记录一次失败并在需要时设置锁定
+func (g *LoginGuard) record(ctx context.Context, kind, subject string, threshold int) (time.Duration, error) {
+	failures, err := g.store.IncrFailure(ctx, g.failureKey(kind, subject), max(g.config.FailureWindow, g.config.MaxLockout))
+	if err != nil {
+		return 0, err
+	}
+	lockout := g.lockoutFor(failures, threshold)
+	if lockout == 0 {
+		return 0, nil
+	}
+	if err := g.store.SetLock(ctx, g.lockKey(kind, subject), lockout); err != nil {
+		return 0, err
+	}
+	Logger().Warn("登录失败次数过多，已锁定",
+		zap.String("kind", kind),
+		zap.String("subject", subject),
+		zap.Int64("failures", failures),
+		zap.Duration("lockout", lockout),
+	)
+	return lockout, nil
+}
+
+// RecordFailure 登录失败时由处理器调用，返回本次触发的锁定时长（未锁定返回 0）
+func (g *LoginGuard) RecordFailure(c *gin.Context, username string) (time.Duration, error) {
+	ctx := c.Request.Context()
+	var lockout time.Duration
+	if ip := c.ClientIP(); ip != "" {
+		d, err := g.record(ctx, loginGuardKindIP, ip, g.config.MaxIPFailures)
+		if err != nil {
+			return 0, err
+		}
+		lockout = max(lockout, d)
+	}
+	if username = normalizeUsername(username); username != "" {
+		d, err := g.record(ctx, loginGuardKindUser, username, g.config.MaxUserFailures)
+		if err != nil {
+			return 0, err
+		}
+		lockout = max(lockout, d)
+	}
+	return lockout, nil
+}
+
+// RecordSuccess 登录成功时由处理器调用，清除该用户名的失败记录
+// IP 维度的计数不会清除，避免攻击者用自己的账号重置计数
+func (g *LoginGuard) RecordSuccess(c *gin.Context, username string) error {
+	if username = normalizeUsername(username); username == "" {
+		return nil
+	}
+	return g.store.Delete(c.Request.Context(),
+		g.failureKey(loginGuardKindUser, username),
+		g.lockKey(loginGuardKindUser, username),
+	)
+}
+
+// Middleware 在登录处理器之前检查锁定状态，被锁定时直接拒绝
+func (g *LoginGuard) Middleware() MiddlewareFunc {
+	return func(c *gin.Context) {
+		username := ""
+		if g.config.UsernameFunc != nil {
+			username = g.config.UsernameFunc(c)
+		}
+
+		retryAfter, err := g.Check(c.Request.Context(), username, c.ClientIP())
+		if err != nil {
+			// 存储不可用时放行，避免因 Redis 故障导致无法登录
+			Logger().Error("检查登录锁定状态失败", zap.Error(err))
+			c.Next()
+			return
+		}
+		if retryAfter > 0 {
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			g.config.ErrorHandler(c, retryAfter)
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// Status 查询指定用户名或 IP 的锁定状态，kind 为 user 或 ip
+func (g *LoginGuard) Status(ctx context.Context, kind, subject string) (*LoginLockStatus, error) {
+	if kind == loginGuardKindUser {
+		subject = normalizeUsername(subject)
+	}
+	failures, err := g.store.GetFailures(ctx, g.failureKey(kind, subject))
+	if err != nil {
+		return nil, err
+	}
+	ttl, err := g.store.LockTTL(ctx, g.lockKey(kind, subject))
+	if err != nil {
+		return nil, err
+	}
+	return &LoginLockStatus{
+		Subject:    subject,
+		Kind:       kind,
+		Failures:   failures,
+		Locked:     ttl > 0,
+		RetryAfter: int64(math.Ceil(ttl.Seconds())),
+	}, nil
+}
+
+// Unlock 清除指定用户名或 IP 的失败记录与锁定，kind 为 user 或 ip
+func (g *LoginGuard) Unlock(ctx context.Context, kind, subject string) error {
+	if kind == loginGuardKindUser {
+		subject = normalizeUsername(subject)
+	}
+	return g.store.Delete(ctx, g.failureKey(kind, subject), g.lockKey(kind, subject))
+}
+
+// RegisterAdminRoutes 注册查询与解除锁定的管理接口，调用方需自行在路由组上添加认证
+//
+//	GET    /login-guard/:kind/:subject  查询锁定状态
+//	DELETE /login-guard/:kind/:subject  解除锁定
+func (g *LoginGuard) RegisterAdminRoutes(router gin.IRoutes) {
+	router.GET("/login-guard/:kind/:subject", g.statusHandler)
+	router.DELETE("/login-guard/:kind/:subject", g.unlockHandler)
+}
+
+// adminParams 解析管理接口的路径参数
+func (g *LoginGuard) adminParams(c *gin.Context) (string, string, bool) {
+	kind, subject := c.Param("kind"), c.Param("subject")
+	if (kind != loginGuardKindUser && kind != loginGuardKindIP) || subject == "" {
+		abortWithCode(c, CodeBadRequest, "kind 必须为 user 或 ip")
+		return "", "", false
+	}
+	return kind, subject, true
+}
+
+func (g *LoginGuard) statusHandler(c *gin.Context) {
+	kind, subject, ok := g.adminParams(c)
+	if !ok {
+		return
+	}
+	status, err := g.Status(c.Request.Context(), kind, subject)
+	if err != nil {
+		_ = c.Error(err)
+		abortWithCode(c, CodeInternal, "查询锁定状态失败")
+		return
+	}
+	OK(c, status)
+}
+
+func (g *LoginGuard) unlockHandler(c *gin.Context) {
+	kind, subject, ok := g.adminParams(c)
+	if !ok {
+		return
+	}
+	if err := g.Unlock(c.Request.Context(), kind, subject); err != nil {
+		_ = c.Error(err)
+		abortWithCode(c, CodeInternal, "解除锁定失败")
+		return
+	}
+	Logger().Info("已解除登录锁定", zap.String("kind", kind), zap.String("subject", subject))
+	OKWithMsg[any](c, "解除成功", nil)
+}
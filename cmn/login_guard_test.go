@@ -0,0 +1,165 @@
+package cmn
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestLoginGuard() *LoginGuard {
+	config := DefaultLoginGuardConfig()
+	config.MaxUserFailures = 3
+	config.MaxIPFailures = 10
+	config.BaseLockout = time.Second
+	config.MaxLockout = 4 * time.Second
+	return NewLoginGuard(NewMemoryLoginAttemptStore(), config)
+}
+
+func newLoginGuardRouter(guard *LoginGuard) *gin.Engine {
+	router := gin.New()
+	router.POST("/login", guard.Middleware(), func(c *gin.Context) {
+		var req struct {
+			Username string `json:"username"`
+			Password string `json:"password"`
+		}
+		_ = c.ShouldBindJSON(&req)
+		if req.Password != "right" {
+			_, _ = guard.RecordFailure(c, req.Username)
+			c.JSON(http.StatusUnauthorized, gin.H{"message": "wrong"})
+			return
+		}
+		_ = guard.RecordSuccess(c, req.Username)
+		c.JSON(http.StatusOK, gin.H{"message": "ok"})
+	})
+	guard.RegisterAdminRoutes(router.Group("/admin"))
+	return router
+}
+
+func doLogin(router *gin.Engine, username, password string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	body := `{"username":"` + username + `","password":"` + password + `"}`
+	req, _ := http.NewRequest("POST", "/login", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestLoginGuard(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	t.Run("達到失敗次數後鎖定", func(t *testing.T) {
+		router := newLoginGuardRouter(newTestLoginGuard())
+
+		for i := 0; i < 3; i++ {
+			assert.Equal(t, http.StatusUnauthorized, doLogin(router, "alice", "bad").Code)
+		}
+
+		// 已鎖定，即使密碼正確也被拒絕
+		w := doLogin(router, "alice", "right")
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+		assert.NotEmpty(t, w.Header().Get("Retry-After"))
+
+		// 其他用戶不受影響
+		assert.Equal(t, http.StatusOK, doLogin(router, "bob", "right").Code)
+	})
+
+	t.Run("鎖定時長指數增長並有上限", func(t *testing.T) {
+		guard := newTestLoginGuard()
+
+		assert.Equal(t, time.Duration(0), guard.lockoutFor(2, 3))
+		assert.Equal(t, time.Second, guard.lockoutFor(3, 3))
+		assert.Equal(t, 2*time.Second, guard.lockoutFor(4, 3))
+		assert.Equal(t, 4*time.Second, guard.lockoutFor(5, 3))
+		assert.Equal(t, 4*time.Second, guard.lockoutFor(100, 3))
+	})
+
+	t.Run("登錄成功清除失敗記錄", func(t *testing.T) {
+		guard := newTestLoginGuard()
+		router := newLoginGuardRouter(guard)
+
+		doLogin(router, "carol", "bad")
+		doLogin(router, "carol", "bad")
+		assert.Equal(t, http.StatusOK, doLogin(router, "carol", "right").Code)
+
+		status, err := guard.Status(t.Context(), "user", "carol")
+		assert.NoError(t, err)
+		assert.Equal(t, int64(0), status.Failures)
+	})
+
+	t.Run("管理接口查詢與解除鎖定", func(t *testing.T) {
+		router := newLoginGuardRouter(newTestLoginGuard())
+		for i := 0; i < 3; i++ {
+			doLogin(router, "dave", "bad")
+		}
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/admin/login-guard/user/dave", nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"locked":true`)
+
+		w = httptest.NewRecorder()
+		req, _ = http.NewRequest("DELETE", "/admin/login-guard/user/dave", nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		assert.Equal(t, http.StatusOK, doLogin(router, "dave", "right").Code)
+
+		w = httptest.NewRecorder()
+		req, _ = http.NewRequest("GET", "/admin/login-guard/device/dave", nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+	t.Run("用戶名大小寫與空白共用計數", func(t *testing.T) {
+		guard := newTestLoginGuard()
+		router := newLoginGuardRouter(guard)
+
+		doLogin(router, "Erin", "bad")
+		doLogin(router, " erin", "bad")
+		doLogin(router, "ERIN ", "bad")
+		assert.Equal(t, http.StatusTooManyRequests, doLogin(router, "erin", "right").Code)
+
+		status, err := guard.Status(t.Context(), "user", "ERIN")
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Equal(t, int64(3), status.Failures)
+		assert.True(t, status.Locked)
+		assert.Equal(t, int64(1), status.RetryAfter)
+	})
+
+	t.Run("請求體過大時不解析用戶名且保留完整請求體", func(t *testing.T) {
+		body := `{"username":"frank","padding":"` + strings.Repeat("x", maxLoginBodySize) + `"}`
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request, _ = http.NewRequest("POST", "/login", strings.NewReader(body))
+
+		assert.Empty(t, usernameFromJSONBody(c))
+		rest, err := io.ReadAll(c.Request.Body)
+		assert.NoError(t, err)
+		assert.Equal(t, body, string(rest))
+	})
+}
+
+func TestMemoryLoginAttemptStoreSweep(t *testing.T) {
+	store := NewMemoryLoginAttemptStore()
+	ctx := t.Context()
+	_ = store.SetLock(ctx, "expired", time.Millisecond)
+	_, _ = store.IncrFailure(ctx, "alive", time.Hour)
+	time.Sleep(5 * time.Millisecond)
+
+	// 未到清理間隔時不清理
+	_, _ = store.IncrFailure(ctx, "other", time.Hour)
+	assert.Len(t, store.entries, 3)
+
+	store.lastSweep = time.Now().Add(-memoryAttemptSweepInterval)
+	_, _ = store.IncrFailure(ctx, "other", time.Hour)
+	assert.Len(t, store.entries, 2)
+	assert.NotContains(t, store.entries, "expired")
+}
@@ -1,64 +1,256 @@
 package cmn
 
 import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
 	"github.com/gin-gonic/gin"
 )
 
 // MiddlewareFunc 中间件函数类型
 type MiddlewareFunc = gin.HandlerFunc
 
+// 内置中间件的默认优先级，数值越小越先执行
+const (
+	PriorityRecovery  = 100
+	PriorityRequestID = 200
+	PriorityLogger    = 300
+	PriorityCORS      = 400
+	PriorityRateLimit = 500
+	PriorityBodyLimit = 550
+	PriorityTimeout   = 600
+	PriorityAuth      = 700
+	PriorityDefault   = 1000
+)
+
+// anonymousPrefix 匿名中间件的名称前缀
+const anonymousPrefix = "anonymous#"
+
+// MiddlewareEntry 已注册的中间件
+type MiddlewareEntry struct {
+	Name     string          // 名称，同一注册器内唯一
+	Priority int             // 优先级，越小越先执行，相同优先级保持注册顺序
+	After    []string        // 必须在这些中间件之后执行（对方已注册时在 Apply 时校验）
+	Handler  MiddlewareFunc  // 中间件函数
+	Policy   RoutePolicyFunc // 对路由施加的策略，供路由清单使用（可选）
+}
+
+// MiddlewareOption 注册中间件时的可选项
+type MiddlewareOption func(*MiddlewareEntry)
+
+// WithPriority 设置优先级
+func WithPriority(priority int) MiddlewareOption {
+	return func(e *MiddlewareEntry) {
+		e.Priority = priority
+	}
+}
+
+// WithAfter 声明必须在指定中间件之后执行
+func WithAfter(names ...string) MiddlewareOption {
+	return func(e *MiddlewareEntry) {
+		e.After = append(e.After, names...)
+	}
+}
+
+// WithPolicy 声明中间件对路由施加的策略（认证、限流、超时），供路由清单使用
+//
+//	registry.RegisterNamed("auth", cmn.AuthMiddlewareWithConfig(config), cmn.WithPolicy(cmn.AuthRoutePolicy(config)))
+func WithPolicy(describe RoutePolicyFunc) MiddlewareOption {
+	return func(e *MiddlewareEntry) {
+		e.Policy = describe
+	}
+}
+
+// MiddlewareInfo 最终执行链中的一项，用于查看与输出
+type MiddlewareInfo struct {
+	Index    int      `json:"index"`
+	Name     string   `json:"name"`
+	Priority int      `json:"priority"`
+	After    []string `json:"after,omitempty"`
+}
+
 // MiddlewareRegistry 中间件注册器
 type MiddlewareRegistry struct {
-	middlewares []MiddlewareFunc
-	router      *gin.Engine
+	entries   []*MiddlewareEntry
+	router    *gin.Engine
+	factories map[string]policyFactory
+	anonymous int
+	// generation 每次注册或清空中间件时递增，applied 记录应用到各目标时的 generation
+	generation int
+	applied    map[*gin.RouterGroup]int
+	// chains 已应用到各路由组的中间件链，供路由清单使用
+	chains []appliedChain
 }
 
 // NewMiddlewareRegistry 创建一个新的中间件注册器
 func NewMiddlewareRegistry(router *gin.Engine) *MiddlewareRegistry {
+	factories := make(map[string]policyFactory, len(builtinMiddlewareFactories))
+	for name, factory := range builtinMiddlewareFactories {
+		factories[name] = factory
+	}
 	return &MiddlewareRegistry{
-		middlewares: make([]MiddlewareFunc, 0),
-		router:      router,
+		entries:   make([]*MiddlewareEntry, 0),
+		router:    router,
+		factories: factories,
+		applied:   make(map[*gin.RouterGroup]int),
 	}
 }
 
-// Register 注册单个中间件
+// Register 注册单个中间件（匿名，使用默认优先级）
 func (r *MiddlewareRegistry) Register(middleware MiddlewareFunc) *MiddlewareRegistry {
-	r.middlewares = append(r.middlewares, middleware)
+	r.anonymous++
+	return r.RegisterNamed(fmt.Sprintf("%s%d", anonymousPrefix, r.anonymous), middleware)
+}
+
+// RegisterNamed 注册命名中间件，可指定优先级与依赖
+func (r *MiddlewareRegistry) RegisterNamed(name string, middleware MiddlewareFunc, opts ...MiddlewareOption) *MiddlewareRegistry {
+	entry := &MiddlewareEntry{
+		Name:     name,
+		Priority: PriorityDefault,
+		Handler:  middleware,
+	}
+	for _, opt := range opts {
+		opt(entry)
+	}
+	r.entries = append(r.entries, entry)
+	r.generation++
 	return r
 }
 
 // RegisterMultiple 批量注册中间件
 func (r *MiddlewareRegistry) RegisterMultiple(middlewares ...MiddlewareFunc) *MiddlewareRegistry {
-	r.middlewares = append(r.middlewares, middlewares...)
+	for _, middleware := range middlewares {
+		r.Register(middleware)
+	}
 	return r
 }
 
+// resolve 按优先级排序并校验名称唯一与依赖顺序，返回最终执行链
+func (r *MiddlewareRegistry) resolve() ([]*MiddlewareEntry, error) {
+	chain := make([]*MiddlewareEntry, len(r.entries))
+	copy(chain, r.entries)
+	sort.SliceStable(chain, func(i, j int) bool {
+		return chain[i].Priority < chain[j].Priority
+	})
+
+	position := make(map[string]int, len(chain))
+	for i, entry := range chain {
+		if _, ok := position[entry.Name]; ok {
+			return nil, fmt.Errorf("重复的中间件名称: %s", entry.Name)
+		}
+		position[entry.Name] = i
+	}
+	for i, entry := range chain {
+		for _, dep := range entry.After {
+			if j, ok := position[dep]; ok && j > i {
+				return nil, fmt.Errorf("中间件 %s 必须在 %s 之后执行，请调整优先级", entry.Name, dep)
+			}
+		}
+	}
+	return chain, nil
+}
+
 // Apply 应用所有已注册的中间件到 gin 引擎
-func (r *MiddlewareRegistry) Apply() {
-	for _, middleware := range r.middlewares {
-		r.router.Use(middleware)
+func (r *MiddlewareRegistry) Apply() error {
+	return r.ApplyTo(&r.router.RouterGroup)
+}
+
+// ApplyTo 把中间件应用到指定路由组（只影响之后在该组上注册的路由）
+// 对同一目标重复调用不会重复注册；应用后又注册或清空了中间件时返回错误
+func (r *MiddlewareRegistry) ApplyTo(group *gin.RouterGroup) error {
+	if generation, ok := r.applied[group]; ok {
+		if generation == r.generation {
+			return nil
+		}
+		return errors.New("中间件已应用到该路由组，之后注册或清空的中间件不会生效")
+	}
+
+	chain, err := r.resolve()
+	if err != nil {
+		return err
 	}
+	handlers := make([]gin.HandlerFunc, 0, len(chain))
+	for _, entry := range chain {
+		handlers = append(handlers, entry.Handler)
+	}
+	// 根路由组通过 Engine.Use 注册，以便同时作用于 404/405 处理器
+	if r.router != nil && group == &r.router.RouterGroup {
+		r.router.Use(handlers...)
+	} else {
+		group.Use(handlers...)
+	}
+	// 记录中间件链在该组处理链中的位置，供路由清单判断哪些路由经过了它
+	r.chains = append(r.chains, appliedChain{
+		group:   group,
+		start:   len(group.Handlers) - len(handlers),
+		end:     len(group.Handlers),
+		entries: chain,
+	})
+	r.applied[group] = r.generation
+	return nil
 }
 
 // ApplyDefault 应用默认中间件集合（Recovery + Logger + CORS）
 func (r *MiddlewareRegistry) ApplyDefault() *MiddlewareRegistry {
-	r.Register(RecoveryMiddleware())
-	r.Register(LoggerMiddleware())
-	r.Register(CORSMiddleware())
+	r.RegisterNamed("recovery", RecoveryMiddleware(), WithPriority(PriorityRecovery))
+	r.RegisterNamed("logger", LoggerMiddleware(), WithPriority(PriorityLogger))
+	r.RegisterNamed("cors", CORSMiddleware(), WithPriority(PriorityCORS))
 	return r
 }
 
-// GetMiddlewares 获取所有已注册的中间件
+// GetMiddlewares 获取所有已注册的中间件（注册顺序）
 func (r *MiddlewareRegistry) GetMiddlewares() []MiddlewareFunc {
-	return r.middlewares
+	middlewares := make([]MiddlewareFunc, 0, len(r.entries))
+	for _, entry := range r.entries {
+		middlewares = append(middlewares, entry.Handler)
+	}
+	return middlewares
+}
+
+// Chain 返回排序后的最终执行链
+func (r *MiddlewareRegistry) Chain() ([]MiddlewareInfo, error) {
+	chain, err := r.resolve()
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]MiddlewareInfo, 0, len(chain))
+	for i, entry := range chain {
+		infos = append(infos, MiddlewareInfo{
+			Index:    i,
+			Name:     entry.Name,
+			Priority: entry.Priority,
+			After:    entry.After,
+		})
+	}
+	return infos, nil
+}
+
+// Dump 以文本形式输出最终执行链，便于启动时打印或排查顺序问题
+func (r *MiddlewareRegistry) Dump() string {
+	infos, err := r.Chain()
+	if err != nil {
+		return "invalid middleware chain: " + err.Error()
+	}
+	var b strings.Builder
+	for _, info := range infos {
+		fmt.Fprintf(&b, "%2d. %-20s priority=%d", info.Index+1, info.Name, info.Priority)
+		if len(info.After) > 0 {
+			fmt.Fprintf(&b, " after=%s", strings.Join(info.After, ","))
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
 }
 
-// Clear 清空所有已注册的中间件
+// Clear 清空所有已注册的中间件（不影响已应用到路由的中间件）
 func (r *MiddlewareRegistry) Clear() {
-	r.middlewares = make([]MiddlewareFunc, 0)
+	r.entries = make([]*MiddlewareEntry, 0)
+	r.generation++
 }
 
 // Count 返回已注册中间件的数量
 func (r *MiddlewareRegistry) Count() int {
-	return len(r.middlewares)
+	return len(r.entries)
 }
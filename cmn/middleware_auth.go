@@ -1,7 +1,6 @@
 package cmn
 
 import (
-	"net/http"
 	"strings"
 
 	"github.com/gin-gonic/gin"
@@ -13,22 +12,14 @@ func AuthMiddleware() MiddlewareFunc {
 		// 从请求头获取 token
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"code":    http.StatusUnauthorized,
-				"message": "缺少认证令牌",
-			})
-			c.Abort()
+			abortWithCode(c, CodeUnauthorized, "缺少认证令牌")
 			return
 		}
 
 		// 检查 Bearer 前缀
 		parts := strings.SplitN(authHeader, " ", 2)
 		if !(len(parts) == 2 && parts[0] == "Bearer") {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"code":    http.StatusUnauthorized,
-				"message": "认证令牌格式错误",
-			})
-			c.Abort()
+			abortWithCode(c, CodeUnauthorized, "认证令牌格式错误")
 			return
 		}
 
@@ -36,12 +27,8 @@ func AuthMiddleware() MiddlewareFunc {
 		token := parts[1]
 		claims, err := ParseToken(token)
 		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"code":    http.StatusUnauthorized,
-				"message": "无效的认证令牌",
-				"error":   err.Error(),
-			})
-			c.Abort()
+			_ = c.Error(err)
+			abortWithCode(c, CodeUnauthorized, "无效的认证令牌")
 			return
 		}
 
@@ -49,6 +36,7 @@ func AuthMiddleware() MiddlewareFunc {
 		c.Set("user_id", claims.UserId)
 		c.Set("username", claims.Username)
 		c.Set("claims", claims)
+		c.Request = c.Request.WithContext(WithClaims(c.Request.Context(), claims))
 
 		c.Next()
 	}
@@ -69,11 +57,8 @@ func DefaultAuthConfig() *AuthConfig {
 		TokenPrefix: "Bearer",
 		SkipPaths:   []string{"/login", "/register", "/health", "/ping"},
 		ErrorHandler: func(c *gin.Context, err error) {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"code":    http.StatusUnauthorized,
-				"message": "认证失败",
-				"error":   err.Error(),
-			})
+			_ = c.Error(err)
+			abortWithCode(c, CodeUnauthorized, "认证失败")
 		},
 	}
 }
@@ -124,6 +109,7 @@ func AuthMiddlewareWithConfig(config *AuthConfig) MiddlewareFunc {
 		c.Set("user_id", claims.UserId)
 		c.Set("username", claims.Username)
 		c.Set("claims", claims)
+		c.Request = c.Request.WithContext(WithClaims(c.Request.Context(), claims))
 
 		c.Next()
 	}
@@ -151,6 +137,7 @@ func OptionalAuthMiddleware() MiddlewareFunc {
 				c.Set("user_id", claims.UserId)
 				c.Set("username", claims.Username)
 				c.Set("claims", claims)
+				c.Request = c.Request.WithContext(WithClaims(c.Request.Context(), claims))
 			}
 		}
 
@@ -0,0 +1,202 @@
+package cmn
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// gzipBytes 壓縮數據
+func gzipBytes(t *testing.T, data []byte) []byte {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	_, err := w.Write(data)
+	assert.NoError(t, err)
+	assert.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+// onlyReader 隱藏 bytes.Reader 的類型，使請求成為未知長度（chunked）
+type onlyReader struct{ io.Reader }
+
+// chunked 與服務端收到 chunked 請求時一致，ContentLength 為 -1
+func chunked(req *http.Request) *http.Request {
+	req.ContentLength = -1
+	return req
+}
+
+func newBodyLimitTestRouter(config *BodyLimitConfig) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(BodyLimitMiddlewareWithConfig(config))
+	echo := func(c *gin.Context) {
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			Fail(c, err)
+			return
+		}
+		OK(c, len(body))
+	}
+	router.POST("/echo", echo)
+	router.POST("/upload", echo)
+	router.POST("/ignore", func(c *gin.Context) {
+		// 忽略讀取錯誤的處理器
+		_, _ = io.ReadAll(c.Request.Body)
+	})
+	router.GET("/ping", func(c *gin.Context) {
+		OK(c, "pong")
+	})
+	return router
+}
+
+func serveBodyLimit(router *gin.Engine, req *http.Request) (int, ReplyProto) {
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	var reply ReplyProto
+	_ = json.Unmarshal(w.Body.Bytes(), &reply)
+	return w.Code, reply
+}
+
+func TestBodyLimitMiddleware(t *testing.T) {
+	config := DefaultBodyLimitConfig()
+	config.MaxBytes = 1024
+	config.Routes = map[string]int64{"POST /upload": 8192}
+	router := newBodyLimitTestRouter(config)
+
+	newRequest := func(path string, body io.Reader, contentType string) *http.Request {
+		req, _ := http.NewRequest("POST", path, body)
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		return req
+	}
+	big := bytes.Repeat([]byte("a"), 2048)
+
+	t.Run("未超過上限", func(t *testing.T) {
+		code, reply := serveBodyLimit(router, newRequest("/echo", bytes.NewReader(big[:1024]), "application/json"))
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, "1024", string(reply.Data))
+
+		req, _ := http.NewRequest("GET", "/ping", nil)
+		code, _ = serveBodyLimit(router, req)
+		assert.Equal(t, http.StatusOK, code)
+	})
+
+	t.Run("Content-Length超過上限直接返回413", func(t *testing.T) {
+		code, reply := serveBodyLimit(router, newRequest("/echo", bytes.NewReader(big), "application/json"))
+		assert.Equal(t, http.StatusRequestEntityTooLarge, code)
+		assert.Equal(t, CodeRequestTooLarge, reply.Status)
+		assert.Equal(t, "/echo", reply.API)
+	})
+
+	t.Run("未聲明長度時讀取超過上限中止", func(t *testing.T) {
+		code, reply := serveBodyLimit(router, chunked(newRequest("/echo", onlyReader{bytes.NewReader(big)}, "application/json")))
+		assert.Equal(t, http.StatusRequestEntityTooLarge, code)
+		assert.Equal(t, CodeRequestTooLarge, reply.Status)
+
+		// 處理器忽略錯誤時由中間件返回 413
+		code, _ = serveBodyLimit(router, chunked(newRequest("/ignore", onlyReader{bytes.NewReader(big)}, "application/json")))
+		assert.Equal(t, http.StatusRequestEntityTooLarge, code)
+	})
+
+	t.Run("路由級上限", func(t *testing.T) {
+		code, reply := serveBodyLimit(router, newRequest("/upload", bytes.NewReader(big), "application/json"))
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, "2048", string(reply.Data))
+	})
+
+	t.Run("不支持的Content-Type返回415", func(t *testing.T) {
+		code, reply := serveBodyLimit(router, newRequest("/echo", strings.NewReader("<a/>"), "application/xml"))
+		assert.Equal(t, http.StatusUnsupportedMediaType, code)
+		assert.Equal(t, CodeUnsupportedMedia, reply.Status)
+
+		code, _ = serveBodyLimit(router, newRequest("/echo", strings.NewReader("{}"), ""))
+		assert.Equal(t, http.StatusUnsupportedMediaType, code)
+
+		code, _ = serveBodyLimit(router, newRequest("/echo", strings.NewReader("{}"), "application/json; charset=utf-8"))
+		assert.Equal(t, http.StatusOK, code)
+	})
+
+	t.Run("gzip請求體", func(t *testing.T) {
+		req := newRequest("/echo", bytes.NewReader(gzipBytes(t, []byte(`{"name": "tom"}`))), "application/json")
+		req.Header.Set("Content-Encoding", "gzip")
+		code, reply := serveBodyLimit(router, req)
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, "15", string(reply.Data))
+
+		// 解壓後超過上限
+		random := make([]byte, 2048)
+		for i := range random {
+			random[i] = byte(i*7919%251) ^ byte(i>>3)
+		}
+		req = newRequest("/echo", bytes.NewReader(gzipBytes(t, random)), "application/json")
+		req.Header.Set("Content-Encoding", "gzip")
+		code, _ = serveBodyLimit(router, req)
+		assert.Equal(t, http.StatusRequestEntityTooLarge, code)
+
+		req = newRequest("/echo", strings.NewReader("not gzip"), "application/json")
+		req.Header.Set("Content-Encoding", "gzip")
+		code, _ = serveBodyLimit(router, req)
+		assert.Equal(t, http.StatusBadRequest, code)
+
+		req = newRequest("/echo", strings.NewReader("{}"), "application/json")
+		req.Header.Set("Content-Encoding", "br")
+		code, _ = serveBodyLimit(router, req)
+		assert.Equal(t, http.StatusUnsupportedMediaType, code)
+	})
+
+	t.Run("壓縮炸彈", func(t *testing.T) {
+		config := DefaultBodyLimitConfig()
+		config.MaxBytes = 10 << 20
+		router := newBodyLimitTestRouter(config)
+
+		bomb := gzipBytes(t, make([]byte, 8<<20))
+		assert.Less(t, len(bomb), 64<<10)
+		req := newRequest("/echo", bytes.NewReader(bomb), "application/json")
+		req.Header.Set("Content-Encoding", "gzip")
+		code, reply := serveBodyLimit(router, req)
+		assert.Equal(t, http.StatusRequestEntityTooLarge, code)
+		assert.Equal(t, "请求体解压比例过高", reply.Msg)
+	})
+
+	t.Run("Bind返回413", func(t *testing.T) {
+		gin.SetMode(gin.TestMode)
+		router := gin.New()
+		router.Use(BodyLimitMiddleware(16))
+		router.POST("/users", func(c *gin.Context) {
+			if _, err := Bind[map[string]string](c); err != nil {
+				Fail(c, err)
+				return
+			}
+			OK(c, "ok")
+		})
+		code, _ := serveBodyLimit(router, chunked(newRequest("/users", onlyReader{strings.NewReader(`{"name": "a very long name"}`)}, "application/json")))
+		assert.Equal(t, http.StatusRequestEntityTooLarge, code)
+	})
+
+	t.Run("通過配置創建", func(t *testing.T) {
+		middleware, err := bodyLimitFactory(MiddlewareOptions{
+			"maxbytes": 10,
+			"routes":   []interface{}{map[string]interface{}{"method": "post", "path": "/upload", "value": 4096}},
+		})
+		assert.NoError(t, err)
+		gin.SetMode(gin.TestMode)
+		router := gin.New()
+		router.Use(middleware)
+		router.POST("/upload", func(c *gin.Context) { OK(c, "ok") })
+		router.POST("/echo", func(c *gin.Context) { OK(c, "ok") })
+
+		code, _ := serveBodyLimit(router, newRequest("/upload", bytes.NewReader(big), "application/json"))
+		assert.Equal(t, http.StatusOK, code)
+		code, _ = serveBodyLimit(router, newRequest("/echo", bytes.NewReader(big), "application/json"))
+		assert.Equal(t, http.StatusRequestEntityTooLarge, code)
+	})
+}
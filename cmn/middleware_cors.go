@@ -2,18 +2,23 @@ package cmn
 
 import (
 	"net/http"
+	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 )
 
 // CORSConfig CORS 配置
 type CORSConfig struct {
-	AllowOrigins     []string
-	AllowMethods     []string
-	AllowHeaders     []string
-	ExposeHeaders    []string
-	AllowCredentials bool
-	MaxAge           int
+	AllowOrigins        []string                 // 允许的来源，支持 "*" 与通配子域名（如 "https://*.example.com"）；"*" 匹配的来源不会携带凭证
+	AllowOriginFunc     func(origin string) bool // 动态校验来源，AllowOrigins 未命中时调用
+	AllowMethods        []string                 // 允许的方法
+	AllowHeaders        []string                 // 允许的请求头，"*" 表示允许任意请求头
+	ExposeHeaders       []string                 // 暴露给浏览器的响应头
+	AllowCredentials    bool                     // 是否允许携带凭证，只对显式来源、通配子域名与 AllowOriginFunc 匹配的来源生效并回显具体来源
+	AllowPrivateNetwork bool                     // 是否响应私有网络访问预检（Access-Control-Request-Private-Network）
+	MaxAge              int                      // 预检请求的缓存时间（秒）
 }
 
 // DefaultCORSConfig 默认 CORS 配置
@@ -28,6 +33,12 @@ func DefaultCORSConfig() *CORSConfig {
 	}
 }
 
+// CORSPolicy 路由组级别的 CORS 策略，PathPrefix 匹配请求路径前缀
+type CORSPolicy struct {
+	PathPrefix string
+	Config     *CORSConfig
+}
+
 // CORSMiddleware 创建 CORS 中间件（使用默认配置）
 func CORSMiddleware() MiddlewareFunc {
 	return CORSMiddlewareWithConfig(DefaultCORSConfig())
@@ -35,81 +46,232 @@ func CORSMiddleware() MiddlewareFunc {
 
 // CORSMiddlewareWithConfig 创建 CORS 中间件（使用自定义配置）
 func CORSMiddlewareWithConfig(config *CORSConfig) MiddlewareFunc {
+	policy := newCORSPolicy(config)
 	return func(c *gin.Context) {
-		// 设置允许的来源
-		if len(config.AllowOrigins) > 0 {
-			origin := c.Request.Header.Get("Origin")
-			if origin != "" {
-				// 检查来源是否在允许列表中
-				allowed := false
-				for _, allowOrigin := range config.AllowOrigins {
-					if allowOrigin == "*" || allowOrigin == origin {
-						allowed = true
-						break
-					}
-				}
-				if allowed {
-					if config.AllowOrigins[0] == "*" {
-						c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
-					} else {
-						c.Writer.Header().Set("Access-Control-Allow-Origin", origin)
-					}
-				}
-			}
-		}
+		policy.handle(c)
+	}
+}
 
-		// 设置允许的方法
-		if len(config.AllowMethods) > 0 {
-			methods := ""
-			for i, method := range config.AllowMethods {
-				if i > 0 {
-					methods += ", "
-				}
-				methods += method
-			}
-			c.Writer.Header().Set("Access-Control-Allow-Methods", methods)
-		}
+// CORSMiddlewareWithPolicies 按路径前缀为不同路由组应用不同的 CORS 策略，最长前缀优先，未命中时使用 defaultConfig
+// 必须注册在 gin 引擎上（而不是路由组上），否则未注册 OPTIONS 路由的预检请求不会经过该中间件
+func CORSMiddlewareWithPolicies(defaultConfig *CORSConfig, policies ...CORSPolicy) MiddlewareFunc {
+	type prefixPolicy struct {
+		prefix string
+		policy *corsPolicy
+	}
+	compiled := make([]prefixPolicy, 0, len(policies))
+	for _, p := range policies {
+		compiled = append(compiled, prefixPolicy{prefix: p.PathPrefix, policy: newCORSPolicy(p.Config)})
+	}
+	sort.SliceStable(compiled, func(i, j int) bool {
+		return len(compiled[i].prefix) > len(compiled[j].prefix)
+	})
+	fallback := newCORSPolicy(defaultConfig)
 
-		// 设置允许的请求头
-		if len(config.AllowHeaders) > 0 {
-			headers := ""
-			for i, header := range config.AllowHeaders {
-				if i > 0 {
-					headers += ", "
-				}
-				headers += header
+	return func(c *gin.Context) {
+		path := c.Request.URL.Path
+		for _, p := range compiled {
+			if strings.HasPrefix(path, p.prefix) {
+				p.policy.handle(c)
+				return
 			}
-			c.Writer.Header().Set("Access-Control-Allow-Headers", headers)
 		}
+		fallback.handle(c)
+	}
+}
 
-		// 设置暴露的响应头
-		if len(config.ExposeHeaders) > 0 {
-			headers := ""
-			for i, header := range config.ExposeHeaders {
-				if i > 0 {
-					headers += ", "
-				}
-				headers += header
-			}
-			c.Writer.Header().Set("Access-Control-Expose-Headers", headers)
-		}
+// corsPolicy 预处理后的 CORS 配置
+type corsPolicy struct {
+	config        *CORSConfig
+	allowAll      bool
+	exactOrigins  map[string]struct{}
+	wildcards     []originPattern
+	methods       map[string]struct{}
+	headers       map[string]struct{}
+	anyHeader     bool
+	allowMethods  string
+	allowHeaders  string
+	exposeHeaders string
+	maxAge        string
+}
 
-		// 设置是否允许携带凭证
-		if config.AllowCredentials {
-			c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
+// originPattern 通配来源，如 "https://*.example.com" 拆分为前缀 "https://" 与后缀 ".example.com"
+type originPattern struct {
+	prefix string
+	suffix string
+}
+
+func (p originPattern) match(origin string) bool {
+	if len(origin) <= len(p.prefix)+len(p.suffix) {
+		return false
+	}
+	if !strings.HasPrefix(origin, p.prefix) || !strings.HasSuffix(origin, p.suffix) {
+		return false
+	}
+	// 通配部分只能是子域名，不能包含路径、端口或用户信息
+	sub := origin[len(p.prefix) : len(origin)-len(p.suffix)]
+	return !strings.ContainsAny(sub, "/:@?#")
+}
+
+func newCORSPolicy(config *CORSConfig) *corsPolicy {
+	if config == nil {
+		config = DefaultCORSConfig()
+	}
+	p := &corsPolicy{
+		config:       config,
+		exactOrigins: make(map[string]struct{}),
+		methods:      make(map[string]struct{}),
+		headers:      make(map[string]struct{}),
+	}
+	for _, origin := range config.AllowOrigins {
+		origin = strings.ToLower(strings.TrimSpace(origin))
+		switch {
+		case origin == "*":
+			p.allowAll = true
+		case strings.Contains(origin, "*"):
+			i := strings.Index(origin, "*")
+			p.wildcards = append(p.wildcards, originPattern{prefix: origin[:i], suffix: origin[i+1:]})
+		default:
+			p.exactOrigins[origin] = struct{}{}
 		}
+	}
+	for _, method := range config.AllowMethods {
+		p.methods[strings.ToUpper(method)] = struct{}{}
+	}
+	for _, header := range config.AllowHeaders {
+		if header == "*" {
+			p.anyHeader = true
+			continue
+		}
+		p.headers[strings.ToLower(header)] = struct{}{}
+	}
+	p.allowMethods = strings.Join(config.AllowMethods, ", ")
+	p.allowHeaders = strings.Join(config.AllowHeaders, ", ")
+	p.exposeHeaders = strings.Join(config.ExposeHeaders, ", ")
+	if config.MaxAge > 0 {
+		p.maxAge = strconv.Itoa(config.MaxAge)
+	}
+	if p.allowAll && config.AllowCredentials {
+		Logger().Warn("CORS AllowOrigins \"*\" 不会携带凭证，需要凭证的来源请显式配置")
+	}
+	return p
+}
 
-		// 设置预检请求的缓存时间
-		if config.MaxAge > 0 {
-			c.Writer.Header().Set("Access-Control-Max-Age", string(rune(config.MaxAge)))
+// originAllowed 检查来源是否允许
+// 第二个返回值表示是否只由 "*" 匹配，此时不携带凭证，否则任意网站都能以用户身份跨域访问
+func (p *corsPolicy) originAllowed(origin string) (allowed, anyOrigin bool) {
+	lower := strings.ToLower(origin)
+	if _, ok := p.exactOrigins[lower]; ok {
+		return true, false
+	}
+	for _, w := range p.wildcards {
+		if w.match(lower) {
+			return true, false
 		}
+	}
+	if p.config.AllowOriginFunc != nil && p.config.AllowOriginFunc(origin) {
+		return true, false
+	}
+	return p.allowAll, p.allowAll
+}
 
-		// 处理预检请求
-		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(http.StatusNoContent)
-			return
+// requestHeadersAllowed 检查预检请求声明的请求头是否都被允许
+func (p *corsPolicy) requestHeadersAllowed(requested string) bool {
+	if p.anyHeader || requested == "" {
+		return true
+	}
+	for _, header := range strings.Split(requested, ",") {
+		header = strings.ToLower(strings.TrimSpace(header))
+		if header == "" {
+			continue
 		}
+		if _, ok := p.headers[header]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// setAllowOrigin 设置 Access-Control-Allow-Origin；只由 "*" 匹配的来源返回 "*" 且不携带凭证
+func (p *corsPolicy) setAllowOrigin(c *gin.Context, origin string, anyOrigin bool) {
+	header := c.Writer.Header()
+	if anyOrigin || (p.allowAll && !p.config.AllowCredentials) {
+		header.Set("Access-Control-Allow-Origin", "*")
+	} else {
+		header.Set("Access-Control-Allow-Origin", origin)
+	}
+	if p.config.AllowCredentials && !anyOrigin {
+		header.Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+func (p *corsPolicy) handle(c *gin.Context) {
+	origin := c.Request.Header.Get("Origin")
+	// 响应内容随 Origin 变化，需告知缓存
+	c.Writer.Header().Add("Vary", "Origin")
 
+	// 非跨域请求
+	if origin == "" {
 		c.Next()
+		return
 	}
+
+	allowed, anyOrigin := p.originAllowed(origin)
+
+	// 只有带 Access-Control-Request-Method 的 OPTIONS 才是预检请求，其余 OPTIONS 按普通跨域请求交给路由处理
+	if c.Request.Method == http.MethodOptions && c.Request.Header.Get("Access-Control-Request-Method") != "" {
+		p.handlePreflight(c, origin, allowed, anyOrigin)
+		return
+	}
+
+	// 不允许的来源：不附加任何 CORS 响应头，由浏览器拦截
+	if allowed {
+		p.setAllowOrigin(c, origin, anyOrigin)
+		if p.exposeHeaders != "" {
+			c.Writer.Header().Set("Access-Control-Expose-Headers", p.exposeHeaders)
+		}
+	}
+	c.Next()
+}
+
+// handlePreflight 处理预检请求：校验来源、请求方法与请求头
+func (p *corsPolicy) handlePreflight(c *gin.Context, origin string, allowed, anyOrigin bool) {
+	header := c.Writer.Header()
+	header.Add("Vary", "Access-Control-Request-Method")
+	header.Add("Vary", "Access-Control-Request-Headers")
+
+	if !allowed {
+		c.AbortWithStatus(http.StatusForbidden)
+		return
+	}
+
+	requestMethod := strings.ToUpper(c.Request.Header.Get("Access-Control-Request-Method"))
+	if _, ok := p.methods[requestMethod]; !ok {
+		c.AbortWithStatus(http.StatusForbidden)
+		return
+	}
+	requestHeaders := c.Request.Header.Get("Access-Control-Request-Headers")
+	if !p.requestHeadersAllowed(requestHeaders) {
+		c.AbortWithStatus(http.StatusForbidden)
+		return
+	}
+
+	p.setAllowOrigin(c, origin, anyOrigin)
+	if p.allowMethods != "" {
+		header.Set("Access-Control-Allow-Methods", p.allowMethods)
+	}
+	if p.anyHeader && requestHeaders != "" {
+		// "*" 在携带凭证时不被浏览器接受，直接回显请求的头
+		header.Set("Access-Control-Allow-Headers", requestHeaders)
+	} else if p.allowHeaders != "" {
+		header.Set("Access-Control-Allow-Headers", p.allowHeaders)
+	}
+	if p.maxAge != "" {
+		header.Set("Access-Control-Max-Age", p.maxAge)
+	}
+	if p.config.AllowPrivateNetwork && c.Request.Header.Get("Access-Control-Request-Private-Network") == "true" {
+		header.Set("Access-Control-Allow-Private-Network", "true")
+	}
+
+	c.AbortWithStatus(http.StatusNoContent)
 }
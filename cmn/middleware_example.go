@@ -15,10 +15,10 @@ func SetupRouter() *gin.Engine {
 	// 方式1: 使用默認中間件集合
 	registry.ApplyDefault()
 
-	// 方式2: 手動注冊中間件
-	// registry.Register(RecoveryMiddleware())
-	// registry.Register(LoggerMiddleware())
-	// registry.Register(CORSMiddleware())
+	// 方式2: 手動注冊中間件（按名稱和優先級排序，與註冊順序無關）
+	// registry.RegisterNamed("recovery", RecoveryMiddleware(), WithPriority(PriorityRecovery))
+	// registry.RegisterNamed("requestId", RequestIDMiddleware(), WithPriority(PriorityRequestID))
+	// registry.RegisterNamed("logger", LoggerMiddleware(), WithPriority(PriorityLogger), WithAfter("requestId"))
 
 	// 方式3: 批量注冊中間件
 	// registry.RegisterMultiple(
@@ -30,7 +30,9 @@ func SetupRouter() *gin.Engine {
 	// )
 
 	// 應用所有已注冊的中間件
-	registry.Apply()
+	if err := registry.Apply(); err != nil {
+		panic(err)
+	}
 
 	return router
 }
@@ -62,16 +64,18 @@ func SetupRouterWithCustomConfig() *gin.Engine {
 	rateLimitConfig.Rate = 100     // 每秒100個請求
 	rateLimitConfig.Capacity = 200 // 桶容量200
 
-	// 註冊中間件
-	registry.RegisterMultiple(
-		RecoveryMiddleware(),
-		LoggerMiddlewareWithConfigCustom(loggerConfig),
-		CORSMiddlewareWithConfig(corsConfig),
-		RateLimitMiddleware(rateLimitConfig),
-		TimeoutMiddleware(30000000000), // 30秒
-	)
-
-	registry.Apply()
+	// 註冊中間件，執行順序由優先級決定
+	registry.
+		RegisterNamed("recovery", RecoveryMiddleware(), WithPriority(PriorityRecovery)).
+		RegisterNamed("requestId", RequestIDMiddleware(), WithPriority(PriorityRequestID)).
+		RegisterNamed("logger", LoggerMiddlewareWithConfigCustom(loggerConfig), WithPriority(PriorityLogger), WithAfter("requestId")).
+		RegisterNamed("cors", CORSMiddlewareWithConfig(corsConfig), WithPriority(PriorityCORS)).
+		RegisterNamed("rateLimit", RateLimitMiddleware(rateLimitConfig), WithPriority(PriorityRateLimit)).
+		RegisterNamed("timeout", TimeoutMiddleware(30000000000), WithPriority(PriorityTimeout)) // 30秒
+
+	if err := registry.Apply(); err != nil {
+		panic(err)
+	}
 
 	// 設置路由組，添加認證中間件
 	api := router.Group("/api/v1")
@@ -80,9 +84,13 @@ func SetupRouterWithCustomConfig() *gin.Engine {
 		api.POST("/login", loginHandler)
 		api.POST("/register", registerHandler)
 
-		// 需要認證的路由
+		// 需要認證的路由：認證中間件只應用到該路由組
 		auth := api.Group("")
-		auth.Use(AuthMiddlewareWithConfig(authConfig))
+		authRegistry := NewMiddlewareRegistry(router)
+		authRegistry.RegisterNamed("auth", AuthMiddlewareWithConfig(authConfig), WithPriority(PriorityAuth))
+		if err := authRegistry.ApplyTo(auth); err != nil {
+			panic(err)
+		}
 		{
 			auth.GET("/profile", profileHandler)
 			auth.PUT("/profile", updateProfileHandler)
@@ -92,6 +100,33 @@ func SetupRouterWithCustomConfig() *gin.Engine {
 	return router
 }
 
+// SetupRouterFromConfig 根據配置文件的 middleware.pipeline 設置中間件
+// 不同環境使用不同的配置文件即可啟用、禁用或調整中間件順序，無需重新編譯
+func SetupRouterFromConfig() (*gin.Engine, error) {
+	router := gin.New()
+	registry := NewMiddlewareRegistry(router)
+
+	// 註冊自定義中間件工廠後即可在配置中按名稱引用
+	// registry.RegisterFactory("myMiddleware", func(options MiddlewareOptions) (MiddlewareFunc, error) {
+	// 	return myMiddleware(), nil
+	// })
+
+	if err := registry.LoadFromConfig(); err != nil {
+		return nil, err
+	}
+	if err := registry.Apply(); err != nil {
+		return nil, err
+	}
+
+	api := router.Group("/api/v1")
+	{
+		api.POST("/login", loginHandler)
+		api.POST("/register", registerHandler)
+	}
+
+	return router, nil
+}
+
 // 示例處理器函數
 func loginHandler(c *gin.Context) {
 	c.JSON(200, gin.H{"message": "login"})
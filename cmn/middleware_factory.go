@@ -0,0 +1,355 @@
+package cmn
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// MiddlewareOptions 中间件选项，来自配置文件中每个中间件的 options
+type MiddlewareOptions map[string]interface{}
+
+// Decode 把选项解码到结构体，字段名大小写不敏感（viper 读取配置时会把键转为小写）
+func (o MiddlewareOptions) Decode(v interface{}) error {
+	if len(o) == 0 {
+		return nil
+	}
+	data, err := json.Marshal(o)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// MiddlewareFactory 根据选项创建中间件
+type MiddlewareFactory func(options MiddlewareOptions) (MiddlewareFunc, error)
+
+// policyFactory 同时返回中间件对路由施加的策略的工厂，内置中间件使用，自定义工厂的策略为 nil
+type policyFactory func(options MiddlewareOptions) (MiddlewareFunc, RoutePolicyFunc, error)
+
+// withoutPolicy 把不描述策略的工厂转换为 policyFactory
+func withoutPolicy(factory MiddlewareFactory) policyFactory {
+	return func(options MiddlewareOptions) (MiddlewareFunc, RoutePolicyFunc, error) {
+		middleware, err := factory(options)
+		return middleware, nil, err
+	}
+}
+
+// MiddlewareSpec 配置文件中声明的一个中间件
+type MiddlewareSpec struct {
+	Name     string            `mapstructure:"name" json:"name"`
+	Enabled  *bool             `mapstructure:"enabled" json:"enabled"`   // 缺省为启用
+	Priority *int              `mapstructure:"priority" json:"priority"` // 缺省为 PriorityDefault，即按声明顺序执行
+	After    []string          `mapstructure:"after" json:"after"`       // 额外声明的依赖，与内置依赖合并
+	Options  MiddlewareOptions `mapstructure:"options" json:"options"`
+}
+
+// enabled 返回该中间件是否启用
+func (s MiddlewareSpec) enabled() bool {
+	return s.Enabled == nil || *s.Enabled
+}
+
+// optionDuration 支持 "30s" 字符串或纳秒数字的时长
+type optionDuration time.Duration
+
+func (d *optionDuration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		parsed, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		*d = optionDuration(parsed)
+		return nil
+	}
+	var n int64
+	if err := json.Unmarshal(data, &n); err != nil {
+		return fmt.Errorf("invalid duration %s", data)
+	}
+	*d = optionDuration(n)
+	return nil
+}
+
+// routeOption 路由级选项，如 {"method": "POST", "path": "/api/v1/userInfo", "value": "2m"}
+// 以列表而不是 map 配置：viper 会把 map 的键转为小写，并把键中的 "." 当作层级分隔符
+type routeOption[T any] struct {
+	Method string `json:"method"` // 为空时匹配该路径的所有方法
+	Path   string `json:"path"`   // 路由模板路径，如 /api/v1/posts/:id
+	Value  T      `json:"value"`
+}
+
+// routeOptions 把路由级选项转为 "方法 路径" 或 "路径" 为键的 map
+func routeOptions[T, V any](routes []routeOption[T], convert func(T) V) (map[string]V, error) {
+	if len(routes) == 0 {
+		return nil, nil
+	}
+	result := make(map[string]V, len(routes))
+	for _, route := range routes {
+		if route.Path == "" {
+			return nil, fmt.Errorf("route option requires a path")
+		}
+		key := route.Path
+		if route.Method != "" {
+			key = strings.ToUpper(route.Method) + " " + route.Path
+		}
+		result[key] = convert(route.Value)
+	}
+	return result, nil
+}
+
+// builtinMiddlewareFactories 内置中间件工厂，每个注册器创建时复制一份
+var builtinMiddlewareFactories = map[string]policyFactory{
+	"recovery":  withoutPolicy(recoveryFactory),
+	"logger":    withoutPolicy(loggerFactory),
+	"cors":      withoutPolicy(corsFactory),
+	"rateLimit": rateLimitFactory,
+	"timeout":   timeoutFactory,
+	"auth":      authFactory,
+	"requestId": withoutPolicy(requestIdFactory),
+	"bodyLimit": withoutPolicy(bodyLimitFactory),
+}
+
+// builtinMiddlewareAfter 内置中间件必须满足的执行顺序（仅在依赖的中间件也已注册时校验）
+var builtinMiddlewareAfter = map[string][]string{
+	"logger":    {"recovery", "requestId"},
+	"rateLimit": {"recovery"},
+	"timeout":   {"recovery"},
+	"bodyLimit": {"recovery"},
+	"auth":      {"recovery", "requestId"},
+}
+
+// requestIdFactory 无选项
+func requestIdFactory(MiddlewareOptions) (MiddlewareFunc, error) {
+	return RequestIDMiddleware(), nil
+}
+
+// recoveryFactory 选项：enableStackTrace、errorMessage
+func recoveryFactory(options MiddlewareOptions) (MiddlewareFunc, error) {
+	if len(options) == 0 {
+		return RecoveryMiddleware(), nil
+	}
+	config := DefaultRecoveryConfig()
+	if err := options.Decode(config); err != nil {
+		return nil, err
+	}
+	return RecoveryMiddlewareWithConfig(config), nil
+}
+
+// loggerFactory 选项：skipPaths、skipMethods、slowThreshold，
+// 以及 logBody、logHeaders、maxBodyBytes、redactFields、redactHeaders（追加到默认的脱敏列表）
+func loggerFactory(options MiddlewareOptions) (MiddlewareFunc, error) {
+	if len(options) == 0 {
+		return LoggerMiddleware(), nil
+	}
+	config := DefaultLoggerConfig()
+	var opts struct {
+		SkipPaths     []string        `json:"skipPaths"`
+		SkipMethods   []string        `json:"skipMethods"`
+		SlowThreshold *optionDuration `json:"slowThreshold"`
+		LogBody       bool            `json:"logBody"`
+		LogHeaders    bool            `json:"logHeaders"`
+		MaxBodyBytes  int             `json:"maxBodyBytes"`
+		RedactFields  []string        `json:"redactFields"`
+		RedactHeaders []string        `json:"redactHeaders"`
+	}
+	if err := options.Decode(&opts); err != nil {
+		return nil, err
+	}
+	if opts.SkipPaths != nil {
+		config.SkipPaths = opts.SkipPaths
+	}
+	if opts.SkipMethods != nil {
+		config.SkipMethods = opts.SkipMethods
+	}
+	if opts.SlowThreshold != nil {
+		config.SlowThreshold = time.Duration(*opts.SlowThreshold)
+	}
+	config.HttpLog.LogBody = opts.LogBody
+	config.HttpLog.LogHeaders = opts.LogHeaders
+	if opts.MaxBodyBytes > 0 {
+		config.HttpLog.MaxBodyBytes = opts.MaxBodyBytes
+	}
+	config.HttpLog.RedactFields = append(config.HttpLog.RedactFields, opts.RedactFields...)
+	config.HttpLog.RedactHeaders = append(config.HttpLog.RedactHeaders, opts.RedactHeaders...)
+	return LoggerMiddlewareWithConfigCustom(config), nil
+}
+
+// corsFactory 选项与 CORSConfig 字段同名（allowOrigins、allowCredentials、maxAge 等）
+func corsFactory(options MiddlewareOptions) (MiddlewareFunc, error) {
+	config := DefaultCORSConfig()
+	if err := options.Decode(config); err != nil {
+		return nil, err
+	}
+	return CORSMiddlewareWithConfig(config), nil
+}
+
+// rateLimitFactory 选项：rate、capacity、key（ip 或 user，默认 ip）
+func rateLimitFactory(options MiddlewareOptions) (MiddlewareFunc, RoutePolicyFunc, error) {
+	config := DefaultRateLimitConfig()
+	var opts struct {
+		Rate     *float64 `json:"rate"`
+		Capacity *int     `json:"capacity"`
+		Key      string   `json:"key"`
+	}
+	if err := options.Decode(&opts); err != nil {
+		return nil, nil, err
+	}
+	if opts.Rate != nil {
+		config.Rate = *opts.Rate
+	}
+	if opts.Capacity != nil {
+		config.Capacity = *opts.Capacity
+	}
+	switch opts.Key {
+	case "", "ip":
+	case "user":
+		config.KeyFunc = func(c *gin.Context) string {
+			if userId, ok := GetUserId(c); ok {
+				return userId
+			}
+			return c.ClientIP()
+		}
+	default:
+		return nil, nil, fmt.Errorf("unsupported rate limit key: %s", opts.Key)
+	}
+	return RateLimitMiddleware(config), RateLimitRoutePolicy(config), nil
+}
+
+// timeoutFactory 选项：timeout（如 "30s"）、routes（路由级超时，如 [{"method": "GET", "path": "/api/v1/report", "value": "2m"}]）
+func timeoutFactory(options MiddlewareOptions) (MiddlewareFunc, RoutePolicyFunc, error) {
+	config := DefaultTimeoutConfig()
+	var opts struct {
+		Timeout *optionDuration               `json:"timeout"`
+		Routes  []routeOption[optionDuration] `json:"routes"`
+	}
+	if err := options.Decode(&opts); err != nil {
+		return nil, nil, err
+	}
+	if opts.Timeout != nil {
+		config.Timeout = time.Duration(*opts.Timeout)
+	}
+	routes, err := routeOptions(opts.Routes, func(d optionDuration) time.Duration { return time.Duration(d) })
+	if err != nil {
+		return nil, nil, err
+	}
+	config.Routes = routes
+	return TimeoutMiddlewareWithConfig(config), TimeoutRoutePolicy(config), nil
+}
+
+// bodyLimitFactory 选项：maxBytes、routes（路由级上限，如 [{"method": "POST", "path": "/api/v1/upload", "value": 10485760}]）、
+// allowedContentTypes、maxDecompressionRatio
+func bodyLimitFactory(options MiddlewareOptions) (MiddlewareFunc, error) {
+	config := DefaultBodyLimitConfig()
+	var opts struct {
+		MaxBytes              *int64               `json:"maxBytes"`
+		Routes                []routeOption[int64] `json:"routes"`
+		AllowedContentTypes   []string             `json:"allowedContentTypes"`
+		MaxDecompressionRatio *int64               `json:"maxDecompressionRatio"`
+	}
+	if err := options.Decode(&opts); err != nil {
+		return nil, err
+	}
+	if opts.MaxBytes != nil {
+		config.MaxBytes = *opts.MaxBytes
+	}
+	routes, err := routeOptions(opts.Routes, func(n int64) int64 { return n })
+	if err != nil {
+		return nil, err
+	}
+	config.Routes = routes
+	if opts.AllowedContentTypes != nil {
+		config.AllowedContentTypes = opts.AllowedContentTypes
+	}
+	if opts.MaxDecompressionRatio != nil {
+		config.MaxDecompressionRatio = *opts.MaxDecompressionRatio
+	}
+	return BodyLimitMiddlewareWithConfig(config), nil
+}
+
+// authFactory 选项：tokenHeader、tokenPrefix、skipPaths
+func authFactory(options MiddlewareOptions) (MiddlewareFunc, RoutePolicyFunc, error) {
+	if len(options) == 0 {
+		return AuthMiddleware(), AuthRoutePolicy(nil), nil
+	}
+	config := DefaultAuthConfig()
+	if err := options.Decode(config); err != nil {
+		return nil, nil, err
+	}
+	return AuthMiddlewareWithConfig(config), AuthRoutePolicy(config), nil
+}
+
+// RegisterFactory 注册命名的中间件工厂，同名工厂会被覆盖（覆盖内置工厂后路由清单不再显示其策略）
+func (r *MiddlewareRegistry) RegisterFactory(name string, factory MiddlewareFactory) *MiddlewareRegistry {
+	r.factories[name] = withoutPolicy(factory)
+	return r
+}
+
+// Factory 获取命名的中间件工厂
+func (r *MiddlewareRegistry) Factory(name string) (MiddlewareFactory, bool) {
+	factory, ok := r.factories[name]
+	if !ok {
+		return nil, false
+	}
+	return func(options MiddlewareOptions) (MiddlewareFunc, error) {
+		middleware, _, err := factory(options)
+		return middleware, err
+	}, true
+}
+
+// LoadPipeline 按顺序根据声明创建并注册中间件，未启用的中间件会被跳过
+// 未指定 priority 时按声明顺序执行；内置中间件的顺序约束（如 auth 必须在 recovery 之后）在 Apply 时校验
+func (r *MiddlewareRegistry) LoadPipeline(specs []MiddlewareSpec) error {
+	entries := make([]*MiddlewareEntry, 0, len(specs))
+	for _, spec := range specs {
+		if !spec.enabled() {
+			Logger().Info("中间件未启用，跳过", zap.String("name", spec.Name))
+			continue
+		}
+		factory, ok := r.factories[spec.Name]
+		if !ok {
+			return fmt.Errorf("未知的中间件: %s", spec.Name)
+		}
+		middleware, policy, err := factory(spec.Options)
+		if err != nil {
+			return fmt.Errorf("创建中间件 %s 失败: %w", spec.Name, err)
+		}
+		priority := PriorityDefault
+		if spec.Priority != nil {
+			priority = *spec.Priority
+		}
+		after := append(append([]string(nil), builtinMiddlewareAfter[spec.Name]...), spec.After...)
+		entries = append(entries, &MiddlewareEntry{
+			Name:     spec.Name,
+			Priority: priority,
+			After:    after,
+			Handler:  middleware,
+			Policy:   policy,
+		})
+	}
+	// 全部创建成功后再注册，避免配置错误时只注册了一部分
+	r.entries = append(r.entries, entries...)
+	r.generation++
+	return nil
+}
+
+// LoadFromConfig 从配置文件的 middleware.pipeline 读取中间件声明并注册
+//
+//	"middleware": {
+//	  "pipeline": [
+//	    {"name": "recovery"},
+//	    {"name": "rateLimit", "options": {"rate": 100, "capacity": 200}},
+//	    {"name": "timeout", "enabled": false, "options": {"timeout": "30s"}}
+//	  ]
+//	}
+func (r *MiddlewareRegistry) LoadFromConfig() error {
+	var specs []MiddlewareSpec
+	if err := viper.UnmarshalKey("middleware.pipeline", &specs); err != nil {
+		return fmt.Errorf("解析中间件配置失败: %w", err)
+	}
+	return r.LoadPipeline(specs)
+}
@@ -0,0 +1,177 @@
+package cmn
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMiddlewarePipeline(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	t.Run("從配置文件加載中間件", func(t *testing.T) {
+		assert.NoError(t, ViperInit(".conf_linux.json"))
+
+		router := gin.New()
+		registry := NewMiddlewareRegistry(router)
+		assert.NoError(t, registry.LoadFromConfig())
+		assert.Equal(t, 5, registry.Count())
+	})
+
+	t.Run("選項生效並跳過禁用的中間件", func(t *testing.T) {
+		disabled := false
+		router := gin.New()
+		registry := NewMiddlewareRegistry(router)
+		err := registry.LoadPipeline([]MiddlewareSpec{
+			{Name: "recovery"},
+			{Name: "rateLimit", Options: MiddlewareOptions{"rate": 1, "capacity": 1}},
+			{Name: "timeout", Enabled: &disabled, Options: MiddlewareOptions{"timeout": "1ms"}},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, 2, registry.Count())
+		registry.Apply()
+
+		router.GET("/test", func(c *gin.Context) {
+			time.Sleep(5 * time.Millisecond)
+			c.JSON(200, gin.H{"message": "ok"})
+		})
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/test", nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		w = httptest.NewRecorder()
+		req, _ = http.NewRequest("GET", "/test", nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	})
+
+	t.Run("viper小寫鍵仍可解碼", func(t *testing.T) {
+		viper.Set("middleware_test.pipeline", []interface{}{
+			map[string]interface{}{
+				"name": "cors",
+				"options": map[string]interface{}{
+					"alloworigins": []string{"https://*.example.com"},
+					"maxage":       600,
+				},
+			},
+			map[string]interface{}{
+				"name": "timeout",
+				"options": map[string]interface{}{
+					"timeout": "1s",
+					"routes":  []interface{}{map[string]interface{}{"method": "get", "path": "/slow", "value": "10ms"}},
+				},
+			},
+		})
+		var specs []MiddlewareSpec
+		assert.NoError(t, viper.UnmarshalKey("middleware_test.pipeline", &specs))
+
+		router := gin.New()
+		registry := NewMiddlewareRegistry(router)
+		assert.NoError(t, registry.LoadPipeline(specs))
+		registry.Apply()
+		router.GET("/slow", func(c *gin.Context) {
+			<-c.Request.Context().Done()
+		})
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("OPTIONS", "/slow", nil)
+		req.Header.Set("Origin", "https://app.example.com")
+		req.Header.Set("Access-Control-Request-Method", "GET")
+		router.ServeHTTP(w, req)
+		assert.Equal(t, "600", w.Header().Get("Access-Control-Max-Age"))
+
+		w = httptest.NewRecorder()
+		req, _ = http.NewRequest("GET", "/slow", nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusRequestTimeout, w.Code)
+	})
+
+	t.Run("路由級選項保留路徑大小寫與點號", func(t *testing.T) {
+		v := viper.New()
+		v.SetConfigType("json")
+		assert.NoError(t, v.ReadConfig(strings.NewReader(`{"middleware": {"pipeline": [
+			{"name": "timeout", "options": {"timeout": "1s", "routes": [
+				{"method": "POST", "path": "/api/v1/userInfo", "value": "10ms"}
+			]}},
+			{"name": "bodyLimit", "options": {"maxBytes": 1024, "routes": [
+				{"path": "/api/v1/file.upload", "value": 8}
+			]}}
+		]}}`)))
+		var specs []MiddlewareSpec
+		if !assert.NoError(t, v.UnmarshalKey("middleware.pipeline", &specs)) {
+			return
+		}
+
+		router := gin.New()
+		registry := NewMiddlewareRegistry(router)
+		assert.NoError(t, registry.LoadPipeline(specs))
+		assert.NoError(t, registry.Apply())
+		router.POST("/api/v1/userInfo", func(c *gin.Context) {
+			<-c.Request.Context().Done()
+		})
+		router.POST("/api/v1/file.upload", func(c *gin.Context) {
+			if _, err := c.GetRawData(); err != nil {
+				return
+			}
+			c.Status(http.StatusOK)
+		})
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/v1/userInfo", nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusRequestTimeout, w.Code)
+
+		w = httptest.NewRecorder()
+		req, _ = http.NewRequest("POST", "/api/v1/file.upload", strings.NewReader(`{"name":"0123456789"}`))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	})
+
+	t.Run("自定義工廠", func(t *testing.T) {
+		router := gin.New()
+		registry := NewMiddlewareRegistry(router)
+		registry.RegisterFactory("header", func(options MiddlewareOptions) (MiddlewareFunc, error) {
+			var opts struct {
+				Value string `json:"value"`
+			}
+			if err := options.Decode(&opts); err != nil {
+				return nil, err
+			}
+			return func(c *gin.Context) {
+				c.Header("X-Custom", opts.Value)
+				c.Next()
+			}, nil
+		})
+		assert.NoError(t, registry.LoadPipeline([]MiddlewareSpec{
+			{Name: "header", Options: MiddlewareOptions{"value": "v1"}},
+		}))
+		registry.Apply()
+		router.GET("/test", func(c *gin.Context) {})
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/test", nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, "v1", w.Header().Get("X-Custom"))
+	})
+
+	t.Run("未知中間件或錯誤選項不註冊任何中間件", func(t *testing.T) {
+		registry := NewMiddlewareRegistry(gin.New())
+
+		assert.Error(t, registry.LoadPipeline([]MiddlewareSpec{{Name: "recovery"}, {Name: "unknown"}}))
+		assert.Error(t, registry.LoadPipeline([]MiddlewareSpec{{Name: "timeout", Options: MiddlewareOptions{"timeout": "abc"}}}))
+		assert.Error(t, registry.LoadPipeline([]MiddlewareSpec{{Name: "rateLimit", Options: MiddlewareOptions{"key": "device"}}}))
+		assert.Error(t, registry.LoadPipeline([]MiddlewareSpec{{Name: "timeout", Options: MiddlewareOptions{
+			"routes": []interface{}{map[string]interface{}{"method": "GET", "value": "1s"}},
+		}}}))
+		assert.Equal(t, 0, registry.Count())
+	})
+}
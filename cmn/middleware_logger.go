@@ -1,6 +1,9 @@
 package cmn
 
 import (
+	"bytes"
+	"io"
+	"net/http"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -25,8 +28,8 @@ func LoggerMiddleware() MiddlewareFunc {
 		// 请求方式
 		reqMethod := c.Request.Method
 
-		// 请求路由
-		reqUri := c.Request.RequestURI
+		// 请求路由（查询参数已脱敏）
+		reqUri := defaultHttpLogConfig.RedactURL(c.Request.RequestURI)
 
 		// 状态码
 		statusCode := c.Writer.Status()
@@ -34,8 +37,8 @@ func LoggerMiddleware() MiddlewareFunc {
 		// 请求IP
 		clientIP := c.ClientIP()
 
-		// 日志记录
-		Logger().Info("HTTP请求",
+		// 日志记录，级别由状态码决定
+		Logger().Log(defaultHttpLogConfig.LevelForStatus(statusCode), "HTTP请求",
 			zap.Int("status_code", statusCode),
 			zap.String("latency", latencyTime.String()),
 			zap.String("client_ip", clientIP),
@@ -44,10 +47,10 @@ func LoggerMiddleware() MiddlewareFunc {
 			zap.String("user_agent", c.Request.UserAgent()),
 		)
 
-		// 如果有错误，记录错误
+		// 如果有错误，按错误码定义的级别记录错误
 		if len(c.Errors) > 0 {
 			for _, e := range c.Errors {
-				Logger().Error("请求错误",
+				Logger().Log(errorLogLevel(e.Err), "请求错误",
 					zap.String("error", e.Error()),
 					zap.String("method", reqMethod),
 					zap.String("uri", reqUri),
@@ -62,6 +65,9 @@ type LoggerConfig struct {
 	SkipPaths     []string      // 跳过记录的路径
 	SkipMethods   []string      // 跳过记录的方法
 	SlowThreshold time.Duration // 慢请求阈值
+
+	// HttpLog 脱敏、请求体记录与日志级别，与出站 HttpClient 共用，为空时使用 DefaultHttpLogConfig
+	HttpLog *HttpLogConfig
 }
 
 // DefaultLoggerConfig 默认日志配置
@@ -70,11 +76,17 @@ func DefaultLoggerConfig() *LoggerConfig {
 		SkipPaths:     []string{"/health", "/ping"},
 		SkipMethods:   []string{},
 		SlowThreshold: 200 * time.Millisecond,
+		HttpLog:       DefaultHttpLogConfig(),
 	}
 }
 
 // LoggerMiddlewareWithConfigCustom 自定义配置的日志中间件
+// URI 的查询参数按 HttpLog 脱敏；开启 HttpLog.LogBody 时记录脱敏并截断后的请求体与响应体
 func LoggerMiddlewareWithConfigCustom(config *LoggerConfig) MiddlewareFunc {
+	httpLog := config.HttpLog
+	if httpLog == nil {
+		httpLog = defaultHttpLogConfig
+	}
 	return func(c *gin.Context) {
 		// 检查是否需要跳过此路径
 		path := c.Request.URL.Path
@@ -94,6 +106,15 @@ func LoggerMiddlewareWithConfigCustom(config *LoggerConfig) MiddlewareFunc {
 			}
 		}
 
+		// 需要记录请求体/响应体时，截取开头部分用于日志，处理器仍能读取完整的请求体
+		var reqBody []byte
+		var respBody *bodyCaptureWriter
+		if httpLog.LogBody {
+			reqBody = captureRequestBody(c.Request)
+			respBody = &bodyCaptureWriter{ResponseWriter: c.Writer}
+			c.Writer = respBody
+		}
+
 		// 开始时间
 		startTime := time.Now()
 
@@ -109,8 +130,8 @@ func LoggerMiddlewareWithConfigCustom(config *LoggerConfig) MiddlewareFunc {
 		// 请求方式
 		reqMethod := c.Request.Method
 
-		// 请求路由
-		reqUri := c.Request.RequestURI
+		// 请求路由（查询参数已脱敏）
+		reqUri := httpLog.RedactURL(c.Request.RequestURI)
 
 		// 状态码
 		statusCode := c.Writer.Status()
@@ -118,29 +139,31 @@ func LoggerMiddlewareWithConfigCustom(config *LoggerConfig) MiddlewareFunc {
 		// 请求IP
 		clientIP := c.ClientIP()
 
-		// 根据执行时间选择日志级别
+		fields := []zap.Field{
+			zap.Int("status_code", statusCode),
+			zap.Duration("latency", latencyTime),
+			zap.String("client_ip", clientIP),
+			zap.String("method", reqMethod),
+			zap.String("uri", reqUri),
+		}
+		fields = append(fields, httpLog.headerFields(c.Request.Header, c.Writer.Header())...)
+		if respBody != nil {
+			fields = append(fields, httpLog.bodyFields(reqBody, c.GetHeader("Content-Type"),
+				respBody.buf.Bytes(), c.Writer.Header().Get("Content-Type"))...)
+		}
+
+		// 根据状态码选择日志级别，慢请求至少为 Warn
+		level := httpLog.LevelForStatus(statusCode)
 		if latencyTime > config.SlowThreshold {
-			Logger().Warn("慢请求",
-				zap.Int("status_code", statusCode),
-				zap.Duration("latency", latencyTime),
-				zap.String("client_ip", clientIP),
-				zap.String("method", reqMethod),
-				zap.String("uri", reqUri),
-			)
+			Logger().Log(max(level, zap.WarnLevel), "慢请求", fields...)
 		} else {
-			Logger().Info("HTTP请求",
-				zap.Int("status_code", statusCode),
-				zap.Duration("latency", latencyTime),
-				zap.String("client_ip", clientIP),
-				zap.String("method", reqMethod),
-				zap.String("uri", reqUri),
-			)
+			Logger().Log(level, "HTTP请求", fields...)
 		}
 
-		// 如果有错误，记录错误
+		// 如果有错误，按错误码定义的级别记录错误
 		if len(c.Errors) > 0 {
 			for _, e := range c.Errors {
-				Logger().Error("请求错误",
+				Logger().Log(errorLogLevel(e.Err), "请求错误",
 					zap.String("error", e.Error()),
 					zap.String("method", reqMethod),
 					zap.String("uri", reqUri),
@@ -149,3 +172,41 @@ func LoggerMiddlewareWithConfigCustom(config *LoggerConfig) MiddlewareFunc {
 		}
 	}
 }
+
+// maxCapturedBody 为记录日志截取的请求体/响应体最大长度，完整的 JSON 才能脱敏，因此比 MaxBodyBytes 大
+const maxCapturedBody = 64 << 10
+
+// captureRequestBody 读取请求体的开头部分，并把读取的内容放回请求体
+func captureRequestBody(req *http.Request) []byte {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil
+	}
+	prefix, _ := io.ReadAll(io.LimitReader(req.Body, maxCapturedBody))
+	req.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(prefix), req.Body), req.Body}
+	return prefix
+}
+
+// bodyCaptureWriter 在写出响应的同时保留响应体的开头部分
+type bodyCaptureWriter struct {
+	gin.ResponseWriter
+	buf bytes.Buffer
+}
+
+func (w *bodyCaptureWriter) capture(n int, write func(limit int)) {
+	if room := maxCapturedBody - w.buf.Len(); room > 0 {
+		write(min(n, room))
+	}
+}
+
+func (w *bodyCaptureWriter) Write(b []byte) (int, error) {
+	w.capture(len(b), func(limit int) { w.buf.Write(b[:limit]) })
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *bodyCaptureWriter) WriteString(s string) (int, error) {
+	w.capture(len(s), func(limit int) { w.buf.WriteString(s[:limit]) })
+	return w.ResponseWriter.WriteString(s)
+}
@@ -1,7 +1,6 @@
 package cmn
 
 import (
-	"net/http"
 	"sync"
 	"time"
 
@@ -86,10 +85,7 @@ func DefaultRateLimitConfig() *RateLimitConfig {
 			return c.ClientIP()
 		},
 		ErrorHandler: func(c *gin.Context) {
-			c.JSON(http.StatusTooManyRequests, gin.H{
-				"code":    http.StatusTooManyRequests,
-				"message": "请求过于频繁，请稍后再试",
-			})
+			abortWithCode(c, CodeTooManyRequests, "请求过于频繁，请稍后再试")
 		},
 	}
 }
@@ -124,10 +120,7 @@ func RateLimitByIP(rate float64, capacity int) MiddlewareFunc {
 			return c.ClientIP()
 		},
 		ErrorHandler: func(c *gin.Context) {
-			c.JSON(http.StatusTooManyRequests, gin.H{
-				"code":    http.StatusTooManyRequests,
-				"message": "请求过于频繁，请稍后再试",
-			})
+			abortWithCode(c, CodeTooManyRequests, "请求过于频繁，请稍后再试")
 		},
 	}
 	return RateLimitMiddleware(config)
@@ -147,10 +140,7 @@ func RateLimitByUser(rate float64, capacity int) MiddlewareFunc {
 			return userId
 		},
 		ErrorHandler: func(c *gin.Context) {
-			c.JSON(http.StatusTooManyRequests, gin.H{
-				"code":    http.StatusTooManyRequests,
-				"message": "请求过于频繁，请稍后再试",
-			})
+			abortWithCode(c, CodeTooManyRequests, "请求过于频繁，请稍后再试")
 		},
 	}
 	return RateLimitMiddleware(config)
@@ -14,27 +14,29 @@ func RecoveryMiddleware() MiddlewareFunc {
 	return func(c *gin.Context) {
 		defer func() {
 			if err := recover(); err != nil {
-				// 获取堆栈信息
-				stack := string(debug.Stack())
+				// 获取堆栈信息（超时中间件转发的 panic 携带处理器 goroutine 的原始堆栈）
+				value, stack := unwrapPanic(err)
 
 				// 记录错误日志
 				Logger().Error("发生panic",
-					zap.Any("error", err),
+					zap.Any("error", value),
 					zap.String("stack", stack),
 					zap.String("method", c.Request.Method),
 					zap.String("uri", c.Request.RequestURI),
 					zap.String("client_ip", c.ClientIP()),
 				)
 
-				// 返回错误响应
-				c.JSON(http.StatusInternalServerError, gin.H{
-					"code":    http.StatusInternalServerError,
-					"message": "服务器内部错误",
-					"error":   fmt.Sprintf("%v", err),
-				})
+				// 分发给已注册的 panic 上报器
+				ReportPanic(NewHTTPPanicReport(c, value, stack))
 
-				// 终止请求
-				c.Abort()
+				// 响应已提交（例如超时响应已写出）时只终止请求
+				if c.Writer.Written() {
+					c.Abort()
+					return
+				}
+
+				// 返回错误响应并终止请求
+				abortWithCode(c, CodeInternal, "服务器内部错误")
 			}
 		}()
 
@@ -61,38 +63,50 @@ func RecoveryMiddlewareWithConfig(config *RecoveryConfig) MiddlewareFunc {
 	return func(c *gin.Context) {
 		defer func() {
 			if err := recover(); err != nil {
-				// 获取堆栈信息
-				stack := string(debug.Stack())
+				// 获取堆栈信息（超时中间件转发的 panic 携带处理器 goroutine 的原始堆栈）
+				value, stack := unwrapPanic(err)
 
 				// 记录错误日志
 				Logger().Error("发生panic",
-					zap.Any("error", err),
+					zap.Any("error", value),
 					zap.String("stack", stack),
 					zap.String("method", c.Request.Method),
 					zap.String("uri", c.Request.RequestURI),
 					zap.String("client_ip", c.ClientIP()),
 				)
 
-				// 构建响应
-				response := gin.H{
-					"code":    http.StatusInternalServerError,
-					"message": config.ErrorMessage,
+				// 分发给已注册的 panic 上报器
+				ReportPanic(NewHTTPPanicReport(c, value, stack))
+
+				// 响应已提交（例如超时响应已写出）时只终止请求
+				if c.Writer.Written() {
+					c.Abort()
+					return
 				}
 
-				// 如果启用堆栈跟踪，添加到响应中（仅用于调试环境）
+				// 如果启用堆栈跟踪，放入响应的 data 中（仅用于调试环境）
 				if config.EnableStackTrace {
-					response["error"] = fmt.Sprintf("%v", err)
-					response["stack"] = stack
+					reply := newReply(c, http.StatusInternalServerError, config.ErrorMessage, gin.H{
+						"error": fmt.Sprintf("%v", value),
+						"stack": stack,
+					})
+					c.AbortWithStatusJSON(http.StatusInternalServerError, reply)
+					return
 				}
 
-				// 返回错误响应
-				c.JSON(http.StatusInternalServerError, response)
-
-				// 终止请求
-				c.Abort()
+				// 返回错误响应并终止请求
+				abortWithCode(c, CodeInternal, config.ErrorMessage)
 			}
 		}()
 
 		c.Next()
 	}
 }
+
+// unwrapPanic 返回 panic 的原始值与堆栈
+func unwrapPanic(err any) (any, string) {
+	if p, ok := err.(*handlerPanic); ok {
+		return p.value, string(p.stack)
+	}
+	return err, string(debug.Stack())
+}
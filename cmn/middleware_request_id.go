@@ -0,0 +1,46 @@
+package cmn
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequestIDHeader 请求 ID 使用的请求头/响应头
+const RequestIDHeader = "X-Request-ID"
+
+// RequestIDMiddleware 请求 ID 中间件：沿用客户端传入的 X-Request-ID，没有时生成新的 ID
+// ID 存入上下文的 request_id 并写回响应头，供日志、panic 上报和下游调用使用
+func RequestIDMiddleware() MiddlewareFunc {
+	return func(c *gin.Context) {
+		requestId := c.GetHeader(RequestIDHeader)
+		if requestId == "" || len(requestId) > 128 {
+			requestId = newRequestId()
+		}
+
+		c.Set("request_id", requestId)
+		c.Header(RequestIDHeader, requestId)
+		// 同时放入请求的 context，出站请求的 WithRequestID 拦截器据此传给下游
+		c.Request = c.Request.WithContext(ContextWithRequestID(c.Request.Context(), requestId))
+
+		c.Next()
+	}
+}
+
+// newRequestId 生成 32 位十六进制的随机 ID
+func newRequestId() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// GetRequestId 从上下文中获取请求ID
+func GetRequestId(c *gin.Context) (string, bool) {
+	requestId, exists := c.Get("request_id")
+	if !exists {
+		return "", false
+	}
+	requestIdStr, ok := requestId.(string)
+	return requestIdStr, ok
+}
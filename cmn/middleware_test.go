@@ -1,8 +1,12 @@
 package cmn
 
 import (
+	"context"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -68,6 +72,165 @@ func TestMiddlewareRegistry(t *testing.T) {
 		registry.Clear()
 		assert.Equal(t, 0, registry.Count())
 	})
+
+	// record 返回把名稱追加到 order 的中間件
+	record := func(order *[]string, name string) MiddlewareFunc {
+		return func(c *gin.Context) {
+			*order = append(*order, name)
+			c.Next()
+		}
+	}
+
+	t.Run("按優先級排序", func(t *testing.T) {
+		var order []string
+		router := gin.New()
+		registry := NewMiddlewareRegistry(router)
+
+		registry.
+			RegisterNamed("auth", record(&order, "auth"), WithPriority(PriorityAuth)).
+			RegisterNamed("custom", record(&order, "custom")).
+			RegisterNamed("requestId", record(&order, "requestId"), WithPriority(PriorityRequestID)).
+			RegisterNamed("recovery", record(&order, "recovery"), WithPriority(PriorityRecovery))
+		assert.NoError(t, registry.Apply())
+		router.GET("/test", func(c *gin.Context) {})
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/test", nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, []string{"recovery", "requestId", "auth", "custom"}, order)
+	})
+
+	t.Run("違反依賴順序時Apply返回錯誤", func(t *testing.T) {
+		router := gin.New()
+		registry := NewMiddlewareRegistry(router)
+
+		registry.
+			RegisterNamed("auth", func(c *gin.Context) { c.Next() }, WithPriority(10), WithAfter("requestId")).
+			RegisterNamed("requestId", RequestIDMiddleware(), WithPriority(PriorityRequestID))
+		assert.Error(t, registry.Apply())
+		assert.Empty(t, router.Handlers)
+
+		// 依賴的中間件未註冊時不校驗
+		registry = NewMiddlewareRegistry(gin.New())
+		registry.RegisterNamed("auth", func(c *gin.Context) { c.Next() }, WithAfter("requestId"))
+		assert.NoError(t, registry.Apply())
+	})
+
+	t.Run("名稱重複時Apply返回錯誤", func(t *testing.T) {
+		registry := NewMiddlewareRegistry(gin.New())
+		registry.ApplyDefault()
+		registry.RegisterNamed("logger", LoggerMiddleware())
+		assert.Error(t, registry.Apply())
+	})
+
+	t.Run("內置中間件的順序約束", func(t *testing.T) {
+		registry := NewMiddlewareRegistry(gin.New())
+		err := registry.LoadPipeline([]MiddlewareSpec{
+			{Name: "auth"},
+			{Name: "recovery"},
+		})
+		assert.NoError(t, err)
+		assert.Error(t, registry.Apply())
+
+		registry = NewMiddlewareRegistry(gin.New())
+		priority := 1
+		err = registry.LoadPipeline([]MiddlewareSpec{
+			{Name: "auth"},
+			{Name: "recovery", Priority: &priority},
+		})
+		assert.NoError(t, err)
+		assert.NoError(t, registry.Apply())
+	})
+
+	t.Run("重複Apply不會重複註冊", func(t *testing.T) {
+		var order []string
+		router := gin.New()
+		registry := NewMiddlewareRegistry(router)
+
+		registry.RegisterNamed("a", record(&order, "a"))
+		assert.NoError(t, registry.Apply())
+		assert.NoError(t, registry.Apply())
+		assert.Len(t, router.Handlers, 1)
+
+		registry.RegisterNamed("b", record(&order, "b"))
+		assert.Error(t, registry.Apply())
+
+		// 清空後重新註冊同樣數量的中間件也不會被當作已應用
+		registry.Clear()
+		registry.RegisterNamed("c", record(&order, "c"))
+		assert.Error(t, registry.Apply())
+		assert.Len(t, router.Handlers, 1)
+	})
+
+	t.Run("應用到路由組", func(t *testing.T) {
+		var order []string
+		router := gin.New()
+		registry := NewMiddlewareRegistry(router)
+		registry.RegisterNamed("group", record(&order, "group"))
+
+		api := router.Group("/api")
+		assert.NoError(t, registry.ApplyTo(api))
+		assert.NoError(t, registry.ApplyTo(api))
+		api.GET("/test", func(c *gin.Context) {})
+		router.GET("/public", func(c *gin.Context) {})
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/public", nil)
+		router.ServeHTTP(w, req)
+		assert.Empty(t, order)
+
+		w = httptest.NewRecorder()
+		req, _ = http.NewRequest("GET", "/api/test", nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, []string{"group"}, order)
+	})
+
+	t.Run("輸出最終執行鏈", func(t *testing.T) {
+		registry := NewMiddlewareRegistry(gin.New())
+		registry.
+			RegisterNamed("logger", LoggerMiddleware(), WithPriority(PriorityLogger), WithAfter("recovery")).
+			RegisterNamed("recovery", RecoveryMiddleware(), WithPriority(PriorityRecovery))
+
+		chain, err := registry.Chain()
+		assert.NoError(t, err)
+		assert.Equal(t, "recovery", chain[0].Name)
+		assert.Equal(t, "logger", chain[1].Name)
+
+		dump := registry.Dump()
+		assert.Contains(t, dump, " 1. recovery")
+		assert.Contains(t, dump, " 2. logger")
+		assert.Contains(t, dump, "after=recovery")
+	})
+}
+
+func TestRequestIDMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.Use(RequestIDMiddleware())
+	router.GET("/test", func(c *gin.Context) {
+		requestId, _ := GetRequestId(c)
+		c.String(http.StatusOK, requestId)
+	})
+
+	t.Run("生成請求ID", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/test", nil)
+		router.ServeHTTP(w, req)
+
+		assert.Len(t, w.Body.String(), 32)
+		assert.Equal(t, w.Body.String(), w.Header().Get(RequestIDHeader))
+	})
+
+	t.Run("沿用客戶端傳入的請求ID", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/test", nil)
+		req.Header.Set(RequestIDHeader, "abc-123")
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, "abc-123", w.Body.String())
+		assert.Equal(t, "abc-123", w.Header().Get(RequestIDHeader))
+	})
 }
 
 func TestCORSMiddleware(t *testing.T) {
@@ -84,6 +247,7 @@ func TestCORSMiddleware(t *testing.T) {
 		w := httptest.NewRecorder()
 		req, _ := http.NewRequest("OPTIONS", "/test", nil)
 		req.Header.Set("Origin", "http://localhost:3000")
+		req.Header.Set("Access-Control-Request-Method", "GET")
 
 		router.ServeHTTP(w, req)
 
@@ -110,6 +274,182 @@ func TestCORSMiddleware(t *testing.T) {
 	})
 }
 
+func TestCORSMiddlewareWithConfig(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	newRouter := func(middleware MiddlewareFunc) *gin.Engine {
+		router := gin.New()
+		router.Use(middleware)
+		router.GET("/test", func(c *gin.Context) {
+			c.JSON(200, gin.H{"message": "ok"})
+		})
+		router.GET("/public/test", func(c *gin.Context) {
+			c.JSON(200, gin.H{"message": "ok"})
+		})
+		return router
+	}
+	preflight := func(router *gin.Engine, path, origin, method, headers string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("OPTIONS", path, nil)
+		req.Header.Set("Origin", origin)
+		req.Header.Set("Access-Control-Request-Method", method)
+		if headers != "" {
+			req.Header.Set("Access-Control-Request-Headers", headers)
+		}
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	config := &CORSConfig{
+		AllowOrigins:     []string{"https://*.example.com", "http://localhost:3000"},
+		AllowMethods:     []string{"GET", "POST"},
+		AllowHeaders:     []string{"Content-Type", "Authorization"},
+		AllowCredentials: true,
+		MaxAge:           600,
+	}
+
+	t.Run("Max-Age為十進制數字", func(t *testing.T) {
+		w := preflight(newRouter(CORSMiddlewareWithConfig(config)), "/test", "http://localhost:3000", "POST", "")
+
+		assert.Equal(t, http.StatusNoContent, w.Code)
+		assert.Equal(t, "600", w.Header().Get("Access-Control-Max-Age"))
+	})
+
+	t.Run("攜帶憑證時回顯來源並添加Vary", func(t *testing.T) {
+		router := newRouter(CORSMiddlewareWithConfig(config))
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/test", nil)
+		req.Header.Set("Origin", "https://app.example.com")
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, "https://app.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+		assert.Equal(t, "true", w.Header().Get("Access-Control-Allow-Credentials"))
+		assert.Contains(t, w.Header().Values("Vary"), "Origin")
+	})
+
+	t.Run("星號匹配的來源不攜帶憑證", func(t *testing.T) {
+		router := newRouter(CORSMiddlewareWithConfig(&CORSConfig{
+			AllowOrigins:     []string{"*", "https://app.example.com"},
+			AllowMethods:     []string{"GET"},
+			AllowCredentials: true,
+		}))
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/test", nil)
+		req.Header.Set("Origin", "https://evil.com")
+		router.ServeHTTP(w, req)
+		assert.Equal(t, "*", w.Header().Get("Access-Control-Allow-Origin"))
+		assert.Empty(t, w.Header().Get("Access-Control-Allow-Credentials"))
+
+		w = preflight(router, "/test", "https://evil.com", "GET", "")
+		assert.Equal(t, http.StatusNoContent, w.Code)
+		assert.Equal(t, "*", w.Header().Get("Access-Control-Allow-Origin"))
+		assert.Empty(t, w.Header().Get("Access-Control-Allow-Credentials"))
+
+		// 顯式配置的來源仍然攜帶憑證
+		w = preflight(router, "/test", "https://app.example.com", "GET", "")
+		assert.Equal(t, "https://app.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+		assert.Equal(t, "true", w.Header().Get("Access-Control-Allow-Credentials"))
+	})
+
+	t.Run("通配子域名匹配", func(t *testing.T) {
+		router := newRouter(CORSMiddlewareWithConfig(config))
+
+		assert.Equal(t, http.StatusNoContent, preflight(router, "/test", "https://a.b.example.com", "GET", "").Code)
+		assert.Equal(t, http.StatusForbidden, preflight(router, "/test", "https://example.com", "GET", "").Code)
+		assert.Equal(t, http.StatusForbidden, preflight(router, "/test", "http://app.example.com", "GET", "").Code)
+		assert.Equal(t, http.StatusForbidden, preflight(router, "/test", "https://evil.com/.example.com", "GET", "").Code)
+	})
+
+	t.Run("不允許的來源不返回CORS頭", func(t *testing.T) {
+		router := newRouter(CORSMiddlewareWithConfig(config))
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/test", nil)
+		req.Header.Set("Origin", "https://evil.com")
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+	})
+
+	t.Run("預檢校驗請求方法與請求頭", func(t *testing.T) {
+		router := newRouter(CORSMiddlewareWithConfig(config))
+
+		assert.Equal(t, http.StatusForbidden, preflight(router, "/test", "http://localhost:3000", "DELETE", "").Code)
+		assert.Equal(t, http.StatusForbidden, preflight(router, "/test", "http://localhost:3000", "POST", "X-Custom").Code)
+		assert.Equal(t, http.StatusNoContent, preflight(router, "/test", "http://localhost:3000", "POST", "content-type, authorization").Code)
+	})
+
+	t.Run("動態來源校驗", func(t *testing.T) {
+		router := newRouter(CORSMiddlewareWithConfig(&CORSConfig{
+			AllowOriginFunc: func(origin string) bool { return origin == "https://dynamic.dev" },
+			AllowMethods:    []string{"GET"},
+		}))
+
+		assert.Equal(t, http.StatusNoContent, preflight(router, "/test", "https://dynamic.dev", "GET", "").Code)
+		assert.Equal(t, http.StatusForbidden, preflight(router, "/test", "https://other.dev", "GET", "").Code)
+	})
+
+	t.Run("私有網絡訪問", func(t *testing.T) {
+		router := newRouter(CORSMiddlewareWithConfig(&CORSConfig{
+			AllowOrigins:        []string{"https://app.example.com"},
+			AllowMethods:        []string{"GET"},
+			AllowPrivateNetwork: true,
+		}))
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("OPTIONS", "/test", nil)
+		req.Header.Set("Origin", "https://app.example.com")
+		req.Header.Set("Access-Control-Request-Method", "GET")
+		req.Header.Set("Access-Control-Request-Private-Network", "true")
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, "true", w.Header().Get("Access-Control-Allow-Private-Network"))
+	})
+
+	t.Run("按路由組應用策略", func(t *testing.T) {
+		router := newRouter(CORSMiddlewareWithPolicies(config, CORSPolicy{
+			PathPrefix: "/public",
+			Config:     DefaultCORSConfig(),
+		}))
+
+		w := preflight(router, "/public/test", "https://anyone.dev", "GET", "")
+		assert.Equal(t, http.StatusNoContent, w.Code)
+		assert.Equal(t, "*", w.Header().Get("Access-Control-Allow-Origin"))
+
+		assert.Equal(t, http.StatusForbidden, preflight(router, "/test", "https://anyone.dev", "GET", "").Code)
+	})
+
+	t.Run("沒有Origin的OPTIONS請求不做處理", func(t *testing.T) {
+		router := newRouter(CORSMiddleware())
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("OPTIONS", "/test", nil)
+		router.ServeHTTP(w, req)
+
+		assert.NotEqual(t, http.StatusNoContent, w.Code)
+	})
+
+	t.Run("沒有Access-Control-Request-Method的OPTIONS交給路由處理", func(t *testing.T) {
+		router := newRouter(CORSMiddlewareWithConfig(config))
+		router.OPTIONS("/test", func(c *gin.Context) {
+			c.String(http.StatusOK, "options")
+		})
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("OPTIONS", "/test", nil)
+		req.Header.Set("Origin", "http://localhost:3000")
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "options", w.Body.String())
+		assert.Equal(t, "http://localhost:3000", w.Header().Get("Access-Control-Allow-Origin"))
+		assert.Empty(t, w.Header().Get("Access-Control-Allow-Methods"))
+	})
+}
+
 func TestRecoveryMiddleware(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 
@@ -268,6 +608,160 @@ func TestTimeoutMiddleware(t *testing.T) {
 
 		assert.Equal(t, http.StatusOK, w.Code)
 	})
+
+	t.Run("路由級超時覆蓋全局超時", func(t *testing.T) {
+		router := gin.New()
+		config := DefaultTimeoutConfig()
+		config.Timeout = 50 * time.Millisecond
+		config.Routes = map[string]time.Duration{
+			"GET /report/:id": 300 * time.Millisecond,
+		}
+		router.Use(TimeoutMiddlewareWithConfig(config))
+
+		handler := func(c *gin.Context) {
+			time.Sleep(100 * time.Millisecond)
+			c.JSON(200, gin.H{"message": "ok"})
+		}
+		router.GET("/report/:id", handler)
+		router.GET("/other", handler)
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/report/1", nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		w = httptest.NewRecorder()
+		req, _ = http.NewRequest("GET", "/other", nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusRequestTimeout, w.Code)
+	})
+
+	t.Run("超時後處理器寫入的響應頭被丟棄", func(t *testing.T) {
+		router := gin.New()
+		router.Use(TimeoutMiddleware(50 * time.Millisecond))
+
+		router.GET("/slow", func(c *gin.Context) {
+			<-c.Request.Context().Done()
+			c.Header("X-Late", "1")
+			c.JSON(200, gin.H{"message": "late"})
+		})
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/slow", nil)
+
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusRequestTimeout, w.Code)
+		assert.Empty(t, w.Header().Get("X-Late"))
+		assert.NotContains(t, w.Body.String(), "late")
+	})
+
+	t.Run("處理器不理會ctx時客戶端仍在超時後收到響應", func(t *testing.T) {
+		router := gin.New()
+		router.Use(TimeoutMiddleware(50 * time.Millisecond))
+
+		release := make(chan struct{})
+		router.GET("/stuck", func(c *gin.Context) {
+			<-release
+		})
+		server := httptest.NewServer(router)
+		defer server.Close()
+		defer close(release)
+
+		start := time.Now()
+		resp, err := http.Get(server.URL + "/stuck")
+		if !assert.NoError(t, err) {
+			return
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		assert.NoError(t, err)
+		assert.Less(t, time.Since(start), time.Second)
+		assert.Equal(t, http.StatusRequestTimeout, resp.StatusCode)
+		assert.Contains(t, string(body), "请求超时")
+	})
+
+	t.Run("超時為0的流式路由不緩沖", func(t *testing.T) {
+		router := gin.New()
+		config := DefaultTimeoutConfig()
+		config.Timeout = 50 * time.Millisecond
+		config.Routes = map[string]time.Duration{"GET /events": 0}
+		router.Use(TimeoutMiddlewareWithConfig(config))
+
+		router.GET("/events", func(c *gin.Context) {
+			_, hasDeadline := c.Request.Context().Deadline()
+			assert.False(t, hasDeadline)
+			for i := 0; i < 3; i++ {
+				c.SSEvent("message", i)
+				c.Writer.Flush()
+				time.Sleep(30 * time.Millisecond)
+			}
+		})
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/events", nil)
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.True(t, w.Flushed)
+		assert.Equal(t, 3, strings.Count(w.Body.String(), "event:message"))
+	})
+
+	t.Run("處理器panic交給Recovery處理", func(t *testing.T) {
+		router := gin.New()
+		router.Use(RecoveryMiddleware())
+		router.Use(TimeoutMiddleware(time.Second))
+
+		router.GET("/panic", func(c *gin.Context) {
+			panic("timeout panic")
+		})
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/panic", nil)
+
+		assert.NotPanics(t, func() { router.ServeHTTP(w, req) })
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+	})
+
+	t.Run("並發請求無數據競爭", func(t *testing.T) {
+		router := gin.New()
+		router.Use(RecoveryMiddleware())
+		router.Use(TimeoutMiddleware(20 * time.Millisecond))
+
+		router.GET("/mixed/:delay", func(c *gin.Context) {
+			delay, _ := time.ParseDuration(c.Param("delay"))
+			c.Set("delay", delay)
+			select {
+			case <-time.After(delay):
+			case <-c.Request.Context().Done():
+			}
+			c.Header("X-Delay", delay.String())
+			c.JSON(200, gin.H{"message": "ok"})
+		})
+
+		var wg sync.WaitGroup
+		for i := 0; i < 50; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				delay := "1ms"
+				if i%2 == 0 {
+					delay = "40ms"
+				}
+				w := httptest.NewRecorder()
+				req, _ := http.NewRequest("GET", "/mixed/"+delay, nil)
+				router.ServeHTTP(w, req)
+				if delay == "1ms" {
+					assert.Equal(t, http.StatusOK, w.Code)
+					assert.Equal(t, delay, w.Header().Get("X-Delay"))
+				} else {
+					assert.Equal(t, http.StatusRequestTimeout, w.Code)
+					assert.Empty(t, w.Header().Get("X-Delay"))
+				}
+			}(i)
+		}
+		wg.Wait()
+	})
 }
 
 func TestOptionalAuthMiddleware(t *testing.T) {
@@ -316,3 +810,58 @@ func TestOptionalAuthMiddleware(t *testing.T) {
 		assert.Equal(t, http.StatusOK, w.Code)
 	})
 }
+
+func TestBudgetContext(t *testing.T) {
+	t.Run("從剩餘預算中扣除預留時間", func(t *testing.T) {
+		parent, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		ctx, cancelBudget := BudgetContext(parent, 200*time.Millisecond, 0)
+		defer cancelBudget()
+
+		remaining, ok := RequestBudget(ctx)
+		assert.True(t, ok)
+		assert.LessOrEqual(t, remaining, 800*time.Millisecond)
+		assert.Greater(t, remaining, 500*time.Millisecond)
+	})
+
+	t.Run("上限限制子上下文超時", func(t *testing.T) {
+		parent, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		ctx, cancelBudget := BudgetContext(parent, 0, 100*time.Millisecond)
+		defer cancelBudget()
+
+		remaining, _ := RequestBudget(ctx)
+		assert.LessOrEqual(t, remaining, 100*time.Millisecond)
+	})
+
+	t.Run("預算不足時立即過期", func(t *testing.T) {
+		parent, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		ctx, cancelBudget := BudgetContext(parent, 100*time.Millisecond, 0)
+		defer cancelBudget()
+
+		<-ctx.Done()
+		assert.ErrorIs(t, ctx.Err(), context.DeadlineExceeded)
+	})
+
+	t.Run("沒有截止時間且沒有上限時不設置截止時間", func(t *testing.T) {
+		ctx, cancelBudget := BudgetContext(context.Background(), 0, 0)
+		defer cancelBudget()
+
+		_, ok := RequestBudget(ctx)
+		assert.False(t, ok)
+	})
+
+	t.Run("沒有截止時間時使用上限", func(t *testing.T) {
+		ctx, cancelBudget := BudgetContext(context.Background(), time.Second, 200*time.Millisecond)
+		defer cancelBudget()
+
+		budget, ok := RequestBudget(ctx)
+		assert.True(t, ok)
+		assert.LessOrEqual(t, budget, 200*time.Millisecond)
+		assert.Greater(t, budget, 100*time.Millisecond)
+	})
+}
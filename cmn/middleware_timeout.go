@@ -1,18 +1,47 @@
 package cmn
 
 import (
+	"bufio"
+	"bytes"
 	"context"
 	"errors"
+	"fmt"
+	"net"
 	"net/http"
+	"runtime/debug"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
 // TimeoutConfig 超时配置
+//
+// 处理器的响应先写入缓冲区，完成后才提交，因此 SSE、流式下载等需要 Flush 的路由必须排除：
+// 在 Routes 中把这些路由的超时设置为 0（不缓冲、不设置超时，由处理器自行控制 ctx）
 type TimeoutConfig struct {
-	Timeout      time.Duration      // 超时时间
-	ErrorHandler func(*gin.Context) // 超时时的错误处理
+	Timeout      time.Duration            // 超时时间
+	Routes       map[string]time.Duration // 路由级超时，键为 "GET /api/v1/report" 或 "/api/v1/report"（使用路由模板路径），0 表示排除该路由
+	ErrorHandler func(*gin.Context)       // 超时时的错误处理
+}
+
+// timeoutFor 返回当前路由的超时时间
+func (config *TimeoutConfig) timeoutFor(c *gin.Context) time.Duration {
+	return config.routeTimeout(c.Request.Method, c.FullPath())
+}
+
+// routeTimeout 返回路由的超时时间，优先匹配 "方法 路径"，其次匹配路径
+func (config *TimeoutConfig) routeTimeout(method, path string) time.Duration {
+	if len(config.Routes) > 0 {
+		if d, ok := config.Routes[method+" "+path]; ok {
+			return d
+		}
+		if d, ok := config.Routes[path]; ok {
+			return d
+		}
+	}
+	return config.Timeout
 }
 
 // DefaultTimeoutConfig 默认超时配置
@@ -20,10 +49,7 @@ func DefaultTimeoutConfig() *TimeoutConfig {
 	return &TimeoutConfig{
 		Timeout: 30 * time.Second,
 		ErrorHandler: func(c *gin.Context) {
-			c.JSON(http.StatusRequestTimeout, gin.H{
-				"code":    http.StatusRequestTimeout,
-				"message": "请求超时",
-			})
+			abortWithCode(c, CodeRequestTimeout, "请求超时")
 		},
 	}
 }
@@ -33,41 +59,253 @@ func TimeoutMiddleware(timeout time.Duration) MiddlewareFunc {
 	return TimeoutMiddlewareWithConfig(&TimeoutConfig{
 		Timeout: timeout,
 		ErrorHandler: func(c *gin.Context) {
-			c.JSON(http.StatusRequestTimeout, gin.H{
-				"code":    http.StatusRequestTimeout,
-				"message": "请求超时",
-			})
+			abortWithCode(c, CodeRequestTimeout, "请求超时")
 		},
 	})
 }
 
+// handlerPanic 处理器 goroutine 中捕获的 panic
+type handlerPanic struct {
+	value any
+	stack []byte
+}
+
+func (p *handlerPanic) String() string {
+	return fmt.Sprintf("%v\n\n%s", p.value, p.stack)
+}
+
 // TimeoutMiddlewareWithConfig 带配置的超时中间件
+//
+// 后续处理器在独立 goroutine 中执行，并写入缓冲的 timeoutWriter：
+//   - 正常完成时由中间件把缓冲的响应头与响应体一次性提交到真实连接
+//   - 超时时中间件提交超时响应，处理器之后的写入（包括响应头）全部丢弃
+//   - 处理器通过 c.Request.Context() 得知超时，中间件会等待其退出后再返回，
+//     避免 gin 在处理器仍在运行时回收并复用 gin.Context
+//   - 超时响应带 Content-Length 并立即刷新，不理会 ctx 的处理器不会让客户端一直等待
+//   - 处理器中的 panic 会在中间件所在 goroutine 中重新抛出，交给外层 RecoveryMiddleware 处理
+//   - 超时为 0 的路由直接执行，不缓冲响应（用于 SSE 等流式路由）
 func TimeoutMiddlewareWithConfig(config *TimeoutConfig) MiddlewareFunc {
 	return func(c *gin.Context) {
-		// 创建带超时的上下文
-		ctx, cancel := context.WithTimeout(c.Request.Context(), config.Timeout)
+		timeout := config.timeoutFor(c)
+		if timeout <= 0 {
+			c.Next()
+			return
+		}
+
+		// 创建带超时的上下文（路由级超时优先）
+		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
 		defer cancel()
 
 		// 替换请求的上下文
 		c.Request = c.Request.WithContext(ctx)
 
-		// 使用通道来等待请求完成或超时
+		// 超时响应使用独立的上下文副本写入，不与处理器共享 gin.Context
+		original := c.Writer
+		tc := c.Copy()
+
+		tw := newTimeoutWriter(original)
+		c.Writer = tw
+
 		finished := make(chan struct{})
+		var recovered *handlerPanic
 
 		go func() {
+			defer close(finished)
+			defer func() {
+				if p := recover(); p != nil {
+					recovered = &handlerPanic{value: p, stack: debug.Stack()}
+				}
+			}()
 			c.Next()
-			close(finished)
 		}()
 
 		select {
+		case <-finished:
+			// 请求正常完成（或发生 panic），提交缓冲的响应
+			c.Writer = original
+			if recovered == nil {
+				tw.commit()
+			}
 		case <-ctx.Done():
-			// 请求超时
+			// 请求超时或客户端断开：先锁定写入器，再由中间件独占地写出超时响应
+			tw.timeout()
 			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
-				config.ErrorHandler(c)
-				c.Abort()
+				// 超时响应同样先缓冲，带上 Content-Length 后提交并刷新，客户端无需等待处理器退出
+				ew := newTimeoutWriter(original)
+				tc.Writer = ew
+				config.ErrorHandler(tc)
+				ew.header.Set("Content-Length", strconv.Itoa(ew.body.Len()))
+				ew.commit()
+				original.Flush()
 			}
-		case <-finished:
-			// 请求正常完成
+			// 等待处理器退出后再归还上下文
+			<-finished
+			c.Writer = original
+			c.Abort()
+		}
+
+		if recovered != nil {
+			panic(recovered)
+		}
+	}
+}
+
+// timeoutWriter 缓冲处理器写入的响应，由中间件决定是否提交
+type timeoutWriter struct {
+	gin.ResponseWriter
+
+	mu       sync.Mutex
+	header   http.Header
+	body     bytes.Buffer
+	status   int
+	wrote    bool
+	timedOut bool
+}
+
+var _ gin.ResponseWriter = (*timeoutWriter)(nil)
+
+func newTimeoutWriter(w gin.ResponseWriter) *timeoutWriter {
+	return &timeoutWriter{
+		ResponseWriter: w,
+		header:         make(http.Header),
+		status:         http.StatusOK,
+	}
+}
+
+// Header 返回缓冲的响应头，仅由处理器 goroutine 访问
+func (w *timeoutWriter) Header() http.Header {
+	return w.header
+}
+
+// WriteHeader 记录状态码
+func (w *timeoutWriter) WriteHeader(code int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.timedOut || w.wrote {
+		return
+	}
+	w.status = code
+}
+
+// WriteHeaderNow 标记响应头已写出
+func (w *timeoutWriter) WriteHeaderNow() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.timedOut {
+		return
+	}
+	w.wrote = true
+}
+
+// Write 写入缓冲区，超时后返回 http.ErrHandlerTimeout
+func (w *timeoutWriter) Write(data []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	w.wrote = true
+	return w.body.Write(data)
+}
+
+// WriteString 写入字符串
+func (w *timeoutWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Status 返回处理器设置的状态码
+func (w *timeoutWriter) Status() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.status
+}
+
+// Size 返回已缓冲的响应体大小
+func (w *timeoutWriter) Size() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if !w.wrote {
+		return -1
+	}
+	return w.body.Len()
+}
+
+// Written 返回处理器是否已写入响应
+func (w *timeoutWriter) Written() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.wrote
+}
+
+// Flush 缓冲模式下不支持提前刷新，忽略；流式路由需要把超时设置为 0 以排除（见 TimeoutConfig）
+func (w *timeoutWriter) Flush() {}
+
+// Hijack 缓冲模式下不支持劫持连接
+func (w *timeoutWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return nil, nil, errors.New("timeout middleware does not support hijacking")
+}
+
+// Pusher 缓冲模式下不支持 HTTP/2 推送
+func (w *timeoutWriter) Pusher() http.Pusher {
+	return nil
+}
+
+// timeout 标记超时，此后处理器的写入全部丢弃
+func (w *timeoutWriter) timeout() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.timedOut = true
+}
+
+// commit 把缓冲的响应提交到真实连接，只在处理器退出后调用
+func (w *timeoutWriter) commit() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	dst := w.ResponseWriter.Header()
+	for k, vv := range w.header {
+		dst[k] = vv
+	}
+	if !w.wrote {
+		// 处理器没有写入任何内容时保持 gin 的默认行为，由 gin 在请求结束时写出状态码
+		w.ResponseWriter.WriteHeader(w.status)
+		return
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+	_, _ = w.ResponseWriter.Write(w.body.Bytes())
+}
+
+// RequestBudget 返回上下文剩余的时间预算，上下文没有截止时间时第二个返回值为 false
+func RequestBudget(ctx context.Context) (time.Duration, bool) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return 0, false
+	}
+	return time.Until(deadline), true
+}
+
+// BudgetContext 从请求剩余的时间预算派生子上下文，用于数据库、Redis 和 HTTP 调用
+// reserve 为预留给后续处理（如组装与写出响应）的时间；limit > 0 时子上下文的超时不超过 limit
+// 剩余预算不足 reserve 时返回已过期的上下文，调用方会立即得到 context.DeadlineExceeded
+func BudgetContext(ctx context.Context, reserve, limit time.Duration) (context.Context, context.CancelFunc) {
+	remaining, ok := RequestBudget(ctx)
+	if !ok {
+		if limit > 0 {
+			return context.WithTimeout(ctx, limit)
 		}
+		return context.WithCancel(ctx)
+	}
+
+	budget := remaining - reserve
+	if limit > 0 && budget > limit {
+		budget = limit
 	}
+	return context.WithTimeout(ctx, max(budget, 0))
 }
@@ -0,0 +1,258 @@
+package cmn
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const (
+	PanicSourceHTTP = "http"           // 请求处理器中的 panic
+	PanicSourcePool = "goroutine_pool" // ants 协程池任务中的 panic
+)
+
+// SensitiveHeaders 上报 panic 时需要脱敏的请求头
+var SensitiveHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "X-Api-Key", "X-Auth-Token"}
+
+const redactedValue = "[REDACTED]"
+
+// unmatchedRoute 未匹配到路由模板时的计数键，避免按原始 URI 计数导致键无限增长
+const unmatchedRoute = "<unmatched>"
+
+// PanicReport 一次 panic 的上报内容
+type PanicReport struct {
+	Time      time.Time         `json:"time"`
+	Source    string            `json:"source"`
+	Value     string            `json:"value"`
+	Stack     string            `json:"stack"`
+	Method    string            `json:"method,omitempty"`
+	URI       string            `json:"uri,omitempty"`   // 查询参数已脱敏
+	Route     string            `json:"route,omitempty"` // 路由模板，如 /api/v1/posts/:id
+	ClientIP  string            `json:"clientIp,omitempty"`
+	RequestID string            `json:"requestId,omitempty"`
+	UserID    string            `json:"userId,omitempty"`
+	Headers   map[string]string `json:"headers,omitempty"` // 敏感请求头已脱敏
+}
+
+// PanicReporter panic 上报接口，RecoveryMiddleware 与协程池捕获到 panic 时调用
+type PanicReporter interface {
+	Report(report *PanicReport) error
+}
+
+var (
+	panicReportersMu sync.RWMutex
+	panicReporters   []PanicReporter
+
+	panicCountsMu sync.Mutex
+	panicCounts   = make(map[string]int64)
+)
+
+// RegisterPanicReporter 注册全局 panic 上报器
+func RegisterPanicReporter(reporters ...PanicReporter) {
+	panicReportersMu.Lock()
+	defer panicReportersMu.Unlock()
+
+	panicReporters = append(panicReporters, reporters...)
+}
+
+// ClearPanicReporters 清空所有已注册的上报器
+func ClearPanicReporters() {
+	panicReportersMu.Lock()
+	defer panicReportersMu.Unlock()
+
+	panicReporters = nil
+}
+
+// PanicCounts 返回每个路由（"方法 路由模板"）累计的 panic 次数，未匹配路由的计入 "方法 <unmatched>"，
+// 协程池中的 panic 计入 goroutine_pool
+func PanicCounts() map[string]int64 {
+	panicCountsMu.Lock()
+	defer panicCountsMu.Unlock()
+
+	counts := make(map[string]int64, len(panicCounts))
+	for k, v := range panicCounts {
+		counts[k] = v
+	}
+	return counts
+}
+
+// ReportPanic 计数并把 panic 分发给所有上报器，单个上报器出错只记录日志
+func ReportPanic(report *PanicReport) {
+	key := report.Source
+	if report.Source == PanicSourceHTTP {
+		route := report.Route
+		if route == "" {
+			route = unmatchedRoute
+		}
+		key = report.Method + " " + route
+	}
+	panicCountsMu.Lock()
+	panicCounts[key]++
+	panicCountsMu.Unlock()
+
+	panicReportersMu.RLock()
+	reporters := append([]PanicReporter(nil), panicReporters...)
+	panicReportersMu.RUnlock()
+
+	for _, r := range reporters {
+		if err := r.Report(report); err != nil {
+			Logger().Error("panic 上报失败", zap.Error(err), zap.String("reporter", fmt.Sprintf("%T", r)))
+		}
+	}
+}
+
+// NewHTTPPanicReport 根据请求上下文构建 panic 报告
+func NewHTTPPanicReport(c *gin.Context, value any, stack string) *PanicReport {
+	userId, _ := GetUserId(c)
+	requestID, ok := GetRequestId(c)
+	if !ok {
+		requestID = c.GetHeader(RequestIDHeader)
+	}
+	return &PanicReport{
+		Time:      time.Now(),
+		Source:    PanicSourceHTTP,
+		Value:     fmt.Sprintf("%v", value),
+		Stack:     stack,
+		Method:    c.Request.Method,
+		URI:       defaultHttpLogConfig.RedactURL(c.Request.URL.RequestURI()),
+		Route:     c.FullPath(),
+		ClientIP:  c.ClientIP(),
+		RequestID: requestID,
+		UserID:    userId,
+		Headers:   redactHeaders(c.Request.Header),
+	}
+}
+
+// redactHeaders 复制请求头并脱敏敏感字段
+func redactHeaders(header http.Header) map[string]string {
+	result := make(map[string]string, len(header))
+	for k, v := range header {
+		result[k] = strings.Join(v, ", ")
+	}
+	for _, name := range SensitiveHeaders {
+		key := http.CanonicalHeaderKey(name)
+		if _, ok := result[key]; ok {
+			result[key] = redactedValue
+		}
+	}
+	return result
+}
+
+// FilePanicReporter 把每次 panic 写成一个 JSON 文件
+type FilePanicReporter struct {
+	Dir string
+}
+
+// NewFilePanicReporter 创建文件上报器，目录不存在时自动创建
+func NewFilePanicReporter(dir string) (*FilePanicReporter, error) {
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, fmt.Errorf("无法创建 panic 目录 %s: %w", dir, err)
+	}
+	return &FilePanicReporter{Dir: dir}, nil
+}
+
+// Report 写入 panic-<时间>.json
+func (r *FilePanicReporter) Report(report *PanicReport) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	name := fmt.Sprintf("panic-%s.json", report.Time.Format("20060102-150405.000000000"))
+	return os.WriteFile(filepath.Join(r.Dir, name), data, 0o644)
+}
+
+// WebhookPanicReporter 把 panic 以 JSON POST 到 webhook 地址（异步发送，不阻塞请求）
+type WebhookPanicReporter struct {
+	URL     string
+	Headers map[string]string
+	Timeout time.Duration
+}
+
+// NewWebhookPanicReporter 创建 webhook 上报器
+func NewWebhookPanicReporter(url string, headers map[string]string) *WebhookPanicReporter {
+	return &WebhookPanicReporter{
+		URL:     url,
+		Headers: headers,
+		Timeout: 5 * time.Second,
+	}
+}
+
+// Report 异步发送报告
+func (r *WebhookPanicReporter) Report(report *PanicReport) error {
+	body, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	go func() {
+		if _, err := SendHttpRequest(http.MethodPost, r.URL, body, r.Headers, r.Timeout); err != nil {
+			Logger().Error("panic webhook 发送失败", zap.Error(err), zap.String("url", r.URL))
+		}
+	}()
+	return nil
+}
+
+// RingBufferPanicReporter 在内存中保留最近的 panic，供管理接口查看
+type RingBufferPanicReporter struct {
+	mu      sync.Mutex
+	entries []*PanicReport
+	next    int
+	full    bool
+}
+
+// NewRingBufferPanicReporter 创建容量为 size 的环形缓冲上报器
+func NewRingBufferPanicReporter(size int) *RingBufferPanicReporter {
+	if size <= 0 {
+		size = 100
+	}
+	return &RingBufferPanicReporter{
+		entries: make([]*PanicReport, size),
+	}
+}
+
+// Report 写入环形缓冲，满时覆盖最旧的记录
+func (r *RingBufferPanicReporter) Report(report *PanicReport) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.entries[r.next] = report
+	r.next = (r.next + 1) % len(r.entries)
+	if r.next == 0 {
+		r.full = true
+	}
+	return nil
+}
+
+// Entries 返回缓冲中的记录，最新的在前
+func (r *RingBufferPanicReporter) Entries() []*PanicReport {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	n := r.next
+	if r.full {
+		n = len(r.entries)
+	}
+	result := make([]*PanicReport, 0, n)
+	for i := 1; i <= n; i++ {
+		idx := (r.next - i + len(r.entries)) % len(r.entries)
+		result = append(result, r.entries[idx])
+	}
+	return result
+}
+
+// Handler 管理接口：返回最近的 panic 记录与按路由统计的次数，调用方需自行添加认证
+func (r *RingBufferPanicReporter) Handler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		OK(c, gin.H{
+			"reports": r.Entries(),
+			"counts":  PanicCounts(),
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package cmn
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPanicReporter(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	t.Run("Recovery上報panic並脫敏請求頭", func(t *testing.T) {
+		defer ClearPanicReporters()
+		ring := NewRingBufferPanicReporter(10)
+		RegisterPanicReporter(ring)
+
+		router := gin.New()
+		router.Use(RecoveryMiddleware())
+		router.GET("/boom/:id", func(c *gin.Context) {
+			panic("secret detail")
+		})
+		router.GET("/admin/panics", ring.Handler())
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/boom/1?page=2&access_token=tok123", nil)
+		req.Header.Set("Authorization", "Bearer abc")
+		req.Header.Set("X-Request-ID", "req-1")
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+		assert.NotContains(t, w.Body.String(), "secret detail")
+
+		entries := ring.Entries()
+		if assert.Len(t, entries, 1) {
+			report := entries[0]
+			assert.Equal(t, PanicSourceHTTP, report.Source)
+			assert.Equal(t, "secret detail", report.Value)
+			assert.Equal(t, "/boom/:id", report.Route)
+			assert.Equal(t, "/boom/1?page=2&access_token=[REDACTED]", report.URI)
+			assert.Equal(t, "req-1", report.RequestID)
+			assert.Equal(t, "[REDACTED]", report.Headers["Authorization"])
+			assert.NotEmpty(t, report.Stack)
+		}
+		assert.GreaterOrEqual(t, PanicCounts()["GET /boom/:id"], int64(1))
+
+		w = httptest.NewRecorder()
+		req, _ = http.NewRequest("GET", "/admin/panics", nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"GET /boom/:id"`)
+	})
+
+	t.Run("未匹配路由按固定鍵計數", func(t *testing.T) {
+		before := PanicCounts()["GET <unmatched>"]
+		ReportPanic(&PanicReport{Source: PanicSourceHTTP, Method: "GET", URI: "/missing/1?token=abc"})
+		ReportPanic(&PanicReport{Source: PanicSourceHTTP, Method: "GET", URI: "/missing/2"})
+
+		counts := PanicCounts()
+		assert.Equal(t, before+2, counts["GET <unmatched>"])
+		assert.NotContains(t, counts, "GET /missing/1?token=abc")
+	})
+
+	t.Run("環形緩衝覆蓋最舊記錄", func(t *testing.T) {
+		ring := NewRingBufferPanicReporter(2)
+		for _, v := range []string{"a", "b", "c"} {
+			_ = ring.Report(&PanicReport{Value: v})
+		}
+
+		entries := ring.Entries()
+		if assert.Len(t, entries, 2) {
+			assert.Equal(t, "c", entries[0].Value)
+			assert.Equal(t, "b", entries[1].Value)
+		}
+	})
+
+	t.Run("文件上報器寫入JSON", func(t *testing.T) {
+		dir := t.TempDir()
+		reporter, err := NewFilePanicReporter(dir)
+		assert.NoError(t, err)
+
+		assert.NoError(t, reporter.Report(&PanicReport{Time: time.Now(), Value: "file"}))
+
+		files, _ := os.ReadDir(dir)
+		if assert.Len(t, files, 1) {
+			data, _ := os.ReadFile(dir + "/" + files[0].Name())
+			var report PanicReport
+			assert.NoError(t, json.Unmarshal(data, &report))
+			assert.Equal(t, "file", report.Value)
+		}
+	})
+
+	t.Run("Webhook上報器發送JSON", func(t *testing.T) {
+		received := make(chan PanicReport, 1)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			var report PanicReport
+			_ = json.Unmarshal(body, &report)
+			received <- report
+		}))
+		defer server.Close()
+
+		reporter := NewWebhookPanicReporter(server.URL, nil)
+		assert.NoError(t, reporter.Report(&PanicReport{Value: "webhook"}))
+
+		select {
+		case report := <-received:
+			assert.Equal(t, "webhook", report.Value)
+		case <-time.After(2 * time.Second):
+			t.Fatal("webhook 未收到 panic 報告")
+		}
+	})
+
+	t.Run("協程池panic上報", func(t *testing.T) {
+		defer ClearPanicReporters()
+		ring := NewRingBufferPanicReporter(10)
+		RegisterPanicReporter(ring)
+
+		assert.NoError(t, InitGoroutinePool(false))
+		assert.NoError(t, GetGoroutinePool().Submit(func() {
+			panic("pool panic")
+		}))
+
+		assert.Eventually(t, func() bool {
+			return len(ring.Entries()) == 1
+		}, 2*time.Second, 10*time.Millisecond)
+		assert.Equal(t, PanicSourcePool, ring.Entries()[0].Source)
+	})
+}
@@ -28,7 +28,13 @@ type ReplyProto struct {
 	SN int `json:"SN,omitempty"`
 }
 
+// NewErrorReply 使用默认语言的消息构造错误响应
 func NewErrorReply(err error, API, Method string) ReplyProto {
+	return NewErrorReplyLang(err, API, Method, "")
+}
+
+// NewErrorReplyLang 按 Accept-Language 选择消息构造错误响应，AppError 的 Details 作为 data 返回
+func NewErrorReplyLang(err error, API, Method, acceptLanguage string) ReplyProto {
 	var appErr *AppError
 	ok := errors.As(err, &appErr)
 	if !ok {
@@ -42,13 +48,18 @@ func NewErrorReply(err error, API, Method string) ReplyProto {
 			SN:       0,
 		}
 	} else {
+		lang := negotiateLanguage(acceptLanguage, errorLanguages(appErr.StatusCode))
+		var data json.RawMessage
+		if len(appErr.Details) > 0 {
+			data, _ = json.Marshal(appErr.Details)
+		}
 		return ReplyProto{
 			Status:   appErr.StatusCode,
-			Msg:      appErr.Message,
+			Msg:      appErr.Localize(lang),
 			API:      API,
 			Method:   Method,
 			RowCount: 0,
-			Data:     nil,
+			Data:     data,
 			SN:       0,
 		}
 	}
@@ -67,5 +78,6 @@ type ReqProto struct {
 	Data   json.RawMessage `json:"data,omitempty"`
 	Filter interface{}     `json:"filter,omitempty"`
 
+	// AuthFilter 服务端忽略客户端传入的值，数据权限由行级安全策略（RegisterRowPolicy）决定
 	AuthFilter interface{} `json:"authFilter,omitempty"`
 }
@@ -0,0 +1,454 @@
+package cmn
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"sync"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// 过滤条件支持的操作符
+const (
+	FilterOpEq    = "eq"    // 等于，value 为 null 时生成 IS NULL
+	FilterOpNe    = "ne"    // 不等于，value 为 null 时生成 IS NOT NULL
+	FilterOpIn    = "in"    // value 为非空数组
+	FilterOpLike  = "like"  // 包含，value 中的 % 与 _ 会被转义
+	FilterOpRange = "range" // value 为 [min, max]，任一端为 null 表示不限
+)
+
+// 过滤条件的限制，防止构造过大的查询
+const (
+	maxFilterDepth      = 5
+	maxFilterConditions = 50
+	maxFilterInValues   = 1000
+)
+
+// FilterNode ReqProto.Filter 的结构，叶子节点为单个条件，and/or 节点用于嵌套组合
+//
+//	{"and": [
+//	  {"field": "status", "op": "in", "value": [1, 2]},
+//	  {"or": [
+//	    {"field": "name", "op": "like", "value": "张"},
+//	    {"field": "age", "op": "range", "value": [18, null]}
+//	  ]}
+//	]}
+//
+// Filter 也可以直接是条件数组，等同于 and
+type FilterNode struct {
+	And   []FilterNode `json:"and,omitempty"`
+	Or    []FilterNode `json:"or,omitempty"`
+	Field string       `json:"field,omitempty"`
+	Op    string       `json:"op,omitempty"`
+	Value interface{}  `json:"value,omitempty"`
+}
+
+// QueryOptions 查询构建选项
+type QueryOptions struct {
+	DefaultPageSize int64 // 未指定 pageSize 时的每页行数
+	MaxPageSize     int64 // pageSize 的上限
+}
+
+// DefaultQueryOptions 默认查询构建选项
+func DefaultQueryOptions() *QueryOptions {
+	return &QueryOptions{
+		DefaultPageSize: 20,
+		MaxPageSize:     100,
+	}
+}
+
+// queryField 模型中可被客户端引用的字段
+type queryField struct {
+	column     string
+	filterable bool
+	sortable   bool
+}
+
+// QueryBuilder 把 ReqProto 的 Filter、OrderBy、Sets、Page、PageSize 转换为 GORM 查询
+//
+// 客户端使用字段的 json 名称引用字段，只有在 query 标签中声明的字段才能过滤或排序：
+//
+//	type User struct {
+//	    ID       int64  `json:"id" gorm:"primaryKey" query:"filter,sort"`
+//	    Name     string `json:"name" query:"filter,sort"`
+//	    Password string `json:"-"`
+//	}
+//
+// Sets 可以选择任意 json 可见的字段；ReqProto.AuthFilter 来自客户端，不会被使用
+type QueryBuilder struct {
+	schema  *schema.Schema
+	fields  map[string]*queryField
+	options *QueryOptions
+}
+
+// querySchemaCache 模型解析结果的缓存
+var querySchemaCache sync.Map
+
+// normalize 返回补全后的选项副本：未设置（<=0）的字段取默认值，DefaultPageSize 不超过 MaxPageSize
+func (o *QueryOptions) normalize() *QueryOptions {
+	defaults := DefaultQueryOptions()
+	if o == nil {
+		return defaults
+	}
+	normalized := *o
+	if normalized.MaxPageSize <= 0 {
+		normalized.MaxPageSize = defaults.MaxPageSize
+	}
+	if normalized.DefaultPageSize <= 0 {
+		normalized.DefaultPageSize = defaults.DefaultPageSize
+	}
+	normalized.DefaultPageSize = min(normalized.DefaultPageSize, normalized.MaxPageSize)
+	return &normalized
+}
+
+// NewQueryBuilder 为模型创建查询构建器，options 为 nil 时使用默认选项，未设置的字段同样取默认值
+func NewQueryBuilder(db *gorm.DB, model interface{}, options *QueryOptions) (*QueryBuilder, error) {
+	s, err := schema.Parse(model, &querySchemaCache, db.NamingStrategy)
+	if err != nil {
+		return nil, fmt.Errorf("解析模型失败: %w", err)
+	}
+	options = options.normalize()
+
+	fields := make(map[string]*queryField)
+	for _, f := range s.Fields {
+		if f.DBName == "" {
+			continue
+		}
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		qf := &queryField{column: f.DBName}
+		for _, opt := range strings.Split(f.Tag.Get("query"), ",") {
+			switch strings.TrimSpace(opt) {
+			case "filter":
+				qf.filterable = true
+			case "sort":
+				qf.sortable = true
+			}
+		}
+		fields[name] = qf
+	}
+
+	return &QueryBuilder{
+		schema:  s,
+		fields:  fields,
+		options: options,
+	}, nil
+}
+
+// badQuery 查询参数错误，Fail 会返回 400
+func badQuery(format string, args ...interface{}) error {
+	return NewAppError(CodeBadRequest, fmt.Sprintf(format, args...))
+}
+
+// Where 只应用过滤条件，用于统计总行数
+func (b *QueryBuilder) Where(db *gorm.DB, req *ReqProto) (*gorm.DB, error) {
+	db = db.Model(reflect.New(b.schema.ModelType).Interface())
+	if req == nil || req.Filter == nil {
+		return db, nil
+	}
+	node, err := decodeFilter(req.Filter)
+	if err != nil {
+		return nil, err
+	}
+	count := 0
+	expr, err := b.buildFilter(node, 0, &count)
+	if err != nil {
+		return nil, err
+	}
+	if expr == nil {
+		return db, nil
+	}
+	return db.Where(expr), nil
+}
+
+// Apply 应用过滤、排序、字段选择与分页
+func (b *QueryBuilder) Apply(db *gorm.DB, req *ReqProto) (*gorm.DB, error) {
+	if req == nil {
+		req = &ReqProto{}
+	}
+	db, err := b.Where(db, req)
+	if err != nil {
+		return nil, err
+	}
+	if db, err = b.applySets(db, req.Sets); err != nil {
+		return nil, err
+	}
+	if db, err = b.applyOrder(db, req.OrderBy); err != nil {
+		return nil, err
+	}
+	return b.applyPage(db, req.Page, req.PageSize)
+}
+
+// Count 统计满足过滤条件的总行数，结果用于 ReplyProto.RowCount
+func (b *QueryBuilder) Count(db *gorm.DB, req *ReqProto) (int64, error) {
+	db, err := b.Where(db, req)
+	if err != nil {
+		return 0, err
+	}
+	var total int64
+	if err := db.Count(&total).Error; err != nil {
+		return 0, err
+	}
+	return total, nil
+}
+
+// QueryPage 按 ReqProto 查询一页数据并统计总行数
+//
+//	users, total, err := cmn.QueryPage[User](db.GetPgWithContext(ctx), &req, nil)
+//	if err != nil {
+//	    cmn.Fail(c, err)
+//	    return
+//	}
+//	cmn.Page(c, users, total)
+func QueryPage[T any](db *gorm.DB, req *ReqProto, options *QueryOptions) ([]T, int64, error) {
+	var model T
+	builder, err := NewQueryBuilder(db, &model, options)
+	if err != nil {
+		return nil, 0, err
+	}
+	total, err := builder.Count(db, req)
+	if err != nil {
+		return nil, 0, err
+	}
+	query, err := builder.Apply(db, req)
+	if err != nil {
+		return nil, 0, err
+	}
+	var items []T
+	if err := query.Find(&items).Error; err != nil {
+		return nil, 0, err
+	}
+	return items, total, nil
+}
+
+// decodeFilter 把 ReqProto.Filter（通常是 JSON 解码得到的 map 或数组）转换为 FilterNode
+func decodeFilter(filter interface{}) (*FilterNode, error) {
+	var data []byte
+	switch v := filter.(type) {
+	case json.RawMessage:
+		data = v
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		var err error
+		if data, err = json.Marshal(v); err != nil {
+			return nil, badQuery("filter 格式错误: %v", err)
+		}
+	}
+
+	trimmed := strings.TrimSpace(string(data))
+	if trimmed == "" || trimmed == "null" {
+		return &FilterNode{}, nil
+	}
+	// 拼错的键（如 "feild"）会让条件被静默忽略，因此拒绝未知的键
+	decoder := json.NewDecoder(strings.NewReader(trimmed))
+	decoder.DisallowUnknownFields()
+	if strings.HasPrefix(trimmed, "[") {
+		var nodes []FilterNode
+		if err := decoder.Decode(&nodes); err != nil {
+			return nil, badQuery("filter 格式错误: %v", err)
+		}
+		return &FilterNode{And: nodes}, nil
+	}
+	var node FilterNode
+	if err := decoder.Decode(&node); err != nil {
+		return nil, badQuery("filter 格式错误: %v", err)
+	}
+	return &node, nil
+}
+
+// buildFilter 递归构建过滤表达式，空节点返回 nil
+func (b *QueryBuilder) buildFilter(node *FilterNode, depth int, count *int) (clause.Expression, error) {
+	if depth > maxFilterDepth {
+		return nil, badQuery("filter 嵌套层数不能超过 %d", maxFilterDepth)
+	}
+
+	isGroup := len(node.And) > 0 || len(node.Or) > 0
+	if isGroup && node.Field != "" {
+		return nil, badQuery("filter 节点不能同时包含条件与 and/or")
+	}
+	if len(node.And) > 0 && len(node.Or) > 0 {
+		return nil, badQuery("filter 节点不能同时包含 and 与 or")
+	}
+
+	if isGroup {
+		children := node.And
+		if len(node.Or) > 0 {
+			children = node.Or
+		}
+		exprs := make([]clause.Expression, 0, len(children))
+		for i := range children {
+			expr, err := b.buildFilter(&children[i], depth+1, count)
+			if err != nil {
+				return nil, err
+			}
+			if expr != nil {
+				exprs = append(exprs, expr)
+			}
+		}
+		switch len(exprs) {
+		case 0:
+			return nil, nil
+		case 1:
+			// 单个条件的 or 组在 GORM 中会以 OR 与其它条件连接，直接返回条件本身
+			return exprs[0], nil
+		}
+		if len(node.Or) > 0 {
+			return clause.Or(exprs...), nil
+		}
+		return clause.And(exprs...), nil
+	}
+
+	if node.Field == "" {
+		// 只有顶层的空节点（"filter": {}）表示不过滤，其余既不是条件也不是 and/or 的节点视为错误
+		if depth == 0 && node.Op == "" && node.Value == nil {
+			return nil, nil
+		}
+		return nil, badQuery("filter 节点必须包含 field 或 and/or")
+	}
+	*count++
+	if *count > maxFilterConditions {
+		return nil, badQuery("filter 条件数不能超过 %d", maxFilterConditions)
+	}
+	return b.buildCondition(node)
+}
+
+// buildCondition 构建单个条件
+func (b *QueryBuilder) buildCondition(node *FilterNode) (clause.Expression, error) {
+	field, ok := b.fields[node.Field]
+	if !ok || !field.filterable {
+		return nil, badQuery("字段 %s 不允许过滤", node.Field)
+	}
+	column := clause.Column{Table: clause.CurrentTable, Name: field.column}
+
+	switch node.Op {
+	case FilterOpEq, "", FilterOpNe:
+		switch node.Value.(type) {
+		case []interface{}, map[string]interface{}:
+			return nil, badQuery("字段 %s 的 %s 条件需要单个值", node.Field, node.Op)
+		}
+		if node.Op == FilterOpNe {
+			return clause.Neq{Column: column, Value: node.Value}, nil
+		}
+		return clause.Eq{Column: column, Value: node.Value}, nil
+	case FilterOpIn:
+		values, ok := node.Value.([]interface{})
+		if !ok || len(values) == 0 {
+			return nil, badQuery("字段 %s 的 in 条件需要非空数组", node.Field)
+		}
+		if len(values) > maxFilterInValues {
+			return nil, badQuery("字段 %s 的 in 条件不能超过 %d 个值", node.Field, maxFilterInValues)
+		}
+		return clause.IN{Column: column, Values: values}, nil
+	case FilterOpLike:
+		s, ok := node.Value.(string)
+		if !ok || s == "" {
+			return nil, badQuery("字段 %s 的 like 条件需要非空字符串", node.Field)
+		}
+		return clause.Like{Column: column, Value: "%" + escapeLike(s) + "%"}, nil
+	case FilterOpRange:
+		bounds, ok := node.Value.([]interface{})
+		if !ok || len(bounds) != 2 || (bounds[0] == nil && bounds[1] == nil) {
+			return nil, badQuery("字段 %s 的 range 条件需要 [min, max]", node.Field)
+		}
+		exprs := make([]clause.Expression, 0, 2)
+		if bounds[0] != nil {
+			exprs = append(exprs, clause.Gte{Column: column, Value: bounds[0]})
+		}
+		if bounds[1] != nil {
+			exprs = append(exprs, clause.Lte{Column: column, Value: bounds[1]})
+		}
+		return clause.And(exprs...), nil
+	default:
+		return nil, badQuery("不支持的操作符: %s", node.Op)
+	}
+}
+
+// escapeLike 转义 LIKE 通配符，PostgreSQL 与 MySQL 默认使用反斜杠作为转义字符
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// applySets 只查询 Sets 中的字段
+func (b *QueryBuilder) applySets(db *gorm.DB, sets []string) (*gorm.DB, error) {
+	if len(sets) == 0 {
+		return db, nil
+	}
+	columns := make([]clause.Column, 0, len(sets))
+	for _, name := range sets {
+		field, ok := b.fields[name]
+		if !ok {
+			return nil, badQuery("未知的字段: %s", name)
+		}
+		columns = append(columns, clause.Column{Table: clause.CurrentTable, Name: field.column})
+	}
+	return db.Clauses(clause.Select{Columns: columns}), nil
+}
+
+// applyOrder 排序，OrderBy 的每一项形如 {"createdAt": "desc"}
+// 未指定排序时按主键升序，保证分页稳定
+func (b *QueryBuilder) applyOrder(db *gorm.DB, orderBy []map[string]string) (*gorm.DB, error) {
+	columns := make([]clause.OrderByColumn, 0, len(orderBy))
+	for _, item := range orderBy {
+		if len(item) != 1 {
+			return nil, badQuery("orderBy 的每一项只能包含一个字段")
+		}
+		for name, direction := range item {
+			field, ok := b.fields[name]
+			if !ok || !field.sortable {
+				return nil, badQuery("字段 %s 不允许排序", name)
+			}
+			var desc bool
+			switch strings.ToLower(direction) {
+			case "", "asc":
+			case "desc":
+				desc = true
+			default:
+				return nil, badQuery("不支持的排序方向: %s", direction)
+			}
+			columns = append(columns, clause.OrderByColumn{
+				Column: clause.Column{Table: clause.CurrentTable, Name: field.column},
+				Desc:   desc,
+			})
+		}
+	}
+	if len(columns) == 0 && b.schema.PrioritizedPrimaryField != nil {
+		columns = append(columns, clause.OrderByColumn{
+			Column: clause.Column{Table: clause.CurrentTable, Name: b.schema.PrioritizedPrimaryField.DBName},
+		})
+	}
+	if len(columns) == 0 {
+		return db, nil
+	}
+	return db.Clauses(clause.OrderBy{Columns: columns}), nil
+}
+
+// applyPage 分页，页码从第零页开始
+func (b *QueryBuilder) applyPage(db *gorm.DB, page, pageSize int64) (*gorm.DB, error) {
+	if page < 0 {
+		return nil, badQuery("page 不能小于 0")
+	}
+	if pageSize <= 0 {
+		pageSize = b.options.DefaultPageSize
+	}
+	if pageSize > b.options.MaxPageSize {
+		pageSize = b.options.MaxPageSize
+	}
+	// page * pageSize 溢出时会得到负数或错误的偏移量
+	if page > int64(math.MaxInt)/pageSize {
+		return nil, badQuery("page 过大")
+	}
+	return db.Offset(int(page * pageSize)).Limit(int(pageSize)), nil
+}
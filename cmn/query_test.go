@@ -0,0 +1,182 @@
+package cmn
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+type queryTestUser struct {
+	ID        int64     `json:"id" gorm:"primaryKey" query:"filter,sort"`
+	Name      string    `json:"name" query:"filter,sort"`
+	Age       int       `json:"age" query:"filter"`
+	Status    int       `json:"status" query:"filter"`
+	Email     string    `json:"email"`
+	Password  string    `json:"-"`
+	CreatedAt time.Time `json:"createdAt" query:"sort"`
+}
+
+// newDryRunDB 只生成 SQL、不連接數據庫的 GORM 實例
+func newDryRunDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost user=test dbname=test sslmode=disable"}), &gorm.Config{
+		DryRun:               true,
+		DisableAutomaticPing: true,
+	})
+	assert.NoError(t, err)
+	return db
+}
+
+// buildQuerySQL 解析請求並返回生成的 SQL 與參數
+func buildQuerySQL(t *testing.T, reqJSON string) (string, []interface{}, error) {
+	db := newDryRunDB(t)
+	var req ReqProto
+	assert.NoError(t, json.Unmarshal([]byte(reqJSON), &req))
+
+	builder, err := NewQueryBuilder(db, &queryTestUser{}, nil)
+	assert.NoError(t, err)
+	query, err := builder.Apply(db, &req)
+	if err != nil {
+		return "", nil, err
+	}
+	var users []queryTestUser
+	stmt := query.Find(&users).Statement
+	return stmt.SQL.String(), stmt.Vars, nil
+}
+
+func TestQueryBuilder(t *testing.T) {
+	t.Run("基本過濾與默認分頁", func(t *testing.T) {
+		sql, vars, err := buildQuerySQL(t, `{"filter": {"field": "name", "op": "eq", "value": "tom"}}`)
+		assert.NoError(t, err)
+		assert.Equal(t, `SELECT * FROM "query_test_users" WHERE "query_test_users"."name" = $1 ORDER BY "query_test_users"."id" LIMIT $2`, sql)
+		assert.Equal(t, []interface{}{"tom", 20}, vars)
+	})
+
+	t.Run("and/or嵌套", func(t *testing.T) {
+		sql, vars, err := buildQuerySQL(t, `{"filter": {"and": [
+			{"field": "status", "op": "in", "value": [1, 2]},
+			{"or": [
+				{"field": "name", "op": "like", "value": "50%_"},
+				{"field": "age", "op": "range", "value": [18, null]}
+			]}
+		]}}`)
+		assert.NoError(t, err)
+		assert.Contains(t, sql, `WHERE "query_test_users"."status" IN ($1,$2) AND ("query_test_users"."name" LIKE $3 OR "query_test_users"."age" >= $4)`)
+		assert.Equal(t, `%50\%\_%`, vars[2])
+	})
+
+	t.Run("條件數組等同於and", func(t *testing.T) {
+		sql, _, err := buildQuerySQL(t, `{"filter": [
+			{"field": "age", "op": "range", "value": [18, 30]},
+			{"field": "name", "op": "ne", "value": null}
+		]}`)
+		assert.NoError(t, err)
+		assert.Contains(t, sql, `"query_test_users"."age" >= $1 AND "query_test_users"."age" <= $2`)
+		assert.Contains(t, sql, `"query_test_users"."name" IS NOT NULL`)
+	})
+
+	t.Run("排序投影與分頁", func(t *testing.T) {
+		sql, vars, err := buildQuerySQL(t, `{"sets": ["id", "name"], "orderBy": [{"createdAt": "desc"}, {"id": "asc"}], "page": 2, "pageSize": 500}`)
+		assert.NoError(t, err)
+		assert.Equal(t, `SELECT "query_test_users"."id","query_test_users"."name" FROM "query_test_users" ORDER BY "query_test_users"."created_at" DESC,"query_test_users"."id" LIMIT $1 OFFSET $2`, sql)
+		// pageSize 超過上限時使用上限，頁碼從第零頁開始
+		assert.Equal(t, []interface{}{100, 200}, vars)
+	})
+
+	t.Run("部分選項使用默認值補全", func(t *testing.T) {
+		db := newDryRunDB(t)
+		cases := []struct {
+			options *QueryOptions
+			limit   int
+		}{
+			{&QueryOptions{MaxPageSize: 50}, 20},
+			{&QueryOptions{MaxPageSize: 10}, 10},
+			{&QueryOptions{DefaultPageSize: 30}, 30},
+			{&QueryOptions{DefaultPageSize: 500, MaxPageSize: 50}, 50},
+		}
+		for _, c := range cases {
+			builder, err := NewQueryBuilder(db, &queryTestUser{}, c.options)
+			if !assert.NoError(t, err) {
+				return
+			}
+			query, err := builder.Apply(db, &ReqProto{Page: 1})
+			if !assert.NoError(t, err) {
+				return
+			}
+			var users []queryTestUser
+			stmt := query.Find(&users).Statement
+			assert.Equal(t, []interface{}{c.limit, c.limit}, stmt.Vars, "%+v", *c.options)
+		}
+	})
+
+	t.Run("拒絕未在白名單中的字段", func(t *testing.T) {
+		cases := []string{
+			`{"filter": {"field": "email", "op": "eq", "value": "a@b.c"}}`,
+			`{"filter": {"field": "password", "op": "eq", "value": "x"}}`,
+			`{"filter": {"field": "name; DROP TABLE users", "op": "eq", "value": "x"}}`,
+			`{"orderBy": [{"age": "desc"}]}`,
+			`{"orderBy": [{"name": "desc; DROP TABLE users"}]}`,
+			`{"sets": ["password"]}`,
+		}
+		for _, c := range cases {
+			_, _, err := buildQuerySQL(t, c)
+			var appErr *AppError
+			if assert.True(t, errors.As(err, &appErr), c) {
+				assert.Equal(t, http.StatusBadRequest, appErr.StatusCode)
+			}
+		}
+	})
+
+	t.Run("拒絕錯誤的條件", func(t *testing.T) {
+		cases := []string{
+			`{"filter": {"field": "name", "op": "regex", "value": "x"}}`,
+			`{"filter": {"field": "status", "op": "in", "value": []}}`,
+			`{"filter": {"field": "status", "op": "eq", "value": [1, 2]}}`,
+			`{"filter": {"field": "age", "op": "range", "value": [null, null]}}`,
+			`{"filter": {"field": "name", "and": [{"field": "age", "value": 1}]}}`,
+			`{"page": -1}`,
+			`{"page": 9223372036854775807, "pageSize": 10}`,
+			`{"filter": {"field": "name", "value": "x", "extra": 1}}`,
+			`{"filter": {"feild": "name", "value": "x"}}`,
+			`{"filter": {"op": "eq", "value": 1}}`,
+			`{"filter": {"and": [{}]}}`,
+			`{"filter": {"or": [{"field": "status", "value": 1}, {"and": []}]}}`,
+		}
+		for _, c := range cases {
+			_, _, err := buildQuerySQL(t, c)
+			assert.Error(t, err, c)
+		}
+	})
+
+	t.Run("空的頂層條件表示不過濾", func(t *testing.T) {
+		for _, c := range []string{`{"filter": {}}`, `{"filter": []}`, `{"filter": null}`} {
+			sql, _, err := buildQuerySQL(t, c)
+			if !assert.NoError(t, err, c) {
+				return
+			}
+			assert.NotContains(t, sql, "WHERE", c)
+		}
+	})
+
+	t.Run("統計總行數只應用過濾條件", func(t *testing.T) {
+		db := newDryRunDB(t)
+		builder, err := NewQueryBuilder(db, &queryTestUser{}, nil)
+		assert.NoError(t, err)
+
+		req := &ReqProto{
+			Filter:  map[string]interface{}{"field": "status", "value": 1},
+			OrderBy: []map[string]string{{"name": "asc"}},
+			Page:    3,
+		}
+		query, err := builder.Where(db, req)
+		assert.NoError(t, err)
+		var total int64
+		stmt := query.Count(&total).Statement
+		assert.Equal(t, `SELECT count(*) FROM "query_test_users" WHERE "query_test_users"."status" = $1`, stmt.SQL.String())
+	})
+}
@@ -0,0 +1,120 @@
+package cmn
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// Reply 泛型响应，字段与 ReplyProto 一致，Data 直接使用业务类型，只需序列化一次
+type Reply[T any] struct {
+	//Status, 0: success, others: fault
+	Status int `json:"status"`
+
+	//Msg, Action result describe by literal
+	Msg string `json:"msg,omitempty"`
+
+	//Data, operand
+	Data T `json:"data,omitempty"`
+
+	// RowCount, just row count
+	RowCount int64 `json:"rowCount,omitempty"`
+
+	//API, call target
+	API string `json:"API,omitempty"`
+
+	//Method, using http method
+	Method string `json:"method,omitempty"`
+
+	//SN, call order
+	SN int `json:"SN,omitempty"`
+}
+
+// MsgSuccess 成功响应的默认消息
+const MsgSuccess = "success"
+
+// newReply 根据请求上下文填充 API 与 Method
+func newReply[T any](c *gin.Context, status int, msg string, data T) Reply[T] {
+	return Reply[T]{
+		Status: status,
+		Msg:    msg,
+		Data:   data,
+		API:    c.Request.URL.Path,
+		Method: c.Request.Method,
+	}
+}
+
+// OK 返回成功响应
+func OK[T any](c *gin.Context, data T) {
+	c.JSON(http.StatusOK, newReply(c, Success, MsgSuccess, data))
+}
+
+// OKWithMsg 返回带自定义消息的成功响应
+func OKWithMsg[T any](c *gin.Context, msg string, data T) {
+	c.JSON(http.StatusOK, newReply(c, Success, msg, data))
+}
+
+// PageReply 分页响应，字段与 Reply 一致，但 data 与 rowCount 始终输出，空页为 "data":[]
+type PageReply[T any] struct {
+	Status   int    `json:"status"`
+	Msg      string `json:"msg,omitempty"`
+	Data     []T    `json:"data"`
+	RowCount int64  `json:"rowCount"`
+	API      string `json:"API,omitempty"`
+	Method   string `json:"method,omitempty"`
+	SN       int    `json:"SN,omitempty"`
+}
+
+// Page 返回分页响应，total 为满足条件的总行数（不是本页行数）
+func Page[T any](c *gin.Context, items []T, total int64) {
+	if items == nil {
+		items = []T{}
+	}
+	c.JSON(http.StatusOK, PageReply[T]{
+		Status:   Success,
+		Msg:      MsgSuccess,
+		Data:     items,
+		RowCount: total,
+		API:      c.Request.URL.Path,
+		Method:   c.Request.Method,
+	})
+}
+
+// Fail 返回错误响应并终止请求，HTTP 状态码由错误码定义决定（见 AppError.HTTPStatus），非 AppError 返回 500
+// 消息按请求的 Accept-Language 选择
+func Fail(c *gin.Context, err error) {
+	FailWithStatus(c, httpStatusOf(err), err)
+}
+
+// FailWithStatus 使用指定的 HTTP 状态码返回错误响应并终止请求
+// 非 AppError 的错误内容可能包含 SQL、内部地址等信息，只记录日志，响应使用 CodeInternal 的消息
+func FailWithStatus(c *gin.Context, httpStatus int, err error) {
+	_ = c.Error(err)
+	var appErr *AppError
+	if !errors.As(err, &appErr) {
+		Logger().Error("请求处理失败",
+			zap.Error(err),
+			zap.String("method", c.Request.Method),
+			zap.String("path", c.Request.URL.Path),
+		)
+		err = WrapError(CodeInternal, err)
+	}
+	reply := NewErrorReplyLang(err, c.Request.URL.Path, c.Request.Method, c.GetHeader("Accept-Language"))
+	c.AbortWithStatusJSON(httpStatus, reply)
+}
+
+// abortWithCode 内置中间件使用的错误响应，code 为 error.go 中定义的错误码，HTTP 状态码取自错误码定义，msg 为默认语言的消息
+func abortWithCode(c *gin.Context, code int, msg string) {
+	Fail(c, NewAppError(code, msg))
+}
+
+// httpStatusOf 推导错误对应的 HTTP 状态码
+func httpStatusOf(err error) int {
+	var appErr *AppError
+	if !errors.As(err, &appErr) {
+		return http.StatusInternalServerError
+	}
+	return appErr.HTTPStatus()
+}
@@ -0,0 +1,143 @@
+package cmn
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+type replyTestItem struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+// serveReply 執行處理器並把響應解碼為 ReplyProto
+func serveReply(t *testing.T, router *gin.Engine, method, path string) (int, ReplyProto) {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(method, path, nil)
+	router.ServeHTTP(w, req)
+
+	var reply ReplyProto
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &reply))
+	return w.Code, reply
+}
+
+func TestReplyHelpers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.GET("/item", func(c *gin.Context) {
+		OK(c, replyTestItem{ID: 1, Name: "a"})
+	})
+	router.GET("/items", func(c *gin.Context) {
+		Page(c, []replyTestItem{{ID: 1}, {ID: 2}}, 12)
+	})
+	router.GET("/empty", func(c *gin.Context) {
+		Page[replyTestItem](c, nil, 0)
+	})
+	router.GET("/empty-slice", func(c *gin.Context) {
+		Page(c, []replyTestItem{}, 0)
+	})
+	router.GET("/business", func(c *gin.Context) {
+		Fail(c, NewAppError(-3, "余额不足"))
+	})
+	router.GET("/forbidden", func(c *gin.Context) {
+		Fail(c, NewAppError(http.StatusForbidden, "无权访问"))
+	})
+	router.GET("/internal", func(c *gin.Context) {
+		Fail(c, errors.New("db down"))
+	})
+
+	t.Run("成功響應", func(t *testing.T) {
+		code, reply := serveReply(t, router, "GET", "/item")
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, Success, reply.Status)
+		assert.Equal(t, "/item", reply.API)
+		assert.Equal(t, "GET", reply.Method)
+
+		var item replyTestItem
+		assert.NoError(t, json.Unmarshal(reply.Data, &item))
+		assert.Equal(t, replyTestItem{ID: 1, Name: "a"}, item)
+	})
+
+	t.Run("分頁響應", func(t *testing.T) {
+		_, reply := serveReply(t, router, "GET", "/items")
+		assert.Equal(t, int64(12), reply.RowCount)
+
+		var items []replyTestItem
+		assert.NoError(t, json.Unmarshal(reply.Data, &items))
+		assert.Len(t, items, 2)
+
+		code, reply := serveReply(t, router, "GET", "/empty")
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, Success, reply.Status)
+	})
+
+	t.Run("空頁仍返回data與rowCount", func(t *testing.T) {
+		for _, path := range []string{"/empty", "/empty-slice"} {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", path, nil)
+			router.ServeHTTP(w, req)
+			assert.Contains(t, w.Body.String(), `"data":[]`, path)
+			assert.Contains(t, w.Body.String(), `"rowCount":0`, path)
+		}
+	})
+
+	t.Run("錯誤響應", func(t *testing.T) {
+		code, reply := serveReply(t, router, "GET", "/business")
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, -3, reply.Status)
+		assert.Equal(t, "余额不足", reply.Msg)
+
+		code, reply = serveReply(t, router, "GET", "/forbidden")
+		assert.Equal(t, http.StatusForbidden, code)
+		assert.Equal(t, http.StatusForbidden, reply.Status)
+
+		code, reply = serveReply(t, router, "GET", "/internal")
+		assert.Equal(t, http.StatusInternalServerError, code)
+		assert.Equal(t, CodeInternal, reply.Status)
+		assert.Equal(t, "服务器内部错误", reply.Msg)
+		assert.NotContains(t, reply.Msg, "db down")
+	})
+
+	t.Run("非AppError按語言返回內部錯誤消息", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/internal", nil)
+		req.Header.Set("Accept-Language", "en-US")
+		router.ServeHTTP(w, req)
+
+		var reply ReplyProto
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &reply))
+		assert.Equal(t, "Internal server error", reply.Msg)
+		assert.NotContains(t, w.Body.String(), "db down")
+	})
+
+	t.Run("內置中間件使用相同的響應格式", func(t *testing.T) {
+		router := gin.New()
+		router.Use(RecoveryMiddleware())
+		router.GET("/auth", AuthMiddleware(), func(c *gin.Context) {})
+		router.GET("/panic", func(c *gin.Context) { panic("boom") })
+		router.GET("/limit", RateLimitByIP(0, 0), func(c *gin.Context) {})
+
+		code, reply := serveReply(t, router, "GET", "/auth")
+		assert.Equal(t, http.StatusUnauthorized, code)
+		assert.Equal(t, http.StatusUnauthorized, reply.Status)
+		assert.Equal(t, "缺少认证令牌", reply.Msg)
+		assert.Equal(t, "/auth", reply.API)
+
+		code, reply = serveReply(t, router, "GET", "/panic")
+		assert.Equal(t, http.StatusInternalServerError, code)
+		assert.Equal(t, "服务器内部错误", reply.Msg)
+
+		req, _ := http.NewRequest("GET", "/limit", nil)
+		router.ServeHTTP(httptest.NewRecorder(), req)
+		code, reply = serveReply(t, router, "GET", "/limit")
+		assert.Equal(t, http.StatusTooManyRequests, code)
+		assert.Equal(t, http.StatusTooManyRequests, reply.Status)
+	})
+}
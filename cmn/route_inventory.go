@@ -0,0 +1,387 @@
+package cmn
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"path"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RoutePolicy 中间件对某个路由施加的策略
+type RoutePolicy struct {
+	AuthRequired bool          // 是否强制认证（已排除 SkipPaths）
+	RateLimits   []string      // 限流策略，如 "100/s burst 200"
+	Timeout      time.Duration // 超时时间（已考虑路由级超时）
+}
+
+// RoutePolicyFunc 根据路由（方法与路由模板）描述中间件施加的策略，注册中间件时通过 WithPolicy 提供
+type RoutePolicyFunc func(method, path string, policy *RoutePolicy)
+
+// AuthRoutePolicy 认证中间件的策略：config 为 nil 时（AuthMiddleware）所有路由都需要认证，否则排除 SkipPaths
+func AuthRoutePolicy(config *AuthConfig) RoutePolicyFunc {
+	return func(method, path string, policy *RoutePolicy) {
+		if config != nil {
+			for _, skipPath := range config.SkipPaths {
+				if path == skipPath {
+					return
+				}
+			}
+		}
+		policy.AuthRequired = true
+	}
+}
+
+// RateLimitRoutePolicy 限流中间件的策略
+func RateLimitRoutePolicy(config *RateLimitConfig) RoutePolicyFunc {
+	if config == nil {
+		config = DefaultRateLimitConfig()
+	}
+	description := fmt.Sprintf("%g/s burst %d", config.Rate, config.Capacity)
+	return func(method, path string, policy *RoutePolicy) {
+		policy.RateLimits = append(policy.RateLimits, description)
+	}
+}
+
+// TimeoutRoutePolicy 超时中间件的策略（已考虑路由级超时）
+func TimeoutRoutePolicy(config *TimeoutConfig) RoutePolicyFunc {
+	return func(method, path string, policy *RoutePolicy) {
+		policy.Timeout = config.routeTimeout(method, path)
+	}
+}
+
+// appliedChain 注册器应用到某个路由组的中间件链，位于该组处理链的 [start, end) 位置
+type appliedChain struct {
+	group      *gin.RouterGroup
+	start, end int
+	entries    []*MiddlewareEntry
+}
+
+// anyMethods 与 gin 的 Any 注册的方法一致
+var anyMethods = []string{
+	http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch,
+	http.MethodHead, http.MethodOptions, http.MethodDelete, http.MethodConnect,
+	http.MethodTrace,
+}
+
+// routeLevel 路由所在路由组及其祖先中对该路由可见的处理器数量
+// 子路由组创建时复制父组的处理器，位置不变，因此可以按位置判断注册器的中间件链是否作用于该路由
+type routeLevel struct {
+	group   *gin.RouterGroup
+	visible int
+}
+
+// recordedRoute 通过 RouteGroup 注册的路由
+type recordedRoute struct {
+	handlers gin.HandlersChain
+	levels   []routeLevel
+}
+
+// routeRecorder 同一引擎上所有 RouteGroup 共用的路由记录
+type routeRecorder struct {
+	engine *gin.Engine
+	mu     sync.Mutex
+	routes map[string]recordedRoute
+}
+
+// RouteGroup 包装 gin.RouterGroup，记录通过它注册的路由及完整的处理链，供路由清单使用
+//
+// 只有通过 RouteGroup 注册的路由才能在清单中显示中间件链与策略，
+// 直接在 gin 的路由组上注册的路由显示为未记录，并视为无需认证
+type RouteGroup struct {
+	*gin.RouterGroup
+	recorder  *routeRecorder
+	parent    *RouteGroup
+	inherited int // 创建时从父组复制的处理器数量
+}
+
+// RecordRoutes 返回引擎根路由组的 RouteGroup
+//
+//	routes := cmn.RecordRoutes(router)
+//	api := routes.Group("/api")
+//	if err := authRegistry.ApplyTo(api.RouterGroup); err != nil {
+//	    panic(err)
+//	}
+//	api.GET("/profile", profileHandler)
+func RecordRoutes(engine *gin.Engine) *RouteGroup {
+	return &RouteGroup{
+		RouterGroup: &engine.RouterGroup,
+		recorder:    &routeRecorder{engine: engine, routes: make(map[string]recordedRoute)},
+	}
+}
+
+// Group 创建子路由组，通过它注册的路由同样会被记录
+func (g *RouteGroup) Group(relativePath string, handlers ...gin.HandlerFunc) *RouteGroup {
+	return &RouteGroup{
+		RouterGroup: g.RouterGroup.Group(relativePath, handlers...),
+		recorder:    g.recorder,
+		parent:      g,
+		inherited:   len(g.Handlers),
+	}
+}
+
+// Use 添加中间件，只影响之后在该组上注册的路由
+func (g *RouteGroup) Use(middleware ...gin.HandlerFunc) gin.IRoutes {
+	g.RouterGroup.Use(middleware...)
+	return g
+}
+
+// Handle 注册路由并记录其处理链
+func (g *RouteGroup) Handle(httpMethod, relativePath string, handlers ...gin.HandlerFunc) gin.IRoutes {
+	g.RouterGroup.Handle(httpMethod, relativePath, handlers...)
+
+	chain := make(gin.HandlersChain, 0, len(g.Handlers)+len(handlers))
+	chain = append(append(chain, g.Handlers...), handlers...)
+	var levels []routeLevel
+	visible := len(g.Handlers)
+	for level := g; level != nil; level = level.parent {
+		levels = append(levels, routeLevel{group: level.RouterGroup, visible: visible})
+		visible = min(visible, level.inherited)
+	}
+
+	g.recorder.mu.Lock()
+	g.recorder.routes[httpMethod+" "+joinRoutePath(g.BasePath(), relativePath)] = recordedRoute{handlers: chain, levels: levels}
+	g.recorder.mu.Unlock()
+	return g
+}
+
+// POST 注册 POST 路由
+func (g *RouteGroup) POST(relativePath string, handlers ...gin.HandlerFunc) gin.IRoutes {
+	return g.Handle(http.MethodPost, relativePath, handlers...)
+}
+
+// GET 注册 GET 路由
+func (g *RouteGroup) GET(relativePath string, handlers ...gin.HandlerFunc) gin.IRoutes {
+	return g.Handle(http.MethodGet, relativePath, handlers...)
+}
+
+// DELETE 注册 DELETE 路由
+func (g *RouteGroup) DELETE(relativePath string, handlers ...gin.HandlerFunc) gin.IRoutes {
+	return g.Handle(http.MethodDelete, relativePath, handlers...)
+}
+
+// PATCH 注册 PATCH 路由
+func (g *RouteGroup) PATCH(relativePath string, handlers ...gin.HandlerFunc) gin.IRoutes {
+	return g.Handle(http.MethodPatch, relativePath, handlers...)
+}
+
+// PUT 注册 PUT 路由
+func (g *RouteGroup) PUT(relativePath string, handlers ...gin.HandlerFunc) gin.IRoutes {
+	return g.Handle(http.MethodPut, relativePath, handlers...)
+}
+
+// OPTIONS 注册 OPTIONS 路由
+func (g *RouteGroup) OPTIONS(relativePath string, handlers ...gin.HandlerFunc) gin.IRoutes {
+	return g.Handle(http.MethodOptions, relativePath, handlers...)
+}
+
+// HEAD 注册 HEAD 路由
+func (g *RouteGroup) HEAD(relativePath string, handlers ...gin.HandlerFunc) gin.IRoutes {
+	return g.Handle(http.MethodHead, relativePath, handlers...)
+}
+
+// Any 为所有方法注册路由
+func (g *RouteGroup) Any(relativePath string, handlers ...gin.HandlerFunc) gin.IRoutes {
+	return g.Match(anyMethods, relativePath, handlers...)
+}
+
+// Match 为指定方法注册路由
+func (g *RouteGroup) Match(methods []string, relativePath string, handlers ...gin.HandlerFunc) gin.IRoutes {
+	for _, method := range methods {
+		g.Handle(method, relativePath, handlers...)
+	}
+	return g
+}
+
+// joinRoutePath 与 gin 计算路由绝对路径的方式一致
+func joinRoutePath(basePath, relativePath string) string {
+	if relativePath == "" {
+		return basePath
+	}
+	finalPath := path.Join(basePath, relativePath)
+	if strings.HasSuffix(relativePath, "/") && !strings.HasSuffix(finalPath, "/") {
+		return finalPath + "/"
+	}
+	return finalPath
+}
+
+// funcName 返回函数名，去掉包路径，如 cmn.AuthMiddlewareWithConfig.func1
+func funcName(fn gin.HandlerFunc) string {
+	return shortFuncName(runtime.FuncForPC(reflect.ValueOf(fn).Pointer()).Name())
+}
+
+// shortFuncName 去掉函数全名中的包路径
+func shortFuncName(name string) string {
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[i+1:]
+	}
+	return name
+}
+
+// RouteEntry 路由清单中的一项
+type RouteEntry struct {
+	Method       string   `json:"method"`
+	Path         string   `json:"path"`
+	Handler      string   `json:"handler"`
+	Middlewares  []string `json:"middlewares"`
+	Unrecorded   bool     `json:"unrecorded,omitempty"` // 未通过 RouteGroup 注册，中间件链未知
+	AuthRequired bool     `json:"authRequired"`
+	RateLimit    string   `json:"rateLimit,omitempty"`
+	Timeout      string   `json:"timeout,omitempty"`
+}
+
+// RouteInventory 列出引擎上注册的所有路由及其中间件链，按路径、方法排序
+//
+// 路由取自 Engine.Routes()，中间件链取自通过 RouteGroup 注册时记录的完整处理链：
+//   - 直接 Use 或内联的中间件显示函数名，注册器应用的中间件显示注册名称
+//   - 注册器的中间件链只作用于 ApplyTo 的路由组及之后从它创建的子组中、应用之后注册的路由
+//   - 认证、限流、超时策略来自注册时的 WithPolicy（配置文件声明的内置中间件自动提供），
+//     其他中间件不会被视为认证；未通过 RouteGroup 注册的路由视为无需认证
+func RouteInventory(routes *RouteGroup, registries ...*MiddlewareRegistry) []RouteEntry {
+	var chains []*appliedChain
+	for _, registry := range registries {
+		for i := range registry.chains {
+			chains = append(chains, &registry.chains[i])
+		}
+	}
+
+	routes.recorder.mu.Lock()
+	recorded := make(map[string]recordedRoute, len(routes.recorder.routes))
+	for key, route := range routes.recorder.routes {
+		recorded[key] = route
+	}
+	routes.recorder.mu.Unlock()
+
+	infos := routes.recorder.engine.Routes()
+	entries := make([]RouteEntry, 0, len(infos))
+	for _, info := range infos {
+		entry := RouteEntry{
+			Method:      info.Method,
+			Path:        info.Path,
+			Handler:     shortFuncName(info.Handler),
+			Middlewares: make([]string, 0),
+		}
+		route, ok := recorded[info.Method+" "+info.Path]
+		if !ok {
+			entry.Unrecorded = true
+			entries = append(entries, entry)
+			continue
+		}
+
+		middlewares := route.handlers[:len(route.handlers)-1]
+		names := make([]string, len(middlewares))
+		for i, handler := range middlewares {
+			names[i] = funcName(handler)
+		}
+		policies := make([]RoutePolicyFunc, len(middlewares))
+		for _, chain := range chains {
+			if !route.covers(chain) {
+				continue
+			}
+			for i, e := range chain.entries {
+				if !strings.HasPrefix(e.Name, anonymousPrefix) {
+					// 匿名中间件显示函数名
+					names[chain.start+i] = e.Name
+				}
+				policies[chain.start+i] = e.Policy
+			}
+		}
+		entry.Middlewares = names
+
+		// 按执行顺序应用策略
+		policy := &RoutePolicy{}
+		for _, describe := range policies {
+			if describe != nil {
+				describe(info.Method, info.Path, policy)
+			}
+		}
+		entry.AuthRequired = policy.AuthRequired
+		entry.RateLimit = strings.Join(policy.RateLimits, "; ")
+		if policy.Timeout > 0 {
+			entry.Timeout = policy.Timeout.String()
+		}
+		entries = append(entries, entry)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Path != entries[j].Path {
+			return entries[i].Path < entries[j].Path
+		}
+		return entries[i].Method < entries[j].Method
+	})
+	return entries
+}
+
+// covers 判断中间件链是否在路由的处理链中：路由经由该链应用的路由组注册，且注册时该链已应用
+func (r *recordedRoute) covers(chain *appliedChain) bool {
+	for _, level := range r.levels {
+		if level.group == chain.group {
+			return chain.end <= level.visible
+		}
+	}
+	return false
+}
+
+// FormatRouteTable 以表格形式输出路由清单
+func FormatRouteTable(entries []RouteEntry) string {
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "METHOD\tPATH\tAUTH\tRATE LIMIT\tTIMEOUT\tHANDLER\tMIDDLEWARES")
+	for _, e := range entries {
+		auth := "no"
+		if e.AuthRequired {
+			auth = "yes"
+		}
+		middlewares := strings.Join(e.Middlewares, " > ")
+		if e.Unrecorded {
+			middlewares = "?"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			e.Method, e.Path, auth, orDash(e.RateLimit), orDash(e.Timeout), e.Handler, middlewares)
+	}
+	w.Flush()
+	return buf.String()
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// RoutesHandler 管理接口：返回路由清单，?format=table 时返回文本表格，?auth=false 只列出无需认证的路由
+// 调用方需自行添加认证
+func RoutesHandler(routes *RouteGroup, registries ...*MiddlewareRegistry) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		entries := RouteInventory(routes, registries...)
+		if c.Query("auth") == "false" {
+			entries = UnauthenticatedRoutes(entries)
+		}
+
+		if c.Query("format") == "table" {
+			c.String(http.StatusOK, FormatRouteTable(entries))
+			return
+		}
+		OK(c, entries)
+	}
+}
+
+// UnauthenticatedRoutes 过滤出无需认证的路由
+func UnauthenticatedRoutes(entries []RouteEntry) []RouteEntry {
+	result := make([]RouteEntry, 0, len(entries))
+	for _, e := range entries {
+		if !e.AuthRequired {
+			result = append(result, e)
+		}
+	}
+	return result
+}
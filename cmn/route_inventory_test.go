@@ -0,0 +1,165 @@
+package cmn
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRouteInventory(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	root := RecordRoutes(router)
+	// 應用之前註冊的路由不受中間件影響
+	root.GET("/early", func(c *gin.Context) {})
+
+	registry := NewMiddlewareRegistry(router)
+	rateLimitConfig := &RateLimitConfig{Rate: 100, Capacity: 200}
+	timeoutConfig := DefaultTimeoutConfig()
+	timeoutConfig.Routes = map[string]time.Duration{"GET /api/report": 2 * time.Minute}
+	registry.
+		RegisterNamed("recovery", RecoveryMiddleware(), WithPriority(PriorityRecovery)).
+		RegisterNamed("rateLimit", RateLimitByIP(100, 200), WithPriority(PriorityRateLimit), WithPolicy(RateLimitRoutePolicy(rateLimitConfig))).
+		RegisterNamed("timeout", TimeoutMiddlewareWithConfig(timeoutConfig), WithPriority(PriorityTimeout), WithPolicy(TimeoutRoutePolicy(timeoutConfig)))
+	assert.NoError(t, registry.Apply())
+
+	authConfig := DefaultAuthConfig()
+	authConfig.SkipPaths = []string{"/api/login"}
+	api := root.Group("/api")
+	// 同一前綴下另一個未應用認證的路由組
+	public := root.Group("/api")
+	apiRegistry := NewMiddlewareRegistry(router)
+	apiRegistry.
+		RegisterNamed("auth", AuthMiddlewareWithConfig(authConfig), WithPolicy(AuthRoutePolicy(authConfig))).
+		Register(func(c *gin.Context) { c.Next() })
+	assert.NoError(t, apiRegistry.ApplyTo(api.RouterGroup))
+	// 直接 Use 的中間件顯示函數名
+	api.Use(OptionalAuthMiddleware())
+	api.POST("/login", func(c *gin.Context) {})
+	api.GET("/report", func(c *gin.Context) {})
+	api.GET("/users/:id", func(c *gin.Context) {})
+	// 應用之後從該組創建的子組同樣經過認證
+	api.Group("/admin").GET("/stats", func(c *gin.Context) {})
+	public.GET("/news", OptionalAuthMiddleware(), func(c *gin.Context) {})
+	root.GET("/health", func(c *gin.Context) {})
+	root.GET("/apix", func(c *gin.Context) {})
+	// 直接在 gin 上註冊的路由未被記錄
+	router.GET("/raw", func(c *gin.Context) {})
+
+	entries := RouteInventory(root, registry, apiRegistry)
+	assert.Len(t, entries, 9)
+
+	routes := make(map[string]RouteEntry)
+	for _, e := range entries {
+		routes[e.Method+" "+e.Path] = e
+	}
+
+	t.Run("列出中間件鏈", func(t *testing.T) {
+		e := routes["GET /api/users/:id"]
+		assert.Len(t, e.Middlewares, 6)
+		assert.Equal(t, []string{"recovery", "rateLimit", "timeout", "auth"}, e.Middlewares[:4])
+		// 匿名中間件與直接 Use 的中間件顯示函數名
+		assert.Contains(t, e.Middlewares[4], "cmn.TestRouteInventory")
+		assert.Contains(t, e.Middlewares[5], "cmn.OptionalAuthMiddleware")
+		assert.Contains(t, e.Handler, "cmn.TestRouteInventory")
+		assert.True(t, e.AuthRequired)
+		assert.Equal(t, "100/s burst 200", e.RateLimit)
+		assert.Equal(t, "30s", e.Timeout)
+	})
+
+	t.Run("跳過認證的路徑與未認證的路由", func(t *testing.T) {
+		assert.False(t, routes["POST /api/login"].AuthRequired)
+		assert.False(t, routes["GET /health"].AuthRequired)
+		// 路由組按路徑段歸屬，/apix 不屬於 /api
+		assert.False(t, routes["GET /apix"].AuthRequired)
+		assert.Equal(t, []string{"recovery", "rateLimit", "timeout"}, routes["GET /apix"].Middlewares)
+
+		assert.True(t, routes["GET /api/admin/stats"].AuthRequired)
+
+		unauthenticated := UnauthenticatedRoutes(entries)
+		assert.Len(t, unauthenticated, 6)
+	})
+
+	t.Run("同一前綴下的其他路由組不視為需要認證", func(t *testing.T) {
+		e := routes["GET /api/news"]
+		assert.False(t, e.AuthRequired)
+		assert.Len(t, e.Middlewares, 4)
+		assert.Equal(t, []string{"recovery", "rateLimit", "timeout"}, e.Middlewares[:3])
+		// 內聯的中間件同樣列出
+		assert.Contains(t, e.Middlewares[3], "cmn.OptionalAuthMiddleware")
+	})
+
+	t.Run("未通過 RouteGroup 註冊的路由", func(t *testing.T) {
+		e := routes["GET /raw"]
+		assert.True(t, e.Unrecorded)
+		assert.False(t, e.AuthRequired)
+		assert.Empty(t, e.Middlewares)
+	})
+
+	t.Run("應用之前註冊的路由", func(t *testing.T) {
+		e := routes["GET /early"]
+		assert.Empty(t, e.Middlewares)
+		assert.Empty(t, e.RateLimit)
+	})
+
+	t.Run("配置文件聲明的內置中間件自動提供策略", func(t *testing.T) {
+		router := gin.New()
+		registry := NewMiddlewareRegistry(router)
+		assert.NoError(t, registry.LoadPipeline([]MiddlewareSpec{
+			{Name: "recovery"},
+			{Name: "rateLimit", Options: MiddlewareOptions{"rate": 5, "capacity": 10}},
+			{Name: "auth", Options: MiddlewareOptions{"skipPaths": []string{"/login"}}},
+		}))
+		assert.NoError(t, registry.Apply())
+		root := RecordRoutes(router)
+		root.POST("/login", func(c *gin.Context) {})
+		root.GET("/me", func(c *gin.Context) {})
+
+		routes := make(map[string]RouteEntry)
+		for _, e := range RouteInventory(root, registry) {
+			routes[e.Method+" "+e.Path] = e
+		}
+		assert.Equal(t, []string{"recovery", "rateLimit", "auth"}, routes["GET /me"].Middlewares)
+		assert.Equal(t, "5/s burst 10", routes["GET /me"].RateLimit)
+		assert.True(t, routes["GET /me"].AuthRequired)
+		assert.False(t, routes["POST /login"].AuthRequired)
+	})
+
+	t.Run("路由級超時", func(t *testing.T) {
+		assert.Equal(t, "2m0s", routes["GET /api/report"].Timeout)
+	})
+
+	t.Run("表格輸出", func(t *testing.T) {
+		table := FormatRouteTable(entries)
+		assert.Contains(t, table, "METHOD")
+		assert.Contains(t, table, "/api/users/:id")
+		assert.Contains(t, table, "recovery > rateLimit > timeout")
+	})
+
+	t.Run("管理接口", func(t *testing.T) {
+		admin := gin.New()
+		admin.GET("/admin/routes", RoutesHandler(root, registry, apiRegistry))
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/admin/routes?auth=false", nil)
+		admin.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var resp struct {
+			Data []RouteEntry `json:"data"`
+		}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Len(t, resp.Data, 6)
+
+		w = httptest.NewRecorder()
+		req, _ = http.NewRequest("GET", "/admin/routes?format=table", nil)
+		admin.ServeHTTP(w, req)
+		assert.Contains(t, w.Body.String(), "/health")
+	})
+}
@@ -0,0 +1,691 @@
+package cmn
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"unicode"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// ErrRowAccessDenied 受行级安全保护的模型在缺少认证信息或认证信息不完整时拒绝访问
+var ErrRowAccessDenied = errors.New("row access denied")
+
+// RowPolicy 行级安全策略：根据认证信息返回模型的强制过滤条件
+// 返回错误时查询会被拒绝（默认拒绝），而不是放开过滤
+type RowPolicy func(claims *Claims) (clause.Expression, error)
+
+// TenantPolicy 只能访问同一租户的数据
+func TenantPolicy(column string) RowPolicy {
+	return claimPolicy(column, "tenant", func(c *Claims) string { return c.TenantId })
+}
+
+// DeptPolicy 只能访问同一部门的数据
+func DeptPolicy(column string) RowPolicy {
+	return claimPolicy(column, "dept", func(c *Claims) string { return c.DeptId })
+}
+
+// OwnerPolicy 只能访问自己的数据
+func OwnerPolicy(column string) RowPolicy {
+	return claimPolicy(column, "owner", func(c *Claims) string { return c.UserId })
+}
+
+// claimPolicy 以 claims 中的某个值等值过滤，值为空时拒绝访问
+func claimPolicy(column, kind string, value func(*Claims) string) RowPolicy {
+	return func(claims *Claims) (clause.Expression, error) {
+		v := value(claims)
+		if v == "" {
+			return nil, fmt.Errorf("%w: missing %s in claims", ErrRowAccessDenied, kind)
+		}
+		return clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: column}, Value: v}, nil
+	}
+}
+
+var (
+	rowPoliciesMu sync.RWMutex
+	rowPolicies   = make(map[reflect.Type][]RowPolicy)
+)
+
+// RegisterRowPolicy 为模型注册行级安全策略，多个策略之间为 AND 关系
+//
+//	cmn.RegisterRowPolicy(&Order{}, cmn.TenantPolicy("tenant_id"), cmn.OwnerPolicy("user_id"))
+func RegisterRowPolicy(model interface{}, policies ...RowPolicy) {
+	t := reflect.Indirect(reflect.ValueOf(model)).Type()
+
+	rowPoliciesMu.Lock()
+	defer rowPoliciesMu.Unlock()
+
+	rowPolicies[t] = append(rowPolicies[t], policies...)
+}
+
+// ClearRowPolicies 清空所有行级安全策略（用于测试）
+func ClearRowPolicies() {
+	rowPoliciesMu.Lock()
+	defer rowPoliciesMu.Unlock()
+
+	rowPolicies = make(map[reflect.Type][]RowPolicy)
+}
+
+type claimsContextKey struct{}
+type rowSecurityBypassKey struct{}
+
+// WithClaims 把认证信息放入 context，认证中间件会自动放入请求的 context
+func WithClaims(ctx context.Context, claims *Claims) context.Context {
+	return context.WithValue(ctx, claimsContextKey{}, claims)
+}
+
+// ClaimsFromContext 从 context 获取认证信息
+func ClaimsFromContext(ctx context.Context) (*Claims, bool) {
+	claims, ok := ctx.Value(claimsContextKey{}).(*Claims)
+	return claims, ok && claims != nil
+}
+
+// WithoutRowSecurity 跳过行级安全策略，仅用于定时任务、数据迁移等没有用户身份的系统操作
+func WithoutRowSecurity(ctx context.Context) context.Context {
+	return context.WithValue(ctx, rowSecurityBypassKey{}, true)
+}
+
+// rowSecurityOp 行级安全回调所在的 GORM 流程
+type rowSecurityOp int
+
+const (
+	rowSecurityRead rowSecurityOp = iota
+	rowSecurityCreate
+	rowSecurityUpdate
+	rowSecurityDelete
+	rowSecurityRaw
+)
+
+// EnableRowLevelSecurity 在 GORM 的查询、新增、更新、删除流程中自动附加行级安全过滤条件
+// 条件来自 db.WithContext(ctx) 中的认证信息，与客户端传入的 ReqProto.AuthFilter 无关
+func EnableRowLevelSecurity(db *gorm.DB) error {
+	if err := db.Callback().Query().Before("gorm:query").Register("cmn:row_security", applyRowSecurity(rowSecurityRead)); err != nil {
+		return err
+	}
+	if err := db.Callback().Row().Before("gorm:row").Register("cmn:row_security", applyRowSecurity(rowSecurityRead)); err != nil {
+		return err
+	}
+	if err := db.Callback().Create().Before("gorm:create").Register("cmn:row_security", applyRowSecurity(rowSecurityCreate)); err != nil {
+		return err
+	}
+	if err := db.Callback().Update().Before("gorm:update").Register("cmn:row_security", applyRowSecurity(rowSecurityUpdate)); err != nil {
+		return err
+	}
+	if err := db.Callback().Delete().Before("gorm:delete").Register("cmn:row_security", applyRowSecurity(rowSecurityDelete)); err != nil {
+		return err
+	}
+	return db.Callback().Raw().Before("gorm:raw").Register("cmn:row_security", applyRowSecurity(rowSecurityRaw))
+}
+
+// applyRowSecurity 返回按 op 附加过滤条件、写入或校验策略字段的回调
+func applyRowSecurity(op rowSecurityOp) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		if db.Error != nil {
+			return
+		}
+		stmt := db.Statement
+		if bypass, _ := stmt.Context.Value(rowSecurityBypassKey{}).(bool); bypass {
+			return
+		}
+
+		// Raw/Exec 的 SQL 已经拼好，无法附加条件：涉及受保护的表时直接拒绝
+		if op == rowSecurityRaw || stmt.SQL.Len() > 0 {
+			if table := rawProtectedTable(db); table != "" {
+				_ = db.AddError(fmt.Errorf("%w: raw SQL on protected table %s", ErrRowAccessDenied, table))
+			}
+			return
+		}
+
+		sch, exprs, err := rowSecurityConditions(db)
+		if err != nil {
+			_ = db.AddError(err)
+			return
+		}
+		if len(exprs) == 0 {
+			return
+		}
+
+		switch op {
+		case rowSecurityCreate:
+			if err := assignPolicyColumns(db, sch, exprs); err != nil {
+				_ = db.AddError(err)
+			}
+			return
+		case rowSecurityUpdate, rowSecurityDelete:
+			// 没有条件的更新/删除：保持 GORM 原有的 ErrMissingWhereClause 保护，避免变成整个租户范围的批量操作
+			if !hasWriteCondition(db, sch) {
+				_ = db.AddError(gorm.ErrMissingWhereClause)
+				return
+			}
+			if op == rowSecurityUpdate {
+				if err := checkPolicyAssignments(db, sch, exprs); err != nil {
+					_ = db.AddError(err)
+					return
+				}
+			}
+		}
+
+		// 策略条件与已有条件分别加括号后以 AND 连接，防止已有条件中的 OR 绕过策略
+		where := clause.Where{Exprs: []clause.Expression{parenthesized{clause.Where{Exprs: exprs}}}}
+		if c, ok := stmt.Clauses["WHERE"]; ok {
+			if existing, ok := c.Expression.(clause.Where); ok && len(existing.Exprs) > 0 {
+				where.Exprs = append(where.Exprs, parenthesized{existing})
+			}
+		}
+		c := stmt.Clauses["WHERE"]
+		c.Name = "WHERE"
+		c.Expression = where
+		stmt.Clauses["WHERE"] = c
+	}
+}
+
+// rowSecurityConditions 解析语句访问的受保护模型，并根据 context 中的认证信息生成策略条件
+func rowSecurityConditions(db *gorm.DB) (*schema.Schema, []clause.Expression, error) {
+	sch, policies, err := resolveRowPolicies(db)
+	if err != nil || len(policies) == 0 {
+		return nil, nil, err
+	}
+	claims, ok := ClaimsFromContext(db.Statement.Context)
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: no claims in context for %s", ErrRowAccessDenied, sch.Table)
+	}
+	exprs := make([]clause.Expression, 0, len(policies))
+	for _, policy := range policies {
+		expr, err := policy(claims)
+		if err != nil {
+			return nil, nil, err
+		}
+		if expr != nil {
+			exprs = append(exprs, expr)
+		}
+	}
+	return sch, exprs, nil
+}
+
+// resolveRowPolicies 先按模型类型查找策略，再按表名查找，db.Table("orders") 这类没有模型的语句同样受保护
+// 表名无法确定（别名、子查询）但表达式引用了受保护的表时拒绝访问
+func resolveRowPolicies(db *gorm.DB) (*schema.Schema, []RowPolicy, error) {
+	stmt := db.Statement
+	rowPoliciesMu.RLock()
+	defer rowPoliciesMu.RUnlock()
+
+	if len(rowPolicies) == 0 {
+		return nil, nil, nil
+	}
+	tables := protectedTables(db)
+	// 策略只附加到主表：JOIN、FROM 子句或子查询引用受保护的表时无法过滤，直接拒绝
+	if table := joinedProtectedTable(db, stmt, tables); table != "" {
+		return nil, nil, fmt.Errorf("%w: join or subquery on protected table %s", ErrRowAccessDenied, table)
+	}
+	if stmt.Schema != nil {
+		if policies := rowPolicies[stmt.Schema.ModelType]; len(policies) > 0 {
+			return stmt.Schema, policies, nil
+		}
+	}
+	if sch, ok := tables[strings.ToLower(stmt.Table)]; ok {
+		return sch, rowPolicies[sch.ModelType], nil
+	}
+	if stmt.TableExpr != nil {
+		if table := mentionedTable(stmt.TableExpr.SQL, tables); table != "" {
+			return nil, nil, fmt.Errorf("%w: table expression on protected table %s", ErrRowAccessDenied, table)
+		}
+	}
+	return nil, nil, nil
+}
+
+// joinedProtectedTable 返回语句在主表之外引用的受保护表：JOIN（关联名、SQL 与参数）、FROM 子句以及任意子句中作为参数传入的子查询
+func joinedProtectedTable(db *gorm.DB, stmt *gorm.Statement, tables map[string]*schema.Schema) string {
+	if len(tables) == 0 {
+		return ""
+	}
+	for _, join := range stmt.Joins {
+		if sch := joinedSchema(db, stmt, join.Name); sch != nil {
+			if _, ok := tables[strings.ToLower(sch.Table)]; ok {
+				return sch.Table
+			}
+		} else if table := joinedTable(join.Name, tables); table != "" {
+			return table
+		}
+		for _, v := range []interface{}{join.Conds, join.On, join.Expression} {
+			if table := referencedProtectedTable(db, v, tables, true); table != "" {
+				return table
+			}
+		}
+	}
+	for name, c := range stmt.Clauses {
+		if table := referencedProtectedTable(db, c.Expression, tables, name == "FROM"); table != "" {
+			return table
+		}
+	}
+	return ""
+}
+
+// joinedSchema 按关联名（可嵌套，如 "Customer.Address"）查找 JOIN 的模型，不是关联时返回 nil
+func joinedSchema(db *gorm.DB, stmt *gorm.Statement, name string) *schema.Schema {
+	sch := stmt.Schema
+	if sch == nil && stmt.Model != nil {
+		sch, _ = schema.Parse(stmt.Model, &rowPolicySchemas, db.NamingStrategy)
+	}
+	for _, part := range strings.Split(name, ".") {
+		if sch == nil {
+			return nil
+		}
+		rel, ok := sch.Relationships.Relations[part]
+		if !ok {
+			return nil
+		}
+		sch = rel.FieldSchema
+	}
+	return sch
+}
+
+// referencedProtectedTable 在表达式中查找子查询引用的受保护表，withSQL 为 true 时（FROM、JOIN）同时检查 SQL 文本与表名
+func referencedProtectedTable(db *gorm.DB, v interface{}, tables map[string]*schema.Schema, withSQL bool) string {
+	var values []interface{}
+	switch e := v.(type) {
+	case *gorm.DB:
+		if e == nil {
+			return ""
+		}
+		return subqueryProtectedTable(db, e.Statement, tables)
+	case *clause.Where:
+		if e == nil {
+			return ""
+		}
+		return referencedProtectedTable(db, *e, tables, withSQL)
+	case clause.Expr:
+		if withSQL {
+			if table := joinedTable(e.SQL, tables); table != "" {
+				return table
+			}
+		}
+		values = e.Vars
+	case clause.NamedExpr:
+		if withSQL {
+			if table := joinedTable(e.SQL, tables); table != "" {
+				return table
+			}
+		}
+		values = e.Vars
+	case clause.From:
+		for _, table := range e.Tables {
+			if table := joinedTable(table.Name, tables); table != "" {
+				return table
+			}
+		}
+		for _, join := range e.Joins {
+			values = append(values, join)
+		}
+	case clause.Join:
+		if withSQL {
+			if table := joinedTable(e.Table.Name, tables); table != "" {
+				return table
+			}
+		}
+		values = []interface{}{e.ON, e.Expression}
+	case clause.Where:
+		values = expressionValues(e.Exprs)
+	case clause.AndConditions:
+		values = expressionValues(e.Exprs)
+	case clause.OrConditions:
+		values = expressionValues(e.Exprs)
+	case clause.NotConditions:
+		values = expressionValues(e.Exprs)
+	case clause.Select:
+		values = []interface{}{e.Expression}
+	case clause.GroupBy:
+		values = expressionValues(e.Having)
+	case clause.Set:
+		for _, assignment := range e {
+			values = append(values, assignment.Value)
+		}
+	case clause.Eq:
+		values = []interface{}{e.Value}
+	case clause.Neq:
+		values = []interface{}{e.Value}
+	case clause.Gt:
+		values = []interface{}{e.Value}
+	case clause.Gte:
+		values = []interface{}{e.Value}
+	case clause.Lt:
+		values = []interface{}{e.Value}
+	case clause.Lte:
+		values = []interface{}{e.Value}
+	case clause.Like:
+		values = []interface{}{e.Value}
+	case clause.IN:
+		values = e.Values
+	case []interface{}:
+		values = e
+	}
+	for _, value := range values {
+		if table := referencedProtectedTable(db, value, tables, withSQL); table != "" {
+			return table
+		}
+	}
+	return ""
+}
+
+func expressionValues(exprs []clause.Expression) []interface{} {
+	values := make([]interface{}, 0, len(exprs))
+	for _, expr := range exprs {
+		values = append(values, expr)
+	}
+	return values
+}
+
+// subqueryProtectedTable 返回子查询访问的受保护表：模型、表名、表表达式、原生 SQL 及其中嵌套的 JOIN 与子查询
+func subqueryProtectedTable(db *gorm.DB, stmt *gorm.Statement, tables map[string]*schema.Schema) string {
+	sch := stmt.Schema
+	if sch == nil && stmt.Model != nil {
+		sch, _ = schema.Parse(stmt.Model, &rowPolicySchemas, db.NamingStrategy)
+	}
+	if sch != nil {
+		if _, ok := tables[strings.ToLower(sch.Table)]; ok {
+			return sch.Table
+		}
+	}
+	if table := mentionedTable(stmt.Table, tables); table != "" {
+		return table
+	}
+	if stmt.TableExpr != nil {
+		if table := mentionedTable(stmt.TableExpr.SQL, tables); table != "" {
+			return table
+		}
+	}
+	if table := mentionedTable(stmt.SQL.String(), tables); table != "" {
+		return table
+	}
+	return joinedProtectedTable(db, stmt, tables)
+}
+
+// rawProtectedTable 返回原生 SQL 涉及的受保护表，接收结果的模型受保护时同样视为涉及
+func rawProtectedTable(db *gorm.DB) string {
+	stmt := db.Statement
+	rowPoliciesMu.RLock()
+	defer rowPoliciesMu.RUnlock()
+
+	if len(rowPolicies) == 0 {
+		return ""
+	}
+	if stmt.Schema != nil && len(rowPolicies[stmt.Schema.ModelType]) > 0 {
+		return stmt.Schema.Table
+	}
+	return mentionedTable(stmt.SQL.String(), protectedTables(db))
+}
+
+// rowPolicySchemas 解析受保护模型表名的缓存
+var rowPolicySchemas sync.Map
+
+// protectedTables 返回受保护的表名（小写）到模型结构的映射，调用方需持有 rowPoliciesMu
+func protectedTables(db *gorm.DB) map[string]*schema.Schema {
+	tables := make(map[string]*schema.Schema, len(rowPolicies))
+	for t := range rowPolicies {
+		sch, err := schema.Parse(reflect.New(t).Interface(), &rowPolicySchemas, db.NamingStrategy)
+		if err != nil {
+			continue
+		}
+		tables[strings.ToLower(sch.Table)] = sch
+	}
+	return tables
+}
+
+// mentionedTable 按标识符切分 SQL，返回其中出现的第一个受保护表名
+func mentionedTable(sql string, tables map[string]*schema.Schema) string {
+	return scanTables(sql, tables, false)
+}
+
+// joinedTable 与 mentionedTable 相同，但忽略作为字段限定符出现的表名（如 ON 条件中的 orders.id）
+// 用于 JOIN、FROM 片段：其中引用主表字段是正常的，作为表出现时才需要拒绝
+func joinedTable(sql string, tables map[string]*schema.Schema) string {
+	return scanTables(sql, tables, true)
+}
+
+func scanTables(sql string, tables map[string]*schema.Schema, skipQualifiers bool) string {
+	if len(tables) == 0 {
+		return ""
+	}
+	isWord := func(r rune) bool {
+		return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+	}
+	runes := []rune(strings.ToLower(sql))
+	for i := 0; i < len(runes); {
+		if !isWord(runes[i]) {
+			i++
+			continue
+		}
+		start := i
+		for i < len(runes) && isWord(runes[i]) {
+			i++
+		}
+		sch, ok := tables[string(runes[start:i])]
+		if !ok {
+			continue
+		}
+		if skipQualifiers {
+			next := i
+			if next < len(runes) && (runes[next] == '"' || runes[next] == '`') {
+				next++
+			}
+			if next < len(runes) && runes[next] == '.' {
+				continue
+			}
+		}
+		return sch.Table
+	}
+	return ""
+}
+
+// policyColumns 从策略条件中提取字段：等值条件的字段固定为对应的值，其它可识别的条件字段不允许赋值
+// 无法识别的表达式返回 false
+func policyColumns(expr clause.Expression, pinned map[string]interface{}, locked map[string]bool) bool {
+	switch e := expr.(type) {
+	case clause.Eq:
+		if col, ok := e.Column.(clause.Column); ok {
+			pinned[col.Name] = e.Value
+			return true
+		}
+	case clause.Neq:
+		if col, ok := e.Column.(clause.Column); ok {
+			locked[col.Name] = true
+			return true
+		}
+	case clause.IN:
+		if col, ok := e.Column.(clause.Column); ok {
+			locked[col.Name] = true
+			return true
+		}
+	case clause.Where:
+		return policyColumnsAll(e.Exprs, pinned, locked)
+	case clause.AndConditions:
+		return policyColumnsAll(e.Exprs, pinned, locked)
+	case clause.OrConditions:
+		return policyColumnsAll(e.Exprs, pinned, locked)
+	}
+	return false
+}
+
+func policyColumnsAll(exprs []clause.Expression, pinned map[string]interface{}, locked map[string]bool) bool {
+	known := true
+	for _, expr := range exprs {
+		if !policyColumns(expr, pinned, locked) {
+			known = false
+		}
+	}
+	return known
+}
+
+// assignPolicyColumns 新增数据时按策略写入策略字段：为空时填入认证信息中的值，已有值不一致时拒绝
+// 策略不是等值条件时无法确定写入的值，拒绝新增
+func assignPolicyColumns(db *gorm.DB, sch *schema.Schema, exprs []clause.Expression) error {
+	pinned := make(map[string]interface{})
+	locked := make(map[string]bool)
+	if !policyColumnsAll(exprs, pinned, locked) || len(locked) > 0 {
+		return fmt.Errorf("%w: policy on %s cannot be applied to create", ErrRowAccessDenied, sch.Table)
+	}
+
+	stmt := db.Statement
+	rv := reflect.Indirect(stmt.ReflectValue)
+	records := []reflect.Value{rv}
+	if rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array {
+		records = records[:0]
+		for i := 0; i < rv.Len(); i++ {
+			records = append(records, reflect.Indirect(rv.Index(i)))
+		}
+	}
+	for _, record := range records {
+		for column, value := range pinned {
+			if err := assignPolicyColumn(stmt.Context, sch, record, column, value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// assignPolicyColumn 为一条记录（结构体或 map[string]interface{}）写入或校验一个策略字段
+func assignPolicyColumn(ctx context.Context, sch *schema.Schema, record reflect.Value, column string, value interface{}) error {
+	field := sch.LookUpField(column)
+	switch record.Kind() {
+	case reflect.Struct:
+		if field == nil || record.Type() != sch.ModelType {
+			return fmt.Errorf("%w: %s.%s cannot be assigned", ErrRowAccessDenied, sch.Table, column)
+		}
+		current, zero := field.ValueOf(ctx, record)
+		if zero {
+			return field.Set(ctx, record, value)
+		}
+		if fmt.Sprint(current) != fmt.Sprint(value) {
+			return fmt.Errorf("%w: %s.%s does not match claims", ErrRowAccessDenied, sch.Table, column)
+		}
+		return nil
+	case reflect.Map:
+		values, ok := record.Interface().(map[string]interface{})
+		if !ok {
+			break
+		}
+		found := false
+		for key, current := range values {
+			if key != column && (field == nil || key != field.Name) {
+				continue
+			}
+			found = true
+			if fmt.Sprint(current) != fmt.Sprint(value) {
+				return fmt.Errorf("%w: %s.%s does not match claims", ErrRowAccessDenied, sch.Table, column)
+			}
+		}
+		if !found {
+			values[column] = value
+		}
+		return nil
+	}
+	return fmt.Errorf("%w: unsupported create value for %s", ErrRowAccessDenied, sch.Table)
+}
+
+// checkPolicyAssignments 拒绝把策略字段更新为与认证信息不同的值，防止把数据移出自己的范围
+// 自定义策略返回无法识别的表达式时，其中的字段不做检查
+func checkPolicyAssignments(db *gorm.DB, sch *schema.Schema, exprs []clause.Expression) error {
+	pinned := make(map[string]interface{})
+	locked := make(map[string]bool)
+	policyColumnsAll(exprs, pinned, locked)
+	if len(pinned) == 0 && len(locked) == 0 {
+		return nil
+	}
+
+	check := func(column string, value interface{}) error {
+		if field := sch.LookUpField(column); field != nil {
+			column = field.DBName
+		}
+		want, isPinned := pinned[column]
+		if locked[column] || (isPinned && fmt.Sprint(value) != fmt.Sprint(want)) {
+			return fmt.Errorf("%w: cannot update policy column %s.%s", ErrRowAccessDenied, sch.Table, column)
+		}
+		return nil
+	}
+
+	stmt := db.Statement
+	if c, ok := stmt.Clauses["SET"]; ok {
+		if set, ok := c.Expression.(clause.Set); ok {
+			for _, assignment := range set {
+				if err := check(assignment.Column.Name, assignment.Value); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	if values, ok := stmt.Dest.(map[string]interface{}); ok {
+		for column, value := range values {
+			if err := check(column, value); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	// 结构体：与 GORM 一致，指定了 Select 时按选择的字段更新，否则只更新非零字段
+	dest := reflect.Indirect(reflect.ValueOf(stmt.Dest))
+	if dest.Kind() != reflect.Struct || stmt.Schema == nil {
+		return nil
+	}
+	selected, restricted := stmt.SelectAndOmitColumns(false, true)
+	columns := make([]string, 0, len(pinned)+len(locked))
+	for column := range pinned {
+		columns = append(columns, column)
+	}
+	for column := range locked {
+		columns = append(columns, column)
+	}
+	for _, column := range columns {
+		field := sch.LookUpField(column)
+		if field == nil {
+			continue
+		}
+		value := dest.FieldByName(field.Name)
+		if !value.IsValid() {
+			continue
+		}
+		use, ok := selected[field.DBName]
+		if (ok && !use) || (!ok && (restricted || value.IsZero())) {
+			continue
+		}
+		if err := check(column, value.Interface()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hasWriteCondition 判断更新/删除是否带有条件（显式条件、允许全局更新或模型主键）
+func hasWriteCondition(db *gorm.DB, sch *schema.Schema) bool {
+	stmt := db.Statement
+	if _, ok := stmt.Clauses["WHERE"]; ok || db.AllowGlobalUpdate {
+		return true
+	}
+	if stmt.Schema != sch || len(sch.PrimaryFields) == 0 || !stmt.ReflectValue.IsValid() {
+		return false
+	}
+	switch stmt.ReflectValue.Kind() {
+	case reflect.Struct, reflect.Slice, reflect.Array:
+		_, values := schema.GetIdentityFieldValuesMap(stmt.Context, stmt.ReflectValue, sch.PrimaryFields)
+		return len(values) > 0
+	}
+	return false
+}
+
+// parenthesized 把一组条件作为整体加括号输出
+type parenthesized struct {
+	where clause.Where
+}
+
+func (p parenthesized) Build(builder clause.Builder) {
+	builder.WriteByte('(')
+	p.where.Build(builder)
+	builder.WriteByte(')')
+}
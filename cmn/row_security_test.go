@@ -0,0 +1,289 @@
+package cmn
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type rlsTestOrder struct {
+	ID       int64  `json:"id" gorm:"primaryKey" query:"filter,sort"`
+	TenantId string `json:"tenantId" query:"filter"`
+	UserId   string `json:"userId" query:"filter"`
+	Amount   int64  `json:"amount" query:"filter"`
+}
+
+type rlsTestProduct struct {
+	ID   int64  `json:"id" gorm:"primaryKey"`
+	Name string `json:"name"`
+}
+
+type rlsTestOrderItem struct {
+	ID      int64        `json:"id" gorm:"primaryKey"`
+	OrderID int64        `json:"orderId"`
+	Order   rlsTestOrder `json:"order"`
+}
+
+// newRLSTestDB 啟用行級安全的 DryRun 數據庫，rlsTestOrder 按租戶隔離
+func newRLSTestDB(t *testing.T) *gorm.DB {
+	ClearRowPolicies()
+	t.Cleanup(ClearRowPolicies)
+	RegisterRowPolicy(&rlsTestOrder{}, TenantPolicy("tenant_id"))
+
+	db := newDryRunDB(t)
+	assert.NoError(t, EnableRowLevelSecurity(db))
+	return db
+}
+
+func tenantContext(tenantId string) context.Context {
+	return WithClaims(context.Background(), &Claims{UserId: "u1", TenantId: tenantId})
+}
+
+func TestRowLevelSecurity(t *testing.T) {
+	t.Run("查詢自動附加租戶條件", func(t *testing.T) {
+		db := newRLSTestDB(t)
+		var orders []rlsTestOrder
+		stmt := db.WithContext(tenantContext("t1")).Where("amount > ?", 100).Find(&orders).Statement
+
+		assert.NoError(t, stmt.Error)
+		assert.Equal(t, `SELECT * FROM "rls_test_orders" WHERE ("rls_test_orders"."tenant_id" = $1) AND (amount > $2)`, stmt.SQL.String())
+		assert.Equal(t, []interface{}{"t1", 100}, stmt.Vars)
+	})
+
+	t.Run("OR條件無法繞過租戶條件", func(t *testing.T) {
+		db := newRLSTestDB(t)
+		var orders []rlsTestOrder
+		stmt := db.WithContext(tenantContext("t1")).Or("tenant_id = ?", "t2").Find(&orders).Statement
+		assert.Equal(t, `SELECT * FROM "rls_test_orders" WHERE ("rls_test_orders"."tenant_id" = $1) AND (tenant_id = $2)`, stmt.SQL.String())
+
+		stmt = db.WithContext(tenantContext("t1")).Where("1 = 1 OR tenant_id = ?", "t2").Find(&orders).Statement
+		assert.Equal(t, `SELECT * FROM "rls_test_orders" WHERE ("rls_test_orders"."tenant_id" = $1) AND (1 = 1 OR tenant_id = $2)`, stmt.SQL.String())
+	})
+
+	t.Run("客戶端的filter與authFilter無法讀取其它租戶", func(t *testing.T) {
+		db := newRLSTestDB(t).WithContext(tenantContext("t1"))
+		req := &ReqProto{
+			Filter:     map[string]interface{}{"or": []interface{}{map[string]interface{}{"field": "tenantId", "value": "t2"}}},
+			AuthFilter: map[string]interface{}{"field": "tenantId", "value": "t2"},
+		}
+		builder, err := NewQueryBuilder(db, &rlsTestOrder{}, nil)
+		assert.NoError(t, err)
+		query, err := builder.Apply(db, req)
+		assert.NoError(t, err)
+
+		var orders []rlsTestOrder
+		stmt := query.Find(&orders).Statement
+		assert.Contains(t, stmt.SQL.String(), `WHERE ("rls_test_orders"."tenant_id" = $1) AND ("rls_test_orders"."tenant_id" = $2)`)
+		assert.Equal(t, "t1", stmt.Vars[0])
+
+		total, err := builder.Count(db, req)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(0), total)
+	})
+
+	t.Run("缺少認證信息時拒絕訪問", func(t *testing.T) {
+		db := newRLSTestDB(t)
+		var orders []rlsTestOrder
+
+		err := db.Find(&orders).Error
+		assert.True(t, errors.Is(err, ErrRowAccessDenied))
+
+		err = db.WithContext(WithClaims(context.Background(), &Claims{UserId: "u1"})).Find(&orders).Error
+		assert.True(t, errors.Is(err, ErrRowAccessDenied))
+	})
+
+	t.Run("未註冊策略的模型不受影響", func(t *testing.T) {
+		db := newRLSTestDB(t)
+		var products []rlsTestProduct
+		stmt := db.Find(&products).Statement
+		assert.NoError(t, stmt.Error)
+		assert.Equal(t, `SELECT * FROM "rls_test_products"`, stmt.SQL.String())
+	})
+
+	t.Run("系統任務可以跳過策略", func(t *testing.T) {
+		db := newRLSTestDB(t)
+		var orders []rlsTestOrder
+		stmt := db.WithContext(WithoutRowSecurity(context.Background())).Find(&orders).Statement
+		assert.NoError(t, stmt.Error)
+		assert.Equal(t, `SELECT * FROM "rls_test_orders"`, stmt.SQL.String())
+	})
+
+	t.Run("多個策略與更新刪除", func(t *testing.T) {
+		db := newRLSTestDB(t)
+		RegisterRowPolicy(&rlsTestOrder{}, OwnerPolicy("user_id"))
+		ctx := tenantContext("t1")
+		// 更新/刪除默認開啟事務需要連接數據庫，DryRun 下跳過
+		db = db.Session(&gorm.Session{SkipDefaultTransaction: true})
+
+		stmt := db.WithContext(ctx).Model(&rlsTestOrder{ID: 7}).Update("amount", 1).Statement
+		assert.NoError(t, stmt.Error)
+		assert.Contains(t, stmt.SQL.String(), `WHERE ("rls_test_orders"."tenant_id" = $2 AND "rls_test_orders"."user_id" = $3) AND "id" = $4`)
+
+		stmt = db.WithContext(ctx).Delete(&rlsTestOrder{ID: 7}).Statement
+		assert.NoError(t, stmt.Error)
+		assert.Contains(t, stmt.SQL.String(), `"rls_test_orders"."tenant_id" = $1 AND "rls_test_orders"."user_id" = $2`)
+
+		// 沒有條件的刪除仍然被拒絕，不會變成刪除整個租戶的數據
+		err := db.WithContext(ctx).Delete(&rlsTestOrder{}).Error
+		assert.True(t, errors.Is(err, gorm.ErrMissingWhereClause))
+	})
+
+	t.Run("新增時寫入並校驗策略字段", func(t *testing.T) {
+		db := newRLSTestDB(t).Session(&gorm.Session{SkipDefaultTransaction: true}).WithContext(tenantContext("t1"))
+
+		order := rlsTestOrder{Amount: 1}
+		stmt := db.Create(&order).Statement
+		if !assert.NoError(t, stmt.Error) {
+			return
+		}
+		assert.Equal(t, "t1", order.TenantId)
+		assert.Contains(t, stmt.Vars, "t1")
+
+		orders := []*rlsTestOrder{{Amount: 1}, {Amount: 2, TenantId: "t1"}}
+		assert.NoError(t, db.Create(&orders).Error)
+		assert.Equal(t, "t1", orders[0].TenantId)
+
+		values := map[string]interface{}{"amount": 3}
+		assert.NoError(t, db.Model(&rlsTestOrder{}).Create(values).Error)
+		assert.Equal(t, "t1", values["tenant_id"])
+
+		err := db.Create(&rlsTestOrder{Amount: 1, TenantId: "t2"}).Error
+		assert.True(t, errors.Is(err, ErrRowAccessDenied))
+
+		err = db.Model(&rlsTestOrder{}).Create(map[string]interface{}{"TenantId": "t2", "amount": 1}).Error
+		assert.True(t, errors.Is(err, ErrRowAccessDenied))
+
+		err = newRLSTestDB(t).Session(&gorm.Session{SkipDefaultTransaction: true}).Create(&rlsTestOrder{Amount: 1}).Error
+		assert.True(t, errors.Is(err, ErrRowAccessDenied))
+	})
+
+	t.Run("更新不能修改策略字段", func(t *testing.T) {
+		db := newRLSTestDB(t).Session(&gorm.Session{SkipDefaultTransaction: true}).WithContext(tenantContext("t1"))
+
+		cases := []*gorm.DB{
+			db.Model(&rlsTestOrder{ID: 7}).Update("tenant_id", "t2"),
+			db.Model(&rlsTestOrder{ID: 7}).Updates(map[string]interface{}{"TenantId": "t2"}),
+			db.Model(&rlsTestOrder{ID: 7}).Updates(rlsTestOrder{TenantId: "t2", Amount: 2}),
+			db.Save(&rlsTestOrder{ID: 7, Amount: 2}),
+		}
+		for i, tx := range cases {
+			assert.True(t, errors.Is(tx.Error, ErrRowAccessDenied), i)
+		}
+
+		// 沒有修改策略字段或賦值與認證信息一致時正常更新
+		assert.NoError(t, db.Model(&rlsTestOrder{ID: 7}).Updates(rlsTestOrder{Amount: 2}).Error)
+		assert.NoError(t, db.Save(&rlsTestOrder{ID: 7, TenantId: "t1", Amount: 2}).Error)
+	})
+
+	t.Run("按表名保護沒有模型的語句", func(t *testing.T) {
+		db := newRLSTestDB(t)
+		var rows []map[string]interface{}
+
+		stmt := db.WithContext(tenantContext("t1")).Table("rls_test_orders").Where("amount > ?", 1).Find(&rows).Statement
+		assert.NoError(t, stmt.Error)
+		assert.Equal(t, `SELECT * FROM "rls_test_orders" WHERE ("rls_test_orders"."tenant_id" = $1) AND (amount > $2)`, stmt.SQL.String())
+
+		err := db.Table("rls_test_orders").Find(&rows).Error
+		assert.True(t, errors.Is(err, ErrRowAccessDenied))
+
+		// 別名、子查詢無法可靠地附加條件，直接拒絕
+		err = db.WithContext(tenantContext("t1")).Table("rls_test_orders o").Find(&rows).Error
+		assert.True(t, errors.Is(err, ErrRowAccessDenied))
+
+		stmt = db.Table("rls_test_products").Find(&rows).Statement
+		assert.NoError(t, stmt.Error)
+	})
+
+	t.Run("JOIN與子查詢涉及受保護的表時拒絕", func(t *testing.T) {
+		db := newRLSTestDB(t).WithContext(tenantContext("t1"))
+		var orders []rlsTestOrder
+
+		// 從其它模型 JOIN 受保護的表讀取其它租戶的數據
+		err := db.Model(&rlsTestProduct{}).
+			Joins("JOIN rls_test_orders ON rls_test_orders.id = rls_test_products.id").
+			Select("rls_test_orders.*").Find(&orders).Error
+		assert.True(t, errors.Is(err, ErrRowAccessDenied))
+
+		// 主表自連接時別名上的行無法過濾
+		err = db.Joins("JOIN rls_test_orders o2 ON o2.id = rls_test_orders.id").Find(&orders).Error
+		assert.True(t, errors.Is(err, ErrRowAccessDenied))
+
+		var items []rlsTestOrderItem
+		err = db.Joins("Order").Find(&items).Error
+		assert.True(t, errors.Is(err, ErrRowAccessDenied))
+
+		// 子查詢作為 JOIN 或條件的參數
+		subquery := db.Session(&gorm.Session{NewDB: true}).Model(&rlsTestOrder{}).Select("id")
+		err = db.Model(&rlsTestProduct{}).Joins("JOIN (?) o ON o.id = rls_test_products.id", subquery).Find(&orders).Error
+		assert.True(t, errors.Is(err, ErrRowAccessDenied))
+
+		var products []rlsTestProduct
+		err = db.Where("id IN (?)", subquery).Find(&products).Error
+		assert.True(t, errors.Is(err, ErrRowAccessDenied))
+
+		err = db.Where(map[string]interface{}{"id": db.Session(&gorm.Session{NewDB: true}).Table("rls_test_orders").Select("id")}).Find(&products).Error
+		assert.True(t, errors.Is(err, ErrRowAccessDenied))
+
+		// FROM 子句
+		err = db.Model(&rlsTestProduct{}).Clauses(clause.From{Tables: []clause.Table{{Name: "rls_test_orders"}}}).Find(&orders).Error
+		assert.True(t, errors.Is(err, ErrRowAccessDenied))
+
+		// 不涉及受保護的表時不受影響
+		stmt := db.Joins("JOIN rls_test_products p ON p.id = rls_test_orders.id").Find(&orders).Statement
+		assert.NoError(t, stmt.Error)
+		assert.Contains(t, stmt.SQL.String(), `"rls_test_orders"."tenant_id" = $1`)
+		stmt = db.Where("id IN (?)", db.Session(&gorm.Session{NewDB: true}).Model(&rlsTestProduct{}).Select("id")).Find(&products).Statement
+		assert.NoError(t, stmt.Error)
+	})
+
+	t.Run("原生SQL涉及受保護的表時拒絕", func(t *testing.T) {
+		db := newRLSTestDB(t).WithContext(tenantContext("t1"))
+		var rows []map[string]interface{}
+
+		err := db.Raw(`SELECT * FROM "rls_test_orders" WHERE amount > ?`, 1).Scan(&rows).Error
+		assert.True(t, errors.Is(err, ErrRowAccessDenied))
+
+		// 結果模型受保護時，即使 SQL 中沒有表名也拒絕
+		var orders []rlsTestOrder
+		err = db.Raw("SELECT 1").Find(&orders).Error
+		assert.True(t, errors.Is(err, ErrRowAccessDenied))
+
+		err = db.Exec("UPDATE rls_test_orders SET amount = 0").Error
+		assert.True(t, errors.Is(err, ErrRowAccessDenied))
+
+		// DryRun 不支持 Rows，只確認沒有被行級安全拒絕
+		err = db.Raw("SELECT * FROM rls_test_products").Scan(&rows).Error
+		assert.False(t, errors.Is(err, ErrRowAccessDenied))
+		assert.NoError(t, db.WithContext(WithoutRowSecurity(context.Background())).Exec("UPDATE rls_test_orders SET amount = 0").Error)
+	})
+
+	t.Run("認證中間件把claims放入請求context", func(t *testing.T) {
+		gin.SetMode(gin.TestMode)
+		viper.Set("safe.jwtSecret", "test-secret")
+		token, err := GenerateTokenWithClaims(&Claims{UserId: "u1", Username: "tom", TenantId: "t1", DeptId: "d1"})
+		assert.NoError(t, err)
+
+		router := gin.New()
+		router.GET("/orders", AuthMiddleware(), func(c *gin.Context) {
+			claims, ok := ClaimsFromContext(c.Request.Context())
+			assert.True(t, ok)
+			assert.Equal(t, "t1", claims.TenantId)
+			assert.Equal(t, "d1", claims.DeptId)
+			c.Status(http.StatusOK)
+		})
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/orders", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+}
@@ -14,6 +14,8 @@ import (
 type Claims struct {
 	UserId   string `json:"user_id"`
 	Username string `json:"username"`
+	TenantId string `json:"tenant_id,omitempty"` // 租戶，用於行級安全策略
+	DeptId   string `json:"dept_id,omitempty"`   // 部門，用於行級安全策略
 	jwt.StandardClaims
 }
 
@@ -113,6 +115,24 @@ func GenerateToken(userId, username string) (string, error) {
 	return CreateToken(claims)
 }
 
+// GenerateTokenWithClaims 生成帶租戶、部門信息的 JWT token（24小時過期）
+func GenerateTokenWithClaims(c *Claims) (string, error) {
+	claims := jwt.MapClaims{
+		"user_id":  c.UserId,
+		"username": c.Username,
+		"exp":      time.Now().Add(24 * time.Hour).Unix(),
+		"iat":      time.Now().Unix(),
+		"iss":      "my_template",
+	}
+	if c.TenantId != "" {
+		claims["tenant_id"] = c.TenantId
+	}
+	if c.DeptId != "" {
+		claims["dept_id"] = c.DeptId
+	}
+	return CreateToken(claims)
+}
+
 // ParseToken 解析 JWT token
 func ParseToken(tokenString string) (*Claims, error) {
 	// 使用 VerifyToken 驗證並解析 token
@@ -146,6 +166,12 @@ func ParseToken(tokenString string) (*Claims, error) {
 	if username, ok := mapClaims["username"].(string); ok {
 		result.Username = username
 	}
+	if tenantId, ok := mapClaims["tenant_id"].(string); ok {
+		result.TenantId = tenantId
+	}
+	if deptId, ok := mapClaims["dept_id"].(string); ok {
+		result.DeptId = deptId
+	}
 	if exp, ok := mapClaims["exp"].(float64); ok {
 		result.ExpiresAt = int64(exp)
 	}
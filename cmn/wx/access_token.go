@@ -0,0 +1,369 @@
+package wx
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	neturl "net/url"
+	"sync"
+	"time"
+
+	"my_template/cmn"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+	"golang.org/x/sync/singleflight"
+)
+
+// DefaultTokenURL 微信获取 access_token 的接口地址
+const DefaultTokenURL = "https://api.weixin.qq.com/cgi-bin/token"
+
+const (
+	tokenKeyPrefix     = "wx:access_token:"
+	tokenRefreshBefore = 5 * time.Minute // 剩余有效期少于该值时刷新，刷新后旧 token 在 5 分钟内仍然可用
+	tokenLockTTL       = 10 * time.Second
+	tokenPollInterval  = 50 * time.Millisecond
+)
+
+// TokenStore access_token 与刷新锁的共享存储，多副本部署时使用 RedisTokenStore
+type TokenStore interface {
+	// Get 返回值与剩余有效期，不存在时返回空字符串
+	Get(ctx context.Context, key string) (string, time.Duration, error)
+	// Set 保存值并设置有效期
+	Set(ctx context.Context, key, value string, ttl time.Duration) error
+	// SetNX 键不存在时保存，返回是否保存成功（用作刷新锁）
+	SetNX(ctx context.Context, key, value string, ttl time.Duration) (bool, error)
+	// CompareAndDelete 值等于 value 时删除，返回是否删除
+	CompareAndDelete(ctx context.Context, key, value string) (bool, error)
+}
+
+// RedisTokenStore 基于 Redis 的 access_token 存储
+type RedisTokenStore struct {
+	client *redis.Client
+}
+
+// NewRedisTokenStore 创建 Redis access_token 存储
+func NewRedisTokenStore(client *redis.Client) *RedisTokenStore {
+	return &RedisTokenStore{client: client}
+}
+
+// Get 返回值与剩余有效期
+func (s *RedisTokenStore) Get(ctx context.Context, key string) (string, time.Duration, error) {
+	var get *redis.StringCmd
+	var pttl *redis.DurationCmd
+	_, err := s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		get = pipe.Get(ctx, key)
+		pttl = pipe.PTTL(ctx, key)
+		return nil
+	})
+	if errors.Is(err, redis.Nil) {
+		return "", 0, nil
+	}
+	if err != nil {
+		return "", 0, err
+	}
+	return get.Val(), max(pttl.Val(), 0), nil
+}
+
+// Set 保存值并设置有效期
+func (s *RedisTokenStore) Set(ctx context.Context, key, value string, ttl time.Duration) error {
+	return s.client.Set(ctx, key, value, ttl).Err()
+}
+
+// SetNX 键不存在时保存
+func (s *RedisTokenStore) SetNX(ctx context.Context, key, value string, ttl time.Duration) (bool, error) {
+	return s.client.SetNX(ctx, key, value, ttl).Result()
+}
+
+// compareAndDelete 值相等时删除，保证只删除自己设置的值
+var compareAndDelete = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+
+// CompareAndDelete 值等于 value 时删除
+func (s *RedisTokenStore) CompareAndDelete(ctx context.Context, key, value string) (bool, error) {
+	n, err := compareAndDelete.Run(ctx, s.client, []string{key}, value).Int()
+	return n > 0, err
+}
+
+// MemoryTokenStore 基于内存的 access_token 存储，仅适用于单实例或测试
+type MemoryTokenStore struct {
+	mu      sync.Mutex
+	entries map[string]memoryTokenEntry
+}
+
+type memoryTokenEntry struct {
+	value     string
+	expiresAt time.Time
+}
+
+// NewMemoryTokenStore 创建内存 access_token 存储
+func NewMemoryTokenStore() *MemoryTokenStore {
+	return &MemoryTokenStore{entries: make(map[string]memoryTokenEntry)}
+}
+
+// get 获取未过期的条目，调用方需持有锁
+func (s *MemoryTokenStore) get(key string, now time.Time) (memoryTokenEntry, bool) {
+	e, ok := s.entries[key]
+	if ok && !now.Before(e.expiresAt) {
+		delete(s.entries, key)
+		return memoryTokenEntry{}, false
+	}
+	return e, ok
+}
+
+// Get 返回值与剩余有效期
+func (s *MemoryTokenStore) Get(_ context.Context, key string) (string, time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if e, ok := s.get(key, now); ok {
+		return e.value, e.expiresAt.Sub(now), nil
+	}
+	return "", 0, nil
+}
+
+// Set 保存值并设置有效期
+func (s *MemoryTokenStore) Set(_ context.Context, key, value string, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.entries[key] = memoryTokenEntry{value: value, expiresAt: time.Now().Add(ttl)}
+	return nil
+}
+
+// SetNX 键不存在时保存
+func (s *MemoryTokenStore) SetNX(_ context.Context, key, value string, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if _, ok := s.get(key, now); ok {
+		return false, nil
+	}
+	s.entries[key] = memoryTokenEntry{value: value, expiresAt: now.Add(ttl)}
+	return true, nil
+}
+
+// CompareAndDelete 值等于 value 时删除
+func (s *MemoryTokenStore) CompareAndDelete(_ context.Context, key, value string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e, ok := s.get(key, time.Now()); ok && e.value == value {
+		delete(s.entries, key)
+		return true, nil
+	}
+	return false, nil
+}
+
+// AccessTokenManager 微信 access_token 管理：保存在共享存储中供所有副本使用，
+// 快过期时只由一个副本刷新（进程内 singleflight + 存储中的刷新锁），其它副本继续使用旧 token 或等待刷新完成
+//
+//	tokens, err := wx.NewAccessTokenManager(wx.ConfigFromViper(), wx.NewRedisTokenStore(db.GetRedis()), nil)
+//	client := cmn.NewHttpClient(&cmn.HttpClientConfig{
+//		Interceptors: []cmn.HttpInterceptor{tokens.Interceptor()}, // 自动附加 access_token，失效时刷新并重试一次
+//	})
+type AccessTokenManager struct {
+	config Config
+	store  TokenStore
+	client *cmn.HttpClient
+	group  singleflight.Group
+}
+
+// NewAccessTokenManager 创建 access_token 管理器，httpClient 为空时使用 5s 超时的客户端
+func NewAccessTokenManager(config *Config, store TokenStore, httpClient *cmn.HttpClient) (*AccessTokenManager, error) {
+	if config == nil || config.AppID == "" || config.Secret == "" {
+		return nil, errors.New("wx: appId 与 secret 不能为空")
+	}
+	if store == nil {
+		return nil, errors.New("wx: TokenStore 不能为空")
+	}
+	m := &AccessTokenManager{config: *config, store: store, client: httpClient}
+	if m.config.TokenURL == "" {
+		m.config.TokenURL = DefaultTokenURL
+	}
+	if m.client == nil {
+		m.client = cmn.NewHttpClient(&cmn.HttpClientConfig{Timeout: 5 * time.Second})
+	}
+	return m, nil
+}
+
+func (m *AccessTokenManager) key() string {
+	return tokenKeyPrefix + m.config.AppID
+}
+
+// Token 返回有效的 access_token，快过期或已失效时刷新
+func (m *AccessTokenManager) Token(ctx context.Context) (string, error) {
+	token, ttl, err := m.store.Get(ctx, m.key())
+	if err != nil {
+		return "", err
+	}
+	if token != "" && ttl > tokenRefreshBefore {
+		return token, nil
+	}
+
+	// 同一进程内只有一个请求刷新，刷新不受单个调用方取消的影响
+	result := m.group.DoChan("refresh", func() (interface{}, error) {
+		refreshCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 2*tokenLockTTL)
+		defer cancel()
+		return m.refresh(refreshCtx)
+	})
+	select {
+	case <-ctx.Done():
+		return "", ctx.Err()
+	case r := <-result:
+		if r.Err != nil {
+			return "", r.Err
+		}
+		return r.Val.(string), nil
+	}
+}
+
+// refresh 获取刷新锁后请求微信；其它副本正在刷新时，旧 token 仍有效则直接使用，否则等待刷新完成
+func (m *AccessTokenManager) refresh(ctx context.Context) (string, error) {
+	lockKey := m.key() + ":lock"
+	for {
+		token, ttl, err := m.store.Get(ctx, m.key())
+		if err != nil {
+			return "", err
+		}
+		if token != "" && ttl > tokenRefreshBefore {
+			return token, nil
+		}
+
+		lockValue := newLockValue()
+		acquired, err := m.store.SetNX(ctx, lockKey, lockValue, tokenLockTTL)
+		if err != nil {
+			return "", err
+		}
+		if acquired {
+			defer func() {
+				_, _ = m.store.CompareAndDelete(context.WithoutCancel(ctx), lockKey, lockValue)
+			}()
+			return m.fetch(ctx)
+		}
+		if token != "" {
+			return token, nil
+		}
+
+		timer := time.NewTimer(tokenPollInterval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return "", ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// fetch 请求微信获取新的 access_token 并保存
+func (m *AccessTokenManager) fetch(ctx context.Context) (string, error) {
+	resp, err := m.client.Get(ctx, m.config.TokenURL, neturl.Values{
+		"grant_type": {"client_credential"},
+		"appid":      {m.config.AppID},
+		"secret":     {m.config.Secret},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	var result struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+		APIError
+	}
+	if err := json.Unmarshal(resp.Body, &result); err != nil {
+		return "", cmn.WrapError(CodeWxError, err).WithDetail("errcode", 0)
+	}
+	if result.ErrCode != 0 {
+		appErr := newAPIError(result.ErrCode, result.ErrMsg)
+		cmn.Logger().Log(appErr.LogLevel(), "获取微信 access_token 失败", zap.Int("errcode", result.ErrCode), zap.String("errmsg", result.ErrMsg))
+		return "", appErr
+	}
+	if result.AccessToken == "" || result.ExpiresIn <= 0 {
+		return "", cmn.NewAppError(CodeWxError, "微信未返回 access_token").WithDetail("errcode", 0)
+	}
+
+	expiresIn := time.Duration(result.ExpiresIn) * time.Second
+	if err := m.store.Set(ctx, m.key(), result.AccessToken, expiresIn); err != nil {
+		return "", err
+	}
+	cmn.Logger().Info("已刷新微信 access_token", zap.String("appid", m.config.AppID), zap.Duration("expires_in", expiresIn))
+	return result.AccessToken, nil
+}
+
+// Invalidate 微信返回 access_token 无效时调用，只有存储中仍是该 token 时才删除（避免删除其它副本刚刷新的 token）
+func (m *AccessTokenManager) Invalidate(ctx context.Context, token string) error {
+	_, err := m.store.CompareAndDelete(ctx, m.key(), token)
+	return err
+}
+
+// invalidTokenCodes 表示 access_token 无效或过期的微信错误码
+var invalidTokenCodes = map[int]bool{
+	40001: true, // access_token 无效或不是最新的
+	40014: true, // 不合法的 access_token
+	42001: true, // access_token 超时
+}
+
+// Interceptor 返回出站请求拦截器：在 URL 中附加 access_token，微信返回 token 无效时刷新并重试一次
+func (m *AccessTokenManager) Interceptor() cmn.HttpInterceptor {
+	return cmn.HttpInterceptor{
+		Name:     "wx_access_token",
+		Priority: cmn.PriorityHttpAuth,
+		Handle: func(ctx context.Context, req *cmn.HttpRequest, next cmn.HttpHandler) (*cmn.HttpResponse, error) {
+			for attempt := 1; ; attempt++ {
+				token, err := m.Token(ctx)
+				if err != nil {
+					return nil, err
+				}
+				r := *req
+				if r.URL, err = withAccessToken(req.URL, token); err != nil {
+					return nil, err
+				}
+				resp, err := next(ctx, &r)
+				if err != nil || attempt > 1 || !invalidTokenCodes[responseErrCode(resp)] {
+					return resp, err
+				}
+				cmn.Logger().Warn("微信 access_token 已失效，刷新后重试", zap.Int("errcode", responseErrCode(resp)))
+				if err := m.Invalidate(ctx, token); err != nil {
+					return resp, err
+				}
+			}
+		},
+	}
+}
+
+// withAccessToken 设置 URL 中的 access_token 参数
+func withAccessToken(rawURL, token string) (string, error) {
+	u, err := neturl.Parse(rawURL)
+	if err != nil {
+		return "", cmn.NewAppError(cmn.CommonError, "invalid url: "+err.Error())
+	}
+	query := u.Query()
+	query.Set("access_token", token)
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+// responseErrCode 返回响应体中的微信错误码，不是 JSON 或没有 errcode 时为 0
+func responseErrCode(resp *cmn.HttpResponse) int {
+	if resp == nil || len(resp.Body) == 0 {
+		return 0
+	}
+	var result APIError
+	_ = json.Unmarshal(resp.Body, &result)
+	return result.ErrCode
+}
+
+// newLockValue 生成刷新锁的随机值
+func newLockValue() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,156 @@
+package wx
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"my_template/cmn"
+	"my_template/cmn/wx/wxtest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestTokenManager 返回連接本地模擬微信服務器的 access_token 管理器
+func newTestTokenManager(t *testing.T, server *wxtest.Server, store TokenStore) *AccessTokenManager {
+	m, err := NewAccessTokenManager(&Config{
+		TokenURL: server.TokenURL(),
+		AppID:    "wx-app",
+		Secret:   "wx-secret",
+	}, store, nil)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	return m
+}
+
+func TestAccessTokenManager(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("token 有效期內使用緩存", func(t *testing.T) {
+		server := wxtest.NewServer("wx-app", "wx-secret")
+		defer server.Close()
+		m := newTestTokenManager(t, server, NewMemoryTokenStore())
+
+		first, err := m.Token(ctx)
+		assert.NoError(t, err)
+		second, err := m.Token(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, "token-1", first)
+		assert.Equal(t, first, second)
+		assert.Equal(t, 1, server.TokenRequests())
+	})
+
+	t.Run("剩餘有效期不足時刷新", func(t *testing.T) {
+		server := wxtest.NewServer("wx-app", "wx-secret")
+		defer server.Close()
+		server.SetTokenExpiry(4 * time.Minute)
+		m := newTestTokenManager(t, server, NewMemoryTokenStore())
+
+		first, _ := m.Token(ctx)
+		second, err := m.Token(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, "token-1", first)
+		assert.Equal(t, "token-2", second)
+	})
+
+	t.Run("多個副本並發獲取時只請求一次微信", func(t *testing.T) {
+		server := wxtest.NewServer("wx-app", "wx-secret")
+		defer server.Close()
+		server.SetTokenDelay(100 * time.Millisecond)
+		store := NewMemoryTokenStore()
+		replicas := []*AccessTokenManager{newTestTokenManager(t, server, store), newTestTokenManager(t, server, store)}
+
+		var wg sync.WaitGroup
+		tokens := make([]string, 20)
+		for i := range tokens {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				token, err := replicas[i%2].Token(ctx)
+				assert.NoError(t, err)
+				tokens[i] = token
+			}()
+		}
+		wg.Wait()
+
+		assert.Equal(t, 1, server.TokenRequests())
+		for _, token := range tokens {
+			assert.Equal(t, "token-1", token)
+		}
+	})
+
+	t.Run("Invalidate 只刪除仍是該值的 token", func(t *testing.T) {
+		server := wxtest.NewServer("wx-app", "wx-secret")
+		defer server.Close()
+		m := newTestTokenManager(t, server, NewMemoryTokenStore())
+
+		old, _ := m.Token(ctx)
+		assert.NoError(t, m.Invalidate(ctx, old))
+		fresh, _ := m.Token(ctx)
+		assert.Equal(t, "token-2", fresh)
+
+		// 其它副本已刷新，用舊 token 失效不影響新 token
+		assert.NoError(t, m.Invalidate(ctx, old))
+		current, _ := m.Token(ctx)
+		assert.Equal(t, fresh, current)
+		assert.Equal(t, 2, server.TokenRequests())
+	})
+
+	t.Run("微信返回錯誤時轉換為 AppError 並釋放刷新鎖", func(t *testing.T) {
+		server := wxtest.NewServer("wx-app", "wx-secret")
+		defer server.Close()
+		m := newTestTokenManager(t, server, NewMemoryTokenStore())
+		m.config.Secret = "wrong"
+
+		_, err := m.Token(ctx)
+		assert.Equal(t, CodeWxMisconfigured, cmn.ErrorCodeOf(err))
+
+		m.config.Secret = "wx-secret"
+		token, err := m.Token(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, "token-2", token)
+	})
+
+	t.Run("配置校驗", func(t *testing.T) {
+		_, err := NewAccessTokenManager(&Config{AppID: "a"}, NewMemoryTokenStore(), nil)
+		assert.Error(t, err)
+		_, err = NewAccessTokenManager(&Config{AppID: "a", Secret: "s"}, nil, nil)
+		assert.Error(t, err)
+	})
+}
+
+func TestAccessTokenInterceptor(t *testing.T) {
+	ctx := context.Background()
+	server := wxtest.NewServer("wx-app", "wx-secret")
+	defer server.Close()
+	m := newTestTokenManager(t, server, NewMemoryTokenStore())
+	client := cmn.NewHttpClient(&cmn.HttpClientConfig{
+		Timeout:      5 * time.Second,
+		Interceptors: []cmn.HttpInterceptor{m.Interceptor()},
+	})
+
+	t.Run("自動附加 access_token", func(t *testing.T) {
+		resp, err := client.Get(ctx, server.APIURL("getwxacode"), nil)
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Equal(t, 0, responseErrCode(resp))
+		assert.Equal(t, 1, server.TokenRequests())
+	})
+
+	t.Run("token 過期時刷新並重試一次", func(t *testing.T) {
+		server.ExpireTokens()
+
+		resp, err := client.Get(ctx, server.APIURL("getwxacode"), nil)
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Equal(t, 0, responseErrCode(resp))
+		assert.Equal(t, 2, server.TokenRequests())
+
+		token, _ := m.Token(ctx)
+		assert.Equal(t, "token-2", token)
+	})
+}
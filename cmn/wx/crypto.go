@@ -0,0 +1,115 @@
+package wx
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"my_template/cmn"
+
+	"go.uber.org/zap"
+)
+
+// Watermark 开放数据的水印，appid 必须与小程序一致
+type Watermark struct {
+	AppID     string `json:"appid"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+// PhoneInfo wx.getPhoneNumber 的解密结果
+type PhoneInfo struct {
+	PhoneNumber     string    `json:"phoneNumber"`     // 带区号的手机号（境外手机号）
+	PurePhoneNumber string    `json:"purePhoneNumber"` // 不带区号的手机号
+	CountryCode     string    `json:"countryCode"`
+	Watermark       Watermark `json:"watermark"`
+}
+
+// UserInfo wx.getUserInfo 的解密结果
+type UserInfo struct {
+	OpenID    string    `json:"openId"`
+	UnionID   string    `json:"unionId,omitempty"`
+	NickName  string    `json:"nickName"`
+	Gender    int       `json:"gender"`
+	City      string    `json:"city"`
+	Province  string    `json:"province"`
+	Country   string    `json:"country"`
+	AvatarURL string    `json:"avatarUrl"`
+	Language  string    `json:"language"`
+	Watermark Watermark `json:"watermark"`
+}
+
+// DecryptData 解密开放数据（AES-128-CBC，密钥为 session_key，三个参数均为 base64），校验水印 appid 后解码到 v
+// 失败时返回 CodeWxDecryptFailed：session_key 已过期（用户重新登录过）或数据被篡改
+func DecryptData(sessionKey, encryptedData, iv, appID string, v interface{}) error {
+	plainText, err := decryptData(sessionKey, encryptedData, iv)
+	if err != nil {
+		return cmn.WrapError(CodeWxDecryptFailed, err)
+	}
+
+	var payload struct {
+		Watermark Watermark `json:"watermark"`
+	}
+	if err := json.Unmarshal(plainText, &payload); err != nil {
+		return cmn.WrapError(CodeWxDecryptFailed, err)
+	}
+	if payload.Watermark.AppID != appID {
+		cmn.Logger().Warn("微信开放数据水印不匹配", zap.String("appid", payload.Watermark.AppID), zap.String("expected", appID))
+		return cmn.WrapError(CodeWxDecryptFailed, fmt.Errorf("watermark appid %q does not match", payload.Watermark.AppID))
+	}
+	if err := json.Unmarshal(plainText, v); err != nil {
+		return cmn.WrapError(CodeWxDecryptFailed, err)
+	}
+	return nil
+}
+
+// decryptData 解码 base64 参数并解密
+func decryptData(sessionKey, encryptedData, iv string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(sessionKey)
+	if err != nil {
+		return nil, fmt.Errorf("decode session_key: %w", err)
+	}
+	if len(key) != 16 {
+		return nil, errors.New("invalid session_key size")
+	}
+	cipherText, err := base64.StdEncoding.DecodeString(encryptedData)
+	if err != nil {
+		return nil, fmt.Errorf("decode encryptedData: %w", err)
+	}
+	ivBytes, err := base64.StdEncoding.DecodeString(iv)
+	if err != nil {
+		return nil, fmt.Errorf("decode iv: %w", err)
+	}
+	return cmn.DecryptAESCBC(cipherText, key, ivBytes)
+}
+
+// Decrypt 使用用户保存的 session_key 解密开放数据到 v 并校验水印
+func (m *MiniProgram) Decrypt(ctx context.Context, userID uint, encryptedData, iv string, v interface{}) error {
+	sessionKey, err := m.SessionKey(ctx, userID)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			return cmn.WrapError(cmn.CodeNotFound, err)
+		}
+		return cmn.WrapError(CodeWxDecryptFailed, err)
+	}
+	return DecryptData(sessionKey, encryptedData, iv, m.config.AppID, v)
+}
+
+// DecryptPhone 解密 wx.getPhoneNumber 返回的手机号
+func (m *MiniProgram) DecryptPhone(ctx context.Context, userID uint, encryptedData, iv string) (*PhoneInfo, error) {
+	var info PhoneInfo
+	if err := m.Decrypt(ctx, userID, encryptedData, iv, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// DecryptUserInfo 解密 wx.getUserInfo 返回的用户信息
+func (m *MiniProgram) DecryptUserInfo(ctx context.Context, userID uint, encryptedData, iv string) (*UserInfo, error) {
+	var info UserInfo
+	if err := m.Decrypt(ctx, userID, encryptedData, iv, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
@@ -0,0 +1,76 @@
+package wx
+
+import (
+	"context"
+	"encoding/base64"
+	"testing"
+
+	"my_template/cmn"
+	"my_template/cmn/wx/wxtest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecryptData(t *testing.T) {
+	sessionKey := base64.StdEncoding.EncodeToString([]byte("0123456789abcdef"))
+
+	t.Run("解密手機號並校驗水印", func(t *testing.T) {
+		data, iv := wxtest.EncryptData(sessionKey, "wx-app", map[string]interface{}{
+			"phoneNumber": "13800138000", "purePhoneNumber": "13800138000", "countryCode": "86",
+		})
+
+		var info PhoneInfo
+		if !assert.NoError(t, DecryptData(sessionKey, data, iv, "wx-app", &info)) {
+			return
+		}
+		assert.Equal(t, "13800138000", info.PurePhoneNumber)
+		assert.Equal(t, "86", info.CountryCode)
+		assert.Equal(t, "wx-app", info.Watermark.AppID)
+	})
+
+	t.Run("水印 appid 不匹配時失敗", func(t *testing.T) {
+		data, iv := wxtest.EncryptData(sessionKey, "other-app", map[string]interface{}{"phoneNumber": "13800138000"})
+
+		var info PhoneInfo
+		err := DecryptData(sessionKey, data, iv, "wx-app", &info)
+		assert.Equal(t, CodeWxDecryptFailed, cmn.ErrorCodeOf(err))
+	})
+
+	t.Run("session_key 錯誤或數據無效時失敗", func(t *testing.T) {
+		data, iv := wxtest.EncryptData(sessionKey, "wx-app", map[string]interface{}{"phoneNumber": "13800138000"})
+		otherKey := base64.StdEncoding.EncodeToString([]byte("fedcba9876543210"))
+
+		var info PhoneInfo
+		assert.Equal(t, CodeWxDecryptFailed, cmn.ErrorCodeOf(DecryptData(otherKey, data, iv, "wx-app", &info)))
+		assert.Equal(t, CodeWxDecryptFailed, cmn.ErrorCodeOf(DecryptData("short", data, iv, "wx-app", &info)))
+		assert.Equal(t, CodeWxDecryptFailed, cmn.ErrorCodeOf(DecryptData(sessionKey, "bm90LWJsb2Nr", iv, "wx-app", &info)))
+	})
+}
+
+func TestMiniProgramDecrypt(t *testing.T) {
+	ctx := context.Background()
+	mp, server, _ := newTestMiniProgram(t)
+	sessionKey := base64.StdEncoding.EncodeToString([]byte("0123456789abcdef"))
+	server.AddCode("c1", "o1", "", sessionKey)
+	result, err := mp.Login(ctx, "c1")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	t.Run("使用保存的 session_key 解密用戶信息", func(t *testing.T) {
+		data, iv := wxtest.EncryptData(sessionKey, "wx-app", map[string]interface{}{"openId": "o1", "nickName": "小明"})
+
+		info, err := mp.DecryptUserInfo(ctx, result.UserID, data, iv)
+		if assert.NoError(t, err) {
+			assert.Equal(t, "o1", info.OpenID)
+			assert.Equal(t, "小明", info.NickName)
+		}
+	})
+
+	t.Run("用戶不存在返回 404", func(t *testing.T) {
+		data, iv := wxtest.EncryptData(sessionKey, "wx-app", map[string]interface{}{"phoneNumber": "13800138000"})
+
+		_, err := mp.DecryptPhone(ctx, result.UserID+1, data, iv)
+		assert.Equal(t, cmn.CodeNotFound, cmn.ErrorCodeOf(err))
+	})
+}
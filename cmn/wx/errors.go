@@ -0,0 +1,80 @@
+package wx
+
+import (
+	"fmt"
+	"net/http"
+
+	"my_template/cmn"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// 微信接口错误码（框架内置范围 1100-1199），Details 中的 errcode 为微信返回的错误码
+const (
+	CodeWxError         = 1100 // 其它微信接口错误
+	CodeWxInvalidCode   = 1101 // 登录凭证 code 无效、已使用或为空，需要重新调用 wx.login
+	CodeWxRateLimited   = 1102 // 调用频率超限，可稍后重试
+	CodeWxUserBlocked   = 1103 // 高风险用户，微信拦截了登录
+	CodeWxMisconfigured = 1104 // appid、secret 无效或未配置，或服务器 IP 不在白名单
+	CodeWxBusy          = 1105 // 微信系统繁忙，可稍后重试
+	CodeWxDecryptFailed = 1106 // 开放数据解密或水印校验失败，session_key 可能已过期，需要重新登录
+)
+
+func init() {
+	defs := []cmn.ErrorDef{
+		{Code: CodeWxError, HTTPStatus: http.StatusBadGateway, Level: zapcore.ErrorLevel,
+			Messages: map[string]string{"zh": "微信接口错误（{errcode}）", "en": "WeChat API error ({errcode})"}},
+		{Code: CodeWxInvalidCode, HTTPStatus: http.StatusBadRequest, Level: zapcore.InfoLevel,
+			Messages: map[string]string{"zh": "微信登录凭证无效或已使用，请重新登录", "en": "WeChat login code is invalid or already used, please log in again"}},
+		{Code: CodeWxRateLimited, HTTPStatus: http.StatusTooManyRequests, Level: zapcore.WarnLevel, Retryable: true,
+			Messages: map[string]string{"zh": "微信接口调用过于频繁，请稍后再试", "en": "Too many WeChat API calls, please try again later"}},
+		{Code: CodeWxUserBlocked, HTTPStatus: http.StatusForbidden, Level: zapcore.WarnLevel,
+			Messages: map[string]string{"zh": "微信账号存在风险，登录已被拦截", "en": "WeChat account is at risk, login was blocked"}},
+		{Code: CodeWxMisconfigured, HTTPStatus: http.StatusInternalServerError, Level: zapcore.ErrorLevel,
+			Messages: map[string]string{"zh": "微信接口配置错误", "en": "WeChat API is misconfigured"}},
+		{Code: CodeWxBusy, HTTPStatus: http.StatusServiceUnavailable, Level: zapcore.WarnLevel, Retryable: true,
+			Messages: map[string]string{"zh": "微信服务繁忙，请稍后再试", "en": "WeChat is busy, please try again later"}},
+		{Code: CodeWxDecryptFailed, HTTPStatus: http.StatusBadRequest, Level: zapcore.WarnLevel,
+			Messages: map[string]string{"zh": "微信数据解密失败，请重新登录后再试", "en": "Failed to decrypt WeChat data, please log in again"}},
+	}
+	for _, def := range defs {
+		cmn.DefineError(def)
+	}
+}
+
+// APIError 微信接口返回的错误（errcode 不为 0），作为 AppError 的 Cause
+type APIError struct {
+	ErrCode int    `json:"errcode"`
+	ErrMsg  string `json:"errmsg"`
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("wechat errcode %d: %s", e.ErrCode, e.ErrMsg)
+}
+
+// errcodes 微信错误码与 AppError 错误码的对应关系，未列出的为 CodeWxError
+var errcodes = map[int]int{
+	-1:    CodeWxBusy,          // 系统繁忙
+	40029: CodeWxInvalidCode,   // code 无效
+	40163: CodeWxInvalidCode,   // code 已被使用
+	41008: CodeWxInvalidCode,   // 缺少 code
+	45011: CodeWxRateLimited,   // 频率限制，每个用户每分钟 100 次
+	45009: CodeWxRateLimited,   // 接口调用超过每日限额
+	40226: CodeWxUserBlocked,   // 高风险等级用户，小程序登录拦截
+	40013: CodeWxMisconfigured, // appid 无效
+	40125: CodeWxMisconfigured, // secret 无效
+	41002: CodeWxMisconfigured, // 缺少 appid
+	41004: CodeWxMisconfigured, // 缺少 secret
+	40164: CodeWxMisconfigured, // 调用 IP 不在白名单
+}
+
+// newAPIError 把微信错误码转换为 AppError
+func newAPIError(errcode int, errmsg string) *cmn.AppError {
+	code, ok := errcodes[errcode]
+	if !ok {
+		code = CodeWxError
+	}
+	return cmn.NewCodeError(code).
+		WithDetail("errcode", errcode).
+		WithCause(&APIError{ErrCode: errcode, ErrMsg: errmsg})
+}
@@ -0,0 +1,193 @@
+// Package wx 微信小程序登录：用 wx.login 的 code 换取 openid/unionid/session_key，
+// 保存用户并签发 token
+package wx
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	neturl "net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"my_template/cmn"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// DefaultLoginURL 微信 code2Session 接口地址
+const DefaultLoginURL = "https://api.weixin.qq.com/sns/jscode2session"
+
+// SessionKeySecretEnv 提供 session_key 加密密钥的环境变量，密钥不应写入提交到仓库的配置文件
+const SessionKeySecretEnv = "WX_SESSION_KEY_SECRET"
+
+// Config 小程序配置
+type Config struct {
+	LoginURL string // code2Session 接口地址，为空时使用 DefaultLoginURL；测试时指向 wxtest.Server
+	TokenURL string // access_token 接口地址，为空时使用 DefaultTokenURL
+	AppID    string
+	Secret   string
+
+	// SessionKeySecret 加密保存 session_key 的 AES 密钥，长度必须为 16、24 或 32 字节
+	SessionKeySecret string
+}
+
+// ConfigFromViper 读取配置文件中的 wx.loginUrl、wx.tokenUrl、wx.appId、wx.secret 与 wx.sessionKeySecret，
+// wx.sessionKeySecret 为空时从环境变量 WX_SESSION_KEY_SECRET 读取
+func ConfigFromViper() *Config {
+	sessionKeySecret := viper.GetString("wx.sessionKeySecret")
+	if sessionKeySecret == "" {
+		sessionKeySecret = os.Getenv(SessionKeySecretEnv)
+	}
+	return &Config{
+		LoginURL:         viper.GetString("wx.loginUrl"),
+		TokenURL:         viper.GetString("wx.tokenUrl"),
+		AppID:            viper.GetString("wx.appId"),
+		Secret:           viper.GetString("wx.secret"),
+		SessionKeySecret: sessionKeySecret,
+	}
+}
+
+// Session code2Session 返回的登录会话
+type Session struct {
+	OpenID     string `json:"openid"`
+	UnionID    string `json:"unionid"`
+	SessionKey string `json:"session_key"`
+}
+
+// MiniProgram 小程序登录服务，并发安全
+type MiniProgram struct {
+	config Config
+	store  UserStore
+	client *cmn.HttpClient
+}
+
+// NewMiniProgram 创建小程序登录服务，httpClient 为空时使用 5s 超时、不重试的客户端
+// （code 只能使用一次，请求已到达微信后重试会返回 code 已被使用）
+//
+//	mp, err := wx.NewMiniProgram(wx.ConfigFromViper(), wx.NewGormUserStore(db.GetPg()), nil)
+//	v1.POST("/wx/login", mp.LoginHandler())
+func NewMiniProgram(config *Config, store UserStore, httpClient *cmn.HttpClient) (*MiniProgram, error) {
+	if config == nil || config.AppID == "" || config.Secret == "" {
+		return nil, errors.New("wx: appId 与 secret 不能为空")
+	}
+	switch len(config.SessionKeySecret) {
+	case 16, 24, 32:
+	case 0:
+		return nil, fmt.Errorf("wx: sessionKeySecret 未配置，请设置环境变量 %s", SessionKeySecretEnv)
+	default:
+		return nil, fmt.Errorf("wx: sessionKeySecret 长度必须为 16、24 或 32 字节，当前为 %d", len(config.SessionKeySecret))
+	}
+	if store == nil {
+		return nil, errors.New("wx: UserStore 不能为空")
+	}
+	m := &MiniProgram{config: *config, store: store, client: httpClient}
+	if m.config.LoginURL == "" {
+		m.config.LoginURL = DefaultLoginURL
+	}
+	if m.client == nil {
+		m.client = cmn.NewHttpClient(&cmn.HttpClientConfig{Timeout: 5 * time.Second})
+	}
+	return m, nil
+}
+
+// Code2Session 用 wx.login 的 code 换取会话，微信返回的错误码转换为对应的 AppError（见 CodeWxInvalidCode 等）
+func (m *MiniProgram) Code2Session(ctx context.Context, code string) (*Session, error) {
+	if code == "" {
+		return nil, cmn.NewCodeError(CodeWxInvalidCode)
+	}
+	resp, err := m.client.Get(ctx, m.config.LoginURL, neturl.Values{
+		"appid":      {m.config.AppID},
+		"secret":     {m.config.Secret},
+		"js_code":    {code},
+		"grant_type": {"authorization_code"},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// 微信返回的 Content-Type 为 text/plain，直接按 JSON 解析
+	var result struct {
+		Session
+		APIError
+	}
+	if err := json.Unmarshal(resp.Body, &result); err != nil {
+		return nil, cmn.WrapError(CodeWxError, err).WithDetail("errcode", 0)
+	}
+	if result.ErrCode != 0 {
+		appErr := newAPIError(result.ErrCode, result.ErrMsg)
+		cmn.Logger().Log(appErr.LogLevel(), "微信登录失败", zap.Int("errcode", result.ErrCode), zap.String("errmsg", result.ErrMsg))
+		return nil, appErr
+	}
+	if result.OpenID == "" || result.SessionKey == "" {
+		return nil, cmn.NewAppError(CodeWxError, "微信未返回 openid 或 session_key").WithDetail("errcode", 0)
+	}
+	return &result.Session, nil
+}
+
+// LoginResult 登录结果，不包含 session_key
+type LoginResult struct {
+	Token   string `json:"token"`
+	UserID  uint   `json:"userId"`
+	OpenID  string `json:"openId"`
+	UnionID string `json:"unionId,omitempty"`
+	IsNew   bool   `json:"isNew"` // 是否为首次登录
+}
+
+// Login 换取会话，加密保存 session_key 并创建或更新用户，签发 token（user_id 为用户 ID，username 为 openid）
+func (m *MiniProgram) Login(ctx context.Context, code string) (*LoginResult, error) {
+	session, err := m.Code2Session(ctx, code)
+	if err != nil {
+		return nil, err
+	}
+	sessionKey, err := cmn.EncryptAES(session.SessionKey, []byte(m.config.SessionKeySecret))
+	if err != nil {
+		return nil, cmn.WrapError(CodeWxMisconfigured, err)
+	}
+
+	user := &User{OpenID: session.OpenID, UnionID: session.UnionID, SessionKey: sessionKey}
+	isNew, err := m.store.Upsert(ctx, user)
+	if err != nil {
+		return nil, cmn.WrapError(cmn.CodeInternal, err)
+	}
+	token, err := cmn.GenerateToken(strconv.FormatUint(uint64(user.ID), 10), user.OpenID)
+	if err != nil {
+		return nil, err
+	}
+	return &LoginResult{Token: token, UserID: user.ID, OpenID: user.OpenID, UnionID: user.UnionID, IsNew: isNew}, nil
+}
+
+// SessionKey 返回用户解密后的 session_key，用于解密 wx.getPhoneNumber 等开放数据
+func (m *MiniProgram) SessionKey(ctx context.Context, userID uint) (string, error) {
+	user, err := m.store.FindByID(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+	return cmn.DecryptAES(user.SessionKey, []byte(m.config.SessionKeySecret))
+}
+
+// LoginRequest 登录请求
+type LoginRequest struct {
+	Code string `json:"code" binding:"required,max=128"` // wx.login 返回的 code
+}
+
+// LoginHandler 小程序登录处理器：POST {"code": "..."}，成功返回 LoginResult
+func (m *MiniProgram) LoginHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		req, err := cmn.Bind[LoginRequest](c)
+		if err != nil {
+			cmn.Fail(c, err)
+			return
+		}
+		result, err := m.Login(c.Request.Context(), req.Code)
+		if err != nil {
+			cmn.Fail(c, err)
+			return
+		}
+		cmn.OK(c, result)
+	}
+}
@@ -0,0 +1,219 @@
+package wx
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"my_template/cmn"
+	"my_template/cmn/wx/wxtest"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+const testSessionKeySecret = "0123456789abcdef0123456789abcdef"
+
+// newTestMiniProgram 返回連接本地模擬微信服務器的登錄服務
+func newTestMiniProgram(t *testing.T) (*MiniProgram, *wxtest.Server, *MemoryUserStore) {
+	viper.Set("safe.jwtSecret", "test-secret")
+	server := wxtest.NewServer("wx-app", "wx-secret")
+	t.Cleanup(server.Close)
+
+	store := NewMemoryUserStore()
+	mp, err := NewMiniProgram(&Config{
+		LoginURL:         server.LoginURL(),
+		AppID:            "wx-app",
+		Secret:           "wx-secret",
+		SessionKeySecret: testSessionKeySecret,
+	}, store, nil)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	return mp, server, store
+}
+
+func TestMiniProgramLogin(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("首次登錄創建用戶並簽發 token，session_key 加密保存", func(t *testing.T) {
+		mp, server, store := newTestMiniProgram(t)
+		server.AddCode("c1", "o1", "u1", "sk1")
+
+		result, err := mp.Login(ctx, "c1")
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.True(t, result.IsNew)
+		assert.Equal(t, "o1", result.OpenID)
+		assert.Equal(t, "u1", result.UnionID)
+
+		claims, err := cmn.VerifyToken(result.Token)
+		if assert.NoError(t, err) {
+			assert.Equal(t, "1", claims.(jwt.MapClaims)["user_id"])
+			assert.Equal(t, "o1", claims.(jwt.MapClaims)["username"])
+		}
+
+		user, err := store.FindByID(ctx, result.UserID)
+		if assert.NoError(t, err) {
+			assert.NotEqual(t, "sk1", user.SessionKey)
+		}
+		sessionKey, err := mp.SessionKey(ctx, result.UserID)
+		assert.NoError(t, err)
+		assert.Equal(t, "sk1", sessionKey)
+	})
+
+	t.Run("再次登錄更新 session_key，沒有 unionid 時保留原值", func(t *testing.T) {
+		mp, server, _ := newTestMiniProgram(t)
+		server.AddCode("c1", "o1", "u1", "sk1")
+		server.AddCode("c2", "o1", "", "sk2")
+
+		first, err := mp.Login(ctx, "c1")
+		assert.NoError(t, err)
+		second, err := mp.Login(ctx, "c2")
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.False(t, second.IsNew)
+		assert.Equal(t, first.UserID, second.UserID)
+		assert.Equal(t, "u1", second.UnionID)
+
+		sessionKey, err := mp.SessionKey(ctx, second.UserID)
+		assert.NoError(t, err)
+		assert.Equal(t, "sk2", sessionKey)
+	})
+
+	t.Run("微信錯誤碼轉換為 AppError", func(t *testing.T) {
+		mp, server, _ := newTestMiniProgram(t)
+		server.AddCode("used", "o1", "", "sk1")
+		_, _ = mp.Login(ctx, "used")
+		server.FailCode("limited", 45011, "api minute-quota reach limit")
+		server.FailCode("risky", 40226, "invalid user")
+		server.FailCode("busy", -1, "system error")
+		server.FailCode("other", 40001, "invalid credential")
+
+		cases := []struct {
+			code      string
+			errCode   int
+			wxErrCode int
+			status    int
+		}{
+			{"unknown", CodeWxInvalidCode, 40029, http.StatusBadRequest},
+			{"used", CodeWxInvalidCode, 40163, http.StatusBadRequest},
+			{"limited", CodeWxRateLimited, 45011, http.StatusTooManyRequests},
+			{"risky", CodeWxUserBlocked, 40226, http.StatusForbidden},
+			{"busy", CodeWxBusy, -1, http.StatusServiceUnavailable},
+			{"other", CodeWxError, 40001, http.StatusBadGateway},
+		}
+		for _, tc := range cases {
+			_, err := mp.Login(ctx, tc.code)
+			assert.Equal(t, tc.errCode, cmn.ErrorCodeOf(err), tc.code)
+			var appErr *cmn.AppError
+			if assert.True(t, errors.As(err, &appErr), tc.code) {
+				assert.Equal(t, tc.status, appErr.HTTPStatus(), tc.code)
+			}
+			var apiErr *APIError
+			if assert.True(t, errors.As(err, &apiErr), tc.code) {
+				assert.Equal(t, tc.wxErrCode, apiErr.ErrCode, tc.code)
+			}
+		}
+		assert.True(t, cmn.IsRetryable(newAPIError(45011, "")))
+		assert.False(t, cmn.IsRetryable(newAPIError(40029, "")))
+	})
+
+	t.Run("appid 或 secret 錯誤時為配置錯誤", func(t *testing.T) {
+		mp, server, _ := newTestMiniProgram(t)
+		server.AddCode("c1", "o1", "", "sk1")
+		mp.config.Secret = "wrong"
+
+		_, err := mp.Login(ctx, "c1")
+		assert.Equal(t, CodeWxMisconfigured, cmn.ErrorCodeOf(err))
+	})
+
+	t.Run("配置校驗", func(t *testing.T) {
+		store := NewMemoryUserStore()
+		_, err := NewMiniProgram(&Config{AppID: "a", Secret: "s", SessionKeySecret: "short"}, store, nil)
+		assert.Error(t, err)
+		_, err = NewMiniProgram(&Config{AppID: "a", Secret: "s"}, store, nil)
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), SessionKeySecretEnv)
+		}
+		_, err = NewMiniProgram(&Config{AppID: "a", SessionKeySecret: testSessionKeySecret}, store, nil)
+		assert.Error(t, err)
+		_, err = NewMiniProgram(&Config{AppID: "a", Secret: "s", SessionKeySecret: testSessionKeySecret}, nil, nil)
+		assert.Error(t, err)
+	})
+}
+
+func TestConfigFromViper(t *testing.T) {
+	viper.Set("wx.appId", "wx-app")
+	viper.Set("wx.sessionKeySecret", "")
+	t.Cleanup(func() {
+		viper.Set("wx.appId", nil)
+		viper.Set("wx.sessionKeySecret", nil)
+	})
+
+	t.Run("密鑰為空時從環境變量讀取", func(t *testing.T) {
+		t.Setenv(SessionKeySecretEnv, testSessionKeySecret)
+		config := ConfigFromViper()
+		assert.Equal(t, "wx-app", config.AppID)
+		assert.Equal(t, testSessionKeySecret, config.SessionKeySecret)
+	})
+
+	t.Run("配置文件中的密鑰優先", func(t *testing.T) {
+		t.Setenv(SessionKeySecretEnv, testSessionKeySecret)
+		viper.Set("wx.sessionKeySecret", "fedcba9876543210")
+		assert.Equal(t, "fedcba9876543210", ConfigFromViper().SessionKeySecret)
+	})
+}
+
+func TestLoginHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mp, server, _ := newTestMiniProgram(t)
+	server.AddCode("c1", "o1", "u1", "sk1")
+	router := gin.New()
+	router.POST("/wx/login", mp.LoginHandler())
+
+	post := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/wx/login", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("登錄成功返回 token，不返回 session_key", func(t *testing.T) {
+		w := post(`{"code":"c1"}`)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.NotContains(t, w.Body.String(), "sk1")
+
+		var reply cmn.Reply[LoginResult]
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &reply))
+		assert.Equal(t, cmn.Success, reply.Status)
+		assert.NotEmpty(t, reply.Data.Token)
+		assert.Equal(t, "o1", reply.Data.OpenID)
+		assert.True(t, reply.Data.IsNew)
+	})
+
+	t.Run("code 已使用返回 400", func(t *testing.T) {
+		w := post(`{"code":"c1"}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+
+		var reply cmn.Reply[map[string]interface{}]
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &reply))
+		assert.Equal(t, CodeWxInvalidCode, reply.Status)
+		assert.Equal(t, float64(40163), reply.Data["errcode"])
+	})
+
+	t.Run("缺少 code 返回校驗錯誤", func(t *testing.T) {
+		w := post(`{}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), `"status":1003`)
+	})
+}
@@ -0,0 +1,154 @@
+package wx
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"my_template/cmn"
+
+	"gorm.io/gorm"
+)
+
+// User 小程序用户，按 openid 唯一
+type User struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	OpenID     string    `json:"openId" gorm:"column:open_id;size:64;uniqueIndex"`
+	UnionID    string    `json:"unionId,omitempty" gorm:"column:union_id;size:64;index"`
+	SessionKey string    `json:"-" gorm:"column:session_key;size:256"` // EncryptAES 加密后的 session_key，不返回给客户端
+	CreatedAt  time.Time `json:"createdAt"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+}
+
+// TableName 表名
+func (User) TableName() string {
+	return "wx_users"
+}
+
+// UserStore 小程序用户的存储接口
+type UserStore interface {
+	// Upsert 按 openid 创建或更新用户（unionid 为空时保留原值），回填 ID 与时间，返回是否为新用户
+	Upsert(ctx context.Context, user *User) (bool, error)
+	// FindByID 按 ID 查找用户，不存在时返回 ErrUserNotFound
+	FindByID(ctx context.Context, id uint) (*User, error)
+}
+
+// ErrUserNotFound 用户不存在
+var ErrUserNotFound = errors.New("wx user not found")
+
+// GormUserStore 基于 GORM 的用户存储
+type GormUserStore struct {
+	db *gorm.DB
+}
+
+// NewGormUserStore 创建 GORM 用户存储，处于 cmn.BatchHandler 的批量事务中时使用该事务
+func NewGormUserStore(db *gorm.DB) *GormUserStore {
+	return &GormUserStore{db: db}
+}
+
+// AutoMigrate 创建或更新 wx_users 表
+func (s *GormUserStore) AutoMigrate() error {
+	return s.db.AutoMigrate(&User{})
+}
+
+// Upsert 按 openid 创建或更新用户
+func (s *GormUserStore) Upsert(ctx context.Context, user *User) (bool, error) {
+	db := cmn.ContextDB(ctx, s.db)
+	found, err := s.update(db, user)
+	if err != nil || found {
+		return false, err
+	}
+	if err := db.Create(user).Error; err != nil {
+		// 并发首次登录时唯一索引冲突，用户已由另一个请求创建，改为更新
+		user.ID = 0
+		if found, retryErr := s.update(db, user); retryErr == nil && found {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// update 更新已存在的用户并回填，用户不存在时返回 false
+func (s *GormUserStore) update(db *gorm.DB, user *User) (bool, error) {
+	var existing User
+	err := db.Where("open_id = ?", user.OpenID).Take(&existing).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	updates := map[string]interface{}{"session_key": user.SessionKey, "updated_at": time.Now()}
+	if user.UnionID != "" {
+		updates["union_id"] = user.UnionID
+	}
+	if err := db.Model(&existing).Updates(updates).Error; err != nil {
+		return false, err
+	}
+	*user = existing
+	return true, nil
+}
+
+// FindByID 按 ID 查找用户
+func (s *GormUserStore) FindByID(ctx context.Context, id uint) (*User, error) {
+	var user User
+	err := cmn.ContextDB(ctx, s.db).Take(&user, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// MemoryUserStore 基于内存的用户存储，仅适用于单实例或测试
+type MemoryUserStore struct {
+	mu     sync.Mutex
+	nextID uint
+	users  map[string]*User // openid -> 用户
+}
+
+// NewMemoryUserStore 创建内存用户存储
+func NewMemoryUserStore() *MemoryUserStore {
+	return &MemoryUserStore{users: make(map[string]*User)}
+}
+
+// Upsert 按 openid 创建或更新用户
+func (s *MemoryUserStore) Upsert(_ context.Context, user *User) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if existing, ok := s.users[user.OpenID]; ok {
+		existing.SessionKey = user.SessionKey
+		if user.UnionID != "" {
+			existing.UnionID = user.UnionID
+		}
+		existing.UpdatedAt = now
+		*user = *existing
+		return false, nil
+	}
+	s.nextID++
+	stored := *user
+	stored.ID, stored.CreatedAt, stored.UpdatedAt = s.nextID, now, now
+	s.users[user.OpenID] = &stored
+	*user = stored
+	return true, nil
+}
+
+// FindByID 按 ID 查找用户
+func (s *MemoryUserStore) FindByID(_ context.Context, id uint) (*User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, user := range s.users {
+		if user.ID == id {
+			u := *user
+			return &u, nil
+		}
+	}
+	return nil, ErrUserNotFound
+}
@@ -0,0 +1,263 @@
+// Package wxtest 本地模拟的微信接口（code2Session、access_token 与需要 access_token 的业务接口），用于测试而不访问微信
+//
+//	server := wxtest.NewServer("wx-app", "wx-secret")
+//	defer server.Close()
+//	server.AddCode("code-1", "openid-1", "unionid-1", "session-key-1")
+//	mp, _ := wx.NewMiniProgram(&wx.Config{LoginURL: server.LoginURL(), AppID: "wx-app", Secret: "wx-secret", SessionKeySecret: key}, store, nil)
+package wxtest
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+)
+
+const (
+	// LoginPath code2Session 接口路径
+	LoginPath = "/sns/jscode2session"
+	// TokenPath 获取 access_token 接口路径
+	TokenPath = "/cgi-bin/token"
+	// APIPath 模拟的业务接口路径前缀，校验 access_token 后返回 {"errcode":0,"errmsg":"ok"}
+	APIPath = "/wxa/"
+)
+
+// Server 模拟微信接口：code2Session 校验 appid、secret 与 grant_type，每个 code 只能使用一次；
+// access_token 在过期或调用 ExpireTokens 之前有效
+type Server struct {
+	*httptest.Server
+	appID  string
+	secret string
+
+	mu            sync.Mutex
+	sessions      map[string]session
+	failures      map[string]failure
+	used          map[string]bool
+	requests      int
+	tokens        map[string]time.Time
+	tokenRequests int
+	tokenExpiry   time.Duration
+	tokenDelay    time.Duration
+}
+
+type session struct {
+	OpenID     string `json:"openid"`
+	UnionID    string `json:"unionid,omitempty"`
+	SessionKey string `json:"session_key"`
+}
+
+type failure struct {
+	ErrCode int    `json:"errcode"`
+	ErrMsg  string `json:"errmsg"`
+}
+
+// NewServer 启动模拟服务器，使用完毕后调用 Close
+func NewServer(appID, secret string) *Server {
+	s := &Server{
+		appID:    appID,
+		secret:   secret,
+		sessions: make(map[string]session),
+		failures: make(map[string]failure),
+		used:     make(map[string]bool),
+		tokens:   make(map[string]time.Time),
+
+		tokenExpiry: 2 * time.Hour,
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc(LoginPath, s.code2Session)
+	mux.HandleFunc(TokenPath, s.token)
+	mux.HandleFunc(APIPath, s.api)
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+// LoginURL 返回 code2Session 接口地址，作为 wx.Config.LoginURL
+func (s *Server) LoginURL() string {
+	return s.URL + LoginPath
+}
+
+// AddCode 添加一个有效的 code，unionID 可为空
+func (s *Server) AddCode(code, openID, unionID, sessionKey string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sessions[code] = session{OpenID: openID, UnionID: unionID, SessionKey: sessionKey}
+}
+
+// FailCode 使用该 code 时返回指定的微信错误码，如 45011（频率限制）、40226（高风险用户）、-1（系统繁忙）
+func (s *Server) FailCode(code string, errcode int, errmsg string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures[code] = failure{ErrCode: errcode, ErrMsg: errmsg}
+}
+
+// TokenURL 返回 access_token 接口地址，作为 wx.Config.TokenURL
+func (s *Server) TokenURL() string {
+	return s.URL + TokenPath
+}
+
+// APIURL 返回模拟业务接口地址
+func (s *Server) APIURL(name string) string {
+	return s.URL + APIPath + name
+}
+
+// Requests 返回 code2Session 收到的请求数
+func (s *Server) Requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+// TokenRequests 返回 access_token 接口收到的请求数
+func (s *Server) TokenRequests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.tokenRequests
+}
+
+// SetTokenExpiry 设置新签发 access_token 的有效期（expires_in），默认 2 小时
+func (s *Server) SetTokenExpiry(expiry time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokenExpiry = expiry
+}
+
+// SetTokenDelay 设置 access_token 接口的响应延迟，用于测试并发刷新
+func (s *Server) SetTokenDelay(delay time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokenDelay = delay
+}
+
+// ExpireTokens 使已签发的 access_token 全部失效，之后业务接口返回 42001
+func (s *Server) ExpireTokens() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for token := range s.tokens {
+		s.tokens[token] = time.Time{}
+	}
+}
+
+// EncryptData 按微信开放数据格式加密 payload（AES-128-CBC，PKCS#7 填充），
+// 自动加入 appid 水印，返回 base64 编码的 encryptedData 与 iv
+func EncryptData(sessionKey, appID string, payload map[string]interface{}) (encryptedData, iv string) {
+	key, err := base64.StdEncoding.DecodeString(sessionKey)
+	if err != nil {
+		panic(err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		panic(err)
+	}
+
+	data := make(map[string]interface{}, len(payload)+1)
+	for k, v := range payload {
+		data[k] = v
+	}
+	data["watermark"] = map[string]interface{}{"appid": appID, "timestamp": time.Now().Unix()}
+	plainText, err := json.Marshal(data)
+	if err != nil {
+		panic(err)
+	}
+	padding := aes.BlockSize - len(plainText)%aes.BlockSize
+	plainText = append(plainText, bytes.Repeat([]byte{byte(padding)}, padding)...)
+
+	ivBytes := make([]byte, aes.BlockSize)
+	_, _ = rand.Read(ivBytes)
+	cipherText := make([]byte, len(plainText))
+	cipher.NewCBCEncrypter(block, ivBytes).CryptBlocks(cipherText, plainText)
+	return base64.StdEncoding.EncodeToString(cipherText), base64.StdEncoding.EncodeToString(ivBytes)
+}
+
+func (s *Server) code2Session(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests++
+
+	query := r.URL.Query()
+	code := query.Get("js_code")
+	var result interface{}
+	switch {
+	case query.Get("appid") == "":
+		result = failure{41002, "appid missing"}
+	case query.Get("appid") != s.appID:
+		result = failure{40013, "invalid appid"}
+	case query.Get("secret") == "":
+		result = failure{41004, "appsecret missing"}
+	case query.Get("secret") != s.secret:
+		result = failure{40125, "invalid appsecret"}
+	case code == "":
+		result = failure{41008, "missing code"}
+	case query.Get("grant_type") != "authorization_code":
+		result = failure{40002, "invalid grant_type"}
+	case s.used[code]:
+		result = failure{40163, "code been used"}
+	default:
+		if f, ok := s.failures[code]; ok {
+			result = f
+		} else if sess, ok := s.sessions[code]; ok {
+			s.used[code] = true
+			result = sess
+		} else {
+			result = failure{40029, "invalid code"}
+		}
+	}
+	writeResult(w, result)
+}
+
+func (s *Server) token(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.tokenRequests++
+	delay := s.tokenDelay
+	s.mu.Unlock()
+	time.Sleep(delay)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	query := r.URL.Query()
+	var result interface{}
+	switch {
+	case query.Get("grant_type") != "client_credential":
+		result = failure{40002, "invalid grant_type"}
+	case query.Get("appid") != s.appID:
+		result = failure{40013, "invalid appid"}
+	case query.Get("secret") != s.secret:
+		result = failure{40125, "invalid appsecret"}
+	default:
+		token := fmt.Sprintf("token-%d", s.tokenRequests)
+		s.tokens[token] = time.Now().Add(s.tokenExpiry)
+		result = map[string]interface{}{"access_token": token, "expires_in": int(s.tokenExpiry / time.Second)}
+	}
+	writeResult(w, result)
+}
+
+func (s *Server) api(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token := r.URL.Query().Get("access_token")
+	expiresAt, ok := s.tokens[token]
+	switch {
+	case token == "":
+		writeResult(w, failure{41001, "access_token missing"})
+	case !ok:
+		writeResult(w, failure{40001, "invalid credential, access_token is invalid or not latest"})
+	case time.Now().After(expiresAt):
+		writeResult(w, failure{42001, "access_token expired"})
+	default:
+		writeResult(w, failure{0, "ok"})
+	}
+}
+
+// writeResult 与微信一致，错误时同样返回 HTTP 200，Content-Type 为 text/plain
+func writeResult(w http.ResponseWriter, result interface{}) {
+	w.Header().Set("Content-Type", "text/plain")
+	_ = json.NewEncoder(w).Encode(result)
+}
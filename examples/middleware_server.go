@@ -1,13 +1,27 @@
 package main
 
 import (
+	"fmt"
 	"my_template/cmn"
+	"my_template/cmn/db"
+	"my_template/cmn/llm"
+	"my_template/cmn/wx"
 	"net/http"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
 )
 
+// loginGuard 登錄防爆破組件，在 main 中初始化
+var loginGuard *cmn.LoginGuard
+
+// miniProgram 微信小程序登錄，在 main 中初始化
+var miniProgram *wx.MiniProgram
+
+// chatClient 大模型對話客戶端，在 main 中初始化；未配置服務商時為空
+var chatClient *llm.Client
+
 // 這是一個完整的使用示例，展示如何使用中間件注冊模組
 // 運行方式: go run examples/middleware_server.go
 
@@ -32,59 +46,119 @@ func main() {
 	// 方式1: 使用默認中間件（Recovery + Logger + CORS）
 	// registry.ApplyDefault()
 
-	// 方式2: 手動註冊中間件（推薦，可以自定義順序和配置）
-	registry.RegisterMultiple(
-		cmn.RecoveryMiddleware(),              // 捕獲 panic
-		cmn.LoggerMiddleware(),                // 記錄請求日誌
-		cmn.CORSMiddleware(),                  // 處理跨域
-		cmn.RateLimitByIP(100, 200),           // IP 限流（每秒100個請求）
-		cmn.TimeoutMiddleware(30*time.Second), // 30秒超時
-	)
+	// 方式2: 手動註冊命名中間件（推薦，執行順序由優先級決定，並在應用時校驗依賴）
+	// WithPolicy 聲明限流、超時策略，供路由清單顯示
+	rateLimitConfig := &cmn.RateLimitConfig{Rate: 100, Capacity: 200}
+	timeoutConfig := cmn.DefaultTimeoutConfig()
+	timeoutConfig.Routes = map[string]time.Duration{"POST /api/v1/chat": 0} // 流式輸出的路由不經過超時緩衝
+	registry.
+		RegisterNamed("recovery", cmn.RecoveryMiddleware(), cmn.WithPriority(cmn.PriorityRecovery)).                                                                                                      // 捕獲 panic
+		RegisterNamed("requestId", cmn.RequestIDMiddleware(), cmn.WithPriority(cmn.PriorityRequestID)).                                                                                                   // 請求 ID
+		RegisterNamed("logger", cmn.LoggerMiddleware(), cmn.WithPriority(cmn.PriorityLogger)).                                                                                                            // 記錄請求日誌
+		RegisterNamed("cors", cmn.CORSMiddleware(), cmn.WithPriority(cmn.PriorityCORS)).                                                                                                                  // 處理跨域
+		RegisterNamed("rateLimit", cmn.RateLimitByIP(100, 200), cmn.WithPriority(cmn.PriorityRateLimit), cmn.WithPolicy(cmn.RateLimitRoutePolicy(rateLimitConfig))).                                      // IP 限流（每秒100個請求）
+		RegisterNamed("bodyLimit", cmn.BodyLimitMiddleware(1<<20), cmn.WithPriority(cmn.PriorityBodyLimit)).                                                                                              // 請求體上限 1MB
+		RegisterNamed("timeout", cmn.TimeoutMiddlewareWithConfig(timeoutConfig), cmn.WithPriority(cmn.PriorityTimeout), cmn.WithAfter("recovery"), cmn.WithPolicy(cmn.TimeoutRoutePolicy(timeoutConfig))) // 30秒超時
+
+	// 6. 應用中間件（順序或依賴有誤時直接退出）
+	if err := registry.Apply(); err != nil {
+		panic("應用中間件失敗: " + err.Error())
+	}
+	fmt.Print(registry.Dump())
+
+	// 6.1 初始化登錄防爆破（優先使用 Redis，未配置時退化為內存存儲）
+	var store cmn.LoginAttemptStore
+	if err := db.InitRedis(); err != nil {
+		cmn.Logger().Warn("Redis 不可用，登錄防爆破使用內存存儲", zap.Error(err))
+		store = cmn.NewMemoryLoginAttemptStore()
+	} else {
+		store = cmn.NewRedisLoginAttemptStore(db.GetRedis())
+	}
+	loginGuard = cmn.NewLoginGuard(store, cmn.DefaultLoginGuardConfig())
+
+	// 6.2 初始化微信小程序登錄（用戶保存到 PostgreSQL，未配置時退化為內存存儲）
+	var userStore wx.UserStore
+	if err := db.InitPostgreSQL(); err != nil {
+		cmn.Logger().Warn("PostgreSQL 不可用，微信用戶使用內存存儲", zap.Error(err))
+		userStore = wx.NewMemoryUserStore()
+	} else {
+		pgStore := wx.NewGormUserStore(db.GetPg())
+		if err := pgStore.AutoMigrate(); err != nil {
+			panic("創建 wx_users 表失敗: " + err.Error())
+		}
+		userStore = pgStore
+	}
+	mp, err := wx.NewMiniProgram(wx.ConfigFromViper(), userStore, nil)
+	if err != nil {
+		panic("初始化微信小程序登錄失敗: " + err.Error())
+	}
+	miniProgram = mp
 
-	// 6. 應用中間件
-	registry.Apply()
+	// 6.3 初始化大模型對話（按 aliyun、zijie 的順序回退，均未配置時不註冊 /chat）
+	if client, err := llm.NewClient(llm.ConfigFromViper(), nil); err != nil {
+		cmn.Logger().Warn("未配置大模型服務商", zap.Error(err))
+	} else {
+		chatClient = client
+	}
 
 	// 7. 設置路由
-	setupRoutes(router)
+	setupRoutes(router, registry)
 
 	// 8. 啟動服務器
 	router.Run(":8080")
 }
 
-func setupRoutes(router *gin.Engine) {
+func setupRoutes(router *gin.Engine, registry *cmn.MiddlewareRegistry) {
+	// 通過 RouteGroup 註冊的路由才會在路由清單中顯示中間件鏈
+	routes := cmn.RecordRoutes(router)
+
+	// 認證中間件通過注冊器應用到路由組，路由清單才能顯示哪些路由需要認證
+	authRegistry := cmn.NewMiddlewareRegistry(router)
+	authRegistry.RegisterNamed("auth", cmn.AuthMiddleware(), cmn.WithPolicy(cmn.AuthRoutePolicy(nil)))
+
 	// 健康檢查
-	router.GET("/health", func(c *gin.Context) {
+	routes.GET("/health", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{
 			"status": "ok",
 			"time":   time.Now().Format(time.RFC3339),
 		})
 	})
 
-	router.GET("/ping", func(c *gin.Context) {
+	// 上游熔斷狀態（有熔斷時 status 為 degraded）
+	routes.GET("/health/upstreams", cmn.CircuitHealthHandler())
+
+	routes.GET("/ping", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{"message": "pong"})
 	})
 
 	// API v1 路由組
-	v1 := router.Group("/api/v1")
+	v1 := routes.Group("/api/v1")
 	{
-		// 公開路由
-		v1.POST("/login", loginHandler)
-		v1.POST("/register", registerHandler)
-
-		// 測試路由
-		v1.GET("/test-panic", testPanicHandler)
-		v1.GET("/test-slow", testSlowHandler)
-
-		// 需要認證的路由組
+		// 需要認證的路由組（路由清單按路由組歸屬，同一前綴下的其他路由組不受影響）
 		auth := v1.Group("")
-		auth.Use(cmn.AuthMiddleware())
+		if err := authRegistry.ApplyTo(auth.RouterGroup); err != nil {
+			panic("應用認證中間件失敗: " + err.Error())
+		}
 		{
 			auth.GET("/profile", profileHandler)
 			auth.PUT("/profile", updateProfileHandler)
 			auth.GET("/posts", listPostsHandler)
 			auth.POST("/posts", createPostHandler)
+			auth.POST("/batch", cmn.BatchHandler(router, cmn.DefaultBatchConfig())) // 批量請求，子請求同樣經過認證
+			if chatClient != nil {
+				auth.POST("/chat", chatHandler) // 大模型對話，{"stream": true} 時以 SSE 輸出
+			}
 		}
 
+		// 公開路由
+		v1.POST("/login", loginGuard.Middleware(), loginHandler)
+		v1.POST("/register", registerHandler)
+		v1.POST("/wx/login", miniProgram.LoginHandler()) // 微信小程序登錄，請求體 {"code": "..."}
+
+		// 測試路由
+		v1.GET("/test-panic", testPanicHandler)
+		v1.GET("/test-slow", testSlowHandler)
+
 		// 可選認證的路由組
 		optional := v1.Group("")
 		optional.Use(cmn.OptionalAuthMiddleware())
@@ -92,6 +166,14 @@ func setupRoutes(router *gin.Engine) {
 			optional.GET("/posts/public", publicPostsHandler)
 		}
 	}
+
+	// 管理接口（查詢與解除登錄鎖定、路由清單）
+	admin := routes.Group("/admin")
+	if err := authRegistry.ApplyTo(admin.RouterGroup); err != nil {
+		panic("應用認證中間件失敗: " + err.Error())
+	}
+	loginGuard.RegisterAdminRoutes(admin)
+	admin.GET("/routes", cmn.RoutesHandler(routes, registry, authRegistry)) // ?format=table 輸出表格，?auth=false 只看未認證的路由
 }
 
 // ============ 處理器函數 ============
@@ -112,8 +194,23 @@ func loginHandler(c *gin.Context) {
 		return
 	}
 
-	// 這裡應該驗證用戶名和密碼
-	// 為了演示，我們假設驗證成功
+	// 這裡應該查詢數據庫驗證用戶名和密碼
+	// 為了演示，密碼長度不少於 6 位即視為驗證成功
+	if len(req.Password) < 6 {
+		// 記錄失敗，達到閾值後該用戶名/IP 將被臨時鎖定
+		if _, err := loginGuard.RecordFailure(c, req.Username); err != nil {
+			cmn.Logger().Error("記錄登錄失敗次數出錯", zap.Error(err))
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"code":    http.StatusUnauthorized,
+			"message": "用戶名或密碼錯誤",
+		})
+		return
+	}
+	if err := loginGuard.RecordSuccess(c, req.Username); err != nil {
+		cmn.Logger().Error("清除登錄失敗記錄出錯", zap.Error(err))
+	}
+
 	token, err := cmn.GenerateToken("user_"+req.Username, req.Username)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -139,15 +236,13 @@ func registerHandler(c *gin.Context) {
 		Username string `json:"username" binding:"required"`
 		Password string `json:"password" binding:"required,min=6"`
 		Email    string `json:"email" binding:"required,email"`
+		Phone    string `json:"phone" binding:"omitempty,phone"`
 	}
 
-	var req RegisterRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"code":    http.StatusBadRequest,
-			"message": "請求參數錯誤",
-			"error":   err.Error(),
-		})
+	// 校驗失敗時返回 400，data.fields 為按 Accept-Language 翻譯的逐字段錯誤
+	req, err := cmn.Bind[RegisterRequest](c)
+	if err != nil {
+		cmn.Fail(c, err)
 		return
 	}
 
@@ -289,3 +384,45 @@ func testSlowHandler(c *gin.Context) {
 		"delay":   "500ms",
 	})
 }
+
+// chatHandler 大模型對話，stream 為 true 時以 SSE 逐段輸出
+func chatHandler(c *gin.Context) {
+	type ChatRequest struct {
+		Message string `json:"message" binding:"required,max=4000"`
+		Stream  bool   `json:"stream"`
+	}
+	req, err := cmn.Bind[ChatRequest](c)
+	if err != nil {
+		cmn.Fail(c, err)
+		return
+	}
+	chatReq := &llm.ChatRequest{Messages: []llm.Message{llm.UserMessage(req.Message)}}
+
+	if !req.Stream {
+		resp, err := chatClient.Chat(c.Request.Context(), chatReq)
+		if err != nil {
+			cmn.Fail(c, err)
+			return
+		}
+		cmn.OK(c, resp)
+		return
+	}
+
+	started := false
+	for chunk, err := range chatClient.ChatStream(c.Request.Context(), chatReq) {
+		if err != nil {
+			if !started {
+				cmn.Fail(c, err) // 還沒有輸出時返回普通的錯誤響應
+			} else {
+				c.SSEvent("error", gin.H{"status": cmn.ErrorCodeOf(err)})
+			}
+			return
+		}
+		if chunk.Content != "" {
+			started = true
+			c.SSEvent("message", chunk.Content)
+			c.Writer.Flush()
+		}
+	}
+	c.SSEvent("done", "[DONE]")
+}
@@ -3,7 +3,7 @@ Copyright © 2025 NAME HERE <EMAIL ADDRESS>
 */
 package main
 
-import "template/cmd"
+import "my_template/cmd"
 
 func main() {
 	cmd.Execute()